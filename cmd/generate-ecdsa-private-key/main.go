@@ -6,10 +6,20 @@ import (
 	"crypto/rand"
 	"crypto/x509"
 	"encoding/hex"
+	"encoding/pem"
+	"flag"
 	"fmt"
+	"os"
 )
 
+// Prints the hex DER private key (for ECDSA_KEY) on the first line, followed
+// by what has to be registered with Apple and Google: the key ID and version
+// and the PEM public key.
 func main() {
+	id := flag.String("id", "302", "verification key ID")
+	version := flag.String("version", "v1", "verification key version")
+	flag.Parse()
+
 	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		panic(err)
@@ -18,5 +28,16 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	publicData, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+
 	fmt.Println(hex.EncodeToString(data))
+	fmt.Println()
+	fmt.Printf("verification key id: %s\n", *id)
+	fmt.Printf("verification key version: %s\n", *version)
+	if err := pem.Encode(os.Stdout, &pem.Block{Type: "PUBLIC KEY", Bytes: publicData}); err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
+)
+
+const usage = `usage: verify-export -pubkey <public-key.pem> [-qr] <export.zip>...
+
+Checks exports downloaded from /retrieve (or /qr with -qr): the export header,
+export.sig against the given public key, and every key in the export.
+Exits non-zero if any export has problems.
+`
+
+func main() {
+	pubKeyPath := flag.String("pubkey", "", "PEM encoded ECDSA public key the exports were signed with")
+	qr := flag.Bool("qr", false, "verify outbreak event exports from /qr")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *pubKeyPath == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	pemData, err := ioutil.ReadFile(*pubKeyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	publicKey, err := retrieval.ParsePublicKey(pemData)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *pubKeyPath, err)
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		if !verify(path, publicKey, *qr) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func verify(path string, publicKey *ecdsa.PublicKey, qr bool) bool {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Printf("%s: %v\n", path, err)
+		return false
+	}
+
+	var report *retrieval.ExportReport
+	if qr {
+		report, err = retrieval.VerifyOutbreakExport(data, publicKey)
+	} else {
+		report, err = retrieval.VerifyExport(data, publicKey)
+	}
+	if err != nil {
+		fmt.Printf("%s: %v\n", path, err)
+		return false
+	}
+
+	fmt.Printf("%s:\n", path)
+	fmt.Printf("  window:      %s to %s\n", report.StartTimestamp.Format(time.RFC3339), report.EndTimestamp.Format(time.RFC3339))
+	if qr {
+		fmt.Printf("  format:      v%d\n", report.FormatVersion)
+		if report.FormatVersion > 1 {
+			fmt.Printf("  batch:       %d of %d\n", report.BatchNum, report.BatchSize)
+		}
+		fmt.Printf("  locations:   %d\n", report.Locations)
+	} else {
+		fmt.Printf("  region:      %s\n", report.Region)
+		fmt.Printf("  batch:       %d of %d\n", report.BatchNum, report.BatchSize)
+		fmt.Printf("  keys:        %d\n", report.Keys)
+		fmt.Printf("  revised:     %d\n", report.RevisedKeys)
+	}
+	for _, sig := range report.Signatures {
+		status := "invalid"
+		if sig.Valid {
+			status = "valid"
+		}
+		if qr && report.FormatVersion == 1 {
+			fmt.Printf("  signature:   %s\n", status)
+		} else {
+			fmt.Printf("  signature:   %s/%s %s %s\n", sig.Version, sig.ID, sig.Algorithm, status)
+		}
+	}
+
+	if report.OK() {
+		fmt.Println("  OK")
+		return true
+	}
+	fmt.Printf("  %d problem(s):\n", len(report.Problems))
+	for _, problem := range report.Problems {
+		fmt.Printf("    %s\n", problem)
+	}
+	return false
+}
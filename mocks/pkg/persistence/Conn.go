@@ -286,6 +286,48 @@ func (_m *Conn) DeleteOldFailedClaimKeyAttempts() (int64, error) {
 	return r0, r1
 }
 
+// DeleteOldOneTimeCodeUsage provides a mock function with given fields:
+func (_m *Conn) DeleteOldOneTimeCodeUsage() (int64, error) {
+	ret := _m.Called()
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func() int64); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteOldVerificationCertificates provides a mock function with given fields:
+func (_m *Conn) DeleteOldVerificationCertificates() (int64, error) {
+	ret := _m.Called()
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func() int64); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeleteUnclaimedKeys provides a mock function with given fields: _a0
 func (_m *Conn) DeleteUnclaimedKeys(_a0 context.Context) (int64, error) {
 	ret := _m.Called(_a0)
@@ -307,16 +349,88 @@ func (_m *Conn) DeleteUnclaimedKeys(_a0 context.Context) (int64, error) {
 	return r0, r1
 }
 
+// FederationCursor provides a mock function with given fields: peer
+func (_m *Conn) FederationCursor(peer string) (string, error) {
+	ret := _m.Called(peer)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(peer)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(peer)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FederationSyncFailure provides a mock function with given fields: peer, err
+func (_m *Conn) FederationSyncFailure(peer string, err error) error {
+	ret := _m.Called(peer, err)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, error) error); ok {
+		r0 = rf(peer, err)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FederationSyncSuccess provides a mock function with given fields: peer, cursor
+func (_m *Conn) FederationSyncSuccess(peer string, cursor string) error {
+	ret := _m.Called(peer, cursor)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(peer, cursor)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FetchFederationKeys provides a mock function with given fields: region, cursor, endHour, currentRSIN, limit
+func (_m *Conn) FetchFederationKeys(region string, cursor string, endHour uint32, currentRSIN int32, limit int) (*persistence.FederationPage, error) {
+	ret := _m.Called(region, cursor, endHour, currentRSIN, limit)
+
+	var r0 *persistence.FederationPage
+	if rf, ok := ret.Get(0).(func(string, string, uint32, int32, int) *persistence.FederationPage); ok {
+		r0 = rf(region, cursor, endHour, currentRSIN, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*persistence.FederationPage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, uint32, int32, int) error); ok {
+		r1 = rf(region, cursor, endHour, currentRSIN, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // FetchKeysForHours provides a mock function with given fields: _a0, _a1, _a2, _a3
-func (_m *Conn) FetchKeysForHours(_a0 string, _a1 uint32, _a2 uint32, _a3 int32) ([]*covidshield.TemporaryExposureKey, error) {
+func (_m *Conn) FetchKeysForHours(_a0 string, _a1 uint32, _a2 uint32, _a3 int32) (map[uint32][]*covidshield.TemporaryExposureKey, error) {
 	ret := _m.Called(_a0, _a1, _a2, _a3)
 
-	var r0 []*covidshield.TemporaryExposureKey
-	if rf, ok := ret.Get(0).(func(string, uint32, uint32, int32) []*covidshield.TemporaryExposureKey); ok {
+	var r0 map[uint32][]*covidshield.TemporaryExposureKey
+	if rf, ok := ret.Get(0).(func(string, uint32, uint32, int32) map[uint32][]*covidshield.TemporaryExposureKey); ok {
 		r0 = rf(_a0, _a1, _a2, _a3)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*covidshield.TemporaryExposureKey)
+			r0 = ret.Get(0).(map[uint32][]*covidshield.TemporaryExposureKey)
 		}
 	}
 
@@ -330,13 +444,13 @@ func (_m *Conn) FetchKeysForHours(_a0 string, _a1 uint32, _a2 uint32, _a3 int32)
 	return r0, r1
 }
 
-// FetchOutbreakForTimeRange provides a mock function with given fields: _a0, _a1
-func (_m *Conn) FetchOutbreakForTimeRange(_a0 time.Time, _a1 time.Time) ([]*covidshield.OutbreakEvent, error) {
-	ret := _m.Called(_a0, _a1)
+// FetchOutbreakForTimeRange provides a mock function with given fields: _a0, _a1, _a2
+func (_m *Conn) FetchOutbreakForTimeRange(_a0 string, _a1 time.Time, _a2 time.Time) ([]*covidshield.OutbreakEvent, error) {
+	ret := _m.Called(_a0, _a1, _a2)
 
 	var r0 []*covidshield.OutbreakEvent
-	if rf, ok := ret.Get(0).(func(time.Time, time.Time) []*covidshield.OutbreakEvent); ok {
-		r0 = rf(_a0, _a1)
+	if rf, ok := ret.Get(0).(func(string, time.Time, time.Time) []*covidshield.OutbreakEvent); ok {
+		r0 = rf(_a0, _a1, _a2)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*covidshield.OutbreakEvent)
@@ -344,8 +458,31 @@ func (_m *Conn) FetchOutbreakForTimeRange(_a0 time.Time, _a1 time.Time) ([]*covi
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(time.Time, time.Time) error); ok {
-		r1 = rf(_a0, _a1)
+	if rf, ok := ret.Get(1).(func(string, time.Time, time.Time) error); ok {
+		r1 = rf(_a0, _a1, _a2)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FetchRevisedKeysForHours provides a mock function with given fields: _a0, _a1, _a2, _a3
+func (_m *Conn) FetchRevisedKeysForHours(_a0 string, _a1 uint32, _a2 uint32, _a3 int32) (map[uint32][]*covidshield.TemporaryExposureKey, error) {
+	ret := _m.Called(_a0, _a1, _a2, _a3)
+
+	var r0 map[uint32][]*covidshield.TemporaryExposureKey
+	if rf, ok := ret.Get(0).(func(string, uint32, uint32, int32) map[uint32][]*covidshield.TemporaryExposureKey); ok {
+		r0 = rf(_a0, _a1, _a2, _a3)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[uint32][]*covidshield.TemporaryExposureKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, uint32, uint32, int32) error); ok {
+		r1 = rf(_a0, _a1, _a2, _a3)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -422,20 +559,41 @@ func (_m *Conn) GetTEKUploads(startDate string) ([]persistence.Uploads, error) {
 	return r0, r1
 }
 
-// NewKeyClaim provides a mock function with given fields: _a0, _a1, _a2, _a3
-func (_m *Conn) NewKeyClaim(_a0 context.Context, _a1 string, _a2 string, _a3 string) (string, error) {
-	ret := _m.Called(_a0, _a1, _a2, _a3)
+// ImportKeys provides a mock function with given fields: region, originRegion, keys
+func (_m *Conn) ImportKeys(region string, originRegion string, keys []*covidshield.TemporaryExposureKey) (int64, error) {
+	ret := _m.Called(region, originRegion, keys)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(string, string, []*covidshield.TemporaryExposureKey) int64); ok {
+		r0 = rf(region, originRegion, keys)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, []*covidshield.TemporaryExposureKey) error); ok {
+		r1 = rf(region, originRegion, keys)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewKeyClaim provides a mock function with given fields: _a0, _a1, _a2, _a3, _a4
+func (_m *Conn) NewKeyClaim(_a0 context.Context, _a1 string, _a2 string, _a3 string, _a4 persistence.OnsetDates) (string, error) {
+	ret := _m.Called(_a0, _a1, _a2, _a3, _a4)
 
 	var r0 string
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) string); ok {
-		r0 = rf(_a0, _a1, _a2, _a3)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, persistence.OnsetDates) string); ok {
+		r0 = rf(_a0, _a1, _a2, _a3, _a4)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
-		r1 = rf(_a0, _a1, _a2, _a3)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, persistence.OnsetDates) error); ok {
+		r1 = rf(_a0, _a1, _a2, _a3, _a4)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -443,13 +601,36 @@ func (_m *Conn) NewKeyClaim(_a0 context.Context, _a1 string, _a2 string, _a3 str
 	return r0, r1
 }
 
-// NewOutbreakEvent provides a mock function with given fields: _a0, _a1, _a2
-func (_m *Conn) NewOutbreakEvent(_a0 context.Context, _a1 string, _a2 *covidshield.OutbreakEvent) error {
-	ret := _m.Called(_a0, _a1, _a2)
+// NewKeyClaims provides a mock function with given fields: ctx, region, originator, count, hashIDs, dates
+func (_m *Conn) NewKeyClaims(ctx context.Context, region string, originator string, count int, hashIDs []string, dates persistence.OnsetDates) ([]persistence.KeyClaim, error) {
+	ret := _m.Called(ctx, region, originator, count, hashIDs, dates)
+
+	var r0 []persistence.KeyClaim
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, []string, persistence.OnsetDates) []persistence.KeyClaim); ok {
+		r0 = rf(ctx, region, originator, count, hashIDs, dates)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]persistence.KeyClaim)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, []string, persistence.OnsetDates) error); ok {
+		r1 = rf(ctx, region, originator, count, hashIDs, dates)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewOutbreakEvent provides a mock function with given fields: _a0, _a1, _a2, _a3
+func (_m *Conn) NewOutbreakEvent(_a0 context.Context, _a1 string, _a2 string, _a3 *covidshield.OutbreakEvent) error {
+	ret := _m.Called(_a0, _a1, _a2, _a3)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, *covidshield.OutbreakEvent) error); ok {
-		r0 = rf(_a0, _a1, _a2)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *covidshield.OutbreakEvent) error); ok {
+		r0 = rf(_a0, _a1, _a2, _a3)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -457,6 +638,52 @@ func (_m *Conn) NewOutbreakEvent(_a0 context.Context, _a1 string, _a2 *covidshie
 	return r0
 }
 
+// OneTimeCodeStatus provides a mock function with given fields: originator, oneTimeCode, hashID
+func (_m *Conn) OneTimeCodeStatus(originator string, oneTimeCode string, hashID string) (*persistence.CodeStatus, error) {
+	ret := _m.Called(originator, oneTimeCode, hashID)
+
+	var r0 *persistence.CodeStatus
+	if rf, ok := ret.Get(0).(func(string, string, string) *persistence.CodeStatus); ok {
+		r0 = rf(originator, oneTimeCode, hashID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*persistence.CodeStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, string) error); ok {
+		r1 = rf(originator, oneTimeCode, hashID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// OneTimeCodeUsage provides a mock function with given fields:
+func (_m *Conn) OneTimeCodeUsage() ([]persistence.QuotaUsage, error) {
+	ret := _m.Called()
+
+	var r0 []persistence.QuotaUsage
+	if rf, ok := ret.Get(0).(func() []persistence.QuotaUsage); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]persistence.QuotaUsage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // PrivForPub provides a mock function with given fields: _a0
 func (_m *Conn) PrivForPub(_a0 []byte) ([]byte, error) {
 	ret := _m.Called(_a0)
@@ -480,6 +707,97 @@ func (_m *Conn) PrivForPub(_a0 []byte) ([]byte, error) {
 	return r0, r1
 }
 
+// RefundOneTimeCodeQuota provides a mock function with given fields: ctx, originator, count
+func (_m *Conn) RefundOneTimeCodeQuota(ctx context.Context, originator string, count int) error {
+	ret := _m.Called(ctx, originator, count)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) error); ok {
+		r0 = rf(ctx, originator, count)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReissueOneTimeCode provides a mock function with given fields: ctx, originator, oneTimeCode, hashID
+func (_m *Conn) ReissueOneTimeCode(ctx context.Context, originator string, oneTimeCode string, hashID string) (string, error) {
+	ret := _m.Called(ctx, originator, oneTimeCode, hashID)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) string); ok {
+		r0 = rf(ctx, originator, oneTimeCode, hashID)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, originator, oneTimeCode, hashID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReviseKeys provides a mock function with given fields: originator, oneTimeCode, hashID, reportType
+func (_m *Conn) ReviseKeys(originator string, oneTimeCode string, hashID string, reportType covidshield.TemporaryExposureKey_ReportType) (int64, error) {
+	ret := _m.Called(originator, oneTimeCode, hashID, reportType)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(string, string, string, covidshield.TemporaryExposureKey_ReportType) int64); ok {
+		r0 = rf(originator, oneTimeCode, hashID, reportType)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, string, covidshield.TemporaryExposureKey_ReportType) error); ok {
+		r1 = rf(originator, oneTimeCode, hashID, reportType)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeOneTimeCode provides a mock function with given fields: ctx, originator, oneTimeCode, hashID
+func (_m *Conn) RevokeOneTimeCode(ctx context.Context, originator string, oneTimeCode string, hashID string) error {
+	ret := _m.Called(ctx, originator, oneTimeCode, hashID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) error); ok {
+		r0 = rf(ctx, originator, oneTimeCode, hashID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// StoreCertifiedKeys provides a mock function with given fields: region, originator, certificateHash, keys, dates
+func (_m *Conn) StoreCertifiedKeys(region string, originator string, certificateHash []byte, keys []*covidshield.TemporaryExposureKey, dates persistence.OnsetDates) (int64, error) {
+	ret := _m.Called(region, originator, certificateHash, keys, dates)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(string, string, []byte, []*covidshield.TemporaryExposureKey, persistence.OnsetDates) int64); ok {
+		r0 = rf(region, originator, certificateHash, keys, dates)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, []byte, []*covidshield.TemporaryExposureKey, persistence.OnsetDates) error); ok {
+		r1 = rf(region, originator, certificateHash, keys, dates)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // StoreKeys provides a mock function with given fields: _a0, _a1, _a2
 func (_m *Conn) StoreKeys(_a0 *[32]byte, _a1 []*covidshield.TemporaryExposureKey, _a2 context.Context) error {
 	ret := _m.Called(_a0, _a1, _a2)
@@ -493,3 +811,17 @@ func (_m *Conn) StoreKeys(_a0 *[32]byte, _a1 []*covidshield.TemporaryExposureKey
 
 	return r0
 }
+
+// UseOneTimeCodeQuota provides a mock function with given fields: ctx, originator, count
+func (_m *Conn) UseOneTimeCodeQuota(ctx context.Context, originator string, count int) error {
+	ret := _m.Called(ctx, originator, count)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) error); ok {
+		r0 = rf(ctx, originator, count)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -22,3 +22,31 @@ func (_m *Authenticator) Authenticate(_a0 string, _a1 string, _a2 string) bool {
 
 	return r0
 }
+
+// AuthenticateHour provides a mock function with given fields: _a0, _a1, _a2
+func (_m *Authenticator) AuthenticateHour(_a0 string, _a1 string, _a2 string) bool {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string, string, string) bool); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
+// AuthenticateIndex provides a mock function with given fields: _a0, _a1
+func (_m *Authenticator) AuthenticateIndex(_a0 string, _a1 string) bool {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string, string) bool); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
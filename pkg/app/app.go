@@ -9,11 +9,14 @@ import (
 	"github.com/Shopify/goose/logger"
 	"github.com/Shopify/goose/srvutil"
 
+	"github.com/cds-snc/covid-alert-server/pkg/blobstore"
 	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/cds-snc/covid-alert-server/pkg/federation"
 	"github.com/cds-snc/covid-alert-server/pkg/keyclaim"
 	"github.com/cds-snc/covid-alert-server/pkg/persistence"
 	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
 	"github.com/cds-snc/covid-alert-server/pkg/server"
+	"github.com/cds-snc/covid-alert-server/pkg/verification"
 	"github.com/cds-snc/covid-alert-server/pkg/workers"
 )
 
@@ -31,19 +34,27 @@ type AppBuilder struct {
 	components        []genmain.Component
 	servlets          []srvutil.Servlet
 	database          persistence.Conn
+	bundleCache       *retrieval.BundleCache
+	signingKeys       retrieval.SigningKeys
+	proxies           server.TrustedProxies
 }
 
 func NewBuilder() *AppBuilder {
 	config.InitConfig() // read configuration into a structure
+	fatalIfErr(keyclaim.CheckOneTimeCodeFormat(), "invalid one-time code format")
 
 	lookup = keyclaim.NewAuthenticator()
 	persistence.SetupLookup(lookup)
 
+	proxies, err := server.NewTrustedProxies(config.AppConstants.TrustedProxies)
+	fatalIfErr(err, "could not parse trusted proxies")
+
 	builder := &AppBuilder{
 		defaultServerPort: config.AppConstants.DefaultServerPort,
 		database:          newDatabase(DatabaseURL()),
+		bundleCache:       retrieval.NewBundleCache(config.AppConstants.RetrievalCacheSize),
+		proxies:           proxies,
 	}
-	builder.servlets = append(builder.servlets, server.NewServicesServlet())
 	return builder
 }
 
@@ -64,10 +75,23 @@ func (a *AppBuilder) WithSubmission() *AppBuilder {
 
 	migrateDB(DatabaseURL()) // This is a bit of a weird place for this but it works for now.
 	a.defaultServerPort = config.AppConstants.DefaultSubmissionServerPort
+	fatalIfErr(persistence.SetupRevisionKey(), "could not load revision key")
 
 	a.components = append(a.components, newExpirationWorker(a.database))
-	a.servlets = append(a.servlets, server.NewUploadServlet(a.database))
-	a.servlets = append(a.servlets, server.NewKeyClaimServlet(a.database, lookup))
+	if len(config.AppConstants.FederationPeers) > 0 {
+		peers, err := federation.NewPeers(config.AppConstants.FederationPeers)
+		fatalIfErr(err, "could not load federation peers")
+		a.components = append(a.components, newFederationWorker(a.database, peers))
+	}
+	a.servlets = append(a.servlets, server.NewUploadServlet(a.database, a.bundleCache))
+	a.servlets = append(a.servlets, server.NewKeyClaimServlet(a.database, lookup, a.proxies))
+	a.servlets = append(a.servlets, server.NewKeyRevisionServlet(a.database, lookup, a.bundleCache))
+
+	if len(config.AppConstants.VerificationAuthorities) > 0 {
+		verifier, err := verification.NewVerifier(config.AppConstants.VerificationAuthorities)
+		fatalIfErr(err, "could not load verification authorities")
+		a.servlets = append(a.servlets, server.NewPublishServlet(a.database, verifier, a.bundleCache))
+	}
 
 	return a
 }
@@ -76,7 +100,30 @@ func (a *AppBuilder) WithRetrieval() *AppBuilder {
 
 	a.defaultServerPort = config.AppConstants.DefaultRetrievalServerPort
 
-	a.servlets = append(a.servlets, server.NewRetrieveServlet(a.database, retrieval.NewAuthenticator(), retrieval.NewSigner()))
+	signingKeys, err := retrieval.NewSigningKeys(config.AppConstants.SigningKeys)
+	fatalIfErr(err, "could not load signing keys")
+	a.signingKeys = signingKeys
+
+	var padder *retrieval.Padder
+	if config.AppConstants.EnableExportPadding {
+		padder, err = retrieval.NewPadder(config.AppConstants.ExportPaddingMinimumKeys, config.AppConstants.ExportPaddingJitter)
+		fatalIfErr(err, "could not set up export padding")
+	}
+
+	var store blobstore.BlobStore
+	if config.AppConstants.ExportBlobStore != "" {
+		store, err = blobstore.New(config.AppConstants.ExportBlobStore, config.AppConstants.ExportBlobStorePath)
+		fatalIfErr(err, "could not create export blob store")
+		a.components = append(a.components, newExportWorker(a.database, store, signingKeys, padder))
+	}
+
+	a.servlets = append(a.servlets, server.NewRetrieveServlet(a.database, retrieval.NewAuthenticator(), signingKeys, padder, store, a.bundleCache))
+
+	if len(config.AppConstants.FederationClients) > 0 {
+		clients, err := federation.NewClients(config.AppConstants.FederationClients, config.AppConstants.FederationClientCertHeader, a.proxies)
+		fatalIfErr(err, "could not load federation clients")
+		a.servlets = append(a.servlets, server.NewFederationServlet(a.database, clients, signingKeys))
+	}
 
 	//Check Metric existence ENV Variables
 	checkEnvironmentVariable("METRICS_USERNAME")
@@ -92,7 +139,9 @@ func (a *AppBuilder) WithDefaultPort() *AppBuilder {
 }
 
 func (a *AppBuilder) Build() (*App, persistence.Conn) {
-	a.components = append(a.components, server.New(bindAddr(a.defaultServerPort), a.servlets))
+	// Built last so it can publish the signing keys loaded by WithRetrieval
+	servlets := append([]srvutil.Servlet{server.NewServicesServlet(a.signingKeys)}, a.servlets...)
+	a.components = append(a.components, server.New(bindAddr(a.defaultServerPort), servlets))
 
 	main := genmain.New(a.components...)
 	main.SetShutdownDeadline(time.Duration(1) * time.Second)
@@ -130,6 +179,18 @@ func newExpirationWorker(db persistence.Conn) workers.Worker {
 	return worker
 }
 
+func newExportWorker(db persistence.Conn, store blobstore.BlobStore, signingKeys retrieval.SigningKeys, padder *retrieval.Padder) workers.Worker {
+	worker, err := workers.StartExportWorker(db, store, signingKeys, padder)
+	fatalIfErr(err, "failed to start export worker")
+	return worker
+}
+
+func newFederationWorker(db persistence.Conn, peers []federation.Peer) workers.Worker {
+	worker, err := workers.StartFederationWorker(db, peers)
+	fatalIfErr(err, "failed to start federation worker")
+	return worker
+}
+
 func fatalIfErr(err error, msg string) {
 	if err != nil {
 		log(nil, err).Fatal(msg)
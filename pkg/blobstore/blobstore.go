@@ -0,0 +1,47 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when there is no object stored under a name.
+var ErrNotFound = errors.New("object not found")
+
+// ErrUnknownBackend is returned by New for an unsupported backend name.
+var ErrUnknownBackend = errors.New("unknown blob store backend")
+
+// BlobStore stores pre-generated files (such as signed exports) so they can be
+// served without recomputing them. Object names are slash-separated paths.
+type BlobStore interface {
+	// Put stores data under name, replacing any existing object.
+	Put(ctx context.Context, name string, data []byte) error
+	// Get opens the object stored under name, or returns ErrNotFound.
+	Get(ctx context.Context, name string) (*Object, error)
+	// Delete removes the object stored under name. Deleting a missing object
+	// is not an error.
+	Delete(ctx context.Context, name string) error
+	// List returns the names of all objects whose name starts with prefix,
+	// in lexical order.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Object is an open stored object. Callers must Close it.
+type Object struct {
+	io.ReadCloser
+	Size    int64
+	ModTime time.Time
+}
+
+// New returns the blob store for the named backend. location is interpreted
+// by the backend; for "filesystem" it is the root directory.
+func New(backend, location string) (BlobStore, error) {
+	switch backend {
+	case "filesystem":
+		return NewFilesystem(location)
+	default:
+		return nil, ErrUnknownBackend
+	}
+}
@@ -0,0 +1,122 @@
+package blobstore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type filesystem struct {
+	root string
+}
+
+// NewFilesystem returns a BlobStore that keeps objects as files under root,
+// creating it if necessary. The directory can be served as-is by a web
+// server or synced to a CDN.
+func NewFilesystem(root string) (BlobStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &filesystem{root: root}, nil
+}
+
+func (f *filesystem) path(name string) string {
+	return filepath.Join(f.root, filepath.FromSlash(filepath.Clean("/"+name)))
+}
+
+// Put writes to a temporary file and renames it into place, so readers never
+// see a partially written object.
+func (f *filesystem) Put(ctx context.Context, name string, data []byte) error {
+	path := f.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *filesystem) Get(ctx context.Context, name string) (*Object, error) {
+	file, err := os.Open(f.path(name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, ErrNotFound
+	}
+
+	return &Object{ReadCloser: file, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (f *filesystem) Delete(ctx context.Context, name string) error {
+	err := os.Remove(f.path(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *filesystem) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+
+	// Only walk the directory the prefix falls in, not the whole store.
+	start := f.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		start = f.path(prefix[:i])
+	}
+	if _, err := os.Stat(start); os.IsNotExist(err) {
+		return names, nil
+	}
+
+	err := filepath.Walk(start, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(f.root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
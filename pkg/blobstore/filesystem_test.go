@@ -0,0 +1,103 @@
+package blobstore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupFilesystem(t *testing.T) (BlobStore, string) {
+	root, err := ioutil.TempDir("", "blobstore")
+	assert.Nil(t, err)
+
+	store, err := NewFilesystem(filepath.Join(root, "exports"))
+	assert.Nil(t, err)
+
+	return store, root
+}
+
+func TestNew(t *testing.T) {
+	root, _ := ioutil.TempDir("", "blobstore")
+	defer os.RemoveAll(root)
+
+	store, err := New("filesystem", root)
+	assert.Nil(t, err)
+	assert.Equal(t, &filesystem{root: root}, store)
+
+	_, err = New("s3", root)
+	assert.Equal(t, ErrUnknownBackend, err)
+}
+
+func TestFilesystem_PutGet(t *testing.T) {
+	store, root := setupFilesystem(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	_, err := store.Get(ctx, "302/day/18431/export-1.zip")
+	assert.Equal(t, ErrNotFound, err, "should return ErrNotFound for missing objects")
+
+	assert.Nil(t, store.Put(ctx, "302/day/18431/export-1.zip", []byte("first")))
+	assert.Nil(t, store.Put(ctx, "302/day/18431/export-1.zip", []byte("second")), "should replace existing objects")
+
+	obj, err := store.Get(ctx, "302/day/18431/export-1.zip")
+	assert.Nil(t, err)
+	defer obj.Close()
+
+	data, _ := ioutil.ReadAll(obj)
+	assert.Equal(t, []byte("second"), data)
+	assert.Equal(t, int64(6), obj.Size)
+	assert.False(t, obj.ModTime.IsZero())
+
+	_, err = store.Get(ctx, "302/day/18431")
+	assert.Equal(t, ErrNotFound, err, "should not open directories")
+
+	tmpFiles, _ := filepath.Glob(filepath.Join(root, "exports", "302", "day", "18431", ".tmp-*"))
+	assert.Empty(t, tmpFiles, "should not leave temporary files behind")
+}
+
+func TestFilesystem_NamesStayInsideRoot(t *testing.T) {
+	store, root := setupFilesystem(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	assert.Nil(t, store.Put(ctx, "../../escaped.txt", []byte("data")))
+
+	_, err := os.Stat(filepath.Join(root, "exports", "escaped.txt"))
+	assert.Nil(t, err, "should clean names relative to the root")
+}
+
+func TestFilesystem_DeleteList(t *testing.T) {
+	store, root := setupFilesystem(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	names, err := store.List(ctx, "302/")
+	assert.Nil(t, err)
+	assert.Empty(t, names, "should list nothing in an empty store")
+
+	for _, name := range []string{"302/index.txt", "302/day/18431/export-2.zip", "302/day/18431/export-1.zip", "302/hour/442344/export-1.zip", "208/index.txt"} {
+		assert.Nil(t, store.Put(ctx, name, []byte(name)))
+	}
+
+	names, err = store.List(ctx, "302/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"302/day/18431/export-1.zip", "302/day/18431/export-2.zip", "302/hour/442344/export-1.zip", "302/index.txt"}, names)
+
+	names, err = store.List(ctx, "302/day/18431/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"302/day/18431/export-1.zip", "302/day/18431/export-2.zip"}, names)
+
+	names, err = store.List(ctx, "302/day/1843")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"302/day/18431/export-1.zip", "302/day/18431/export-2.zip"}, names, "should match partial names")
+
+	assert.Nil(t, store.Delete(ctx, "302/day/18431/export-2.zip"))
+	assert.Nil(t, store.Delete(ctx, "302/day/18431/export-2.zip"), "should not fail deleting missing objects")
+
+	names, _ = store.List(ctx, "302/day/")
+	assert.Equal(t, []string{"302/day/18431/export-1.zip"}, names)
+}
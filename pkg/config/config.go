@@ -15,6 +15,9 @@ type Constants struct {
 	DefaultServerPort                  uint32
 	WorkerExpirationInterval           uint32
 	MaxConsecutiveClaimKeyFailures     int
+	TrustedProxies                     []string
+	AggregateIPv6Clients               bool
+	ChaffResponseTime                  ChaffResponseTime
 	ClaimKeyBanDuration                uint32
 	MaxDiagnosisKeyRetentionDays       uint32
 	InitialRemainingKeys               uint32
@@ -25,8 +28,124 @@ type Constants struct {
 	CORSAccessControlAllowOrigin       string
 	DisableCurrentDateCheckFeatureFlag bool
 	EnableEntirePeriodBundle           bool
+	EnableExportPadding                bool
+	ExportPaddingMinimumKeys           int
+	ExportPaddingJitter                int
 	RegionCode                         string
+	RegionISOCodes                     map[string]string
+	OriginatorRegions                  map[string]string
 	EventQueryRangeDates               int
+	MaxOnsetDateAgeDays                uint32
+	MaxUnclaimedOneTimeCodes           int
+	OneTimeCodeQuota                   OneTimeCodeQuota
+	OneTimeCodeQuotas                  map[string]OneTimeCodeQuota
+	OneTimeCodeFormat                  OneTimeCodeFormat
+	ExportBlobStore                    string
+	ExportBlobStorePath                string
+	ExportWorkerInterval               uint32
+	RetrievalCacheSize                 int
+	SigningKeys                        []SigningKey
+	QRV1SigningKeyVersion              string
+	FederationPeers                    []FederationPeer
+	FederationIngestInterval           uint32
+	FederationClients                  []FederationClient
+	FederationClientCertHeader         string
+	FederationPageSize                 int
+	KeyEmbargoMarginMinutes            uint32
+	VerificationAuthorities            []VerificationAuthority
+}
+
+// SigningKey describes one of the keys exports are signed with, and the
+// backend that holds it:
+//
+//	env (default): a hex-encoded DER key in the environment variable KeyEnv
+//	pem:           a PEM file at KeyFile, decrypted with the passphrase in PassphraseEnv
+//	remote:        a signing service at URL, authenticated with the token in TokenEnv
+//
+// ValidFrom and ValidUntil are RFC 3339 timestamps, and may be left empty.
+// PublicKeyFile is only needed for remote keys, whose public key can't be
+// derived locally.
+type SigningKey struct {
+	Version       string
+	ID            string
+	Backend       string
+	KeyEnv        string
+	KeyFile       string
+	PassphraseEnv string
+	URL           string
+	TokenEnv      string
+	PublicKeyFile string
+	ValidFrom     string
+	ValidUntil    string
+}
+
+// FederationPeer is another key server we import keys from. Keys are pulled
+// for the peer's Region, checked against the PEM public key in PublicKeyFile,
+// and served in ImportRegion, which defaults to RegionCode. The bearer token
+// for the peer is read from the environment variable TokenEnv.
+type FederationPeer struct {
+	Name          string
+	URL           string
+	TokenEnv      string
+	PublicKeyFile string
+	Region        string
+	ImportRegion  string
+}
+
+// FederationClient is a peer allowed to fetch the keys uploaded to us, for
+// the regions listed in Regions only. It authenticates with the bearer token
+// in the environment variable TokenEnv, or with a client certificate whose
+// hex-encoded SHA-256 fingerprint is CertificateSHA256.
+type FederationClient struct {
+	Name              string
+	TokenEnv          string
+	CertificateSHA256 string
+	Regions           []string
+}
+
+// VerificationAuthority is a verification server whose certificates are
+// accepted in place of a one-time code. Certificates are ES256 JWTs from
+// Issuer for Audience, signed with one of Keys, and the keys uploaded with
+// them are stored in Region, which defaults to RegionCode.
+type VerificationAuthority struct {
+	HealthAuthorityID string
+	Issuer            string
+	Audience          string
+	Region            string
+	Keys              []VerificationKey
+}
+
+// VerificationKey is a verification server's PEM public key, and the key ID
+// ("kid") its certificates name it by.
+type VerificationKey struct {
+	ID            string
+	PublicKeyFile string
+}
+
+// OneTimeCodeFormat describes the one-time codes we issue: Length characters
+// in groups of three, the last group taking any remainder, each group drawn
+// from one of Alphabets at random. With CheckCharacter, the last of the Length
+// characters is a Luhn mod N check character, and codes that fail the check
+// are rejected without looking them up.
+type OneTimeCodeFormat struct {
+	Length         int
+	Alphabets      []string
+	CheckCharacter bool
+}
+
+// OneTimeCodeQuota is how many one-time codes an originator can generate per
+// minute and per UTC day. Zero means no limit. OneTimeCodeQuota applies to
+// every originator without an entry of its own in OneTimeCodeQuotas.
+type OneTimeCodeQuota struct {
+	PerMinute int
+	PerDay    int
+}
+
+// ChaffResponseTime is the range, in milliseconds, that chaff requests are
+// answered in until enough real requests have been timed to go on.
+type ChaffResponseTime struct {
+	MinMilliseconds int
+	MaxMilliseconds int
 }
 
 var AppConstants Constants
@@ -55,6 +174,10 @@ func setDefaults() {
 	viper.SetDefault("workerExpirationInterval", 30)
 	viper.SetDefault("maxConsecutiveClaimKeyFailures", 50)
 	viper.SetDefault("claimKeyBanDuration", 1)
+	viper.SetDefault("trustedProxies", []string{"127.0.0.0/8", "::1/128"})
+	viper.SetDefault("aggregateIPv6Clients", true)
+	viper.SetDefault("chaffResponseTime.minMilliseconds", 30)
+	viper.SetDefault("chaffResponseTime.maxMilliseconds", 120)
 	viper.SetDefault("maxDiagnosisKeyRetentionDays", 15)
 	viper.SetDefault("initialRemainingKeys", 28)
 	viper.SetDefault("encryptionKeyValidityDays", 15)
@@ -64,7 +187,29 @@ func setDefaults() {
 	viper.SetDefault("corsAccessControlAllowOrigin", "*")
 	viper.SetDefault("disableCurrentDateCheckFeatureFlag", true)
 	viper.SetDefault("enableEntirePeriodBundle", false)
+	viper.SetDefault("enableExportPadding", false)
+	viper.SetDefault("exportPaddingMinimumKeys", 50)
+	viper.SetDefault("exportPaddingJitter", 10)
 	/// The MCC Region Code for Canada
 	viper.SetDefault("regionCode", "302")
+	viper.SetDefault("regionISOCodes", map[string]string{"302": "CA"})
+	viper.SetDefault("originatorRegions", map[string]string{})
 	viper.SetDefault("eventQueryRangeDates", 10)
+	viper.SetDefault("maxOnsetDateAgeDays", 28)
+	viper.SetDefault("maxUnclaimedOneTimeCodes", 1000)
+	viper.SetDefault("oneTimeCodeQuota.perMinute", 0)
+	viper.SetDefault("oneTimeCodeQuota.perDay", 0)
+	viper.SetDefault("oneTimeCodeQuotas", map[string]interface{}{})
+	viper.SetDefault("oneTimeCodeFormat.length", 10)
+	viper.SetDefault("oneTimeCodeFormat.alphabets", []string{"AEFHJKLQRSUWXYZ", "2456789"})
+	viper.SetDefault("oneTimeCodeFormat.checkCharacter", false)
+	viper.SetDefault("exportBlobStore", "")
+	viper.SetDefault("exportBlobStorePath", "")
+	viper.SetDefault("exportWorkerInterval", 600)
+	viper.SetDefault("retrievalCacheSize", 256)
+	viper.SetDefault("qrV1SigningKeyVersion", "v1")
+	viper.SetDefault("federationIngestInterval", 600)
+	viper.SetDefault("federationClientCertHeader", "")
+	viper.SetDefault("federationPageSize", 10000)
+	viper.SetDefault("keyEmbargoMarginMinutes", 60)
 }
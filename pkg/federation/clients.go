@@ -0,0 +1,162 @@
+package federation
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
+)
+
+// Client is a peer allowed to fetch the keys uploaded to us.
+type Client struct {
+	Name    string
+	regions map[string]bool
+	token   string
+	certSHA []byte
+}
+
+// MayReceive reports whether the client is allowed the keys of region.
+func (c *Client) MayReceive(region string) bool {
+	return c.regions[region]
+}
+
+// Proxies tells whether a request was passed on to us by one of the proxies
+// in front of us.
+type Proxies interface {
+	Trusts(r *http.Request) bool
+	Len() int
+}
+
+// Clients authenticates requests from the peers allowed to fetch our keys.
+type Clients struct {
+	clients    []*Client
+	certHeader string
+	proxies    Proxies
+}
+
+// NewClients loads the configured clients' tokens and certificate
+// fingerprints. If certHeader isn't empty, client certificates are also
+// accepted from that header, as URL-encoded PEM, for when TLS is terminated
+// by a proxy in front of us. The header is only read from requests that come
+// from one of proxies, since anyone else could send it with any certificate.
+func NewClients(configs []config.FederationClient, certHeader string, proxies Proxies) (*Clients, error) {
+	if certHeader != "" && (proxies == nil || proxies.Len() == 0) {
+		return nil, errors.New("federation client certificate header needs trusted proxies")
+	}
+	clients := &Clients{certHeader: certHeader, proxies: proxies}
+	seen := make(map[string]bool, len(configs))
+
+	for _, c := range configs {
+		if c.Name == "" {
+			return nil, errNoPeerName
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("federation client %s is configured more than once", c.Name)
+		}
+		seen[c.Name] = true
+
+		client := &Client{Name: c.Name, regions: make(map[string]bool, len(c.Regions))}
+		for _, region := range c.Regions {
+			if !retrieval.ServesRegion(region) {
+				return nil, fmt.Errorf("federation client %s is allowed unknown region %s", c.Name, region)
+			}
+			client.regions[region] = true
+		}
+
+		if c.TokenEnv != "" {
+			client.token = os.Getenv(c.TokenEnv)
+			if client.token == "" {
+				return nil, fmt.Errorf("federation client %s has no token in %s", c.Name, c.TokenEnv)
+			}
+		}
+		if c.CertificateSHA256 != "" {
+			sha, err := hex.DecodeString(strings.ReplaceAll(c.CertificateSHA256, ":", ""))
+			if err != nil || len(sha) != sha256.Size {
+				return nil, fmt.Errorf("federation client %s has an invalid certificate fingerprint", c.Name)
+			}
+			client.certSHA = sha
+		}
+		if client.token == "" && client.certSHA == nil {
+			return nil, fmt.Errorf("federation client %s needs a token or a certificate", c.Name)
+		}
+
+		clients.clients = append(clients.clients, client)
+	}
+	return clients, nil
+}
+
+// Authenticate returns the client a request is from, matched by its bearer
+// token or its client certificate.
+func (cs *Clients) Authenticate(r *http.Request) (*Client, bool) {
+	if token := bearerToken(r); token != "" {
+		for _, c := range cs.clients {
+			if c.token != "" && subtle.ConstantTimeCompare([]byte(c.token), []byte(token)) == 1 {
+				return c, true
+			}
+		}
+		return nil, false
+	}
+
+	cert := cs.clientCertificate(r)
+	if cert == nil {
+		return nil, false
+	}
+	sha := sha256.Sum256(cert.Raw)
+	for _, c := range cs.clients {
+		if c.certSHA != nil && subtle.ConstantTimeCompare(c.certSHA, sha[:]) == 1 {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(auth, "Bearer ")
+}
+
+// clientCertificate returns the certificate the client presented, if TLS
+// verified one: our own, or a trusted proxy's that passed it on in the header.
+// A client connecting to us over TLS has no proxy to vouch for the header.
+func (cs *Clients) clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS != nil {
+		if len(r.TLS.VerifiedChains) > 0 {
+			return r.TLS.VerifiedChains[0][0]
+		}
+		return nil
+	}
+	if cs.certHeader == "" || !cs.proxies.Trusts(r) {
+		return nil
+	}
+
+	escaped := r.Header.Get(cs.certHeader)
+	if escaped == "" {
+		return nil
+	}
+	pemData, err := url.PathUnescape(escaped)
+	if err != nil {
+		return nil
+	}
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	return cert
+}
@@ -0,0 +1,153 @@
+package federation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCertificate(t *testing.T) *x509.Certificate {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "keys.example.org"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert
+}
+
+// trustedAddr trusts requests from a single address.
+type trustedAddr string
+
+func (a trustedAddr) Trusts(r *http.Request) bool {
+	return r.RemoteAddr == string(a)
+}
+
+func (a trustedAddr) Len() int {
+	return 1
+}
+
+// noProxies trusts no one.
+type noProxies struct{}
+
+func (noProxies) Trusts(r *http.Request) bool {
+	return false
+}
+
+func (noProxies) Len() int {
+	return 0
+}
+
+func TestClients(t *testing.T) {
+	oldCodes := config.AppConstants.RegionISOCodes
+	defer func() { config.AppConstants.RegionISOCodes = oldCodes }()
+	config.AppConstants.RegionISOCodes = map[string]string{"302": "CA", "310": "US"}
+
+	cert := testCertificate(t)
+	sha := sha256.Sum256(cert.Raw)
+
+	os.Setenv("FEDERATION_CLIENT_TOKEN", "ny-token")
+	clients, err := NewClients([]config.FederationClient{
+		{Name: "ny", TokenEnv: "FEDERATION_CLIENT_TOKEN", Regions: []string{"302"}},
+		{Name: "nj", CertificateSHA256: hex.EncodeToString(sha[:]), Regions: []string{"302", "310"}},
+	}, "X-Client-Cert", trustedAddr("10.0.0.1:443"))
+	assert.Nil(t, err)
+
+	// Bearer token
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer ny-token")
+	client, ok := clients.Authenticate(req)
+	assert.True(t, ok)
+	assert.Equal(t, "ny", client.Name)
+	assert.True(t, client.MayReceive("302"))
+	assert.False(t, client.MayReceive("310"))
+
+	req.Header.Set("Authorization", "Bearer nj-token")
+	_, ok = clients.Authenticate(req)
+	assert.False(t, ok)
+
+	// Certificate verified by our own TLS
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	client, ok = clients.Authenticate(req)
+	assert.True(t, ok)
+	assert.Equal(t, "nj", client.Name)
+	assert.True(t, client.MayReceive("310"))
+
+	// Certificate passed on by the proxy
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:443"
+	req.Header.Set("X-Client-Cert", url.PathEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))))
+	client, ok = clients.Authenticate(req)
+	assert.True(t, ok)
+	assert.Equal(t, "nj", client.Name)
+
+	// but not by anyone else, who could send any peer's certificate
+	req.RemoteAddr = "192.0.2.1:1234"
+	_, ok = clients.Authenticate(req)
+	assert.False(t, ok)
+
+	// nor over TLS, even unverified
+	req.RemoteAddr = "10.0.0.1:443"
+	req.TLS = &tls.ConnectionState{}
+	_, ok = clients.Authenticate(req)
+	assert.False(t, ok)
+
+	// Some other certificate
+	other := testCertificate(t)
+	req.TLS = nil
+	req.Header.Set("X-Client-Cert", url.PathEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: other.Raw}))))
+	_, ok = clients.Authenticate(req)
+	assert.False(t, ok)
+
+	// Nothing at all
+	req, _ = http.NewRequest("GET", "/", nil)
+	_, ok = clients.Authenticate(req)
+	assert.False(t, ok)
+}
+
+func TestNewClients_Invalid(t *testing.T) {
+	oldCodes := config.AppConstants.RegionISOCodes
+	defer func() { config.AppConstants.RegionISOCodes = oldCodes }()
+	config.AppConstants.RegionISOCodes = map[string]string{"302": "CA"}
+
+	os.Setenv("FEDERATION_CLIENT_TOKEN", "ny-token")
+
+	_, err := NewClients([]config.FederationClient{{Name: "ny", Regions: []string{"302"}}}, "", nil)
+	assert.EqualError(t, err, "federation client ny needs a token or a certificate")
+
+	_, err = NewClients([]config.FederationClient{{Name: "ny", TokenEnv: "FEDERATION_CLIENT_TOKEN", Regions: []string{"302"}}}, "X-Client-Cert", nil)
+	assert.EqualError(t, err, "federation client certificate header needs trusted proxies")
+
+	_, err = NewClients([]config.FederationClient{{Name: "ny", TokenEnv: "FEDERATION_CLIENT_TOKEN", Regions: []string{"302"}}}, "X-Client-Cert", noProxies{})
+	assert.EqualError(t, err, "federation client certificate header needs trusted proxies")
+
+	_, err = NewClients([]config.FederationClient{{Name: "ny", TokenEnv: "FEDERATION_CLIENT_TOKEN", Regions: []string{"999"}}}, "", nil)
+	assert.EqualError(t, err, "federation client ny is allowed unknown region 999")
+
+	_, err = NewClients([]config.FederationClient{{Name: "ny", CertificateSHA256: "abcd"}}, "", nil)
+	assert.EqualError(t, err, "federation client ny has an invalid certificate fingerprint")
+
+	_, err = NewClients([]config.FederationClient{{Name: "ny", TokenEnv: "FEDERATION_MISSING_TOKEN"}}, "", nil)
+	assert.EqualError(t, err, "federation client ny has no token in FEDERATION_MISSING_TOKEN")
+}
@@ -0,0 +1,142 @@
+package federation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/cds-snc/covid-alert-server/pkg/persistence"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Pages fetched from one peer in a single sync. Whatever is left is
+	// fetched on the next one.
+	maxPagesPerSync = 100
+
+	// Larger than any export batch a peer should send.
+	maxPageSize = 32 << 20
+)
+
+type page struct {
+	data       []byte
+	nextCursor string
+	more       bool
+}
+
+// Sync imports the keys peer has shared since the last sync, and returns how
+// many were new. Progress is recorded after every page, so a failure part
+// way through only loses the page that failed; failures are recorded against
+// the peer as well as returned. Keys that fail verification are skipped and
+// logged; only a page that can't be trusted as a whole fails the sync.
+func Sync(ctx context.Context, db persistence.Conn, client *http.Client, peer Peer) (int64, error) {
+	imported, err := sync(ctx, db, client, peer)
+	if err != nil {
+		if recordErr := db.FederationSyncFailure(peer.Name, err); recordErr != nil {
+			log(ctx, recordErr).WithField("peer", peer.Name).Warn("failed to record federation sync failure")
+		}
+	}
+	return imported, err
+}
+
+func sync(ctx context.Context, db persistence.Conn, client *http.Client, peer Peer) (int64, error) {
+	cursor, err := db.FederationCursor(peer.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	var imported int64
+	for i := 0; i < maxPagesPerSync; i++ {
+		p, err := fetchPage(ctx, client, peer, cursor)
+		if err != nil {
+			return imported, err
+		}
+
+		report, err := retrieval.VerifyExport(p.data, peer.PublicKey)
+		if err != nil {
+			return imported, fmt.Errorf("unreadable export from %s: %w", peer.Name, err)
+		}
+		if len(report.ExportProblems) > 0 {
+			return imported, fmt.Errorf("export from %s failed verification: %s", peer.Name, report.ExportProblems[0])
+		}
+		export, err := retrieval.DecodeExport(p.data)
+		if err != nil {
+			return imported, err
+		}
+
+		// A peer that signed a key we won't take hasn't sent us a bad export,
+		// so the key is left out rather than holding up the keys after it.
+		keys := validKeys(export.GetKeys(), report.BadKeys)
+		if skipped := len(export.GetKeys()) - len(keys); skipped > 0 {
+			log(ctx, nil).WithFields(logrus.Fields{
+				"peer":     peer.Name,
+				"skipped":  skipped,
+				"problems": report.Problems,
+			}).Warn("skipped invalid keys from federation peer")
+		}
+
+		n, err := db.ImportKeys(peer.ImportRegion, peer.Region, keys)
+		if err != nil {
+			return imported, err
+		}
+		imported += n
+
+		cursor = p.nextCursor
+		if err := db.FederationSyncSuccess(peer.Name, cursor); err != nil {
+			return imported, err
+		}
+		if !p.more {
+			break
+		}
+	}
+	return imported, nil
+}
+
+func validKeys(keys []*pb.TemporaryExposureKey, bad map[int]bool) []*pb.TemporaryExposureKey {
+	valid := make([]*pb.TemporaryExposureKey, 0, len(keys))
+	for i, key := range keys {
+		if !bad[i] {
+			valid = append(valid, key)
+		}
+	}
+	return valid
+}
+
+func fetchPage(ctx context.Context, client *http.Client, peer Peer, cursor string) (*page, error) {
+	u := peer.URL + KeysPath + url.PathEscape(peer.Region) + "?" + url.Values{CursorParam: {cursor}}.Encode()
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+peer.token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded %s", peer.Name, resp.Status)
+	}
+	next := resp.Header.Get(NextCursorHeader)
+	if next == "" {
+		return nil, fmt.Errorf("%s sent no %s", peer.Name, NextCursorHeader)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPageSize {
+		return nil, fmt.Errorf("export from %s is larger than %d bytes", peer.Name, maxPageSize)
+	}
+
+	return &page{data: data, nextCursor: next, more: resp.Header.Get(MorePagesHeader) == "true"}, nil
+}
@@ -0,0 +1,208 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	persistence "github.com/cds-snc/covid-alert-server/mocks/pkg/persistence"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/testhelpers"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// standInPeer serves pages of keys the way a peer key server would, signed
+// with privateKey. Pages are looked up by the cursor they're requested with.
+type standInPeer struct {
+	t          *testing.T
+	privateKey *ecdsa.PrivateKey
+	pages      map[string][]*pb.TemporaryExposureKey
+	next       map[string]string
+	requests   []string
+}
+
+func (p *standInPeer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != KeysPath+"310" || r.Header.Get("Authorization") != "Bearer peer-token" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	cursor := r.URL.Query().Get(CursorParam)
+	p.requests = append(p.requests, cursor)
+
+	keys, ok := p.pages[cursor]
+	if !ok {
+		http.Error(w, "no such cursor", http.StatusBadRequest)
+		return
+	}
+
+	os.Setenv("FEDERATION_TEST_KEY", hexKey(p.privateKey))
+	signer, err := retrieval.NewEnvSigner("FEDERATION_TEST_KEY")
+	assert.Nil(p.t, err)
+
+	now := time.Now()
+	var buf bytes.Buffer
+	_, err = retrieval.SerializeBatchTo(
+		r.Context(), &buf, retrieval.Batch{Keys: keys}, "310", now.Add(-time.Hour), now, 1, 1,
+		retrieval.SigningKeys{{Signer: signer, Version: "v1", ID: "310"}},
+	)
+	assert.Nil(p.t, err)
+
+	w.Header().Set(NextCursorHeader, p.next[cursor])
+	if _, more := p.pages[p.next[cursor]]; more {
+		w.Header().Set(MorePagesHeader, "true")
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Write(buf.Bytes())
+}
+
+func hexKey(privateKey *ecdsa.PrivateKey) string {
+	der, _ := x509.MarshalECPrivateKey(privateKey)
+	return hex.EncodeToString(der)
+}
+
+func testKey(rollingPeriod int32) *pb.TemporaryExposureKey {
+	keyData := make([]byte, 16)
+	rand.Read(keyData)
+	rsin := pb.CurrentRollingStartIntervalNumber() - 144
+	return &pb.TemporaryExposureKey{
+		KeyData:                    keyData,
+		TransmissionRiskLevel:      new(int32),
+		RollingStartIntervalNumber: &rsin,
+		RollingPeriod:              &rollingPeriod,
+		ReportType:                 pb.TemporaryExposureKey_CONFIRMED_TEST.Enum(),
+	}
+}
+
+func setupPeer(t *testing.T) (*standInPeer, *httptest.Server, Peer) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	standIn := &standInPeer{t: t, privateKey: privateKey}
+	server := httptest.NewServer(standIn)
+
+	peer := Peer{
+		Name:         "ny",
+		URL:          server.URL,
+		Region:       "310",
+		ImportRegion: "302",
+		PublicKey:    &privateKey.PublicKey,
+		token:        "peer-token",
+	}
+	return standIn, server, peer
+}
+
+func TestSync(t *testing.T) {
+	standIn, server, peer := setupPeer(t)
+	defer server.Close()
+
+	first := []*pb.TemporaryExposureKey{testKey(144), testKey(144)}
+	second := []*pb.TemporaryExposureKey{testKey(144)}
+	standIn.pages = map[string][]*pb.TemporaryExposureKey{"18500:0": first, "18500:2": second}
+	standIn.next = map[string]string{"18500:0": "18500:2", "18500:2": "18500:3"}
+
+	db := &persistence.Conn{}
+	db.On("FederationCursor", "ny").Return("18500:0", nil)
+	db.On("ImportKeys", "302", "310", mock.MatchedBy(func(keys []*pb.TemporaryExposureKey) bool { return len(keys) == 2 })).Return(int64(2), nil)
+	db.On("ImportKeys", "302", "310", mock.MatchedBy(func(keys []*pb.TemporaryExposureKey) bool { return len(keys) == 1 })).Return(int64(0), nil)
+	db.On("FederationSyncSuccess", "ny", "18500:2").Return(nil)
+	db.On("FederationSyncSuccess", "ny", "18500:3").Return(nil)
+
+	imported, err := Sync(context.Background(), db, server.Client(), peer)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), imported, "keys we already had aren't counted")
+	assert.Equal(t, []string{"18500:0", "18500:2"}, standIn.requests, "should follow the cursor")
+	db.AssertExpectations(t)
+	db.AssertNotCalled(t, "FederationSyncFailure", mock.Anything, mock.Anything)
+}
+
+func TestSync_BadSignature(t *testing.T) {
+	standIn, server, peer := setupPeer(t)
+	defer server.Close()
+
+	standIn.pages = map[string][]*pb.TemporaryExposureKey{"": {testKey(144)}}
+	standIn.next = map[string]string{"": "18500:1"}
+
+	// Someone other than the peer signed the export
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	standIn.privateKey = otherKey
+
+	db := &persistence.Conn{}
+	db.On("FederationCursor", "ny").Return("", nil)
+	db.On("FederationSyncFailure", "ny", mock.Anything).Return(nil)
+
+	imported, err := Sync(context.Background(), db, server.Client(), peer)
+	assert.EqualError(t, err, "export from ny failed verification: no signature verifies against the public key")
+	assert.Equal(t, int64(0), imported)
+	db.AssertNotCalled(t, "ImportKeys", mock.Anything, mock.Anything, mock.Anything)
+	db.AssertNotCalled(t, "FederationSyncSuccess", mock.Anything, mock.Anything)
+	db.AssertCalled(t, "FederationSyncFailure", "ny", err)
+}
+
+func TestSync_InvalidKeys(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	standIn, server, peer := setupPeer(t)
+	defer server.Close()
+
+	good := testKey(144)
+	standIn.pages = map[string][]*pb.TemporaryExposureKey{"": {testKey(0), good}}
+	standIn.next = map[string]string{"": "18500:1"}
+
+	db := &persistence.Conn{}
+	db.On("FederationCursor", "ny").Return("", nil)
+	db.On("ImportKeys", "302", "310", mock.MatchedBy(func(keys []*pb.TemporaryExposureKey) bool {
+		return len(keys) == 1 && bytes.Equal(keys[0].GetKeyData(), good.GetKeyData())
+	})).Return(int64(1), nil)
+	db.On("FederationSyncSuccess", "ny", "18500:1").Return(nil)
+
+	// The bad key is skipped, and the sync moves past it
+	imported, err := Sync(context.Background(), db, server.Client(), peer)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), imported)
+	db.AssertExpectations(t)
+	db.AssertNotCalled(t, "FederationSyncFailure", mock.Anything, mock.Anything)
+
+	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "skipped invalid keys from federation peer")
+}
+
+func TestSync_PeerErrors(t *testing.T) {
+	_, server, peer := setupPeer(t)
+	defer server.Close()
+
+	db := &persistence.Conn{}
+	db.On("FederationCursor", "ny").Return("", nil)
+	db.On("FederationSyncFailure", "ny", mock.Anything).Return(nil)
+
+	// Refused
+	peer.token = "wrong-token"
+	_, err := Sync(context.Background(), db, server.Client(), peer)
+	assert.EqualError(t, err, "ny responded 401 Unauthorized")
+
+	// Unreachable
+	server.Close()
+	_, err = Sync(context.Background(), db, server.Client(), peer)
+	assert.NotNil(t, err)
+
+	db.AssertNumberOfCalls(t, "FederationSyncFailure", 2)
+
+	// Failing to even read the cursor is recorded too
+	db = &persistence.Conn{}
+	db.On("FederationCursor", "ny").Return("", errors.New("database error"))
+	db.On("FederationSyncFailure", "ny", mock.Anything).Return(nil)
+
+	_, err = Sync(context.Background(), db, server.Client(), peer)
+	assert.EqualError(t, err, "database error")
+	db.AssertCalled(t, "FederationSyncFailure", "ny", err)
+}
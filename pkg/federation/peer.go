@@ -0,0 +1,98 @@
+package federation
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
+
+	"github.com/Shopify/goose/logger"
+)
+
+var log = logger.New("federation")
+
+// The protocol peers share keys over. A peer asks for the keys of a region
+// with
+//
+//	GET <url>/federation/v1/keys/<region>?cursor=<cursor>
+//	Authorization: Bearer <token>
+//
+// and gets back a signed export batch, in the same format as /retrieve, of
+// the keys shared since cursor. An empty cursor asks for everything still
+// shared. NextCursorHeader holds the cursor to ask for next, and
+// MorePagesHeader is "true" if there are more keys to fetch now.
+const (
+	KeysPath         = "/federation/v1/keys/"
+	CursorParam      = "cursor"
+	NextCursorHeader = "X-Federation-Next-Cursor"
+	MorePagesHeader  = "X-Federation-More"
+)
+
+var errNoPeerName = errors.New("federation peer has no name")
+
+// Peer is a key server we import keys from.
+type Peer struct {
+	Name         string
+	URL          string
+	Region       string
+	ImportRegion string
+	PublicKey    *ecdsa.PublicKey
+	token        string
+}
+
+// NewPeers loads the configured peers' tokens and public keys.
+func NewPeers(configs []config.FederationPeer) ([]Peer, error) {
+	peers := make([]Peer, 0, len(configs))
+	seen := make(map[string]bool, len(configs))
+
+	for _, c := range configs {
+		if c.Name == "" {
+			return nil, errNoPeerName
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("federation peer %s is configured more than once", c.Name)
+		}
+		seen[c.Name] = true
+
+		if c.URL == "" || c.Region == "" {
+			return nil, fmt.Errorf("federation peer %s needs a url and a region", c.Name)
+		}
+
+		importRegion := c.ImportRegion
+		if importRegion == "" {
+			importRegion = config.AppConstants.RegionCode
+		}
+		if !retrieval.ServesRegion(importRegion) {
+			return nil, fmt.Errorf("federation peer %s imports into unknown region %s", c.Name, importRegion)
+		}
+
+		token := os.Getenv(c.TokenEnv)
+		if c.TokenEnv == "" || token == "" {
+			return nil, fmt.Errorf("federation peer %s has no token", c.Name)
+		}
+
+		pemData, err := ioutil.ReadFile(c.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("federation peer %s: %w", c.Name, err)
+		}
+		publicKey, err := retrieval.ParsePublicKey(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("federation peer %s: %w", c.Name, err)
+		}
+
+		peers = append(peers, Peer{
+			Name:         c.Name,
+			URL:          strings.TrimSuffix(c.URL, "/"),
+			Region:       c.Region,
+			ImportRegion: importRegion,
+			PublicKey:    publicKey,
+			token:        token,
+		})
+	}
+	return peers, nil
+}
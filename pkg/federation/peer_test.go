@@ -0,0 +1,76 @@
+package federation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPeers(t *testing.T) {
+	oldCodes := config.AppConstants.RegionISOCodes
+	oldRegion := config.AppConstants.RegionCode
+	defer func() {
+		config.AppConstants.RegionISOCodes = oldCodes
+		config.AppConstants.RegionCode = oldRegion
+	}()
+	config.AppConstants.RegionISOCodes = map[string]string{"302": "CA"}
+	config.AppConstants.RegionCode = "302"
+
+	dir, _ := ioutil.TempDir("", "federation")
+	defer os.RemoveAll(dir)
+
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	keyFile := filepath.Join(dir, "peer.pem")
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+
+	os.Setenv("FEDERATION_PEER_TOKEN", "peer-token")
+	peerConfig := config.FederationPeer{
+		Name:          "ny",
+		URL:           "https://keys.example.org/",
+		TokenEnv:      "FEDERATION_PEER_TOKEN",
+		PublicKeyFile: keyFile,
+		Region:        "310",
+	}
+
+	peers, err := NewPeers([]config.FederationPeer{peerConfig})
+	assert.Nil(t, err)
+	assert.Equal(t, []Peer{{
+		Name:         "ny",
+		URL:          "https://keys.example.org",
+		Region:       "310",
+		ImportRegion: "302",
+		PublicKey:    &privateKey.PublicKey,
+		token:        "peer-token",
+	}}, peers)
+
+	_, err = NewPeers([]config.FederationPeer{peerConfig, peerConfig})
+	assert.EqualError(t, err, "federation peer ny is configured more than once")
+
+	unknownRegion := peerConfig
+	unknownRegion.ImportRegion = "310"
+	_, err = NewPeers([]config.FederationPeer{unknownRegion})
+	assert.EqualError(t, err, "federation peer ny imports into unknown region 310")
+
+	noToken := peerConfig
+	noToken.TokenEnv = "FEDERATION_MISSING_TOKEN"
+	_, err = NewPeers([]config.FederationPeer{noToken})
+	assert.EqualError(t, err, "federation peer ny has no token")
+
+	noKey := peerConfig
+	noKey.PublicKeyFile = filepath.Join(dir, "missing.pem")
+	_, err = NewPeers([]config.FederationPeer{noKey})
+	assert.NotNil(t, err)
+
+	_, err = NewPeers([]config.FederationPeer{{}})
+	assert.Equal(t, errNoPeerName, err)
+}
@@ -19,6 +19,10 @@ type authenticator struct {
 // 1234deadbeefcafe=1:c0ffeec0ffeec0ffee=2
 // These are two keys with region IDs 1 and 2 respectively. Keys should be much
 // longer than this but still hexadecimal.
+//
+// The "region ID" given to a token names its originator, usually a province
+// or territory. The region its keys belong to is looked up in the
+// originatorRegions config; see RegionFor.
 func NewAuthenticator() Authenticator {
 	authTokens := make(map[string]string)
 	tokens := os.Getenv("KEY_CLAIM_TOKEN")
@@ -40,6 +44,9 @@ func NewAuthenticator() Authenticator {
 		if len(parts[1]) > 31 {
 			panic("region too long")
 		}
+		if _, ok := config.AppConstants.RegionISOCodes[RegionFor(parts[1])]; !ok {
+			panic("unknown region for " + parts[1])
+		}
 		authTokens[parts[0]] = parts[1]
 	}
 
@@ -51,12 +58,30 @@ func (a *authenticator) Authenticate(token string) (string, bool) {
 	return region, ok
 }
 
-// RegionFromAuthHeader authenticate using the Auth Header
+// RegionFromAuthHeader authenticate using the Auth Header, and returns the
+// MCC region of the token's originator along with the token.
 func (a *authenticator) RegionFromAuthHeader(header string) (string, string, bool) {
 	parts := strings.SplitN(header, " ", 2)
 	if len(parts) != 2 || parts[0] != "Bearer" {
 		return "", "", false
 	}
-	region, ok := a.Authenticate(parts[1])
-	return region, parts[1], ok
+	name, ok := a.Authenticate(parts[1])
+	if !ok {
+		return "", parts[1], false
+	}
+	return RegionFor(name), parts[1], true
+}
+
+// RegionFor returns the MCC region an originator belongs to: the one
+// configured in originatorRegions, the originator's name if that is a region
+// itself, or else the default region.
+func RegionFor(name string) string {
+	// Viper lower-cases map keys
+	if region, ok := config.AppConstants.OriginatorRegions[strings.ToLower(name)]; ok {
+		return region
+	}
+	if _, ok := config.AppConstants.RegionISOCodes[name]; ok {
+		return name
+	}
+	return config.AppConstants.RegionCode
 }
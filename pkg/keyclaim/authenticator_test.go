@@ -59,3 +59,40 @@ func TestAuthenticate(t *testing.T) {
 	assert.Equal(t, expectedRegion, receivedRegion, "Expected region is nil on invalid token")
 	assert.Equal(t, expectedBool, receivedBool, "Expected bool is false on invalid token")
 }
+
+func TestRegionFromAuthHeader(t *testing.T) {
+	oldCodes := config.AppConstants.RegionISOCodes
+	oldOriginators := config.AppConstants.OriginatorRegions
+	defer func() {
+		config.AppConstants.RegionISOCodes = oldCodes
+		config.AppConstants.OriginatorRegions = oldOriginators
+	}()
+	config.AppConstants.RegionISOCodes = map[string]string{"302": "CA", "310": "US"}
+	config.AppConstants.OriginatorRegions = map[string]string{"ny": "310"}
+
+	os.Setenv("KEY_CLAIM_TOKEN", strings.Repeat("a", 20)+"=302:"+strings.Repeat("b", 20)+"=ON:"+strings.Repeat("c", 20)+"=NY:"+strings.Repeat("d", 20)+"=310")
+	authenticator := NewAuthenticator()
+
+	region, originator, ok := authenticator.RegionFromAuthHeader("Bearer " + strings.Repeat("a", 20))
+	assert.True(t, ok)
+	assert.Equal(t, "302", region, "a token named after a region belongs to it")
+	assert.Equal(t, strings.Repeat("a", 20), originator)
+
+	region, _, ok = authenticator.RegionFromAuthHeader("Bearer " + strings.Repeat("b", 20))
+	assert.True(t, ok)
+	assert.Equal(t, config.AppConstants.RegionCode, region, "unmapped originators belong to the default region")
+
+	region, _, ok = authenticator.RegionFromAuthHeader("Bearer " + strings.Repeat("c", 20))
+	assert.True(t, ok)
+	assert.Equal(t, "310", region, "originators are mapped case-insensitively")
+
+	region, _, ok = authenticator.RegionFromAuthHeader("Bearer " + strings.Repeat("d", 20))
+	assert.True(t, ok)
+	assert.Equal(t, "310", region)
+
+	_, _, ok = authenticator.RegionFromAuthHeader("Bearer " + strings.Repeat("e", 20))
+	assert.False(t, ok)
+
+	config.AppConstants.OriginatorRegions = map[string]string{"ny": "311"}
+	assert.PanicsWithValue(t, "unknown region for NY", func() { NewAuthenticator() }, "originators must map to a configured region")
+}
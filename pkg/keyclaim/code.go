@@ -0,0 +1,164 @@
+package keyclaim
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+)
+
+// Codes are stored in a VARCHAR(32)
+const maxOneTimeCodeLength = 32
+
+// CheckOneTimeCodeFormat reports what's wrong with the configured one-time
+// code format, if anything.
+func CheckOneTimeCodeFormat() error {
+	f := config.AppConstants.OneTimeCodeFormat
+
+	if f.Length < 4 || f.Length > maxOneTimeCodeLength {
+		return fmt.Errorf("one-time codes must be between 4 and %d characters long", maxOneTimeCodeLength)
+	}
+	if len(f.Alphabets) == 0 {
+		return errors.New("one-time codes need at least one alphabet")
+	}
+	for _, alphabet := range f.Alphabets {
+		if alphabet == "" {
+			return errors.New("one-time code alphabets can't be empty")
+		}
+		for _, c := range alphabet {
+			// Apps and portals strip spaces and hyphens, and codes are upper-cased
+			if c == ' ' || c == '-' || unicode.ToUpper(c) != c {
+				return fmt.Errorf("one-time code alphabets can't contain %q", c)
+			}
+		}
+	}
+	if len(codeSymbols(f.Alphabets)) < 2 {
+		return errors.New("one-time code alphabets need at least two characters between them")
+	}
+	return nil
+}
+
+// NewOneTimeCode generates a one-time code in the configured format. For
+// each group it first picks an alphabet at random, then the group's
+// characters from it.
+func NewOneTimeCode() (string, error) {
+	f := config.AppConstants.OneTimeCodeFormat
+
+	length := f.Length
+	if f.CheckCharacter {
+		length--
+	}
+
+	var b strings.Builder
+	for _, size := range groupSizes(length) {
+		n, err := randomIndex(len(f.Alphabets))
+		if err != nil {
+			return "", err
+		}
+		alphabet := []rune(f.Alphabets[n])
+		for i := 0; i < size; i++ {
+			n, err := randomIndex(len(alphabet))
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(alphabet[n])
+		}
+	}
+
+	code := b.String()
+	if f.CheckCharacter {
+		code += string(checkCharacter(code, codeSymbols(f.Alphabets)))
+	}
+	return code, nil
+}
+
+// WellFormedOneTimeCode reports whether code could be one we issued: it has
+// to be the configured length and only use characters from the configured
+// alphabets. If codes have a check character, it has to match too, which
+// catches typos.
+func WellFormedOneTimeCode(code string) bool {
+	f := config.AppConstants.OneTimeCodeFormat
+
+	runes := []rune(code)
+	if len(runes) != f.Length {
+		return false
+	}
+
+	symbols := codeSymbols(f.Alphabets)
+	sum := 0
+	for i := len(runes) - 1; i >= 0; i-- {
+		index := sort.Search(len(symbols), func(j int) bool { return symbols[j] >= runes[i] })
+		if index == len(symbols) || symbols[index] != runes[i] {
+			return false
+		}
+		// Every second character from the right, starting with the one
+		// before the check character, is doubled
+		sum += luhnAddend(index, (len(runes)-1-i)%2 == 1, len(symbols))
+	}
+	return !f.CheckCharacter || sum%len(symbols) == 0
+}
+
+// groupSizes splits length characters into groups of three, the last taking
+// any remainder.
+func groupSizes(length int) []int {
+	groups := length / 3
+	if groups == 0 {
+		return []int{length}
+	}
+	sizes := make([]int, groups)
+	for i := range sizes {
+		sizes[i] = 3
+	}
+	sizes[groups-1] += length % 3
+	return sizes
+}
+
+// codeSymbols returns every character codes can contain, sorted. Check
+// characters are computed over their positions in it.
+func codeSymbols(alphabets []string) []rune {
+	seen := make(map[rune]bool)
+	var symbols []rune
+	for _, alphabet := range alphabets {
+		for _, c := range alphabet {
+			if !seen[c] {
+				seen[c] = true
+				symbols = append(symbols, c)
+			}
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i] < symbols[j] })
+	return symbols
+}
+
+// checkCharacter computes the Luhn mod N check character for code.
+func checkCharacter(code string, symbols []rune) rune {
+	runes := []rune(code)
+	sum := 0
+	for i := len(runes) - 1; i >= 0; i-- {
+		index := sort.Search(len(symbols), func(j int) bool { return symbols[j] >= runes[i] })
+		// The check character will be last, so the last character here is doubled
+		sum += luhnAddend(index, (len(runes)-1-i)%2 == 0, len(symbols))
+	}
+	n := len(symbols)
+	return symbols[(n-sum%n)%n]
+}
+
+func luhnAddend(index int, double bool, n int) int {
+	if double {
+		index *= 2
+	}
+	return index/n + index%n
+}
+
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
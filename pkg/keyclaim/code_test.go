@@ -0,0 +1,103 @@
+package keyclaim
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func withCodeFormat(format config.OneTimeCodeFormat) func() {
+	old := config.AppConstants.OneTimeCodeFormat
+	config.AppConstants.OneTimeCodeFormat = format
+	return func() { config.AppConstants.OneTimeCodeFormat = old }
+}
+
+var defaultAlphabets = []string{"AEFHJKLQRSUWXYZ", "2456789"}
+
+func TestNewOneTimeCode(t *testing.T) {
+	defer withCodeFormat(config.OneTimeCodeFormat{Length: 10, Alphabets: defaultAlphabets})()
+
+	format := regexp.MustCompile("^([AEFHJKLQRSUWXYZ]{3}|[2456789]{3}){2}([AEFHJKLQRSUWXYZ]{4}|[2456789]{4})$")
+
+	for i := 0; i < 100; i++ {
+		code, err := NewOneTimeCode()
+		assert.Nil(t, err)
+		assert.Regexp(t, format, code)
+
+		assert.True(t, WellFormedOneTimeCode(code))
+	}
+
+	// Without a check character, any code of the right length and alphabets
+	// might be ours
+	assert.True(t, WellFormedOneTimeCode("AAA222ZZZZ"))
+	assert.False(t, WellFormedOneTimeCode("AAA222ZZZ"))
+	assert.False(t, WellFormedOneTimeCode("AAA222ZZZZZ"))
+	assert.False(t, WellFormedOneTimeCode("AAA222ZZZB"))
+	assert.False(t, WellFormedOneTimeCode("1234123412"))
+	assert.False(t, WellFormedOneTimeCode(""))
+}
+
+func TestNewOneTimeCode_CheckCharacter(t *testing.T) {
+	defer withCodeFormat(config.OneTimeCodeFormat{Length: 10, Alphabets: defaultAlphabets, CheckCharacter: true})()
+
+	symbols := codeSymbols(defaultAlphabets)
+	format := regexp.MustCompile("^([AEFHJKLQRSUWXYZ]{3}|[2456789]{3}){3}[AEFHJKLQRSUWXYZ2456789]$")
+
+	for i := 0; i < 100; i++ {
+		code, err := NewOneTimeCode()
+		assert.Nil(t, err)
+		assert.Regexp(t, format, code)
+		assert.True(t, WellFormedOneTimeCode(code), code)
+
+		// Any single mistyped character is caught
+		runes := []rune(code)
+		for j := range runes {
+			for _, c := range symbols {
+				if c == runes[j] {
+					continue
+				}
+				typo := append([]rune{}, runes...)
+				typo[j] = c
+				assert.False(t, WellFormedOneTimeCode(string(typo)), string(typo))
+			}
+		}
+	}
+
+	assert.False(t, WellFormedOneTimeCode("12341234"))
+	assert.False(t, WellFormedOneTimeCode(""))
+	assert.False(t, WellFormedOneTimeCode("AAABBBCCCC"))
+}
+
+func TestCheckCharacter(t *testing.T) {
+	// Luhn mod 10 over digits is the usual Luhn algorithm
+	digits := []rune("0123456789")
+	assert.Equal(t, '3', checkCharacter("7992739871", digits))
+}
+
+func TestGroupSizes(t *testing.T) {
+	assert.Equal(t, []int{3, 3, 4}, groupSizes(10))
+	assert.Equal(t, []int{3, 3, 3}, groupSizes(9))
+	assert.Equal(t, []int{3, 5}, groupSizes(8))
+	assert.Equal(t, []int{2}, groupSizes(2))
+}
+
+func TestCheckOneTimeCodeFormat(t *testing.T) {
+	for _, format := range []config.OneTimeCodeFormat{
+		{Length: 3, Alphabets: defaultAlphabets},
+		{Length: 33, Alphabets: defaultAlphabets},
+		{Length: 10},
+		{Length: 10, Alphabets: []string{"ABC", ""}},
+		{Length: 10, Alphabets: []string{"abc"}},
+		{Length: 10, Alphabets: []string{"A-B"}},
+		{Length: 10, Alphabets: []string{"AAA"}},
+	} {
+		restore := withCodeFormat(format)
+		assert.NotNil(t, CheckOneTimeCodeFormat(), format)
+		restore()
+	}
+
+	defer withCodeFormat(config.OneTimeCodeFormat{Length: 10, Alphabets: defaultAlphabets, CheckCharacter: true})()
+	assert.Nil(t, CheckOneTimeCodeFormat())
+}
@@ -0,0 +1,130 @@
+package persistence
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/timemath"
+)
+
+// ErrCertificateUsed is returned when keys have already been uploaded with a
+// verification certificate.
+var ErrCertificateUsed = errors.New("verification certificate already used")
+
+// StoreCertifiedKeys stores keys uploaded with a verification certificate
+// instead of a one-time code, and returns how many were new. Each certificate
+// can be used once; certificateHash identifies it. As with one-time codes,
+// dates override the app's days since onset and transmission risk.
+func (c *conn) StoreCertifiedKeys(region, originator string, certificateHash []byte, keys []*pb.TemporaryExposureKey, dates OnsetDates) (int64, error) {
+	return storeCertifiedKeys(c.db, region, originator, certificateHash, keys, dates, timemath.HourNumber(time.Now()))
+}
+
+// DeleteOldVerificationCertificates forgets certificates used longer ago than
+// keys are kept, which have long since expired.
+func (c *conn) DeleteOldVerificationCertificates() (int64, error) {
+	return deleteOldVerificationCertificates(c.db)
+}
+
+func storeCertifiedKeys(db *sql.DB, region, originator string, certificateHash []byte, keys []*pb.TemporaryExposureKey, dates OnsetDates, hourOfSubmission uint32) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO verification_certificates (certificate_hash, originator) VALUES (?, ?)`,
+		certificateHash, originator,
+	); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return 0, err
+		}
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			return 0, ErrCertificateUsed
+		}
+		return 0, err
+	}
+
+	s, err := tx.Prepare(`
+		INSERT IGNORE INTO diagnosis_keys
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			return 0, err
+		}
+		return 0, err
+	}
+
+	var symptomOnset, test sql.NullTime
+	if dates.SymptomOnset != nil {
+		symptomOnset = sql.NullTime{Time: *dates.SymptomOnset, Valid: true}
+	}
+	if dates.Test != nil {
+		test = sql.NullTime{Time: *dates.Test, Valid: true}
+	}
+	anchor, hasAnchor := onsetAnchor(symptomOnset, test)
+
+	var keysInserted int64
+	for _, key := range keys {
+		transmissionRisk := key.GetTransmissionRiskLevel()
+		onsetDays := key.GetDaysSinceOnsetOfSymptoms()
+		if hasAnchor {
+			onsetDays = daysSinceOnset(key, anchor)
+			transmissionRisk = transmissionRiskForDaysSinceOnset(onsetDays)
+		}
+
+		result, err := s.Exec(
+			region, originator, key.GetKeyData(), key.GetRollingStartIntervalNumber(), key.GetRollingPeriod(),
+			transmissionRisk, int32(reportTypeOf(key)), onsetDays, hourOfRelease(key, hourOfSubmission),
+		)
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				return 0, err
+			}
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				return 0, err
+			}
+			return 0, err
+		}
+		keysInserted += n
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO tek_upload_count
+		(originator, date, count, first_upload)
+		VALUES (?, ?, ?, ?)`,
+		originator,
+		time.Now().Format("2006-01-02"),
+		keysInserted,
+		true,
+	); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return 0, err
+		}
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return keysInserted, nil
+}
+
+func deleteOldVerificationCertificates(db *sql.DB) (int64, error) {
+	threshold := time.Now().AddDate(0, 0, -int(config.AppConstants.MaxDiagnosisKeyRetentionDays))
+
+	res, err := db.Exec(`DELETE FROM verification_certificates WHERE created < ?`, threshold)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
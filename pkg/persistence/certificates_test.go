@@ -0,0 +1,84 @@
+package persistence
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/stretchr/testify/assert"
+)
+
+const insertCertificate = `INSERT INTO verification_certificates (certificate_hash, originator) VALUES (?, ?)`
+
+const insertCertifiedKey = `
+		INSERT IGNORE INTO diagnosis_keys
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+func TestStoreCertifiedKeys(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	hash := []byte("certificate hash")
+	keys := []*pb.TemporaryExposureKey{
+		randomTestKey(),
+		randomTestKey(),
+	}
+
+	// Duplicates aren't counted
+	mock.ExpectBegin()
+	mock.ExpectExec(insertCertificate).WithArgs(hash, "ca.gc.hc").WillReturnResult(sqlmock.NewResult(1, 1))
+	prepare := mock.ExpectPrepare(insertCertifiedKey)
+	for i, key := range keys {
+		prepare.ExpectExec().WithArgs(
+			"302", "ca.gc.hc", key.GetKeyData(), key.GetRollingStartIntervalNumber(), key.GetRollingPeriod(),
+			key.GetTransmissionRiskLevel(), int32(pb.TemporaryExposureKey_CONFIRMED_TEST), key.GetDaysSinceOnsetOfSymptoms(), uint32(445129),
+		).WillReturnResult(sqlmock.NewResult(int64(i), int64(1-i)))
+	}
+	mock.ExpectExec(`
+		INSERT INTO tek_upload_count
+		(originator, date, count, first_upload)
+		VALUES (?, ?, ?, ?)`).WithArgs("ca.gc.hc", sqlmock.AnyArg(), int64(1), true).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	stored, err := storeCertifiedKeys(db, "302", "ca.gc.hc", hash, keys, OnsetDates{}, 445129)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), stored)
+
+	// A certificate can only be used once
+	mock.ExpectBegin()
+	mock.ExpectExec(insertCertificate).WithArgs(hash, "ca.gc.hc").WillReturnError(fmt.Errorf("Error 1062: Duplicate entry for key 'PRIMARY'"))
+	mock.ExpectRollback()
+
+	_, err = storeCertifiedKeys(db, "302", "ca.gc.hc", hash, keys, OnsetDates{}, 445129)
+	assert.Equal(t, ErrCertificateUsed, err)
+
+	// Rolls back if an insert fails
+	mock.ExpectBegin()
+	mock.ExpectExec(insertCertificate).WithArgs(hash, "ca.gc.hc").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectPrepare(insertCertifiedKey).ExpectExec().WillReturnError(fmt.Errorf("error"))
+	mock.ExpectRollback()
+
+	_, err = storeCertifiedKeys(db, "302", "ca.gc.hc", hash, keys, OnsetDates{}, 445129)
+	assert.Equal(t, fmt.Errorf("error"), err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteOldVerificationCertificates(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	mock.ExpectExec(`DELETE FROM verification_certificates WHERE created < ?`).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 3))
+
+	deleted, err := deleteOldVerificationCertificates(db)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), deleted)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
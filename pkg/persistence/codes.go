@@ -0,0 +1,349 @@
+package persistence
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// ErrCodeNotFound is returned when the requesting originator issued no code
+// matching the one-time code or hashID, or it has since been deleted.
+var ErrCodeNotFound = errors.New("one-time code not found")
+
+// ErrCodeClaimed is returned when a code can't be changed because an app has
+// already claimed it.
+var ErrCodeClaimed = errors.New("one-time code already claimed")
+
+// ErrTooManyUnclaimedCodes is returned when generating codes would leave an
+// originator with more than MaxUnclaimedOneTimeCodes unclaimed.
+var ErrTooManyUnclaimedCodes = errors.New("too many unclaimed one-time codes")
+
+// Statuses of a one-time code, from issue to deletion.
+const (
+	CodeUnclaimed    = "unclaimed"
+	CodeClaimed      = "claimed"
+	CodeKeysUploaded = "keys_uploaded"
+	CodeExhausted    = "exhausted"
+	CodeExpired      = "expired"
+)
+
+// CodeStatus is where a one-time code is in its life.
+type CodeStatus struct {
+	Status        string `json:"status"`
+	RemainingKeys int64  `json:"remaining_keys"`
+}
+
+// KeyClaim is a generated one-time code, and the hashID it's for, if any.
+type KeyClaim struct {
+	OneTimeCode string `json:"one_time_code"`
+	HashID      string `json:"hash_id,omitempty"`
+}
+
+// NewKeyClaims generates count codes in one transaction, one for each of
+// hashIDs if given. As with NewKeyClaim, unclaimed codes for the hashIDs are
+// replaced, and a hashID whose code was claimed fails the whole batch.
+func (c *conn) NewKeyClaims(ctx context.Context, region, originator string, count int, hashIDs []string, dates OnsetDates) ([]KeyClaim, error) {
+	return newKeyClaims(ctx, c.db, region, originator, count, hashIDs, dates)
+}
+
+// OneTimeCodeStatus looks up a code originator issued, by the code itself or
+// by its hashID.
+func (c *conn) OneTimeCodeStatus(originator, oneTimeCode, hashID string) (*CodeStatus, error) {
+	return oneTimeCodeStatus(c.db, originator, oneTimeCode, hashID, time.Now())
+}
+
+// RevokeOneTimeCode deletes a code originator issued, so that it can't be
+// claimed. A hashID can be given a new code afterwards.
+func (c *conn) RevokeOneTimeCode(ctx context.Context, originator, oneTimeCode, hashID string) error {
+	return revokeOneTimeCode(ctx, c.db, originator, oneTimeCode, hashID)
+}
+
+// ReissueOneTimeCode replaces an unclaimed code originator issued with a new
+// one, valid from now, and returns the new code. The code's hashID and onset
+// dates carry over.
+func (c *conn) ReissueOneTimeCode(ctx context.Context, originator, oneTimeCode, hashID string) (string, error) {
+	var err error
+	for tries := 5; tries > 0; tries-- {
+		var newCode string
+		newCode, err = generateOneTimeCode()
+		if err != nil {
+			return "", err
+		}
+
+		err = reissueOneTimeCode(c.db, originator, oneTimeCode, hashID, newCode)
+		if err == nil {
+			c.saveNewKeyClaimEvent(ctx, originator, true)
+			return newCode, nil
+		} else if strings.Contains(err.Error(), "Duplicate entry") {
+			log(nil, err).Warn("duplicate one_time_code")
+			continue
+		} else {
+			return "", err
+		}
+	}
+	return "", err
+}
+
+// codeCondition matches the encryption key issued with oneTimeCode, which
+// is only kept hashed once claimed, or with hashID.
+func codeCondition(oneTimeCode, hashID string) (string, []interface{}) {
+	if hashID != "" {
+		return "hash_id = ?", []interface{}{hashID}
+	}
+	return "(one_time_code = ? OR one_time_code_hash = ?)", []interface{}{oneTimeCode, hashOneTimeCode(oneTimeCode)}
+}
+
+func oneTimeCodeStatus(db *sql.DB, originator, oneTimeCode, hashID string, now time.Time) (*CodeStatus, error) {
+	condition, args := codeCondition(oneTimeCode, hashID)
+	args = append([]interface{}{originator}, args...)
+
+	var claimed bool
+	var remainingKeys int64
+	var created time.Time
+	err := db.QueryRow(
+		`SELECT app_public_key IS NOT NULL, remaining_keys, created FROM encryption_keys
+		WHERE originator = ? AND `+condition,
+		args...,
+	).Scan(&claimed, &remainingKeys, &created)
+
+	if err == sql.ErrNoRows {
+		// The expiration worker deletes keypairs once they're used up or
+		// expired, but the keys uploaded with them are kept for a while longer.
+		var uploaded int64
+		if hashID != "" {
+			err = db.QueryRow(`SELECT COUNT(*) FROM diagnosis_keys WHERE originator = ? AND hash_id_hash = ?`, originator, hashHashID(hashID)).Scan(&uploaded)
+		} else {
+			err = db.QueryRow(`SELECT COUNT(*) FROM diagnosis_keys WHERE originator = ? AND one_time_code_hash = ?`, originator, hashOneTimeCode(oneTimeCode)).Scan(&uploaded)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if uploaded == 0 {
+			return nil, ErrCodeNotFound
+		}
+		if uploaded >= int64(config.AppConstants.InitialRemainingKeys) {
+			return &CodeStatus{Status: CodeExhausted}, nil
+		}
+		return &CodeStatus{Status: CodeExpired}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	status := &CodeStatus{RemainingKeys: remainingKeys}
+	switch {
+	case !claimed && created.Before(now.Add(-time.Duration(config.AppConstants.OneTimeCodeExpiryInMinutes)*time.Minute)):
+		status.Status = CodeExpired
+	case !claimed:
+		status.Status = CodeUnclaimed
+	case remainingKeys == 0:
+		status.Status = CodeExhausted
+	case created.Before(now.AddDate(0, 0, -int(config.AppConstants.EncryptionKeyValidityDays))):
+		status.Status = CodeExpired
+	case remainingKeys < int64(config.AppConstants.InitialRemainingKeys):
+		status.Status = CodeKeysUploaded
+	default:
+		status.Status = CodeClaimed
+	}
+	return status, nil
+}
+
+// codeChangeError explains why no unclaimed code was changed.
+func codeChangeError(db *sql.DB, originator, oneTimeCode, hashID string) error {
+	if _, err := oneTimeCodeStatus(db, originator, oneTimeCode, hashID, time.Now()); err != nil {
+		return err
+	}
+	return ErrCodeClaimed
+}
+
+func revokeOneTimeCode(ctx context.Context, db *sql.DB, originator, oneTimeCode, hashID string) error {
+	condition, args := codeCondition(oneTimeCode, hashID)
+	args = append([]interface{}{originator}, args...)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(
+		`DELETE FROM encryption_keys
+		WHERE originator = ? AND `+condition+`
+		AND app_public_key IS NULL`,
+		args...,
+	)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			return err
+		}
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			return err
+		}
+		return err
+	}
+	if n == 0 {
+		if err := tx.Rollback(); err != nil {
+			return err
+		}
+		return codeChangeError(db, originator, oneTimeCode, hashID)
+	}
+
+	event := Event{Originator: originator, DeviceType: Server, Identifier: OTKRevoked, Count: 1, Date: time.Now()}
+	if err := saveEvent(tx, event); err != nil {
+		LogEvent(ctx, err, event)
+	}
+
+	return tx.Commit()
+}
+
+func reissueOneTimeCode(db *sql.DB, originator, oneTimeCode, hashID, newCode string) error {
+	condition, args := codeCondition(oneTimeCode, hashID)
+	args = append([]interface{}{newCode, originator}, args...)
+
+	res, err := db.Exec(
+		`UPDATE encryption_keys
+		SET one_time_code = ?, created = NOW()
+		WHERE originator = ? AND `+condition+`
+		AND app_public_key IS NULL`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return codeChangeError(db, originator, oneTimeCode, hashID)
+	}
+	return nil
+}
+
+func newKeyClaims(ctx context.Context, db *sql.DB, region, originator string, count int, hashIDs []string, dates OnsetDates) ([]KeyClaim, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	claims, regenerated, err := insertKeyClaims(tx, region, originator, count, hashIDs, dates)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			return nil, err
+		}
+		return nil, err
+	}
+
+	if generated := count - regenerated; generated > 0 {
+		saveCountEvents(ctx, tx, OTKGenerated, []CountByOriginator{{Originator: originator, Count: generated}})
+	}
+	if regenerated > 0 {
+		saveCountEvents(ctx, tx, OTKRegenerated, []CountByOriginator{{Originator: originator, Count: regenerated}})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func insertKeyClaims(tx *sql.Tx, region, originator string, count int, hashIDs []string, dates OnsetDates) ([]KeyClaim, int, error) {
+	regenerated := 0
+	if len(hashIDs) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(hashIDs)), ", ")
+		args := make([]interface{}, len(hashIDs))
+		for i, hashID := range hashIDs {
+			args[i] = hashID
+		}
+
+		var claimed int
+		if err := tx.QueryRow(
+			`SELECT COUNT(*) FROM encryption_keys WHERE hash_id IN (`+placeholders+`) AND one_time_code IS NULL`,
+			args...,
+		).Scan(&claimed); err != nil {
+			return nil, 0, err
+		}
+		if claimed > 0 {
+			return nil, 0, ErrHashIDClaimed
+		}
+
+		res, err := tx.Exec(`DELETE FROM encryption_keys WHERE hash_id IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return nil, 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, 0, err
+		}
+		regenerated = int(n)
+	}
+
+	var unclaimed int
+	if err := tx.QueryRow(
+		`SELECT COUNT(*) FROM encryption_keys WHERE originator = ? AND app_public_key IS NULL`,
+		originator,
+	).Scan(&unclaimed); err != nil {
+		return nil, 0, err
+	}
+	if unclaimed+count > config.AppConstants.MaxUnclaimedOneTimeCodes {
+		return nil, 0, ErrTooManyUnclaimedCodes
+	}
+
+	claims := make([]KeyClaim, 0, count)
+	for i := 0; i < count; i++ {
+		var hashID sql.NullString
+		if len(hashIDs) > 0 {
+			hashID = sql.NullString{String: hashIDs[i], Valid: true}
+		}
+
+		oneTimeCode, err := insertKeyClaim(tx, region, originator, hashID, dates)
+		if err != nil {
+			return nil, 0, err
+		}
+		claims = append(claims, KeyClaim{OneTimeCode: oneTimeCode, HashID: hashID.String})
+	}
+	return claims, regenerated, nil
+}
+
+// insertKeyClaim inserts a new keypair and code, trying again with another
+// code if it's already taken. A failed insert doesn't end the transaction.
+func insertKeyClaim(tx *sql.Tx, region, originator string, hashID sql.NullString, dates OnsetDates) (string, error) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	for tries := 5; tries > 0; tries-- {
+		var oneTimeCode string
+		oneTimeCode, err = generateOneTimeCode()
+		if err != nil {
+			return "", err
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO encryption_keys
+			(region, originator, hash_id, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			region, originator, hashID, priv[:], pub[:], oneTimeCode, config.AppConstants.InitialRemainingKeys,
+			dateOrNull(dates.SymptomOnset), dateOrNull(dates.Test),
+		)
+		if err == nil {
+			return oneTimeCode, nil
+		} else if strings.Contains(err.Error(), "Duplicate entry") {
+			log(nil, err).Warn("duplicate one_time_code")
+			continue
+		}
+		return "", err
+	}
+	return "", err
+}
@@ -0,0 +1,187 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const selectCodeByOneTimeCode = `SELECT app_public_key IS NOT NULL, remaining_keys, created FROM encryption_keys
+		WHERE originator = ? AND (one_time_code = ? OR one_time_code_hash = ?)`
+
+const selectCodeByHashID = `SELECT app_public_key IS NOT NULL, remaining_keys, created FROM encryption_keys
+		WHERE originator = ? AND hash_id = ?`
+
+func TestOneTimeCodeStatus(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	now := time.Now()
+	initial := int64(config.AppConstants.InitialRemainingKeys)
+	columns := []string{"claimed", "remaining_keys", "created"}
+
+	for _, c := range []struct {
+		claimed       bool
+		remainingKeys int64
+		created       time.Time
+		expected      string
+	}{
+		{false, initial, now.Add(-time.Minute), CodeUnclaimed},
+		{false, initial, now.Add(-time.Duration(config.AppConstants.OneTimeCodeExpiryInMinutes+1) * time.Minute), CodeExpired},
+		{true, initial, now.Add(-time.Hour), CodeClaimed},
+		{true, initial - 3, now.Add(-time.Hour), CodeKeysUploaded},
+		{true, 0, now.Add(-time.Hour), CodeExhausted},
+		{true, initial - 3, now.AddDate(0, 0, -int(config.AppConstants.EncryptionKeyValidityDays+1)), CodeExpired},
+	} {
+		mock.ExpectQuery(selectCodeByOneTimeCode).
+			WithArgs("ONApi", "AAABBBCCCC", hashOneTimeCode("AAABBBCCCC")).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(c.claimed, c.remainingKeys, c.created))
+
+		status, err := oneTimeCodeStatus(db, "ONApi", "AAABBBCCCC", "", now)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, status.Status)
+		assert.Equal(t, c.remainingKeys, status.RemainingKeys)
+	}
+
+	// Keypair deleted, keys still around
+	countByHashID := `SELECT COUNT(*) FROM diagnosis_keys WHERE originator = ? AND hash_id_hash = ?`
+
+	mock.ExpectQuery(selectCodeByHashID).WithArgs("ONApi", "abcd").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(countByHashID).WithArgs("ONApi", hashHashID("abcd")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(initial))
+	status, err := oneTimeCodeStatus(db, "ONApi", "", "abcd", now)
+	assert.Nil(t, err)
+	assert.Equal(t, CodeExhausted, status.Status)
+
+	mock.ExpectQuery(selectCodeByHashID).WithArgs("ONApi", "abcd").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(countByHashID).WithArgs("ONApi", hashHashID("abcd")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	status, err = oneTimeCodeStatus(db, "ONApi", "", "abcd", now)
+	assert.Nil(t, err)
+	assert.Equal(t, CodeExpired, status.Status)
+
+	// Never issued, or issued by someone else
+	mock.ExpectQuery(selectCodeByOneTimeCode).WithArgs("ONApi", "AAABBBCCCC", hashOneTimeCode("AAABBBCCCC")).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT COUNT(*) FROM diagnosis_keys WHERE originator = ? AND one_time_code_hash = ?`).
+		WithArgs("ONApi", hashOneTimeCode("AAABBBCCCC")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	_, err = oneTimeCodeStatus(db, "ONApi", "AAABBBCCCC", "", now)
+	assert.Equal(t, ErrCodeNotFound, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRevokeOneTimeCode(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	query := `DELETE FROM encryption_keys
+		WHERE originator = ? AND hash_id = ?
+		AND app_public_key IS NULL`
+
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WithArgs("ONApi", "abcd").WillReturnResult(sqlmock.NewResult(0, 1))
+	setupSaveEventMock(mock, Event{Originator: "ONApi", Identifier: OTKRevoked, DeviceType: Server, Count: 1})
+	mock.ExpectCommit()
+
+	assert.Nil(t, revokeOneTimeCode(context.Background(), db, "ONApi", "", "abcd"))
+
+	// Already claimed
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WithArgs("ONApi", "abcd").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectQuery(selectCodeByHashID).WithArgs("ONApi", "abcd").
+		WillReturnRows(sqlmock.NewRows([]string{"claimed", "remaining_keys", "created"}).AddRow(true, 28, time.Now()))
+
+	assert.Equal(t, ErrCodeClaimed, revokeOneTimeCode(context.Background(), db, "ONApi", "", "abcd"))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReissueOneTimeCode(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	query := `UPDATE encryption_keys
+		SET one_time_code = ?, created = NOW()
+		WHERE originator = ? AND (one_time_code = ? OR one_time_code_hash = ?)
+		AND app_public_key IS NULL`
+
+	mock.ExpectExec(query).WithArgs("DDDEEEFFFF", "ONApi", "AAABBBCCCC", hashOneTimeCode("AAABBBCCCC")).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, reissueOneTimeCode(db, "ONApi", "AAABBBCCCC", "", "DDDEEEFFFF"))
+
+	// Never issued
+	mock.ExpectExec(query).WithArgs("DDDEEEFFFF", "ONApi", "AAABBBCCCC", hashOneTimeCode("AAABBBCCCC")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(selectCodeByOneTimeCode).WithArgs("ONApi", "AAABBBCCCC", hashOneTimeCode("AAABBBCCCC")).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT COUNT(*) FROM diagnosis_keys WHERE originator = ? AND one_time_code_hash = ?`).
+		WithArgs("ONApi", hashOneTimeCode("AAABBBCCCC")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	assert.Equal(t, ErrCodeNotFound, reissueOneTimeCode(db, "ONApi", "AAABBBCCCC", "", "DDDEEEFFFF"))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestNewKeyClaims(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	hashIDs := []string{"abcd", "efgh"}
+	insert := `INSERT INTO encryption_keys
+			(region, originator, hash_id, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	countUnclaimed := `SELECT COUNT(*) FROM encryption_keys WHERE originator = ? AND app_public_key IS NULL`
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT COUNT(*) FROM encryption_keys WHERE hash_id IN (?, ?) AND one_time_code IS NULL`).
+		WithArgs("abcd", "efgh").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`DELETE FROM encryption_keys WHERE hash_id IN (?, ?)`).WithArgs("abcd", "efgh").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(countUnclaimed).WithArgs("ONApi").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+	mock.ExpectExec(insert).WillReturnResult(sqlmock.NewResult(1, 1))
+	// A code that's already taken is replaced
+	mock.ExpectExec(insert).WillReturnError(errors.New("Error 1062: Duplicate entry 'AAABBBCCCC' for key 'one_time_code'"))
+	mock.ExpectExec(insert).WillReturnResult(sqlmock.NewResult(1, 1))
+	setupSaveEventMock(mock, Event{Originator: "ONApi", Identifier: OTKGenerated, DeviceType: Server, Count: 1})
+	setupSaveEventMock(mock, Event{Originator: "ONApi", Identifier: OTKRegenerated, DeviceType: Server, Count: 1})
+	mock.ExpectCommit()
+
+	claims, err := newKeyClaims(context.Background(), db, "302", "ONApi", 2, hashIDs, OnsetDates{})
+	assert.Nil(t, err)
+	assert.Len(t, claims, 2)
+	assert.Equal(t, "abcd", claims[0].HashID)
+	assert.Equal(t, "efgh", claims[1].HashID)
+	assert.Len(t, claims[0].OneTimeCode, 10)
+
+	// A hashID that was claimed fails the batch
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT COUNT(*) FROM encryption_keys WHERE hash_id IN (?, ?) AND one_time_code IS NULL`).
+		WithArgs("abcd", "efgh").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	_, err = newKeyClaims(context.Background(), db, "302", "ONApi", 2, hashIDs, OnsetDates{})
+	assert.Equal(t, ErrHashIDClaimed, err)
+
+	// Over the originator's cap
+	mock.ExpectBegin()
+	mock.ExpectQuery(countUnclaimed).WithArgs("ONApi").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(config.AppConstants.MaxUnclaimedOneTimeCodes - 1))
+	mock.ExpectRollback()
+
+	_, err = newKeyClaims(context.Background(), db, "302", "ONApi", 2, nil, OnsetDates{})
+	assert.Equal(t, ErrTooManyUnclaimedCodes, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -8,11 +8,11 @@ import (
 	"database/sql"
 	"errors"
 	"io/ioutil"
-	"math/big"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/cds-snc/covid-alert-server/pkg/keyclaim"
 	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
 	timestamp "github.com/golang/protobuf/ptypes"
 
@@ -33,14 +33,33 @@ type Conn interface {
 	// UTC date.
 	//
 	// Only returns keys that correspond to a Key for a date
-	// less than 14 days ago.
-	FetchKeysForHours(string, uint32, uint32, int32) ([]*pb.TemporaryExposureKey, error)
+	// less than 14 days ago, and that have expired. Keys uploaded while still
+	// active are held until after they expire. Keys are grouped by the hour
+	// they were submitted in.
+	FetchKeysForHours(string, uint32, uint32, int32) (map[uint32][]*pb.TemporaryExposureKey, error)
+
+	// Return keys that were REVISED during the specified hours, carrying their
+	// new report type, grouped by the hour they were revised in.
+	FetchRevisedKeysForHours(string, uint32, uint32, int32) (map[uint32][]*pb.TemporaryExposureKey, error)
 
 	StoreKeys(*[32]byte, []*pb.TemporaryExposureKey, context.Context) error
-	NewKeyClaim(context.Context, string, string, string) (string, error)
+	StoreCertifiedKeys(region, originator string, certificateHash []byte, keys []*pb.TemporaryExposureKey, dates OnsetDates) (int64, error)
+	ReviseKeys(originator, oneTimeCode, hashID string, reportType pb.TemporaryExposureKey_ReportType) (int64, error)
+	NewKeyClaim(context.Context, string, string, string, OnsetDates) (string, error)
+	NewKeyClaims(ctx context.Context, region, originator string, count int, hashIDs []string, dates OnsetDates) ([]KeyClaim, error)
 	ClaimKey(string, []byte, context.Context) ([]byte, error)
 	PrivForPub([]byte) ([]byte, error)
 
+	// Codes a health authority issued, looked up by code or hashID.
+	OneTimeCodeStatus(originator, oneTimeCode, hashID string) (*CodeStatus, error)
+	RevokeOneTimeCode(ctx context.Context, originator, oneTimeCode, hashID string) error
+	ReissueOneTimeCode(ctx context.Context, originator, oneTimeCode, hashID string) (string, error)
+
+	// How many codes each originator may generate, and has.
+	UseOneTimeCodeQuota(ctx context.Context, originator string, count int) error
+	RefundOneTimeCodeQuota(ctx context.Context, originator string, count int) error
+	OneTimeCodeUsage() ([]QuotaUsage, error)
+
 	CheckClaimKeyBan(string) (triesRemaining int, banDuration time.Duration, err error)
 	ClaimKeySuccess(string) error
 	ClaimKeyFailure(string) (triesRemaining int, banDuration time.Duration, err error)
@@ -50,6 +69,8 @@ type Conn interface {
 	DeleteExhaustedKeys(context.Context) (int64, error)
 	DeleteExpiredKeys(context.Context) (int64, error)
 	DeleteOldFailedClaimKeyAttempts() (int64, error)
+	DeleteOldVerificationCertificates() (int64, error)
+	DeleteOldOneTimeCodeUsage() (int64, error)
 
 	CountClaimedOneTimeCodes() (int64, error)
 	CountDiagnosisKeys() (int64, error)
@@ -61,8 +82,17 @@ type Conn interface {
 
 	ClearDiagnosisKeys(context.Context) error
 
-	NewOutbreakEvent(context.Context, string, *pb.OutbreakEvent) error
-	FetchOutbreakForTimeRange(time.Time, time.Time) ([]*pb.OutbreakEvent, error)
+	// Keys pulled from federation peers, and where each peer's sync got to.
+	ImportKeys(region, originRegion string, keys []*pb.TemporaryExposureKey) (int64, error)
+	FederationCursor(peer string) (string, error)
+	FederationSyncSuccess(peer, cursor string) error
+	FederationSyncFailure(peer string, err error) error
+
+	// Keys uploaded to us, paged through for federation peers.
+	FetchFederationKeys(region, cursor string, endHour uint32, currentRSIN int32, limit int) (*FederationPage, error)
+
+	NewOutbreakEvent(context.Context, string, string, *pb.OutbreakEvent) error
+	FetchOutbreakForTimeRange(string, time.Time, time.Time) ([]*pb.OutbreakEvent, error)
 
 	Close() error
 }
@@ -164,7 +194,7 @@ func (c *conn) ClaimKey(oneTimeCode string, appPublicKey []byte, ctx context.Con
 // HashID that has already used the code
 var ErrHashIDClaimed = errors.New("HashID claimed")
 
-func (c *conn) NewKeyClaim(ctx context.Context, region, originator, hashID string) (string, error) {
+func (c *conn) NewKeyClaim(ctx context.Context, region, originator, hashID string, dates OnsetDates) (string, error) {
 	var err error
 
 	pub, priv, err := box.GenerateKey(rand.Reader)
@@ -183,9 +213,9 @@ func (c *conn) NewKeyClaim(ctx context.Context, region, originator, hashID strin
 		}
 
 		if len(hashID) == 128 {
-			err = persistEncryptionKeyWithHashID(c.db, region, originator, hashID, pub, priv, oneTimeCode)
+			err = persistEncryptionKeyWithHashID(c.db, region, originator, hashID, pub, priv, oneTimeCode, dates)
 		} else {
-			err = persistEncryptionKey(c.db, region, originator, pub, priv, oneTimeCode)
+			err = persistEncryptionKey(c.db, region, originator, pub, priv, oneTimeCode, dates)
 		}
 
 		if err == nil {
@@ -241,45 +271,15 @@ func (c *conn) saveNewKeyClaimEvent(ctx context.Context, originator string, rege
 	}
 }
 
-// Generate a random one time code in the format AAABBBCCCC where
-// each group is made up of a character set. For each group it first
-// randomizes which charater set to use. Then passes that character
-// set and the desired length in another function to generate the
-// string for that group.
+// Generate a random one time code in the configured format, by default
+// AAABBBCCCC where each group is made up of a character set chosen at
+// random.
 func generateOneTimeCode() (string, error) {
-	characterSets := [2][]rune{
-		[]rune("AEFHJKLQRSUWXYZ"),
-		[]rune("2456789"),
-	}
-
-	characterSetLength := int64(len(characterSets))
-
-	seg1, err := rand.Int(rand.Reader, big.NewInt(characterSetLength))
-	seg2, err := rand.Int(rand.Reader, big.NewInt(characterSetLength))
-	seg3, err := rand.Int(rand.Reader, big.NewInt(characterSetLength))
-
-	oneTimeCode := genRandom(characterSets[seg1.Int64()], 3) +
-		genRandom(characterSets[seg2.Int64()], 3) +
-		genRandom(characterSets[seg3.Int64()], 4)
-
-	return oneTimeCode, err
+	return keyclaim.NewOneTimeCode()
 }
 
-// Generates a string of random characters based on a
-// passed list of characters and a desired length. For each
-// position in the desired length, generates a random number
-// between 0 and the length of the character set.
-func genRandom(chars []rune, length int64) string {
-	var b strings.Builder
-	for i := int64(0); i < length; i++ {
-		nBig, _ := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
-		b.WriteRune(chars[nBig.Int64()])
-	}
-	return b.String()
-}
-
-func (c *conn) NewOutbreakEvent(ctx context.Context, originator string, submission *pb.OutbreakEvent) error {
-	err := persistOutbreakEvent(c.db, originator, submission)
+func (c *conn) NewOutbreakEvent(ctx context.Context, region, originator string, submission *pb.OutbreakEvent) error {
+	err := persistOutbreakEvent(c.db, region, originator, submission)
 
 	if err != nil {
 		log(nil, err).Error("saving new QR submission")
@@ -304,48 +304,94 @@ func (c *conn) PrivForPub(pub []byte) ([]byte, error) {
 	}
 }
 
+// ErrInvalidReportType is returned when a key is uploaded with a report type
+// that only the server may assign, such as REVOKED.
+var ErrInvalidReportType = errors.New("invalid report type")
+
+// ErrInvalidDaysSinceOnsetOfSymptoms is returned when a key is uploaded with a
+// days_since_onset_of_symptoms outside of the range allowed by the EN framework.
+var ErrInvalidDaysSinceOnsetOfSymptoms = errors.New("days since onset of symptoms out of range")
+
+const maxDaysSinceOnsetOfSymptoms = 14
+
 func (c *conn) StoreKeys(appPubKey *[32]byte, keys []*pb.TemporaryExposureKey, ctx context.Context) error {
+	for _, key := range keys {
+		if err := validateKeyMetadata(key); err != nil {
+			return err
+		}
+	}
 	return registerDiagnosisKeys(c.db, appPubKey, keys, ctx)
 }
 
-func (c *conn) FetchKeysForHours(region string, startHour uint32, endHour uint32, currentRSIN int32) ([]*pb.TemporaryExposureKey, error) {
-	rows, err := diagnosisKeysForHours(c.db, region, startHour, endHour, currentRSIN)
+func validateKeyMetadata(key *pb.TemporaryExposureKey) error {
+	switch key.GetReportType() {
+	case pb.TemporaryExposureKey_UNKNOWN,
+		pb.TemporaryExposureKey_CONFIRMED_TEST,
+		pb.TemporaryExposureKey_CONFIRMED_CLINICAL_DIAGNOSIS,
+		pb.TemporaryExposureKey_SELF_REPORT:
+	default:
+		return ErrInvalidReportType
+	}
+
+	days := key.GetDaysSinceOnsetOfSymptoms()
+	if days < -maxDaysSinceOnsetOfSymptoms || days > maxDaysSinceOnsetOfSymptoms {
+		return ErrInvalidDaysSinceOnsetOfSymptoms
+	}
+
+	return nil
+}
+
+// reportTypeOf returns the report type to store for a key. Older clients don't
+// send one, and everything they upload is backed by a positive test.
+func reportTypeOf(key *pb.TemporaryExposureKey) pb.TemporaryExposureKey_ReportType {
+	if key.GetReportType() == pb.TemporaryExposureKey_UNKNOWN {
+		return pb.TemporaryExposureKey_CONFIRMED_TEST
+	}
+	return key.GetReportType()
+}
+
+func (c *conn) FetchKeysForHours(region string, startHour uint32, endHour uint32, currentRSIN int32) (map[uint32][]*pb.TemporaryExposureKey, error) {
+	rows, err := diagnosisKeysForHours(c.db, region, startHour, endHour, currentRSIN, currentIntervalNumber())
 	if err != nil {
 		return nil, err
 	}
 	return handleKeysRows(rows)
 }
 
-func handleKeysRows(rows *sql.Rows) ([]*pb.TemporaryExposureKey, error) {
-	var keys []*pb.TemporaryExposureKey
+// handleKeysRows groups keys by hour, keeping the order they were selected in
+// within each hour.
+func handleKeysRows(rows *sql.Rows) (map[uint32][]*pb.TemporaryExposureKey, error) {
+	keys := make(map[uint32][]*pb.TemporaryExposureKey)
 
 	for rows.Next() {
+		var hour uint32
 		var key []byte
 		var rollingStartIntervalNumber int32
 		var rollingPeriod int32
 		var transmissionRiskLevel int32
 		var region string
-		err := rows.Scan(&region, &key, &rollingStartIntervalNumber, &rollingPeriod, &transmissionRiskLevel)
+		var reportType int32
+		var onsetDays int32
+		err := rows.Scan(&region, &key, &rollingStartIntervalNumber, &rollingPeriod, &transmissionRiskLevel, &reportType, &onsetDays, &hour)
 		if err != nil {
 			return nil, err
 		}
 
-		onsetDays := int32(0)
-		keys = append(keys, &pb.TemporaryExposureKey{
+		keys[hour] = append(keys[hour], &pb.TemporaryExposureKey{
 			KeyData:                    key,
 			TransmissionRiskLevel:      &transmissionRiskLevel,
 			RollingStartIntervalNumber: &rollingStartIntervalNumber,
 			RollingPeriod:              &rollingPeriod,
-			ReportType:                 pb.TemporaryExposureKey_CONFIRMED_TEST.Enum(),
+			ReportType:                 pb.TemporaryExposureKey_ReportType(reportType).Enum(),
 			DaysSinceOnsetOfSymptoms:   &onsetDays,
 		})
 
 	}
-	return keys, nil
+	return keys, rows.Err()
 }
 
-func (c *conn) FetchOutbreakForTimeRange(startTime time.Time, endTime time.Time) ([]*pb.OutbreakEvent, error) {
-	rows, err := outbreakEventsForTimeRange(c.db, startTime, endTime)
+func (c *conn) FetchOutbreakForTimeRange(region string, startTime time.Time, endTime time.Time) ([]*pb.OutbreakEvent, error) {
+	rows, err := outbreakEventsForTimeRange(c.db, region, startTime, endTime)
 	if err != nil {
 		return nil, err
 	}
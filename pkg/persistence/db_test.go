@@ -41,6 +41,7 @@ func TestDBDeleteOldDiagnosisKeys(t *testing.T) {
 		db: db,
 	}
 
+	mock.ExpectExec("").WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec("").WillReturnResult(sqlmock.NewResult(1, 1))
 
 	expectedResult := int64(1)
@@ -165,6 +166,7 @@ func TestDBClaimKey(t *testing.T) {
 
 	query := `UPDATE encryption_keys
 		SET one_time_code = NULL,
+			one_time_code_hash = ?,
 			app_public_key = ?,
 			created = ?
 		WHERE one_time_code = ?
@@ -173,6 +175,7 @@ func TestDBClaimKey(t *testing.T) {
 	mock.ExpectPrepare(query).
 		ExpectExec().
 		WithArgs(
+			hashOneTimeCode(oneTimeCode),
 			pub[:],
 			created,
 			oneTimeCode,
@@ -218,14 +221,16 @@ func TestSuccessWithNoHashID(t *testing.T) {
 
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		AnyType{},
 		AnyType{},
 		AnyType{},
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectBegin()
@@ -238,7 +243,7 @@ func TestSuccessWithNoHashID(t *testing.T) {
 	})
 	mock.ExpectCommit()
 
-	receivedResult, receivedError := conn.NewKeyClaim(context.TODO(), region, originator, "")
+	receivedResult, receivedError := conn.NewKeyClaim(context.TODO(), region, originator, "", OnsetDates{})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -269,17 +274,19 @@ func TestErrorGeneric(t *testing.T) {
 	}
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		AnyType{},
 		AnyType{},
 		AnyType{},
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnError(fmt.Errorf("error"))
 
-	receivedResult, receivedError := conn.NewKeyClaim(context.TODO(), region, originator, "")
+	receivedResult, receivedError := conn.NewKeyClaim(context.TODO(), region, originator, "", OnsetDates{})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -312,26 +319,30 @@ func TestErrorExistingCode(t *testing.T) {
 
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		AnyType{},
 		AnyType{},
 		AnyType{},
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnError(fmt.Errorf("Duplicate entry"))
 
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		AnyType{},
 		AnyType{},
 		AnyType{},
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectBegin()
@@ -345,7 +356,7 @@ func TestErrorExistingCode(t *testing.T) {
 		})
 	mock.ExpectCommit()
 
-	receivedResult, receivedError := conn.NewKeyClaim(context.TODO(), region, originator, "")
+	receivedResult, receivedError := conn.NewKeyClaim(context.TODO(), region, originator, "", OnsetDates{})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -380,18 +391,20 @@ func TestNeverSucceedsWithDuplicateCodes(t *testing.T) {
 	for i := 0; i < 5; i++ {
 		mock.ExpectExec(
 			`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 			"302",
 			originator,
 			AnyType{},
 			AnyType{},
 			AnyType{},
 			config.AppConstants.InitialRemainingKeys,
+			nil,
+			nil,
 		).WillReturnError(fmt.Errorf("Duplicate entry"))
 	}
 
-	receivedResult, receivedError := conn.NewKeyClaim(context.TODO(), region, originator, "")
+	receivedResult, receivedError := conn.NewKeyClaim(context.TODO(), region, originator, "", OnsetDates{})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -427,8 +440,8 @@ func TestUnclaimedHashIDEventualSuccess(t *testing.T) {
 
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		hashID,
@@ -436,6 +449,8 @@ func TestUnclaimedHashIDEventualSuccess(t *testing.T) {
 		AnyType{},
 		AnyType{},
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnError(fmt.Errorf("for key 'hash_id"))
 
 	rows := sqlmock.NewRows([]string{"one_time_code"}).AddRow("ABCD")
@@ -445,8 +460,8 @@ func TestUnclaimedHashIDEventualSuccess(t *testing.T) {
 
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		hashID,
@@ -454,6 +469,8 @@ func TestUnclaimedHashIDEventualSuccess(t *testing.T) {
 		AnyType{},
 		AnyType{},
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectBegin()
@@ -466,7 +483,7 @@ func TestUnclaimedHashIDEventualSuccess(t *testing.T) {
 	})
 	mock.ExpectCommit()
 
-	receivedResult, receivedError := conn.NewKeyClaim(context.TODO(), region, originator, hashID)
+	receivedResult, receivedError := conn.NewKeyClaim(context.TODO(), region, originator, hashID, OnsetDates{})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -501,8 +518,8 @@ func TestClaimedHashID(t *testing.T) {
 
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		hashID,
@@ -510,13 +527,15 @@ func TestClaimedHashID(t *testing.T) {
 		AnyType{},
 		AnyType{},
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnError(fmt.Errorf("for key 'hash_id"))
 
 	rows := sqlmock.NewRows([]string{"one_time_code"}).AddRow(nil)
 	mock.ExpectQuery(
 		`SELECT one_time_code FROM encryption_keys WHERE hash_id = ? FOR UPDATE`).WithArgs(hashID).WillReturnRows(rows)
 
-	receivedResult, receivedError := conn.NewKeyClaim(context.TODO(), region, originator, hashID)
+	receivedResult, receivedError := conn.NewKeyClaim(context.TODO(), region, originator, hashID, OnsetDates{})
 
 	assert.Equal(t, "", receivedResult, "Expected result if could not execute insert")
 	assert.Equal(t, ErrHashIDClaimed, receivedError) // This is a bug and should be fixed, however, it is high unlikely to trigger
@@ -548,16 +567,17 @@ func TestNewOutbreakEventError(t *testing.T) {
 
 	mock.ExpectExec(
 		`INSERT INTO qr_outbreak_events
-		(location_id, originator, start_time, end_time, severity)
-		VALUES (?, ?, ?, ?, ?)`).WithArgs(
+		(location_id, region, originator, start_time, end_time, severity)
+		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
 		AnyType{},
+		"302",
 		originator,
 		AnyType{},
 		AnyType{},
 		AnyType{},
 	).WillReturnError(fmt.Errorf("error"))
 
-	receivedError := conn.NewOutbreakEvent(context.TODO(), originator, &submission)
+	receivedError := conn.NewOutbreakEvent(context.TODO(), "302", originator, &submission)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -594,16 +614,17 @@ func TestNewOutbreakEventSuccess(t *testing.T) {
 
 	mock.ExpectExec(
 		`INSERT INTO qr_outbreak_events
-		(location_id, originator, start_time, end_time, severity)
-		VALUES (?, ?, ?, ?, ?)`).WithArgs(
+		(location_id, region, originator, start_time, end_time, severity)
+		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
 		AnyType{},
+		"302",
 		originator,
 		AnyType{},
 		AnyType{},
 		AnyType{},
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 
-	receivedError := conn.NewOutbreakEvent(context.TODO(), originator, &submission)
+	receivedError := conn.NewOutbreakEvent(context.TODO(), "302", originator, &submission)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -677,26 +698,30 @@ func TestDBStoreKeys(t *testing.T) {
 	hourOfSubmission := timemath.HourNumber(time.Now())
 
 	mock.ExpectBegin()
-	row := sqlmock.NewRows([]string{"region", "originator", "remaining_keys"}).AddRow("302", "randomOrigin", 3)
-	mock.ExpectQuery(`SELECT region, originator, remaining_keys FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
+	row := sqlmock.NewRows([]string{"region", "originator", "remaining_keys", "symptom_onset_date", "test_date", "one_time_code_hash", "hash_id"}).AddRow("302", "randomOrigin", 3, nil, nil, nil, nil)
+	mock.ExpectQuery(`SELECT region, originator, remaining_keys, symptom_onset_date, test_date, one_time_code_hash, hash_id FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
 
 	mock.ExpectPrepare(
 		`INSERT IGNORE INTO diagnosis_keys
-		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, hour_of_submission)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission, one_time_code_hash, hash_id_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 	)
 
 	for _, key := range keys {
 		mock.ExpectExec(`INSERT IGNORE INTO diagnosis_keys
-		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, hour_of_submission)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission, one_time_code_hash, hash_id_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 			region,
 			originator,
 			key.GetKeyData(),
 			key.GetRollingStartIntervalNumber(),
 			key.GetRollingPeriod(),
 			key.GetTransmissionRiskLevel(),
+			int32(pb.TemporaryExposureKey_CONFIRMED_TEST),
+			int32(0),
 			hourOfSubmission,
+			[]byte(nil),
+			[]byte(nil),
 		).WillReturnResult(sqlmock.NewResult(1, 1))
 	}
 
@@ -732,6 +757,74 @@ func TestDBStoreKeys(t *testing.T) {
 	assert.Nil(t, receivedResult, "Expected nil when keys are commited")
 }
 
+func TestDBStoreKeysInvalidMetadata(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(allQueryMatcher))
+	defer db.Close()
+
+	conn := conn{
+		db: db,
+	}
+
+	pub, _, _ := box.GenerateKey(rand.Reader)
+
+	// Report types only the server may assign are rejected before touching the db
+	key := randomTestKey()
+	key.ReportType = pb.TemporaryExposureKey_REVOKED.Enum()
+	receivedResult := conn.StoreKeys(pub, []*pb.TemporaryExposureKey{randomTestKey(), key}, nil)
+	assert.Equal(t, ErrInvalidReportType, receivedResult)
+
+	// Days since onset must be within +/- 14
+	days := int32(15)
+	key = randomTestKey()
+	key.DaysSinceOnsetOfSymptoms = &days
+	receivedResult = conn.StoreKeys(pub, []*pb.TemporaryExposureKey{key}, nil)
+	assert.Equal(t, ErrInvalidDaysSinceOnsetOfSymptoms, receivedResult)
+
+	days = int32(-15)
+	receivedResult = conn.StoreKeys(pub, []*pb.TemporaryExposureKey{key}, nil)
+	assert.Equal(t, ErrInvalidDaysSinceOnsetOfSymptoms, receivedResult)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestValidateKeyMetadata(t *testing.T) {
+	key := randomTestKey()
+	assert.Nil(t, validateKeyMetadata(key), "keys without a report type are valid")
+
+	for _, reportType := range []pb.TemporaryExposureKey_ReportType{
+		pb.TemporaryExposureKey_CONFIRMED_TEST,
+		pb.TemporaryExposureKey_CONFIRMED_CLINICAL_DIAGNOSIS,
+		pb.TemporaryExposureKey_SELF_REPORT,
+	} {
+		key.ReportType = reportType.Enum()
+		assert.Nil(t, validateKeyMetadata(key))
+	}
+
+	for _, reportType := range []pb.TemporaryExposureKey_ReportType{
+		pb.TemporaryExposureKey_RECURSIVE,
+		pb.TemporaryExposureKey_REVOKED,
+	} {
+		key.ReportType = reportType.Enum()
+		assert.Equal(t, ErrInvalidReportType, validateKeyMetadata(key))
+	}
+
+	key = randomTestKey()
+	for _, days := range []int32{-14, 0, 14} {
+		key.DaysSinceOnsetOfSymptoms = &days
+		assert.Nil(t, validateKeyMetadata(key))
+	}
+}
+
+func TestReportTypeOf(t *testing.T) {
+	key := randomTestKey()
+	assert.Equal(t, pb.TemporaryExposureKey_CONFIRMED_TEST, reportTypeOf(key), "unset report types default to CONFIRMED_TEST")
+
+	key.ReportType = pb.TemporaryExposureKey_SELF_REPORT.Enum()
+	assert.Equal(t, pb.TemporaryExposureKey_SELF_REPORT, reportTypeOf(key))
+}
+
 func TestDBFetchKeysForHours(t *testing.T) {
 	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(allQueryMatcher))
 	defer db.Close()
@@ -748,19 +841,19 @@ func TestDBFetchKeysForHours(t *testing.T) {
 	rollingPeriod := int32(144)
 	transmissionRiskLevel := int32(4)
 
-	row := sqlmock.NewRows([]string{"region", "key_data", "rolling_start_interval_number", "rolling_period", "transmission_risk_level"}).AddRow("302", []byte{}, 2651450, 144, 4)
+	row := sqlmock.NewRows([]string{"region", "key_data", "rolling_start_interval_number", "rolling_period", "transmission_risk_level", "report_type", "days_since_onset_of_symptoms", "hour_of_submission"}).AddRow("302", []byte{}, 2651450, 144, 4, 3, -2, 150)
 	mock.ExpectQuery("").WillReturnRows(row)
 
-	onsetDays := int32(0)
-	expectedResult := []*pb.TemporaryExposureKey{
-		&pb.TemporaryExposureKey{
+	onsetDays := int32(-2)
+	expectedResult := map[uint32][]*pb.TemporaryExposureKey{
+		150: {&pb.TemporaryExposureKey{
 			KeyData:                    []byte{},
 			TransmissionRiskLevel:      &transmissionRiskLevel,
 			RollingStartIntervalNumber: &currentRollingStartIntervalNumber,
 			RollingPeriod:              &rollingPeriod,
-			ReportType:                 pb.TemporaryExposureKey_CONFIRMED_TEST.Enum(),
+			ReportType:                 pb.TemporaryExposureKey_SELF_REPORT.Enum(),
 			DaysSinceOnsetOfSymptoms:   &onsetDays,
-		},
+		}},
 	}
 
 	receivedResult, _ := conn.FetchKeysForHours(region, startHour, endHour, currentRollingStartIntervalNumber)
@@ -799,7 +892,7 @@ func TestFetchOutbreakForTimeRange(t *testing.T) {
 
 	expectedResult := []*pb.OutbreakEvent{&submission}
 
-	receivedResult, _ := conn.FetchOutbreakForTimeRange(time.Now(), time.Now().Add(time.Hour*24))
+	receivedResult, _ := conn.FetchOutbreakForTimeRange("302", time.Now(), time.Now().Add(time.Hour*24))
 
 	assert.Equal(t, expectedResult, receivedResult, "Expected rows for the query")
 
@@ -810,7 +903,7 @@ func TestFetchOutbreakForTimeRange(t *testing.T) {
 	// Errors
 	mock.ExpectQuery("").WillReturnError(fmt.Errorf("Generic error"))
 
-	_, receivedError := conn.FetchOutbreakForTimeRange(time.Now(), time.Now().Add(time.Hour*24))
+	_, receivedError := conn.FetchOutbreakForTimeRange("302", time.Now(), time.Now().Add(time.Hour*24))
 
 	assert.Equal(t, fmt.Errorf("Generic error"), receivedError, "Expected rows for the query")
 }
@@ -0,0 +1,36 @@
+package persistence
+
+import (
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/timemath"
+)
+
+// Length of an EN interval, which rolling start interval numbers and rolling
+// periods are counted in.
+const secondsInInterval = 600
+
+// hourOfRelease returns the hour a key may be published in. A key that's still
+// active on the phone could be replayed, so it's held until the hour after it
+// expires plus KeyEmbargoMarginMinutes. Keys are stored with this as their
+// hour_of_submission, so they're only fetched once released, and held keys
+// land in an export that hasn't been published yet.
+func hourOfRelease(key *pb.TemporaryExposureKey, hourOfSubmission uint32) uint32 {
+	expiry := int64(key.GetRollingStartIntervalNumber()+key.GetRollingPeriod()) * secondsInInterval
+	release := expiry + int64(config.AppConstants.KeyEmbargoMarginMinutes)*60
+
+	// The first hour starting at or after release
+	hour := uint32((release + timemath.SecondsInHour - 1) / timemath.SecondsInHour)
+	if hour > hourOfSubmission {
+		return hour
+	}
+	return hourOfSubmission
+}
+
+// currentIntervalNumber is the EN interval now, which every key published
+// must have expired by.
+func currentIntervalNumber() int32 {
+	return int32(time.Now().Unix() / secondsInInterval)
+}
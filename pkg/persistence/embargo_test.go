@@ -0,0 +1,42 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/timemath"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHourOfRelease(t *testing.T) {
+	oldMargin := config.AppConstants.KeyEmbargoMarginMinutes
+	defer func() { config.AppConstants.KeyEmbargoMarginMinutes = oldMargin }()
+	config.AppConstants.KeyEmbargoMarginMinutes = 60
+
+	key := func(rsin, rollingPeriod int32) *pb.TemporaryExposureKey {
+		return &pb.TemporaryExposureKey{RollingStartIntervalNumber: &rsin, RollingPeriod: &rollingPeriod}
+	}
+
+	// 2020-10-12 00:00 UTC
+	midnight := time.Unix(1602460800, 0)
+	rsin := int32(midnight.Unix() / 600)
+	hour := timemath.HourNumber(midnight)
+
+	// Submitted at noon, while still active: held until an hour after midnight
+	assert.Equal(t, hour+25, hourOfRelease(key(rsin, 144), hour+12))
+
+	// Expiring at 12:10, released at 13:10, so in the hour starting at 14:00
+	assert.Equal(t, hour+14, hourOfRelease(key(rsin, 73), hour+12))
+
+	// Long expired
+	assert.Equal(t, hour+12, hourOfRelease(key(rsin-144, 144), hour+12))
+
+	// Expired, but not by the margin
+	assert.Equal(t, hour+25, hourOfRelease(key(rsin, 144), hour+24))
+
+	config.AppConstants.KeyEmbargoMarginMinutes = 0
+	assert.Equal(t, hour+24, hourOfRelease(key(rsin, 144), hour+24))
+	assert.Equal(t, hour+24, hourOfRelease(key(rsin, 144), hour+12))
+}
@@ -11,6 +11,8 @@ type EventType string
 // OTKExpired One Time Key Expired
 // OTKExpiredNoUploads One Time Key Expired with no TEK uploads (not exclusive but subset)
 // OTKExhausted One Time Key exhausted all it's TEKs
+// OTKRevoked One Time Key revoked by its health authority before it was claimed
+// OTKQuotaExceeded One Time Key refused because its originator was over quota
 const (
 	OTKClaimed          EventType = "OTKClaimed"
 	OTKUnclaimed        EventType = "OTKUnclaimed"
@@ -19,12 +21,14 @@ const (
 	OTKExhausted        EventType = "OTKExhausted"
 	OTKExpiredNoUploads EventType = "OTKExpiredNoUploads"
 	OTKRegenerated      EventType = "OTKRegenerated"
+	OTKRevoked          EventType = "OTKRevoked"
+	OTKQuotaExceeded    EventType = "OTKQuotaExceeded"
 )
 
 // IsValid validates the Event Type against a list of allowed strings
 func (et EventType) IsValid() error {
 	switch et {
-	case OTKGenerated, OTKClaimed, OTKExpired, OTKRegenerated, OTKExhausted, OTKExpiredNoUploads, OTKUnclaimed:
+	case OTKGenerated, OTKClaimed, OTKExpired, OTKRegenerated, OTKExhausted, OTKExpiredNoUploads, OTKUnclaimed, OTKRevoked, OTKQuotaExceeded:
 		return nil
 	}
 	return fmt.Errorf("invalid EventType: (%s)", et)
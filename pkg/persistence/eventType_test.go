@@ -16,6 +16,8 @@ func TestEventType_IsValid(t *testing.T) {
 		OTKExpired,
 		OTKExpiredNoUploads,
 		OTKUnclaimed,
+		OTKRevoked,
+		OTKQuotaExceeded,
 	} {
 		if err := et.IsValid(); err != nil {
 			t.Errorf("Valid EventType failed: %s", et)
@@ -8,6 +8,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/cds-snc/covid-alert-server/pkg/config"
 	"github.com/cds-snc/covid-alert-server/pkg/keyclaim"
 )
 
@@ -36,7 +37,7 @@ func translateToken(token string) string {
 	region, ok := originatorLookup.Authenticate(token)
 
 	// If we forgot to map a token to a PT just return the token
-	if region == "302" {
+	if _, isRegion := config.AppConstants.RegionISOCodes[region]; isRegion {
 		return token
 	}
 
@@ -52,7 +53,7 @@ func translateToken(token string) string {
 func translateTokenForLogs(token string) string {
 	region, ok := originatorLookup.Authenticate(token)
 
-	if region == "302" || ok == false {
+	if _, isRegion := config.AppConstants.RegionISOCodes[region]; isRegion || ok == false {
 		return fmt.Sprintf("%s...%s", token[0:1], token[len(token)-1:])
 	}
 
@@ -0,0 +1,226 @@
+package persistence
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/timemath"
+)
+
+// Longest error message kept for a failed federation sync.
+const maxFederationErrorLength = 1024
+
+// ErrInvalidFederationCursor is returned when a peer asks for keys with a
+// cursor we didn't give out.
+var ErrInvalidFederationCursor = errors.New("invalid federation cursor")
+
+// FederationPage is a page of the keys uploaded to us, shared with a peer.
+// NextCursor is where the following page starts, and More is set if there
+// are keys past it already.
+type FederationPage struct {
+	Keys       []*pb.TemporaryExposureKey
+	NextCursor string
+	More       bool
+}
+
+// FetchFederationKeys returns up to limit of the keys uploaded to us in
+// region after cursor, and before endHour. Keys imported from peers are left
+// out, as are keys more than 14 days older than currentRSIN.
+//
+// Keys are ordered by hour of submission then key data, and the cursor is the
+// last hour and key shared. Only hours before endHour are paged through, which
+// should be the current hour: the keys of hours still open could otherwise
+// land behind a cursor already handed out.
+func (c *conn) FetchFederationKeys(region, cursor string, endHour uint32, currentRSIN int32, limit int) (*FederationPage, error) {
+	return federationKeys(c.db, region, cursor, endHour, currentRSIN, limit)
+}
+
+// ImportKeys stores keys pulled from a federation peer in region, tagged with
+// the region they originated in, and returns how many were new. Keys we
+// already hold, whether uploaded here or imported before, are skipped.
+//
+// Imported keys are submitted in the current hour, so they appear in the
+// exports that are open now rather than rewriting ones clients already have.
+// Keys still active are held back, as they are when uploaded here.
+func (c *conn) ImportKeys(region, originRegion string, keys []*pb.TemporaryExposureKey) (int64, error) {
+	return importKeys(c.db, region, originRegion, keys, timemath.HourNumber(time.Now()))
+}
+
+// FederationCursor returns where the last successful sync with peer got to,
+// or "" if there hasn't been one.
+func (c *conn) FederationCursor(peer string) (string, error) {
+	var cursor string
+	err := c.db.QueryRow(`SELECT sync_cursor FROM federation_syncs WHERE peer = ?`, peer).Scan(&cursor)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return cursor, err
+}
+
+// FederationSyncSuccess records the cursor a sync with peer got to, and
+// clears its failure count.
+func (c *conn) FederationSyncSuccess(peer, cursor string) error {
+	_, err := c.db.Exec(`
+		INSERT INTO federation_syncs
+		(peer, sync_cursor, last_sync, failures)
+		VALUES (?, ?, NOW(), 0)
+		ON DUPLICATE KEY UPDATE sync_cursor = VALUES(sync_cursor), last_sync = NOW(), failures = 0`,
+		peer, cursor,
+	)
+	return err
+}
+
+// FederationSyncFailure records a failed sync with peer. The cursor is left
+// where it was, so the next sync retries from there.
+func (c *conn) FederationSyncFailure(peer string, syncErr error) error {
+	msg := syncErr.Error()
+	if len(msg) > maxFederationErrorLength {
+		msg = msg[:maxFederationErrorLength]
+	}
+	_, err := c.db.Exec(`
+		INSERT INTO federation_syncs
+		(peer, failures, last_failure, last_error)
+		VALUES (?, 1, NOW(), ?)
+		ON DUPLICATE KEY UPDATE failures = failures + 1, last_failure = NOW(), last_error = VALUES(last_error)`,
+		peer, msg,
+	)
+	return err
+}
+
+func importKeys(db *sql.DB, region, originRegion string, keys []*pb.TemporaryExposureKey, hourOfSubmission uint32) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	s, err := tx.Prepare(`
+		INSERT IGNORE INTO diagnosis_keys
+		(region, origin_region, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			return 0, err
+		}
+		return 0, err
+	}
+
+	var imported int64
+	for _, key := range keys {
+		result, err := s.Exec(
+			region, originRegion, key.GetKeyData(), key.GetRollingStartIntervalNumber(), key.GetRollingPeriod(),
+			key.GetTransmissionRiskLevel(), int32(reportTypeOf(key)), key.GetDaysSinceOnsetOfSymptoms(), hourOfRelease(key, hourOfSubmission),
+		)
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				return 0, err
+			}
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				return 0, err
+			}
+			return 0, err
+		}
+		imported += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return imported, nil
+}
+
+func parseFederationCursor(cursor string) (uint32, []byte, error) {
+	if cursor == "" {
+		return 0, []byte{}, nil
+	}
+	parts := strings.SplitN(cursor, ":", 2)
+	if len(parts) != 2 {
+		return 0, nil, ErrInvalidFederationCursor
+	}
+	hour, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, nil, ErrInvalidFederationCursor
+	}
+	keyData, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return 0, nil, ErrInvalidFederationCursor
+	}
+	return uint32(hour), keyData, nil
+}
+
+func formatFederationCursor(hour uint32, keyData []byte) string {
+	return fmt.Sprintf("%d:%x", hour, keyData)
+}
+
+func federationKeys(db *sql.DB, region, cursor string, endHour uint32, currentRSIN int32, limit int) (*FederationPage, error) {
+	hour, keyData, err := parseFederationCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	minRollingStartIntervalNumber := timemath.RollingStartIntervalNumberPlusDays(currentRSIN, -14)
+
+	// One more than the limit, to tell whether there are more
+	rows, err := db.Query(
+		`SELECT hour_of_submission, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms FROM diagnosis_keys
+		WHERE region = ?
+		AND origin_region IS NULL
+		AND rolling_start_interval_number > ?
+		AND hour_of_submission < ?
+		AND (hour_of_submission > ? OR (hour_of_submission = ? AND key_data > ?))
+		ORDER BY hour_of_submission, key_data
+		LIMIT ?`,
+		region, minRollingStartIntervalNumber, endHour, hour, hour, keyData, limit+1,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &FederationPage{}
+	for rows.Next() {
+		if len(page.Keys) == limit {
+			page.More = true
+			break
+		}
+
+		var key []byte
+		var rollingStartIntervalNumber int32
+		var rollingPeriod int32
+		var transmissionRiskLevel int32
+		var reportType int32
+		var onsetDays int32
+		if err := rows.Scan(&hour, &key, &rollingStartIntervalNumber, &rollingPeriod, &transmissionRiskLevel, &reportType, &onsetDays); err != nil {
+			return nil, err
+		}
+		keyData = key
+
+		page.Keys = append(page.Keys, &pb.TemporaryExposureKey{
+			KeyData:                    key,
+			TransmissionRiskLevel:      &transmissionRiskLevel,
+			RollingStartIntervalNumber: &rollingStartIntervalNumber,
+			RollingPeriod:              &rollingPeriod,
+			ReportType:                 pb.TemporaryExposureKey_ReportType(reportType).Enum(),
+			DaysSinceOnsetOfSymptoms:   &onsetDays,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Keys) == 0 && hour < endHour {
+		// Nothing new, but every hour before endHour is done with
+		hour, keyData = endHour, []byte{}
+	}
+	page.NextCursor = formatFederationCursor(hour, keyData)
+	return page, nil
+}
@@ -0,0 +1,158 @@
+package persistence
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/stretchr/testify/assert"
+)
+
+const insertImportedKey = `
+		INSERT IGNORE INTO diagnosis_keys
+		(region, origin_region, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+func TestImportKeys(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	keys := []*pb.TemporaryExposureKey{
+		randomTestKey(),
+		randomTestKey(),
+	}
+
+	// Duplicates aren't counted
+	mock.ExpectBegin()
+	prepare := mock.ExpectPrepare(insertImportedKey)
+	for i, key := range keys {
+		prepare.ExpectExec().WithArgs(
+			"302", "310", key.GetKeyData(), key.GetRollingStartIntervalNumber(), key.GetRollingPeriod(),
+			key.GetTransmissionRiskLevel(), int32(pb.TemporaryExposureKey_CONFIRMED_TEST), key.GetDaysSinceOnsetOfSymptoms(), uint32(445129),
+		).WillReturnResult(sqlmock.NewResult(int64(i), int64(1-i)))
+	}
+	mock.ExpectCommit()
+
+	imported, err := importKeys(db, "302", "310", keys, 445129)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), imported)
+
+	// Rolls back if an insert fails
+	mock.ExpectBegin()
+	mock.ExpectPrepare(insertImportedKey).ExpectExec().WillReturnError(fmt.Errorf("error"))
+	mock.ExpectRollback()
+
+	_, err = importKeys(db, "302", "310", keys, 445129)
+	assert.Equal(t, fmt.Errorf("error"), err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFederationCursor(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	conn := conn{
+		db: db,
+	}
+
+	query := `SELECT sync_cursor FROM federation_syncs WHERE peer = ?`
+
+	// No sync yet
+	mock.ExpectQuery(query).WithArgs("ny").WillReturnError(sql.ErrNoRows)
+	cursor, err := conn.FederationCursor("ny")
+	assert.Nil(t, err)
+	assert.Equal(t, "", cursor)
+
+	mock.ExpectQuery(query).WithArgs("ny").WillReturnRows(sqlmock.NewRows([]string{"sync_cursor"}).AddRow("18500:2"))
+	cursor, err = conn.FederationCursor("ny")
+	assert.Nil(t, err)
+	assert.Equal(t, "18500:2", cursor)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFederationSyncFailure(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(allQueryMatcher))
+	defer db.Close()
+
+	conn := conn{
+		db: db,
+	}
+
+	// Long errors are truncated
+	msg := strings.Repeat("x", maxFederationErrorLength+10)
+	mock.ExpectExec(`INSERT INTO federation_syncs`).WithArgs("ny", msg[:maxFederationErrorLength]).WillReturnResult(sqlmock.NewResult(1, 1))
+	assert.Nil(t, conn.FederationSyncFailure("ny", errors.New(msg)))
+
+	mock.ExpectExec(`INSERT INTO federation_syncs`).WithArgs("ny", "18500:2").WillReturnResult(sqlmock.NewResult(1, 1))
+	assert.Nil(t, conn.FederationSyncSuccess("ny", "18500:2"))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestParseFederationCursor(t *testing.T) {
+	hour, keyData, err := parseFederationCursor("")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), hour)
+	assert.Equal(t, []byte{}, keyData)
+
+	hour, keyData, err = parseFederationCursor(formatFederationCursor(445129, []byte{0xab, 0xcd}))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(445129), hour)
+	assert.Equal(t, []byte{0xab, 0xcd}, keyData)
+
+	for _, cursor := range []string{"445129", "hour:abcd", "445129:xyz", "-1:ab"} {
+		_, _, err = parseFederationCursor(cursor)
+		assert.Equal(t, ErrInvalidFederationCursor, err, cursor)
+	}
+}
+
+func TestFederationKeys(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(allQueryMatcher))
+	defer db.Close()
+
+	currentRSIN := int32(2651450)
+	minRSIN := currentRSIN - 144*14
+	columns := []string{"hour_of_submission", "key_data", "rolling_start_interval_number", "rolling_period", "transmission_risk_level", "report_type", "days_since_onset_of_symptoms"}
+
+	// One past the limit means there's more
+	rows := sqlmock.NewRows(columns).
+		AddRow(445120, []byte{0x01}, 2651300, 144, 2, 1, 0).
+		AddRow(445121, []byte{0x02}, 2651300, 144, 2, 1, 0).
+		AddRow(445121, []byte{0x03}, 2651300, 144, 2, 1, 0)
+	mock.ExpectQuery(`SELECT hour_of_submission`).WithArgs("302", minRSIN, uint32(445130), uint32(445119), uint32(445119), []byte{0xff}, 3).WillReturnRows(rows)
+
+	page, err := federationKeys(db, "302", "445119:ff", 445130, currentRSIN, 2)
+	assert.Nil(t, err)
+	assert.Len(t, page.Keys, 2)
+	assert.Equal(t, []byte{0x02}, page.Keys[1].GetKeyData())
+	assert.Equal(t, "445121:02", page.NextCursor)
+	assert.True(t, page.More)
+
+	// Nothing new moves the cursor up to endHour
+	mock.ExpectQuery(`SELECT hour_of_submission`).WithArgs("302", minRSIN, uint32(445130), uint32(445121), uint32(445121), []byte{0x02}, 3).WillReturnRows(sqlmock.NewRows(columns))
+
+	page, err = federationKeys(db, "302", "445121:02", 445130, currentRSIN, 2)
+	assert.Nil(t, err)
+	assert.Len(t, page.Keys, 0)
+	assert.Equal(t, "445130:", page.NextCursor)
+	assert.False(t, page.More)
+
+	_, err = federationKeys(db, "302", "nonsense", 445130, currentRSIN, 2)
+	assert.Equal(t, ErrInvalidFederationCursor, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
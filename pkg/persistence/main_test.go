@@ -26,6 +26,11 @@ func TestMain(m *testing.M)  {
 	config.InitConfig()
 	SetupLookup(keyclaim.NewAuthenticator())
 
+	os.Setenv("REVISION_HMAC_KEY", strings.Repeat("c", 64))
+	if err := SetupRevisionKey(); err != nil {
+		panic(err)
+	}
+
 	os.Exit(m.Run())
 }
 
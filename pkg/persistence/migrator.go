@@ -172,6 +172,105 @@ CREATE TABLE IF NOT EXISTS qr_outbreak_events (
 		statements: []string{
 			`ALTER TABLE qr_outbreak_events ALTER severity SET DEFAULT 0`,
 		},
+	}, {
+		id: "14",
+		statements: []string{
+			`ALTER TABLE diagnosis_keys ADD COLUMN report_type SMALLINT UNSIGNED NOT NULL DEFAULT 1`,
+			`ALTER TABLE diagnosis_keys ADD COLUMN days_since_onset_of_symptoms SMALLINT NOT NULL DEFAULT 0`,
+		},
+	}, {
+		id: "15",
+		statements: []string{
+			`ALTER TABLE encryption_keys ADD COLUMN symptom_onset_date DATE NULL`,
+			`ALTER TABLE encryption_keys ADD COLUMN test_date DATE NULL`,
+		},
+	}, {
+		id: "16",
+		statements: []string{
+			`ALTER TABLE encryption_keys ADD COLUMN one_time_code_hash BINARY(32) NULL`,
+			`ALTER TABLE encryption_keys ADD INDEX (one_time_code_hash)`,
+			`ALTER TABLE diagnosis_keys ADD COLUMN one_time_code_hash BINARY(32) NULL`,
+			`ALTER TABLE diagnosis_keys ADD COLUMN hash_id_hash BINARY(32) NULL`,
+			`ALTER TABLE diagnosis_keys ADD INDEX (one_time_code_hash)`,
+			`ALTER TABLE diagnosis_keys ADD INDEX (hash_id_hash)`,
+			`
+CREATE TABLE IF NOT EXISTS diagnosis_key_revisions (
+	id                            BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	key_data                      BINARY(16) NOT NULL,
+	region                        VARCHAR(32) NOT NULL,
+	originator                    VARCHAR(64) NOT NULL,
+	rolling_start_interval_number INT NOT NULL,
+	rolling_period                INT NOT NULL,
+	transmission_risk_level       SMALLINT UNSIGNED NOT NULL,
+	report_type                   SMALLINT UNSIGNED NOT NULL,
+	days_since_onset_of_symptoms  SMALLINT NOT NULL,
+	hour_of_revision              INT UNSIGNED NOT NULL,
+	created                       TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+	INDEX (key_data, region),
+	INDEX (region),
+	INDEX (hour_of_revision),
+	INDEX (rolling_start_interval_number)
+)`,
+		},
+	}, {
+		id: "17",
+		statements: []string{
+			// Every outbreak event recorded so far was Canadian
+			`ALTER TABLE qr_outbreak_events ADD COLUMN region VARCHAR(32) NOT NULL DEFAULT '302'`,
+			`ALTER TABLE qr_outbreak_events ADD INDEX (region)`,
+		},
+	}, {
+		id: "18",
+		statements: []string{
+			// NULL for keys uploaded here, the peer's region for imported keys
+			`ALTER TABLE diagnosis_keys ADD COLUMN origin_region VARCHAR(32) NULL`,
+			`ALTER TABLE diagnosis_keys ADD INDEX (origin_region)`,
+			`
+CREATE TABLE IF NOT EXISTS federation_syncs (
+	peer          VARCHAR(64)   NOT NULL PRIMARY KEY,
+	sync_cursor   VARCHAR(255)  NOT NULL DEFAULT '',
+	last_sync     TIMESTAMP     NULL,
+	failures      INT UNSIGNED  NOT NULL DEFAULT 0,
+	last_failure  TIMESTAMP     NULL,
+	last_error    VARCHAR(1024) NULL
+)`,
+		},
+	}, {
+		id: "19",
+		statements: []string{`
+CREATE TABLE IF NOT EXISTS verification_certificates (
+	certificate_hash BINARY(32)  NOT NULL PRIMARY KEY,
+	originator       VARCHAR(64) NOT NULL,
+	created          TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	INDEX (created)
+)`,
+		},
+	}, {
+		id: "20",
+		statements: []string{
+			// Room for longer configured one-time code formats
+			`ALTER TABLE encryption_keys MODIFY one_time_code VARCHAR(32)`,
+		},
+	}, {
+		id: "21",
+		statements: []string{`
+CREATE TABLE IF NOT EXISTS one_time_code_usage (
+	originator VARCHAR(64)  NOT NULL,
+	minute     DATETIME     NOT NULL,
+	count      INT UNSIGNED NOT NULL,
+
+	PRIMARY KEY (originator, minute),
+	INDEX (minute)
+)`,
+		},
+	}, {
+		id: "22",
+		statements: []string{
+			// Room for IPv6 addresses
+			`ALTER TABLE failed_key_claim_attempts MODIFY identifier VARCHAR(64) NOT NULL`,
+		},
 	},
 }
 
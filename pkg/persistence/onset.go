@@ -0,0 +1,75 @@
+package persistence
+
+import (
+	"database/sql"
+	"time"
+
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+)
+
+// OnsetDates optionally anchors a one-time code to the date the patient's
+// symptoms began and the date they were tested. Either may be nil. When both
+// are set, the symptom onset date takes precedence.
+type OnsetDates struct {
+	SymptomOnset *time.Time
+	Test         *time.Time
+}
+
+const onsetDateFormat = "2006-01-02"
+
+// dateOrNull formats a date for a DATE column, or returns nil so the column is
+// stored as NULL.
+func dateOrNull(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(onsetDateFormat)
+}
+
+// onsetAnchor picks the date that uploaded keys are measured against.
+func onsetAnchor(symptomOnset, test sql.NullTime) (time.Time, bool) {
+	if symptomOnset.Valid {
+		return symptomOnset.Time, true
+	}
+	if test.Valid {
+		return test.Time, true
+	}
+	return time.Time{}, false
+}
+
+// daysSinceOnset returns the number of days between the anchor date and the
+// day the key became active, clamped to the range the exposure notification
+// framework accepts.
+func daysSinceOnset(key *pb.TemporaryExposureKey, anchor time.Time) int32 {
+	keyDay := int64(key.GetRollingStartIntervalNumber()) * 600 / 86400
+	anchorDay := anchor.UTC().Unix() / 86400
+
+	days := keyDay - anchorDay
+	if days > maxDaysSinceOnsetOfSymptoms {
+		return maxDaysSinceOnsetOfSymptoms
+	}
+	if days < -maxDaysSinceOnsetOfSymptoms {
+		return -maxDaysSinceOnsetOfSymptoms
+	}
+	return int32(days)
+}
+
+// transmissionRiskForDaysSinceOnset maps days since onset to a transmission
+// risk level. Infectiousness peaks from two days before to three days after
+// symptoms begin, and falls off on either side.
+func transmissionRiskForDaysSinceOnset(days int32) int32 {
+	switch {
+	case days < -4:
+		return 1
+	case days < -2:
+		return 3
+	case days <= 3:
+		return 8
+	case days <= 6:
+		return 6
+	case days <= 9:
+		return 3
+	default:
+		return 1
+	}
+}
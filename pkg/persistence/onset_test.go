@@ -0,0 +1,53 @@
+package persistence
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDateOrNull(t *testing.T) {
+	assert.Nil(t, dateOrNull(nil))
+
+	date := time.Date(2020, 10, 15, 23, 0, 0, 0, time.UTC)
+	assert.Equal(t, "2020-10-15", dateOrNull(&date))
+}
+
+func TestOnsetAnchor(t *testing.T) {
+	onset := time.Date(2020, 10, 10, 0, 0, 0, 0, time.UTC)
+	test := time.Date(2020, 10, 12, 0, 0, 0, 0, time.UTC)
+
+	_, ok := onsetAnchor(sql.NullTime{}, sql.NullTime{})
+	assert.False(t, ok, "no anchor without dates")
+
+	anchor, ok := onsetAnchor(sql.NullTime{}, sql.NullTime{Time: test, Valid: true})
+	assert.True(t, ok)
+	assert.Equal(t, test, anchor, "falls back to the test date")
+
+	anchor, ok = onsetAnchor(sql.NullTime{Time: onset, Valid: true}, sql.NullTime{Time: test, Valid: true})
+	assert.True(t, ok)
+	assert.Equal(t, onset, anchor, "prefers the symptom onset date")
+}
+
+func TestDaysSinceOnset(t *testing.T) {
+	// 2651450 is on day 18412
+	key := randomTestKey()
+
+	assert.Equal(t, int32(0), daysSinceOnset(key, time.Unix(18412*86400, 0)))
+	assert.Equal(t, int32(3), daysSinceOnset(key, time.Unix(18409*86400, 0)))
+	assert.Equal(t, int32(-2), daysSinceOnset(key, time.Unix(18414*86400, 0)))
+	assert.Equal(t, int32(14), daysSinceOnset(key, time.Unix(18312*86400, 0)), "clamped to 14")
+	assert.Equal(t, int32(-14), daysSinceOnset(key, time.Unix(18512*86400, 0)), "clamped to -14")
+}
+
+func TestTransmissionRiskForDaysSinceOnset(t *testing.T) {
+	expected := map[int32]int32{
+		-14: 1, -5: 1, -4: 3, -3: 3, -2: 8, 0: 8, 3: 8,
+		4: 6, 6: 6, 7: 3, 9: 3, 10: 1, 14: 1,
+	}
+	for days, risk := range expected {
+		assert.Equal(t, risk, transmissionRiskForDaysSinceOnset(days), "days since onset %d", days)
+	}
+}
@@ -39,6 +39,10 @@ func deleteOldDiagnosisKeys(db *sql.DB) (int64, error) {
 		return 0, err
 	}
 
+	if _, err := db.Exec(`DELETE FROM diagnosis_key_revisions WHERE hour_of_revision < ?`, oldestHour); err != nil {
+		return 0, err
+	}
+
 	return res.RowsAffected()
 }
 
@@ -223,6 +227,7 @@ func claimKey(db *sql.DB, oneTimeCode string, appPublicKey []byte, ctx context.C
 	s, err := tx.Prepare(`
 		UPDATE encryption_keys
 		SET one_time_code = NULL,
+			one_time_code_hash = ?,
 			app_public_key = ?,
 			created = ?
 		WHERE one_time_code = ?
@@ -236,7 +241,7 @@ func claimKey(db *sql.DB, oneTimeCode string, appPublicKey []byte, ctx context.C
 		return nil, err
 	}
 
-	res, err := s.Exec(appPublicKey, created, oneTimeCode, config.AppConstants.OneTimeCodeExpiryInMinutes)
+	res, err := s.Exec(hashOneTimeCode(oneTimeCode), appPublicKey, created, oneTimeCode, config.AppConstants.OneTimeCodeExpiryInMinutes)
 	if err != nil {
 		if err := tx.Rollback(); err != nil {
 			return nil, err
@@ -296,22 +301,24 @@ func claimKey(db *sql.DB, oneTimeCode string, appPublicKey []byte, ctx context.C
 	return serverPub, nil
 }
 
-func persistEncryptionKey(db *sql.DB, region, originator string, pub *[32]byte, priv *[32]byte, oneTimeCode string) error {
+func persistEncryptionKey(db *sql.DB, region, originator string, pub *[32]byte, priv *[32]byte, oneTimeCode string, dates OnsetDates) error {
 	_, err := db.Exec(
 		`INSERT INTO encryption_keys
-			(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-			VALUES (?, ?, ?, ?, ?, ?)`,
+			(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
 		region, originator, priv[:], pub[:], oneTimeCode, config.AppConstants.InitialRemainingKeys,
+		dateOrNull(dates.SymptomOnset), dateOrNull(dates.Test),
 	)
 	return err
 }
 
-func persistEncryptionKeyWithHashID(db *sql.DB, region, originator, hashID string, pub *[32]byte, priv *[32]byte, oneTimeCode string) error {
+func persistEncryptionKeyWithHashID(db *sql.DB, region, originator, hashID string, pub *[32]byte, priv *[32]byte, oneTimeCode string, dates OnsetDates) error {
 	_, err := db.Exec(
 		`INSERT INTO encryption_keys
-			(region, originator, hash_id, server_private_key, server_public_key, one_time_code, remaining_keys)
-			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			(region, originator, hash_id, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		region, originator, hashID, priv[:], pub[:], oneTimeCode, config.AppConstants.InitialRemainingKeys,
+		dateOrNull(dates.SymptomOnset), dateOrNull(dates.Test),
 	)
 	if err == nil {
 		return err
@@ -334,12 +341,12 @@ func persistEncryptionKeyWithHashID(db *sql.DB, region, originator, hashID strin
 	return err
 }
 
-func persistOutbreakEvent(db *sql.DB, originator string, submission *pb.OutbreakEvent) error {
+func persistOutbreakEvent(db *sql.DB, region, originator string, submission *pb.OutbreakEvent) error {
 	_, err := db.Exec(
 		`INSERT INTO qr_outbreak_events
-			(location_id, originator, start_time, end_time, severity)
-			VALUES (?, ?, ?, ?, ?)`,
-		submission.GetLocationId(), originator, submission.GetStartTime().Seconds, submission.GetEndTime().Seconds, submission.GetSeverity(),
+			(location_id, region, originator, start_time, end_time, severity)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+		submission.GetLocationId(), region, originator, submission.GetStartTime().Seconds, submission.GetEndTime().Seconds, submission.GetSeverity(),
 	)
 	return err
 }
@@ -359,29 +366,34 @@ func privForPub(db *sql.DB, pub []byte) *sql.Row {
 // Return keys that were SUBMITTED to the Diagnosis Server during the specified
 // UTC date.
 //
-// Only return keys that correspond to a Key valid for a date less than 14 days ago.
-func diagnosisKeysForHours(db *sql.DB, region string, startHour uint32, endHour uint32, currentRollingStartIntervalNumber int32) (*sql.Rows, error) {
+// Only return keys that correspond to a Key valid for a date less than 14 days
+// ago, and that expired before currentInterval. Keys are stored in the hour
+// they're released in (see hourOfRelease), so this only leaves out keys if the
+// clock or the embargo margin has gone backwards.
+func diagnosisKeysForHours(db *sql.DB, region string, startHour uint32, endHour uint32, currentRollingStartIntervalNumber int32, currentInterval int32) (*sql.Rows, error) {
 	minRollingStartIntervalNumber := timemath.RollingStartIntervalNumberPlusDays(currentRollingStartIntervalNumber, -14)
 
 	return db.Query(
-		`SELECT region, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level FROM diagnosis_keys
+		`SELECT region, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission FROM diagnosis_keys
 		WHERE hour_of_submission >= ?
 		AND hour_of_submission < ?
 		AND rolling_start_interval_number > ?
+		AND rolling_start_interval_number + rolling_period <= ?
 		AND region = ?
 		ORDER BY key_data
 		`, // don't implicitly order by insertion date: for privacy
-		startHour, endHour, minRollingStartIntervalNumber, region,
+		startHour, endHour, minRollingStartIntervalNumber, currentInterval, region,
 	)
 }
 
-func outbreakEventsForTimeRange(db *sql.DB, startTime time.Time, endTime time.Time) (*sql.Rows, error) {
+func outbreakEventsForTimeRange(db *sql.DB, region string, startTime time.Time, endTime time.Time) (*sql.Rows, error) {
 	return db.Query(
 		`SELECT location_id, start_time, end_time, severity FROM qr_outbreak_events
 		WHERE created >= ?
 		AND created < ?
+		AND region = ?
 		ORDER BY location_id
-		`, startTime, endTime,
+		`, startTime, endTime, region,
 	)
 }
 
@@ -394,7 +406,10 @@ func registerDiagnosisKeys(db *sql.DB, appPubKey *[32]byte, keys []*pb.Temporary
 	var region string
 	var originator string
 	var remainingKeys int64
-	if err := tx.QueryRow("SELECT region, originator, remaining_keys FROM encryption_keys WHERE app_public_key = ? FOR UPDATE", appPubKey[:]).Scan(&region, &originator, &remainingKeys); err != nil {
+	var symptomOnsetDate, testDate sql.NullTime
+	var oneTimeCodeHash []byte
+	var hashID sql.NullString
+	if err := tx.QueryRow("SELECT region, originator, remaining_keys, symptom_onset_date, test_date, one_time_code_hash, hash_id FROM encryption_keys WHERE app_public_key = ? FOR UPDATE", appPubKey[:]).Scan(&region, &originator, &remainingKeys, &symptomOnsetDate, &testDate, &oneTimeCodeHash, &hashID); err != nil {
 		if err := tx.Rollback(); err != nil {
 			return err
 		}
@@ -410,8 +425,8 @@ func registerDiagnosisKeys(db *sql.DB, appPubKey *[32]byte, keys []*pb.Temporary
 
 	s, err := tx.Prepare(`
 		INSERT IGNORE INTO diagnosis_keys
-		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, hour_of_submission)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission, one_time_code_hash, hash_id_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 	)
 	if err != nil {
 		if err := tx.Rollback(); err != nil {
@@ -420,12 +435,34 @@ func registerDiagnosisKeys(db *sql.DB, appPubKey *[32]byte, keys []*pb.Temporary
 		return err
 	}
 
+	// The hash ID itself isn't kept with the keys, so they can't be tied back
+	// to the patient it identifies.
+	var hashIDHash []byte
+	if hashID.Valid {
+		hashIDHash = hashHashID(hashID.String)
+	}
+
 	hourOfSubmission := timemath.HourNumber(time.Now())
 
+	// When the health authority told us when symptoms began (or when the test
+	// was taken), that overrides whatever the app guessed for each key.
+	anchor, hasAnchor := onsetAnchor(symptomOnsetDate, testDate)
+
+	// Keys held back until they expire still use up remaining_keys now
 	var keysInserted int64
 
 	for _, key := range keys {
-		result, err := s.Exec(region, originator, key.GetKeyData(), key.GetRollingStartIntervalNumber(), key.GetRollingPeriod(), key.GetTransmissionRiskLevel(), hourOfSubmission)
+		transmissionRisk := key.GetTransmissionRiskLevel()
+		onsetDays := key.GetDaysSinceOnsetOfSymptoms()
+		if hasAnchor {
+			onsetDays = daysSinceOnset(key, anchor)
+			transmissionRisk = transmissionRiskForDaysSinceOnset(onsetDays)
+		}
+
+		result, err := s.Exec(
+			region, originator, key.GetKeyData(), key.GetRollingStartIntervalNumber(), key.GetRollingPeriod(),
+			transmissionRisk, int32(reportTypeOf(key)), onsetDays, hourOfRelease(key, hourOfSubmission), oneTimeCodeHash, hashIDHash,
+		)
 		if err != nil {
 			if err := tx.Rollback(); err != nil {
 				return err
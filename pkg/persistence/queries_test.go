@@ -24,6 +24,7 @@ func TestDeleteOldDiagnosisKeys(t *testing.T) {
 	oldestHour := timemath.HourNumberAtStartOfDate(oldestDateNumber)
 
 	mock.ExpectExec(`DELETE FROM diagnosis_keys WHERE hour_of_submission < ?`).WithArgs(oldestHour).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`DELETE FROM diagnosis_key_revisions WHERE hour_of_revision < ?`).WithArgs(oldestHour).WillReturnResult(sqlmock.NewResult(1, 1))
 	deleteOldDiagnosisKeys(db)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -93,6 +94,7 @@ func TestClaimKey(t *testing.T) {
 
 	query := `UPDATE encryption_keys
 		SET one_time_code = NULL,
+			one_time_code_hash = ?,
 			app_public_key = ?,
 			created = ?
 		WHERE one_time_code = ?
@@ -124,6 +126,7 @@ func TestClaimKey(t *testing.T) {
 	mock.ExpectPrepare(query).
 		ExpectExec().
 		WithArgs(
+			hashOneTimeCode(oneTimeCode),
 			pub[:],
 			created,
 			oneTimeCode,
@@ -155,6 +158,7 @@ func TestClaimKey(t *testing.T) {
 	mock.ExpectPrepare(query).
 		ExpectExec().
 		WithArgs(
+			hashOneTimeCode(oneTimeCode),
 			pub[:],
 			created,
 			oneTimeCode,
@@ -186,6 +190,7 @@ func TestClaimKey(t *testing.T) {
 	mock.ExpectPrepare(query).
 		ExpectExec().
 		WithArgs(
+			hashOneTimeCode(oneTimeCode),
 			pub[:],
 			created,
 			oneTimeCode,
@@ -219,6 +224,7 @@ func TestClaimKey(t *testing.T) {
 	mock.ExpectPrepare(query).
 		ExpectExec().
 		WithArgs(
+			hashOneTimeCode(oneTimeCode),
 			pub[:],
 			created,
 			oneTimeCode,
@@ -258,17 +264,19 @@ func TestPersistEncryptionKey(t *testing.T) {
 	// Return error
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		priv[:],
 		pub[:],
 		oneTimeCode,
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnError(fmt.Errorf("error"))
 
-	receivedErr := persistEncryptionKey(db, region, originator, pub, priv, oneTimeCode)
+	receivedErr := persistEncryptionKey(db, region, originator, pub, priv, oneTimeCode, OnsetDates{})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -280,17 +288,19 @@ func TestPersistEncryptionKey(t *testing.T) {
 	// Success
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		priv[:],
 		pub[:],
 		oneTimeCode,
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 
-	receivedResult := persistEncryptionKey(db, region, originator, pub, priv, oneTimeCode)
+	receivedResult := persistEncryptionKey(db, region, originator, pub, priv, oneTimeCode, OnsetDates{})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -313,8 +323,8 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 	// Return error if unknown error
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		hashID,
@@ -322,9 +332,11 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 		pub[:],
 		oneTimeCode,
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnError(fmt.Errorf("error"))
 
-	receivedErr := persistEncryptionKeyWithHashID(db, region, originator, hashID, pub, priv, oneTimeCode)
+	receivedErr := persistEncryptionKeyWithHashID(db, region, originator, hashID, pub, priv, oneTimeCode, OnsetDates{})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -336,8 +348,8 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 	// Return error if duplicate one_time_code
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		hashID,
@@ -345,9 +357,11 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 		pub[:],
 		oneTimeCode,
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnError(fmt.Errorf("for key 'one_time_code"))
 
-	receivedErr = persistEncryptionKeyWithHashID(db, region, originator, hashID, pub, priv, oneTimeCode)
+	receivedErr = persistEncryptionKeyWithHashID(db, region, originator, hashID, pub, priv, oneTimeCode, OnsetDates{})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -359,8 +373,8 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 	// Return error if duplicate used hashID found
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		hashID,
@@ -368,13 +382,15 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 		pub[:],
 		oneTimeCode,
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnError(fmt.Errorf("for key 'hash_id"))
 
 	rows := sqlmock.NewRows([]string{"one_time_code"}).AddRow(nil)
 	mock.ExpectQuery(
 		`SELECT one_time_code FROM encryption_keys WHERE hash_id = ? FOR UPDATE`).WithArgs(hashID).WillReturnRows(rows)
 
-	receivedErr = persistEncryptionKeyWithHashID(db, region, originator, hashID, pub, priv, oneTimeCode)
+	receivedErr = persistEncryptionKeyWithHashID(db, region, originator, hashID, pub, priv, oneTimeCode, OnsetDates{})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -386,8 +402,8 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 	// Return error if duplicate un-used hashID found but delete fails
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		hashID,
@@ -395,6 +411,8 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 		pub[:],
 		oneTimeCode,
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnError(fmt.Errorf("for key 'for key 'hash_id"))
 
 	rows = sqlmock.NewRows([]string{"one_time_code"}).AddRow(oneTimeCode)
@@ -402,7 +420,7 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 		`SELECT one_time_code FROM encryption_keys WHERE hash_id = ? FOR UPDATE`).WithArgs(hashID).WillReturnRows(rows)
 	mock.ExpectExec(`DELETE FROM encryption_keys WHERE hash_id = ? AND one_time_code IS NOT NULL`).WithArgs(hashID).WillReturnError(fmt.Errorf("error"))
 
-	receivedErr = persistEncryptionKeyWithHashID(db, region, originator, hashID, pub, priv, oneTimeCode)
+	receivedErr = persistEncryptionKeyWithHashID(db, region, originator, hashID, pub, priv, oneTimeCode, OnsetDates{})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -414,8 +432,8 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 	// Return error if duplicate un-used hashID found and delete passes (regenerates OTC)
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		hashID,
@@ -423,6 +441,8 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 		pub[:],
 		oneTimeCode,
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnError(fmt.Errorf("for key 'for key 'hash_id"))
 
 	rows = sqlmock.NewRows([]string{"one_time_code"}).AddRow(oneTimeCode)
@@ -430,7 +450,7 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 		`SELECT one_time_code FROM encryption_keys WHERE hash_id = ? FOR UPDATE`).WithArgs(hashID).WillReturnRows(rows)
 	mock.ExpectExec(`DELETE FROM encryption_keys WHERE hash_id = ? AND one_time_code IS NOT NULL`).WithArgs(hashID).WillReturnResult(sqlmock.NewResult(1, 1))
 
-	receivedErr = persistEncryptionKeyWithHashID(db, region, originator, hashID, pub, priv, oneTimeCode)
+	receivedErr = persistEncryptionKeyWithHashID(db, region, originator, hashID, pub, priv, oneTimeCode, OnsetDates{})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -442,8 +462,8 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 	// Success
 	mock.ExpectExec(
 		`INSERT INTO encryption_keys
-		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys)
-		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, server_private_key, server_public_key, one_time_code, remaining_keys, symptom_onset_date, test_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 		region,
 		originator,
 		hashID,
@@ -451,9 +471,11 @@ func testPersistEncryptionKeyWithHashID(t *testing.T) {
 		pub[:],
 		oneTimeCode,
 		config.AppConstants.InitialRemainingKeys,
+		nil,
+		nil,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 
-	receivedResult := persistEncryptionKeyWithHashID(db, region, originator, hashID, pub, priv, oneTimeCode)
+	receivedResult := persistEncryptionKeyWithHashID(db, region, originator, hashID, pub, priv, oneTimeCode, OnsetDates{})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -477,16 +499,17 @@ func TestPersistOutbreakEvent(t *testing.T) {
 
 	mock.ExpectExec(
 		`INSERT INTO qr_outbreak_events
-		(location_id, originator, start_time, end_time, severity)
-		VALUES (?, ?, ?, ?, ?)`).WithArgs(
+		(location_id, region, originator, start_time, end_time, severity)
+		VALUES (?, ?, ?, ?, ?, ?)`).WithArgs(
 		submission.GetLocationId(),
+		"302",
 		originator,
 		submission.GetStartTime().Seconds,
 		submission.GetEndTime().Seconds,
 		submission.GetSeverity(),
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 
-	receivedResult := persistOutbreakEvent(db, originator, &submission)
+	receivedResult := persistOutbreakEvent(db, "302", originator, &submission)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -531,28 +554,31 @@ func TestDiagnosisKeysForHours(t *testing.T) {
 	startHour := uint32(100)
 	endHour := uint32(200)
 	currentRollingStartIntervalNumber := int32(2651450)
+	currentInterval := currentRollingStartIntervalNumber + 100
 	minRollingStartIntervalNumber := timemath.RollingStartIntervalNumberPlusDays(currentRollingStartIntervalNumber, -14)
 
 	query := `
-	SELECT region, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level FROM diagnosis_keys
+	SELECT region, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission FROM diagnosis_keys
 		WHERE hour_of_submission >= ?
 		AND hour_of_submission < ?
 		AND rolling_start_interval_number > ?
+		AND rolling_start_interval_number + rolling_period <= ?
 		AND region = ?
 		ORDER BY key_data`
 
-	row := sqlmock.NewRows([]string{"region", "key_data", "rolling_start_interval_number", "rolling_period", "transmission_risk_level"}).AddRow("302", []byte{}, 2651450, 144, 4)
+	row := sqlmock.NewRows([]string{"region", "key_data", "rolling_start_interval_number", "rolling_period", "transmission_risk_level", "report_type", "days_since_onset_of_symptoms", "hour_of_submission"}).AddRow("302", []byte{}, 2651450, 144, 4, 1, 0, 150)
 	mock.ExpectQuery(query).WithArgs(
 		startHour,
 		endHour,
 		minRollingStartIntervalNumber,
+		currentInterval,
 		region).WillReturnRows(row)
 
 	expectedResult := []byte("302")
-	rows, _ := diagnosisKeysForHours(db, region, startHour, endHour, currentRollingStartIntervalNumber)
+	rows, _ := diagnosisKeysForHours(db, region, startHour, endHour, currentRollingStartIntervalNumber, currentInterval)
 	var receivedResult []byte
 	for rows.Next() {
-		rows.Scan(&receivedResult, nil, nil, nil, nil)
+		rows.Scan(&receivedResult, nil, nil, nil, nil, nil, nil, nil)
 	}
 
 	assert.Equal(t, expectedResult, receivedResult, "Expected rows for the query")
@@ -574,16 +600,18 @@ func TestOutbreakEventsForTimeRange(t *testing.T) {
 	query := `SELECT location_id, start_time, end_time, severity FROM qr_outbreak_events
 	WHERE created >= ?
 	AND created < ?
+	AND region = ?
 	ORDER BY location_id
 	`
 
 	row := sqlmock.NewRows([]string{"location_id", "start_time", "end_time", "severity"}).AddRow(locationID, startTime, endTime, severity)
 	mock.ExpectQuery(query).WithArgs(
 		startTime,
-		endTime).WillReturnRows(row)
+		endTime,
+		"302").WillReturnRows(row)
 
 	expectedResult := locationID
-	rows, _ := outbreakEventsForTimeRange(db, startTime, endTime)
+	rows, _ := outbreakEventsForTimeRange(db, "302", startTime, endTime)
 	var receivedResult string
 	for rows.Next() {
 		rows.Scan(&receivedResult, nil, nil, nil)
@@ -607,7 +635,7 @@ func TestRegisterDiagnosisKeys(t *testing.T) {
 
 	// Roll back if table is locked
 	mock.ExpectBegin()
-	mock.ExpectQuery(`SELECT region, originator, remaining_keys FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WithArgs(pub[:]).WillReturnError(fmt.Errorf("error"))
+	mock.ExpectQuery(`SELECT region, originator, remaining_keys, symptom_onset_date, test_date, one_time_code_hash, hash_id FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WithArgs(pub[:]).WillReturnError(fmt.Errorf("error"))
 	mock.ExpectRollback()
 	receivedErr := registerDiagnosisKeys(db, pub, keys, nil)
 
@@ -620,8 +648,8 @@ func TestRegisterDiagnosisKeys(t *testing.T) {
 
 	// Roll back if 0 keys are left and return error
 	mock.ExpectBegin()
-	row := sqlmock.NewRows([]string{"region", "originator", "remaining_keys"}).AddRow(region, originator, 0)
-	mock.ExpectQuery(`SELECT region, originator, remaining_keys FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
+	row := sqlmock.NewRows([]string{"region", "originator", "remaining_keys", "symptom_onset_date", "test_date", "one_time_code_hash", "hash_id"}).AddRow(region, originator, 0, nil, nil, nil, nil)
+	mock.ExpectQuery(`SELECT region, originator, remaining_keys, symptom_onset_date, test_date, one_time_code_hash, hash_id FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
 	mock.ExpectRollback()
 	receivedErr = registerDiagnosisKeys(db, pub, keys, nil)
 
@@ -634,12 +662,12 @@ func TestRegisterDiagnosisKeys(t *testing.T) {
 
 	// Roll back if prepare fails
 	mock.ExpectBegin()
-	row = sqlmock.NewRows([]string{"region", "originator", "remaining_keys"}).AddRow("302", "randomOrigin", 1)
-	mock.ExpectQuery(`SELECT region, originator, remaining_keys FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
+	row = sqlmock.NewRows([]string{"region", "originator", "remaining_keys", "symptom_onset_date", "test_date", "one_time_code_hash", "hash_id"}).AddRow("302", "randomOrigin", 1, nil, nil, nil, nil)
+	mock.ExpectQuery(`SELECT region, originator, remaining_keys, symptom_onset_date, test_date, one_time_code_hash, hash_id FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
 	mock.ExpectPrepare(
 		`INSERT IGNORE INTO diagnosis_keys
-		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, hour_of_submission)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission, one_time_code_hash, hash_id_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 	).WillReturnError(fmt.Errorf("error"))
 
 	mock.ExpectRollback()
@@ -659,12 +687,12 @@ func TestRegisterDiagnosisKeys(t *testing.T) {
 	hourOfSubmission := timemath.HourNumber(time.Now())
 
 	mock.ExpectBegin()
-	row = sqlmock.NewRows([]string{"region", "originator", "remaining_keys"}).AddRow("302", "randomOrigin", 1)
-	mock.ExpectQuery(`SELECT region, originator, remaining_keys FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
+	row = sqlmock.NewRows([]string{"region", "originator", "remaining_keys", "symptom_onset_date", "test_date", "one_time_code_hash", "hash_id"}).AddRow("302", "randomOrigin", 1, nil, nil, nil, nil)
+	mock.ExpectQuery(`SELECT region, originator, remaining_keys, symptom_onset_date, test_date, one_time_code_hash, hash_id FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
 	mock.ExpectPrepare(
 		`INSERT IGNORE INTO diagnosis_keys
-		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, hour_of_submission)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission, one_time_code_hash, hash_id_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 	).ExpectExec().WithArgs(
 		region,
 		originator,
@@ -672,7 +700,11 @@ func TestRegisterDiagnosisKeys(t *testing.T) {
 		key.GetRollingStartIntervalNumber(),
 		key.GetRollingPeriod(),
 		key.GetTransmissionRiskLevel(),
+		int32(pb.TemporaryExposureKey_CONFIRMED_TEST),
+		int32(0),
 		hourOfSubmission,
+		[]byte(nil),
+		[]byte(nil),
 	).WillReturnError(fmt.Errorf("error"))
 
 	mock.ExpectRollback()
@@ -685,7 +717,8 @@ func TestRegisterDiagnosisKeys(t *testing.T) {
 	expectedErr = fmt.Errorf("error")
 	assert.Equal(t, expectedErr, receivedErr, "Expected error if execute insert fails")
 
-	// Rolls back if more keys are inserted that are allowed
+	// Rolls back if more keys are inserted that are allowed, keyed by
+	// an HMAC of the hash ID rather than the hash ID itself
 	keyOne := randomTestKey()
 	keyTwo := randomTestKey()
 	keys = []*pb.TemporaryExposureKey{keyOne, keyTwo}
@@ -693,26 +726,30 @@ func TestRegisterDiagnosisKeys(t *testing.T) {
 	hourOfSubmission = timemath.HourNumber(time.Now())
 
 	mock.ExpectBegin()
-	row = sqlmock.NewRows([]string{"region", "originator", "remaining_keys"}).AddRow("302", "randomOrigin", 1)
-	mock.ExpectQuery(`SELECT region, originator, remaining_keys FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
+	row = sqlmock.NewRows([]string{"region", "originator", "remaining_keys", "symptom_onset_date", "test_date", "one_time_code_hash", "hash_id"}).AddRow("302", "randomOrigin", 1, nil, nil, nil, "abcd")
+	mock.ExpectQuery(`SELECT region, originator, remaining_keys, symptom_onset_date, test_date, one_time_code_hash, hash_id FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
 
 	mock.ExpectPrepare(
 		`INSERT IGNORE INTO diagnosis_keys
-		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, hour_of_submission)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission, one_time_code_hash, hash_id_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 	)
 
 	for _, key := range keys {
 		mock.ExpectExec(`INSERT IGNORE INTO diagnosis_keys
-		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, hour_of_submission)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission, one_time_code_hash, hash_id_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 			region,
 			originator,
 			key.GetKeyData(),
 			key.GetRollingStartIntervalNumber(),
 			key.GetRollingPeriod(),
 			key.GetTransmissionRiskLevel(),
+			int32(pb.TemporaryExposureKey_CONFIRMED_TEST),
+			int32(0),
 			hourOfSubmission,
+			[]byte(nil),
+			hashHashID("abcd"),
 		).WillReturnResult(sqlmock.NewResult(1, 1))
 	}
 
@@ -734,26 +771,30 @@ func TestRegisterDiagnosisKeys(t *testing.T) {
 	hourOfSubmission = timemath.HourNumber(time.Now())
 
 	mock.ExpectBegin()
-	row = sqlmock.NewRows([]string{"region", "originator", "remaining_keys"}).AddRow("302", "randomOrigin", 3)
-	mock.ExpectQuery(`SELECT region, originator, remaining_keys FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
+	row = sqlmock.NewRows([]string{"region", "originator", "remaining_keys", "symptom_onset_date", "test_date", "one_time_code_hash", "hash_id"}).AddRow("302", "randomOrigin", 3, nil, nil, nil, nil)
+	mock.ExpectQuery(`SELECT region, originator, remaining_keys, symptom_onset_date, test_date, one_time_code_hash, hash_id FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
 
 	mock.ExpectPrepare(
 		`INSERT IGNORE INTO diagnosis_keys
-		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, hour_of_submission)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission, one_time_code_hash, hash_id_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 	)
 
 	for _, key := range keys {
 		mock.ExpectExec(`INSERT IGNORE INTO diagnosis_keys
-		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, hour_of_submission)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission, one_time_code_hash, hash_id_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 			region,
 			originator,
 			key.GetKeyData(),
 			key.GetRollingStartIntervalNumber(),
 			key.GetRollingPeriod(),
 			key.GetTransmissionRiskLevel(),
+			int32(pb.TemporaryExposureKey_CONFIRMED_TEST),
+			int32(0),
 			hourOfSubmission,
+			[]byte(nil),
+			[]byte(nil),
 		).WillReturnResult(sqlmock.NewResult(1, 1))
 	}
 
@@ -797,26 +838,30 @@ func TestRegisterDiagnosisKeys(t *testing.T) {
 	hourOfSubmission = timemath.HourNumber(time.Now())
 
 	mock.ExpectBegin()
-	row = sqlmock.NewRows([]string{"region", "originator", "remaining_keys"}).AddRow("302", "randomOrigin", config.AppConstants.InitialRemainingKeys)
-	mock.ExpectQuery(`SELECT region, originator, remaining_keys FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
+	row = sqlmock.NewRows([]string{"region", "originator", "remaining_keys", "symptom_onset_date", "test_date", "one_time_code_hash", "hash_id"}).AddRow("302", "randomOrigin", config.AppConstants.InitialRemainingKeys, nil, nil, nil, nil)
+	mock.ExpectQuery(`SELECT region, originator, remaining_keys, symptom_onset_date, test_date, one_time_code_hash, hash_id FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
 
 	mock.ExpectPrepare(
 		`INSERT IGNORE INTO diagnosis_keys
-		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, hour_of_submission)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission, one_time_code_hash, hash_id_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 	)
 
 	for _, key := range keys {
 		mock.ExpectExec(`INSERT IGNORE INTO diagnosis_keys
-		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, hour_of_submission)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`).WithArgs(
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission, one_time_code_hash, hash_id_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`).WithArgs(
 			region,
 			originator,
 			key.GetKeyData(),
 			key.GetRollingStartIntervalNumber(),
 			key.GetRollingPeriod(),
 			key.GetTransmissionRiskLevel(),
+			int32(pb.TemporaryExposureKey_CONFIRMED_TEST),
+			int32(0),
 			hourOfSubmission,
+			[]byte(nil),
+			[]byte(nil),
 		).WillReturnResult(sqlmock.NewResult(1, 1))
 	}
 
@@ -852,6 +897,64 @@ func TestRegisterDiagnosisKeys(t *testing.T) {
 	assert.Nil(t, receivedResult, "Expected nil when keys are commited")
 }
 
+func TestRegisterDiagnosisKeysWithOnsetDate(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	pub, _, _ := box.GenerateKey(rand.Reader)
+	key := randomTestKey()
+	keys := []*pb.TemporaryExposureKey{key}
+
+	// randomTestKey is active on day 18412, two days after the test date
+	testDate := time.Unix(18410*86400, 0).UTC()
+
+	hourOfSubmission := timemath.HourNumber(time.Now())
+
+	mock.ExpectBegin()
+	row := sqlmock.NewRows([]string{"region", "originator", "remaining_keys", "symptom_onset_date", "test_date", "one_time_code_hash", "hash_id"}).AddRow("302", "randomOrigin", config.AppConstants.InitialRemainingKeys, nil, testDate, nil, nil)
+	mock.ExpectQuery(`SELECT region, originator, remaining_keys, symptom_onset_date, test_date, one_time_code_hash, hash_id FROM encryption_keys WHERE app_public_key = ? FOR UPDATE`).WillReturnRows(row)
+
+	mock.ExpectPrepare(
+		`INSERT IGNORE INTO diagnosis_keys
+		(region, originator, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_submission, one_time_code_hash, hash_id_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	).ExpectExec().WithArgs(
+		"302",
+		"randomOrigin",
+		key.GetKeyData(),
+		key.GetRollingStartIntervalNumber(),
+		key.GetRollingPeriod(),
+		int32(8),
+		int32(pb.TemporaryExposureKey_CONFIRMED_TEST),
+		int32(2),
+		hourOfSubmission,
+		[]byte(nil),
+		[]byte(nil),
+	).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectExec(
+		`INSERT INTO tek_upload_count
+		(originator, date, count, first_upload)
+		VALUES (?, ?, ?, ?)`,
+	).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectExec(
+		`UPDATE encryption_keys
+	SET remaining_keys = remaining_keys - ?
+	WHERE remaining_keys >= ?
+	AND app_public_key = ?`,
+	).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectCommit()
+	receivedResult := registerDiagnosisKeys(db, pub, keys, nil)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	assert.Nil(t, receivedResult, "Expected nil when keys are commited")
+}
+
 func TestCheckClaimKeyBan(t *testing.T) {
 	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	defer db.Close()
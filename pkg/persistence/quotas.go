@@ -0,0 +1,206 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+)
+
+// ErrQuotaExceeded is returned when an originator has generated as many
+// one-time codes as its quota allows for the minute or the day.
+var ErrQuotaExceeded = errors.New("one-time code quota exceeded")
+
+// QuotaUsage is how many one-time codes an originator has generated this
+// minute and today (UTC), and its quotas for each.
+type QuotaUsage struct {
+	Originator     string `json:"originator"`
+	Minute         int    `json:"minute"`
+	Day            int    `json:"day"`
+	PerMinuteQuota int    `json:"per_minute_quota"`
+	PerDayQuota    int    `json:"per_day_quota"`
+}
+
+// UseOneTimeCodeQuota counts count codes against the quota of the originator
+// the bearer token belongs to. If that would take it over quota, nothing is
+// counted, an OTKQuotaExceeded event is saved and ErrQuotaExceeded returned.
+func (c *conn) UseOneTimeCodeQuota(ctx context.Context, originator string, count int) error {
+	err := useOneTimeCodeQuota(c.db, quotaOriginator(originator), count, time.Now())
+	if err == ErrQuotaExceeded {
+		c.saveQuotaExceededEvent(ctx, originator)
+	}
+	return err
+}
+
+// RefundOneTimeCodeQuota gives back count codes counted by
+// UseOneTimeCodeQuota that weren't generated after all.
+func (c *conn) RefundOneTimeCodeQuota(ctx context.Context, originator string, count int) error {
+	return refundOneTimeCodeQuota(c.db, quotaOriginator(originator), count, time.Now())
+}
+
+// OneTimeCodeUsage returns the usage of every originator that has generated
+// codes today.
+func (c *conn) OneTimeCodeUsage() ([]QuotaUsage, error) {
+	return oneTimeCodeUsage(c.db, time.Now())
+}
+
+// DeleteOldOneTimeCodeUsage forgets usage from before today, which no longer
+// counts towards any quota.
+func (c *conn) DeleteOldOneTimeCodeUsage() (int64, error) {
+	return deleteOldOneTimeCodeUsage(c.db, time.Now())
+}
+
+// quotaOriginator returns the name KEY_CLAIM_TOKEN gives the token, so that
+// all of an originator's tokens share its quota, and tokens aren't stored.
+func quotaOriginator(token string) string {
+	if name, ok := originatorLookup.Authenticate(token); ok {
+		return name
+	}
+	return translateTokenForLogs(token)
+}
+
+// quotaFor returns an originator's quota: its own, if it has one, or else the
+// default.
+func quotaFor(name string) config.OneTimeCodeQuota {
+	// Viper lower-cases map keys
+	if quota, ok := config.AppConstants.OneTimeCodeQuotas[strings.ToLower(name)]; ok {
+		return quota
+	}
+	return config.AppConstants.OneTimeCodeQuota
+}
+
+func overQuota(quota config.OneTimeCodeQuota, minute, day int) bool {
+	return (quota.PerMinute > 0 && minute > quota.PerMinute) || (quota.PerDay > 0 && day > quota.PerDay)
+}
+
+func usageWindows(now time.Time) (minute, day time.Time) {
+	now = now.UTC()
+	return now.Truncate(time.Minute), time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func useOneTimeCodeQuota(db *sql.DB, name string, count int, now time.Time) error {
+	minute, day := usageWindows(now)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Locks the originator's row for the minute, so concurrent requests are
+	// counted one after the other.
+	if _, err := tx.Exec(`
+		INSERT INTO one_time_code_usage (originator, minute, count) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE count = count + ?`,
+		name, minute, count, count,
+	); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return err
+		}
+		return err
+	}
+
+	var minuteUsage, dayUsage int
+	if err := tx.QueryRow(`
+		SELECT COALESCE(SUM(IF(minute = ?, count, 0)), 0), COALESCE(SUM(count), 0)
+		FROM one_time_code_usage WHERE originator = ? AND minute >= ?`,
+		minute, name, day,
+	).Scan(&minuteUsage, &dayUsage); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return err
+		}
+		return err
+	}
+
+	if overQuota(quotaFor(name), minuteUsage, dayUsage) {
+		if err := tx.Rollback(); err != nil {
+			return err
+		}
+		return ErrQuotaExceeded
+	}
+
+	return tx.Commit()
+}
+
+// refundOneTimeCodeQuota takes count off the originator's latest usage
+// today, which is the minute the codes were counted in unless another request
+// has been counted since. The day's total comes out right either way.
+func refundOneTimeCodeQuota(db *sql.DB, name string, count int, now time.Time) error {
+	_, day := usageWindows(now)
+
+	_, err := db.Exec(`
+		UPDATE one_time_code_usage SET count = count - LEAST(count, ?)
+		WHERE originator = ? AND minute >= ?
+		ORDER BY minute DESC LIMIT 1`,
+		count, name, day,
+	)
+	return err
+}
+
+func (c *conn) saveQuotaExceededEvent(ctx context.Context, originator string) {
+	event := Event{
+		Originator: originator,
+		DeviceType: Server,
+		Identifier: OTKQuotaExceeded,
+		Date:       time.Now(),
+		Count:      1,
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		LogEvent(ctx, err, event)
+		return
+	}
+
+	if err := saveEvent(tx, event); err != nil {
+		LogEvent(ctx, err, event)
+		_ = tx.Rollback()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		LogEvent(ctx, err, event)
+	}
+}
+
+func oneTimeCodeUsage(db *sql.DB, now time.Time) ([]QuotaUsage, error) {
+	minute, day := usageWindows(now)
+
+	rows, err := db.Query(`
+		SELECT originator, COALESCE(SUM(IF(minute = ?, count, 0)), 0), COALESCE(SUM(count), 0)
+		FROM one_time_code_usage WHERE minute >= ?
+		GROUP BY originator ORDER BY originator`,
+		minute, day,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make([]QuotaUsage, 0)
+	for rows.Next() {
+		var u QuotaUsage
+		if err := rows.Scan(&u.Originator, &u.Minute, &u.Day); err != nil {
+			return nil, err
+		}
+		quota := quotaFor(u.Originator)
+		u.PerMinuteQuota, u.PerDayQuota = quota.PerMinute, quota.PerDay
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func deleteOldOneTimeCodeUsage(db *sql.DB, now time.Time) (int64, error) {
+	_, day := usageWindows(now)
+
+	res, err := db.Exec(`DELETE FROM one_time_code_usage WHERE minute < ?`, day)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,184 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const insertOneTimeCodeUsage = `
+		INSERT INTO one_time_code_usage (originator, minute, count) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE count = count + ?`
+
+const selectOneTimeCodeUsage = `
+		SELECT COALESCE(SUM(IF(minute = ?, count, 0)), 0), COALESCE(SUM(count), 0)
+		FROM one_time_code_usage WHERE originator = ? AND minute >= ?`
+
+func withQuotas(quota config.OneTimeCodeQuota, quotas map[string]config.OneTimeCodeQuota) func() {
+	oldQuota, oldQuotas := config.AppConstants.OneTimeCodeQuota, config.AppConstants.OneTimeCodeQuotas
+	config.AppConstants.OneTimeCodeQuota, config.AppConstants.OneTimeCodeQuotas = quota, quotas
+	return func() {
+		config.AppConstants.OneTimeCodeQuota, config.AppConstants.OneTimeCodeQuotas = oldQuota, oldQuotas
+	}
+}
+
+func TestQuotaFor(t *testing.T) {
+	defer withQuotas(
+		config.OneTimeCodeQuota{PerMinute: 10, PerDay: 100},
+		map[string]config.OneTimeCodeQuota{"onapi": {PerMinute: 50, PerDay: 500}},
+	)()
+
+	assert.Equal(t, config.OneTimeCodeQuota{PerMinute: 50, PerDay: 500}, quotaFor("ONApi"))
+	assert.Equal(t, config.OneTimeCodeQuota{PerMinute: 10, PerDay: 100}, quotaFor("302"))
+
+	assert.Equal(t, "ONApi", quotaOriginator(token1))
+	assert.Equal(t, "302", quotaOriginator(token2))
+}
+
+func TestOverQuota(t *testing.T) {
+	quota := config.OneTimeCodeQuota{PerMinute: 10, PerDay: 100}
+
+	assert.False(t, overQuota(quota, 10, 100))
+	assert.True(t, overQuota(quota, 11, 11))
+	assert.True(t, overQuota(quota, 1, 101))
+
+	// Zero means no limit
+	assert.False(t, overQuota(config.OneTimeCodeQuota{}, 1000, 100000))
+	assert.True(t, overQuota(config.OneTimeCodeQuota{PerDay: 100}, 1000, 1000))
+}
+
+func TestUsageWindows(t *testing.T) {
+	now := time.Date(2020, 10, 15, 23, 12, 34, 0, time.FixedZone("EDT", -4*60*60))
+
+	minute, day := usageWindows(now)
+	assert.Equal(t, time.Date(2020, 10, 16, 3, 12, 0, 0, time.UTC), minute)
+	assert.Equal(t, time.Date(2020, 10, 16, 0, 0, 0, 0, time.UTC), day)
+}
+
+func TestUseOneTimeCodeQuota(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	defer withQuotas(config.OneTimeCodeQuota{PerMinute: 10, PerDay: 100}, nil)()
+
+	now := time.Date(2020, 10, 16, 3, 12, 34, 0, time.UTC)
+	minute, day := usageWindows(now)
+
+	// Under quota
+	mock.ExpectBegin()
+	mock.ExpectExec(insertOneTimeCodeUsage).WithArgs("ONApi", minute, 3, 3).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(selectOneTimeCodeUsage).WithArgs(minute, "ONApi", day).WillReturnRows(sqlmock.NewRows([]string{"minute", "day"}).AddRow(10, 100))
+	mock.ExpectCommit()
+
+	assert.Nil(t, useOneTimeCodeQuota(db, "ONApi", 3, now))
+
+	// Over quota, so nothing is counted
+	mock.ExpectBegin()
+	mock.ExpectExec(insertOneTimeCodeUsage).WithArgs("ONApi", minute, 1, 1).WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectQuery(selectOneTimeCodeUsage).WithArgs(minute, "ONApi", day).WillReturnRows(sqlmock.NewRows([]string{"minute", "day"}).AddRow(1, 101))
+	mock.ExpectRollback()
+
+	assert.Equal(t, ErrQuotaExceeded, useOneTimeCodeQuota(db, "ONApi", 1, now))
+
+	// Database errors
+	mock.ExpectBegin()
+	mock.ExpectExec(insertOneTimeCodeUsage).WithArgs("ONApi", minute, 1, 1).WillReturnError(fmt.Errorf("error"))
+	mock.ExpectRollback()
+
+	assert.Equal(t, fmt.Errorf("error"), useOneTimeCodeQuota(db, "ONApi", 1, now))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUseOneTimeCodeQuota_Event(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	defer withQuotas(config.OneTimeCodeQuota{PerMinute: 1}, nil)()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(insertOneTimeCodeUsage).WithArgs("ONApi", sqlmock.AnyArg(), 2, 2).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(selectOneTimeCodeUsage).WithArgs(sqlmock.AnyArg(), "ONApi", sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"minute", "day"}).AddRow(2, 2))
+	mock.ExpectRollback()
+
+	mock.ExpectBegin()
+	setupSaveEventMock(mock, Event{Originator: onApi, DeviceType: Server, Identifier: OTKQuotaExceeded, Count: 1})
+	mock.ExpectCommit()
+
+	c := conn{db: db}
+	assert.Equal(t, ErrQuotaExceeded, c.UseOneTimeCodeQuota(context.Background(), token1, 2))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRefundOneTimeCodeQuota(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	now := time.Date(2020, 10, 16, 3, 12, 34, 0, time.UTC)
+	_, day := usageWindows(now)
+
+	mock.ExpectExec(`
+		UPDATE one_time_code_usage SET count = count - LEAST(count, ?)
+		WHERE originator = ? AND minute >= ?
+		ORDER BY minute DESC LIMIT 1`).WithArgs(3, "ONApi", day).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.Nil(t, refundOneTimeCodeQuota(db, "ONApi", 3, now))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestOneTimeCodeUsage(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+	defer withQuotas(
+		config.OneTimeCodeQuota{PerMinute: 10, PerDay: 100},
+		map[string]config.OneTimeCodeQuota{"onapi": {PerMinute: 50, PerDay: 500}},
+	)()
+
+	now := time.Date(2020, 10, 16, 3, 12, 34, 0, time.UTC)
+	minute, day := usageWindows(now)
+
+	mock.ExpectQuery(`
+		SELECT originator, COALESCE(SUM(IF(minute = ?, count, 0)), 0), COALESCE(SUM(count), 0)
+		FROM one_time_code_usage WHERE minute >= ?
+		GROUP BY originator ORDER BY originator`).WithArgs(minute, day).WillReturnRows(
+		sqlmock.NewRows([]string{"originator", "minute", "day"}).AddRow("302", 0, 7).AddRow("ONApi", 2, 40),
+	)
+
+	usage, err := oneTimeCodeUsage(db, now)
+	assert.Nil(t, err)
+	assert.Equal(t, []QuotaUsage{
+		{Originator: "302", Minute: 0, Day: 7, PerMinuteQuota: 10, PerDayQuota: 100},
+		{Originator: "ONApi", Minute: 2, Day: 40, PerMinuteQuota: 50, PerDayQuota: 500},
+	}, usage)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteOldOneTimeCodeUsage(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	now := time.Date(2020, 10, 16, 3, 12, 34, 0, time.UTC)
+	mock.ExpectExec(`DELETE FROM one_time_code_usage WHERE minute < ?`).WithArgs(time.Date(2020, 10, 16, 0, 0, 0, 0, time.UTC)).WillReturnResult(sqlmock.NewResult(0, 3))
+
+	deleted, err := deleteOldOneTimeCodeUsage(db, now)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), deleted)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,252 @@
+package persistence
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/timemath"
+)
+
+// ErrNoKeysToRevise is returned when no keys were uploaded with the given
+// one-time code or hashID by the requesting originator.
+var ErrNoKeysToRevise = errors.New("no keys found to revise")
+
+// ErrInvalidRevision is returned when keys can't be revised to the requested
+// report type.
+var ErrInvalidRevision = errors.New("invalid report type for revision")
+
+// revisionKey keys the hashes uploaded keys are found by for revision. One-time
+// codes and hash IDs are short enough to brute force, so a plain hash of
+// either would tie published keys back to them.
+var revisionKey []byte
+
+// SetupRevisionKey loads the revision key from REVISION_HMAC_KEY.
+func SetupRevisionKey() error {
+	secretHex := os.Getenv("REVISION_HMAC_KEY")
+	if len(secretHex) < hex.EncodedLen(config.AppConstants.HmacKeyLength) {
+		return errors.New("REVISION_HMAC_KEY missing or too short")
+	}
+	key, err := hex.DecodeString(secretHex)
+	if err != nil {
+		return fmt.Errorf("REVISION_HMAC_KEY is not hex encoded: %w", err)
+	}
+	revisionKey = key
+	return nil
+}
+
+// revisionHash is the HMAC of value, with the kind of value it is so a code
+// and a hash ID that happen to be equal don't hash the same.
+func revisionHash(kind, value string) []byte {
+	mac := hmac.New(sha256.New, revisionKey)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// hashOneTimeCode lets us find the keys uploaded with a code after the code
+// itself has been cleared on claim.
+func hashOneTimeCode(oneTimeCode string) []byte {
+	return revisionHash("one_time_code", oneTimeCode)
+}
+
+// hashHashID lets us find the keys uploaded under a hash ID without storing
+// the hash ID alongside them.
+func hashHashID(hashID string) []byte {
+	return revisionHash("hash_id", hashID)
+}
+
+// validRevision reports whether uploaded keys may be revised to reportType.
+func validRevision(reportType pb.TemporaryExposureKey_ReportType) bool {
+	switch reportType {
+	case pb.TemporaryExposureKey_CONFIRMED_TEST,
+		pb.TemporaryExposureKey_CONFIRMED_CLINICAL_DIAGNOSIS,
+		pb.TemporaryExposureKey_REVOKED:
+		return true
+	}
+	return false
+}
+
+// ReviseKeys records a new report type for every key that originator
+// uploaded under the given one-time code or hashID, and returns how many keys
+// were revised. Keys that already have that report type, and keys that have
+// been revoked, are left alone.
+func (c *conn) ReviseKeys(originator, oneTimeCode, hashID string, reportType pb.TemporaryExposureKey_ReportType) (int64, error) {
+	if !validRevision(reportType) {
+		return 0, ErrInvalidRevision
+	}
+	return reviseKeys(c.db, originator, oneTimeCode, hashID, reportType)
+}
+
+// FetchRevisedKeysForHours returns keys that were revised during the specified
+// hours, with their revised report type, by the hour they were revised in.
+func (c *conn) FetchRevisedKeysForHours(region string, startHour uint32, endHour uint32, currentRSIN int32) (map[uint32][]*pb.TemporaryExposureKey, error) {
+	rows, err := revisedKeysForHours(c.db, region, startHour, endHour, currentRSIN)
+	if err != nil {
+		return nil, err
+	}
+	return handleKeysRows(rows)
+}
+
+func reviseKeys(db *sql.DB, originator, oneTimeCode, hashID string, reportType pb.TemporaryExposureKey_ReportType) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var rows *sql.Rows
+	if hashID != "" {
+		rows, err = tx.Query(`
+			SELECT region, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms FROM diagnosis_keys
+			WHERE originator = ?
+			AND hash_id_hash = ?
+			FOR UPDATE`,
+			originator, hashHashID(hashID),
+		)
+	} else {
+		rows, err = tx.Query(`
+			SELECT region, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms FROM diagnosis_keys
+			WHERE originator = ?
+			AND one_time_code_hash = ?
+			FOR UPDATE`,
+			originator, hashOneTimeCode(oneTimeCode),
+		)
+	}
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			return 0, err
+		}
+		return 0, err
+	}
+
+	keys, regions, err := scanKeysToRevise(rows)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			return 0, err
+		}
+		return 0, err
+	}
+
+	if len(keys) == 0 {
+		if err := tx.Rollback(); err != nil {
+			return 0, err
+		}
+		return 0, ErrNoKeysToRevise
+	}
+
+	// A revision of a key that's still held back would publish it early, so
+	// it's held back as well.
+	hourOfRevision := timemath.HourNumber(time.Now())
+
+	var revised int64
+	for i, key := range keys {
+		region := regions[i]
+		current := key.GetReportType()
+
+		var latest int32
+		err := tx.QueryRow(`
+			SELECT report_type FROM diagnosis_key_revisions
+			WHERE key_data = ?
+			AND region = ?
+			ORDER BY id DESC
+			LIMIT 1`,
+			key.GetKeyData(), region,
+		).Scan(&latest)
+		if err == nil {
+			current = pb.TemporaryExposureKey_ReportType(latest)
+		} else if err != sql.ErrNoRows {
+			if err := tx.Rollback(); err != nil {
+				return 0, err
+			}
+			return 0, err
+		}
+
+		if current == reportType || current == pb.TemporaryExposureKey_REVOKED {
+			continue
+		}
+
+		if _, err := tx.Exec(`
+			INSERT INTO diagnosis_key_revisions
+			(key_data, region, originator, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_revision)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			key.GetKeyData(), region, originator, key.GetRollingStartIntervalNumber(), key.GetRollingPeriod(),
+			key.GetTransmissionRiskLevel(), int32(reportType), key.GetDaysSinceOnsetOfSymptoms(), hourOfRelease(key, hourOfRevision),
+		); err != nil {
+			if err := tx.Rollback(); err != nil {
+				return 0, err
+			}
+			return 0, err
+		}
+		revised++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return revised, nil
+}
+
+// scanKeysToRevise reads keys along with the region each was uploaded to, which
+// the revision has to be recorded against.
+func scanKeysToRevise(rows *sql.Rows) ([]*pb.TemporaryExposureKey, []string, error) {
+	defer rows.Close()
+
+	var keys []*pb.TemporaryExposureKey
+	var regions []string
+
+	for rows.Next() {
+		var region string
+		var reportType int32
+		key := &pb.TemporaryExposureKey{
+			TransmissionRiskLevel:      new(int32),
+			RollingStartIntervalNumber: new(int32),
+			RollingPeriod:              new(int32),
+			DaysSinceOnsetOfSymptoms:   new(int32),
+		}
+		err := rows.Scan(
+			&region, &key.KeyData, key.RollingStartIntervalNumber, key.RollingPeriod,
+			key.TransmissionRiskLevel, &reportType, key.DaysSinceOnsetOfSymptoms,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		key.ReportType = pb.TemporaryExposureKey_ReportType(reportType).Enum()
+
+		keys = append(keys, key)
+		regions = append(regions, region)
+	}
+	return keys, regions, rows.Err()
+}
+
+// Return keys that were REVISED during the specified hours. As with
+// diagnosisKeysForHours, keys that are no longer valid are left out. A key
+// revised more than once in an hour only appears with its latest revision;
+// retrieval.RevisedKeysForHours does the same across hours.
+func revisedKeysForHours(db *sql.DB, region string, startHour uint32, endHour uint32, currentRollingStartIntervalNumber int32) (*sql.Rows, error) {
+	minRollingStartIntervalNumber := timemath.RollingStartIntervalNumberPlusDays(currentRollingStartIntervalNumber, -14)
+
+	return db.Query(
+		`SELECT region, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_revision FROM diagnosis_key_revisions
+		WHERE hour_of_revision >= ?
+		AND hour_of_revision < ?
+		AND rolling_start_interval_number > ?
+		AND region = ?
+		AND id IN (
+			SELECT MAX(id) FROM diagnosis_key_revisions
+			WHERE hour_of_revision >= ?
+			AND hour_of_revision < ?
+			GROUP BY key_data, region, hour_of_revision
+		)
+		ORDER BY key_data
+		`,
+		startHour, endHour, minRollingStartIntervalNumber, region, startHour, endHour,
+	)
+}
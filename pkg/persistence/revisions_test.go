@@ -0,0 +1,220 @@
+package persistence
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/timemath"
+	"github.com/stretchr/testify/assert"
+)
+
+var keyToReviseColumns = []string{"region", "key_data", "rolling_start_interval_number", "rolling_period", "transmission_risk_level", "report_type", "days_since_onset_of_symptoms"}
+
+const selectKeysToReviseByOneTimeCode = `
+	SELECT region, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms FROM diagnosis_keys
+	WHERE originator = ?
+	AND one_time_code_hash = ?
+	FOR UPDATE`
+
+const selectLatestRevision = `
+	SELECT report_type FROM diagnosis_key_revisions
+	WHERE key_data = ?
+	AND region = ?
+	ORDER BY id DESC
+	LIMIT 1`
+
+const insertRevision = `
+	INSERT INTO diagnosis_key_revisions
+	(key_data, region, originator, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_revision)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+func TestSetupRevisionKey(t *testing.T) {
+	key := revisionKey
+	defer func() {
+		revisionKey = key
+		os.Setenv("REVISION_HMAC_KEY", strings.Repeat("c", 64))
+	}()
+
+	os.Setenv("REVISION_HMAC_KEY", strings.Repeat("c", 62))
+	assert.EqualError(t, SetupRevisionKey(), "REVISION_HMAC_KEY missing or too short")
+
+	os.Setenv("REVISION_HMAC_KEY", strings.Repeat("z", 64))
+	assert.Contains(t, SetupRevisionKey().Error(), "REVISION_HMAC_KEY is not hex encoded")
+
+	os.Setenv("REVISION_HMAC_KEY", strings.Repeat("d", 64))
+	assert.Nil(t, SetupRevisionKey())
+	assert.Equal(t, []byte(strings.Repeat("\xdd", 32)), revisionKey)
+}
+
+func TestHashOneTimeCode(t *testing.T) {
+	mac := hmac.New(sha256.New, revisionKey)
+	mac.Write([]byte("one_time_code\x00AAABBBCCCC"))
+	assert.Equal(t, mac.Sum(nil), hashOneTimeCode("AAABBBCCCC"))
+
+	// Not a plain hash, which could be reversed by trying every code
+	plain := sha256.Sum256([]byte("AAABBBCCCC"))
+	assert.NotEqual(t, plain[:], hashOneTimeCode("AAABBBCCCC"))
+
+	assert.NotEqual(t, hashOneTimeCode("AAABBBCCCC"), hashHashID("AAABBBCCCC"))
+	assert.Len(t, hashHashID("abcd"), sha256.Size)
+}
+
+func TestValidRevision(t *testing.T) {
+	assert.True(t, validRevision(pb.TemporaryExposureKey_REVOKED))
+	assert.True(t, validRevision(pb.TemporaryExposureKey_CONFIRMED_TEST))
+	assert.True(t, validRevision(pb.TemporaryExposureKey_CONFIRMED_CLINICAL_DIAGNOSIS))
+	assert.False(t, validRevision(pb.TemporaryExposureKey_SELF_REPORT))
+	assert.False(t, validRevision(pb.TemporaryExposureKey_RECURSIVE))
+	assert.False(t, validRevision(pb.TemporaryExposureKey_UNKNOWN))
+}
+
+func TestDBReviseKeysInvalidRevision(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(allQueryMatcher))
+	defer db.Close()
+
+	conn := conn{
+		db: db,
+	}
+
+	_, err := conn.ReviseKeys("originator", "AAABBBCCCC", "", pb.TemporaryExposureKey_SELF_REPORT)
+	assert.Equal(t, ErrInvalidRevision, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReviseKeys(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	originator := "randomOrigin"
+	oneTimeCode := "AAABBBCCCC"
+	otcHash := hashOneTimeCode(oneTimeCode)
+
+	// Rolls back if the select fails
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectKeysToReviseByOneTimeCode).WithArgs(originator, otcHash).WillReturnError(fmt.Errorf("error"))
+	mock.ExpectRollback()
+
+	_, err := reviseKeys(db, originator, oneTimeCode, "", pb.TemporaryExposureKey_REVOKED)
+	assert.Equal(t, fmt.Errorf("error"), err)
+
+	// Rolls back when there are no keys for the code
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectKeysToReviseByOneTimeCode).WithArgs(originator, otcHash).WillReturnRows(sqlmock.NewRows(keyToReviseColumns))
+	mock.ExpectRollback()
+
+	_, err = reviseKeys(db, originator, oneTimeCode, "", pb.TemporaryExposureKey_REVOKED)
+	assert.Equal(t, ErrNoKeysToRevise, err)
+
+	// Looks up keys by hashID when one is given
+	hashID := "abcd"
+	mock.ExpectBegin()
+	mock.ExpectQuery(`
+		SELECT region, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms FROM diagnosis_keys
+		WHERE originator = ?
+		AND hash_id_hash = ?
+		FOR UPDATE`).WithArgs(originator, hashHashID(hashID)).WillReturnRows(sqlmock.NewRows(keyToReviseColumns))
+	mock.ExpectRollback()
+
+	_, err = reviseKeys(db, originator, "", hashID, pb.TemporaryExposureKey_REVOKED)
+	assert.Equal(t, ErrNoKeysToRevise, err)
+
+	// Revises keys, skipping ones that are already revoked or already have the report type
+	fresh := []byte("fresh-key-000000")
+	revoked := []byte("revoked-key-0000")
+	same := []byte("same-type-key-00")
+
+	rows := sqlmock.NewRows(keyToReviseColumns).
+		AddRow("302", fresh, 2651450, 144, 4, int32(pb.TemporaryExposureKey_CONFIRMED_TEST), 1).
+		AddRow("302", revoked, 2651450, 144, 4, int32(pb.TemporaryExposureKey_CONFIRMED_TEST), 1).
+		AddRow("302", same, 2651450, 144, 4, int32(pb.TemporaryExposureKey_REVOKED), 1)
+
+	hourOfRevision := timemath.HourNumber(time.Now())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectKeysToReviseByOneTimeCode).WithArgs(originator, otcHash).WillReturnRows(rows)
+
+	mock.ExpectQuery(selectLatestRevision).WithArgs(fresh, "302").WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(insertRevision).WithArgs(
+		fresh, "302", originator, int32(2651450), int32(144), int32(4), int32(pb.TemporaryExposureKey_REVOKED), int32(1), hourOfRevision,
+	).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectQuery(selectLatestRevision).WithArgs(revoked, "302").WillReturnRows(
+		sqlmock.NewRows([]string{"report_type"}).AddRow(int32(pb.TemporaryExposureKey_REVOKED)),
+	)
+
+	mock.ExpectQuery(selectLatestRevision).WithArgs(same, "302").WillReturnError(sql.ErrNoRows)
+
+	mock.ExpectCommit()
+
+	revised, err := reviseKeys(db, originator, oneTimeCode, "", pb.TemporaryExposureKey_REVOKED)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), revised)
+
+	// Rolls back if the insert fails
+	rows = sqlmock.NewRows(keyToReviseColumns).
+		AddRow("302", fresh, 2651450, 144, 4, int32(pb.TemporaryExposureKey_CONFIRMED_TEST), 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectKeysToReviseByOneTimeCode).WithArgs(originator, otcHash).WillReturnRows(rows)
+	mock.ExpectQuery(selectLatestRevision).WithArgs(fresh, "302").WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(insertRevision).WillReturnError(fmt.Errorf("error"))
+	mock.ExpectRollback()
+
+	_, err = reviseKeys(db, originator, oneTimeCode, "", pb.TemporaryExposureKey_REVOKED)
+	assert.Equal(t, fmt.Errorf("error"), err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRevisedKeysForHours(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	region := "302"
+	startHour := uint32(100)
+	endHour := uint32(124)
+	currentRSIN := int32(2651450)
+	minRSIN := timemath.RollingStartIntervalNumberPlusDays(currentRSIN, -14)
+
+	mock.ExpectQuery(
+		`SELECT region, key_data, rolling_start_interval_number, rolling_period, transmission_risk_level, report_type, days_since_onset_of_symptoms, hour_of_revision FROM diagnosis_key_revisions
+		WHERE hour_of_revision >= ?
+		AND hour_of_revision < ?
+		AND rolling_start_interval_number > ?
+		AND region = ?
+		AND id IN (
+			SELECT MAX(id) FROM diagnosis_key_revisions
+			WHERE hour_of_revision >= ?
+			AND hour_of_revision < ?
+			GROUP BY key_data, region, hour_of_revision
+		)
+		ORDER BY key_data`,
+	).WithArgs(startHour, endHour, minRSIN, region, startHour, endHour).WillReturnRows(
+		sqlmock.NewRows(append(keyToReviseColumns, "hour_of_revision")).AddRow(region, []byte{}, 2651450, 144, 4, int32(pb.TemporaryExposureKey_REVOKED), 0, 110),
+	)
+
+	conn := conn{
+		db: db,
+	}
+	keys, err := conn.FetchRevisedKeysForHours(region, startHour, endHour, currentRSIN)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(keys[110]))
+	assert.Equal(t, pb.TemporaryExposureKey_REVOKED, keys[110][0].GetReportType())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -14,6 +14,8 @@ import (
 
 type Authenticator interface {
 	Authenticate(string, string, string) bool
+	AuthenticateHour(string, string, string) bool
+	AuthenticateIndex(string, string) bool
 }
 
 type authenticator struct {
@@ -36,7 +38,30 @@ func NewAuthenticator() Authenticator {
 }
 
 func (a *authenticator) Authenticate(region, requestedDay, auth string) bool {
-	if len(region) != 3 || len(requestedDay) != 5 || len(auth) != 64 {
+	if len(requestedDay) != 5 {
+		return false
+	}
+	return a.authenticatePeriod(region, requestedDay, auth)
+}
+
+// AuthenticateHour uses the same scheme as Authenticate, with the hour number
+// in place of the date number. Hour numbers are six digits long (until 2084),
+// so a MAC for one can never be replayed as the other.
+func (a *authenticator) AuthenticateHour(region, requestedHour, auth string) bool {
+	if len(requestedHour) != 6 {
+		return false
+	}
+	return a.authenticatePeriod(region, requestedHour, auth)
+}
+
+// AuthenticateIndex uses the same scheme again, with "index" in place of the
+// period.
+func (a *authenticator) AuthenticateIndex(region, auth string) bool {
+	return a.authenticatePeriod(region, "index", auth)
+}
+
+func (a *authenticator) authenticatePeriod(region, period, auth string) bool {
+	if len(region) != 3 || len(auth) != 64 {
 		return false
 	}
 
@@ -51,7 +76,7 @@ func (a *authenticator) Authenticate(region, requestedDay, auth string) bool {
 
 	currentHour := int(timemath.HourNumber(time.Now()))
 
-	base := region + ":" + requestedDay + ":"
+	base := region + ":" + period + ":"
 
 	if validMAC([]byte(base+strconv.Itoa(currentHour)), dst, a.hmacKey) {
 		return true
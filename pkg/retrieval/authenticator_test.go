@@ -117,6 +117,60 @@ func TestAuthenticate(t *testing.T) {
 
 }
 
+func TestAuthenticateHour(t *testing.T) {
+	validHmacKey := strings.Repeat("a", config.AppConstants.HmacKeyLength*2)
+
+	os.Setenv("RETRIEVE_HMAC_KEY", validHmacKey)
+	authenticator := NewAuthenticator()
+
+	hmacKey := make([]byte, hex.DecodedLen(len(validHmacKey)))
+	hex.Decode(hmacKey, []byte(validHmacKey))
+
+	validRegion := "302"
+	currentHour := int(timemath.HourNumber(time.Now()))
+	validHour := strconv.Itoa(currentHour - 1)
+
+	mac := hmac.New(sha256.New, []byte(hmacKey))
+	mac.Write([]byte(validRegion + ":" + validHour + ":" + strconv.Itoa(currentHour)))
+	validAuth := hex.EncodeToString(mac.Sum(nil))
+
+	assert.True(t, authenticator.AuthenticateHour(validRegion, validHour, validAuth), "should return true on valid signature for an hour number")
+	assert.False(t, authenticator.AuthenticateHour(validRegion, "18444", validAuth), "hour must be six characters long")
+	assert.False(t, authenticator.Authenticate(validRegion, validHour, validAuth), "hour numbers should not authenticate as days")
+
+	mac = hmac.New(sha256.New, []byte(hmacKey))
+	mac.Write([]byte(validRegion + ":" + validHour + ":" + strconv.Itoa(currentHour-2)))
+	staleAuth := hex.EncodeToString(mac.Sum(nil))
+
+	assert.False(t, authenticator.AuthenticateHour(validRegion, validHour, staleAuth), "should return false on valid signature for two hours past")
+}
+
+func TestAuthenticateIndex(t *testing.T) {
+	validHmacKey := strings.Repeat("a", config.AppConstants.HmacKeyLength*2)
+
+	os.Setenv("RETRIEVE_HMAC_KEY", validHmacKey)
+	authenticator := NewAuthenticator()
+
+	hmacKey := make([]byte, hex.DecodedLen(len(validHmacKey)))
+	hex.Decode(hmacKey, []byte(validHmacKey))
+
+	validRegion := "302"
+	currentHour := int(timemath.HourNumber(time.Now()))
+
+	mac := hmac.New(sha256.New, []byte(hmacKey))
+	mac.Write([]byte(validRegion + ":index:" + strconv.Itoa(currentHour)))
+	validAuth := hex.EncodeToString(mac.Sum(nil))
+
+	assert.True(t, authenticator.AuthenticateIndex(validRegion, validAuth), "should return true on valid signature for the index")
+	assert.False(t, authenticator.AuthenticateIndex("30", validAuth), "region must be three characters long")
+
+	mac = hmac.New(sha256.New, []byte(hmacKey))
+	mac.Write([]byte(validRegion + ":" + strconv.Itoa(currentHour/24) + ":" + strconv.Itoa(currentHour)))
+	dayAuth := hex.EncodeToString(mac.Sum(nil))
+
+	assert.False(t, authenticator.AuthenticateIndex(validRegion, dayAuth), "day MAC should not authenticate the index")
+}
+
 func TestValidMAC(t *testing.T) {
 	validMessage := []byte("Lavender's blue, dilly, dilly")
 	validKey := []byte(strings.Repeat("a", config.AppConstants.HmacKeyLength*2))
@@ -0,0 +1,117 @@
+package retrieval
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"time"
+
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"google.golang.org/protobuf/proto"
+)
+
+// bundleIndexHeader starts index.bin, so that an index signature can never be
+// mistaken for an export signature made with the same key.
+var bundleIndexHeader = []byte("Bundle Index v1 ")
+
+// NewBundleIndexEntry describes batch batchNum of the bundle fetched with the
+// given period (DayPeriod or HourPeriod) and number.
+func NewBundleIndexEntry(period string, number uint32, batchNum int, bundle *Bundle) *pb.BundleIndexEntry {
+	p := pb.BundleIndexEntry_DAY
+	if period == HourPeriod {
+		p = pb.BundleIndexEntry_HOUR
+	}
+	batchSize := bundle.BatchSize
+	if batchSize == 0 {
+		batchSize = 1
+	}
+	generatedAt := uint64(bundle.LastModified.Unix())
+
+	return &pb.BundleIndexEntry{
+		Period:      &p,
+		Number:      proto.Uint32(number),
+		BatchNum:    proto.Int32(int32(batchNum)),
+		BatchSize:   proto.Int32(int32(batchSize)),
+		Count:       proto.Uint32(uint32(bundle.Count)),
+		Sha256:      bundle.Digest[:],
+		GeneratedAt: &generatedAt,
+	}
+}
+
+// SerializeBundleIndexTo writes an index of bundles, signed with each of the
+// signing keys active now.
+func SerializeBundleIndexTo(
+	ctx context.Context, w io.Writer,
+	region string,
+	entries []*pb.BundleIndexEntry,
+	generatedAt time.Time,
+	signingKeys SigningKeys,
+) (int, error) {
+	activeKeys := signingKeys.Active(time.Now())
+	if len(activeKeys) == 0 {
+		return -1, ErrNoActiveSigningKey
+	}
+
+	var sigInfos []*pb.SignatureInfo
+	for _, key := range activeKeys {
+		sigInfos = append(sigInfos, key.signatureInfo())
+	}
+
+	generated := uint64(generatedAt.Unix())
+	index := &pb.BundleIndex{
+		Region:         &region,
+		GeneratedAt:    &generated,
+		Bundles:        entries,
+		SignatureInfos: sigInfos,
+	}
+
+	indexBinData, err := proto.Marshal(index)
+	if err != nil {
+		return -1, err
+	}
+
+	signedData := append(append([]byte{}, bundleIndexHeader...), indexBinData...)
+
+	sigList := &pb.TEKSignatureList{}
+	for i, key := range activeKeys {
+		sig, err := key.Sign(signedData)
+		if err != nil {
+			return -1, err
+		}
+		sigList.Signatures = append(sigList.Signatures, &pb.TEKSignature{
+			SignatureInfo: sigInfos[i],
+			BatchNum:      proto.Int32(1),
+			BatchSize:     proto.Int32(1),
+			Signature:     sig,
+		})
+	}
+	indexSigData, err := proto.Marshal(sigList)
+	if err != nil {
+		return -1, err
+	}
+
+	zipw := zip.NewWriter(w)
+	totalN := 0
+
+	f, err := zipw.Create("index.bin")
+	if err != nil {
+		return -1, err
+	}
+	n, err := f.Write(signedData)
+	if err != nil {
+		return -1, err
+	}
+	totalN += n
+
+	f, err = zipw.Create("index.sig")
+	if err != nil {
+		return -1, err
+	}
+	n, err = f.Write(indexSigData)
+	if err != nil {
+		return -1, err
+	}
+	totalN += n
+
+	return totalN, zipw.Close()
+}
@@ -0,0 +1,91 @@
+package retrieval
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestNewBundleIndexEntry(t *testing.T) {
+	modified := time.Unix(1602464400, 0)
+	bundle := NewBundle([]byte("export"), "application/zip", 3, modified)
+	bundle.Count = 42
+
+	entry := NewBundleIndexEntry(HourPeriod, 445129, 2, bundle)
+	assert.Equal(t, pb.BundleIndexEntry_HOUR, entry.GetPeriod())
+	assert.Equal(t, uint32(445129), entry.GetNumber())
+	assert.Equal(t, int32(2), entry.GetBatchNum())
+	assert.Equal(t, int32(3), entry.GetBatchSize())
+	assert.Equal(t, uint32(42), entry.GetCount())
+	assert.Equal(t, uint64(1602464400), entry.GetGeneratedAt())
+
+	digest := sha256.Sum256([]byte("export"))
+	assert.Equal(t, digest[:], entry.GetSha256())
+
+	// Outbreak event bundles don't record a batch size
+	entry = NewBundleIndexEntry(DayPeriod, 18546, 1, NewBundle([]byte("export"), "application/zip", 0, modified))
+	assert.Equal(t, pb.BundleIndexEntry_DAY, entry.GetPeriod())
+	assert.Equal(t, int32(1), entry.GetBatchSize())
+}
+
+func TestSerializeBundleIndexTo(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	entry := NewBundleIndexEntry(DayPeriod, 18546, 1, NewBundle([]byte("export"), "application/zip", 1, time.Now()))
+
+	var buf bytes.Buffer
+	generatedAt := time.Unix(1602464400, 0)
+	_, err := SerializeBundleIndexTo(context.Background(), &buf, "302", []*pb.BundleIndexEntry{entry}, generatedAt, defaultSigningKeys(&signer{privateKey: privateKey}))
+	assert.Nil(t, err)
+
+	zipr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+	assert.Len(t, zipr.File, 2)
+	files := make(map[string][]byte)
+	for _, f := range zipr.File {
+		rc, _ := f.Open()
+		files[f.Name], _ = ioutil.ReadAll(rc)
+		rc.Close()
+	}
+	indexBin, indexSig := files["index.bin"], files["index.sig"]
+	assert.Equal(t, bundleIndexHeader, indexBin[:len(bundleIndexHeader)])
+
+	index := &pb.BundleIndex{}
+	assert.Nil(t, proto.Unmarshal(indexBin[len(bundleIndexHeader):], index))
+	assert.Equal(t, "302", index.GetRegion())
+	assert.Equal(t, uint64(1602464400), index.GetGeneratedAt())
+	assert.Len(t, index.GetBundles(), 1)
+	assert.True(t, proto.Equal(entry, index.GetBundles()[0]))
+
+	sigList := &pb.TEKSignatureList{}
+	assert.Nil(t, proto.Unmarshal(indexSig, sigList))
+	assert.Len(t, sigList.GetSignatures(), 1)
+	assert.True(t, proto.Equal(index.GetSignatureInfos()[0], sigList.GetSignatures()[0].GetSignatureInfo()))
+	assert.True(t, verifySignature(&privateKey.PublicKey, indexBin, sigList.GetSignatures()[0].GetSignature()))
+
+	_, err = SerializeBundleIndexTo(context.Background(), &buf, "302", nil, generatedAt, SigningKeys{})
+	assert.Equal(t, ErrNoActiveSigningKey, err)
+}
+
+func TestExportKeyCount(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsin := int32(1602460800/600 - 144)
+	data := verifyTestExport(t, privateKey, []*pb.TemporaryExposureKey{verifyTestKey(rsin), verifyTestKey(rsin), verifyTestKey(rsin)})
+
+	count, err := ExportKeyCount(data)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+
+	_, err = ExportKeyCount([]byte("not a zip"))
+	assert.NotNil(t, err)
+}
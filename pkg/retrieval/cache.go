@@ -0,0 +1,223 @@
+package retrieval
+
+import (
+	"archive/zip"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bundle is a serialized retrieval response, ready to be served again. Count
+// is the number of keys or outbreak events it holds, or -1 if that isn't
+// known.
+type Bundle struct {
+	Body         []byte
+	ContentType  string
+	BatchSize    int
+	Count        int
+	Digest       [sha256.Size]byte
+	ETag         string
+	LastModified time.Time
+}
+
+// NewBundle returns a bundle for body, built at modified. Its digest and ETag
+// are derived from what was signed rather than from body: ECDSA signatures are
+// randomized, so the same export signed by another replica, or rebuilt, is a
+// different zip. They only change when the content does.
+func NewBundle(body []byte, contentType string, batchSize int, modified time.Time) *Bundle {
+	sum := contentDigest(body, contentType)
+	return &Bundle{
+		Body:         body,
+		ContentType:  contentType,
+		BatchSize:    batchSize,
+		Digest:       sum,
+		ETag:         `"` + hex.EncodeToString(sum[:16]) + `"`,
+		LastModified: modified,
+	}
+}
+
+// contentDigest is the SHA-256 digest of the signed content of a zip (see
+// ArchiveDigest), or of the digests of every part of a multipart body. Bodies
+// that are neither are digested as they are.
+func contentDigest(body []byte, contentType string) [sha256.Size]byte {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		if sum, err := ArchiveDigest(body); err == nil {
+			return sum
+		}
+		return sha256.Sum256(body)
+	}
+
+	h := sha256.New()
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return sha256.Sum256(body)
+		}
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			return sha256.Sum256(body)
+		}
+		sum := contentDigest(data, part.Header.Get("Content-Type"))
+		h.Write(sum[:])
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// ArchiveDigest returns the SHA-256 digest of every file in a zip except its
+// signatures, in order: for an export, of its export.bin.
+func ArchiveDigest(data []byte) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return sum, err
+	}
+
+	h := sha256.New()
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, ".sig") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return sum, err
+		}
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return sum, err
+		}
+	}
+
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// BundleKey identifies a cached bundle: the region and hours it covers, the
+// rolling start interval number keys were filtered against, and which
+// representation of it was built (a batch number, multipart, ...).
+type BundleKey struct {
+	Region    string
+	StartHour uint32
+	EndHour   uint32
+	RSIN      int32
+	Variant   string
+}
+
+type bundleCacheEntry struct {
+	key     BundleKey
+	bundle  *Bundle
+	expires time.Time
+}
+
+// BundleCache is an in-memory LRU of serialized bundles, so the same bundle
+// doesn't have to be fetched, signed and zipped for every client that asks for
+// it. A nil BundleCache caches nothing.
+type BundleCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[BundleKey]*list.Element
+}
+
+// NewBundleCache returns a cache holding at most size bundles, or nil if size
+// isn't positive.
+func NewBundleCache(size int) *BundleCache {
+	if size <= 0 {
+		return nil
+	}
+	return &BundleCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[BundleKey]*list.Element),
+	}
+}
+
+// Get returns the bundle cached under key, if there is one that hasn't expired
+// by now.
+func (c *BundleCache) Get(key BundleKey, now time.Time) (*Bundle, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*bundleCacheEntry)
+	if !entry.expires.IsZero() && !now.Before(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.bundle, true
+}
+
+// Add caches bundle under key until expires, or until it's evicted or
+// invalidated if expires is zero.
+func (c *BundleCache) Add(key BundleKey, bundle *Bundle, expires time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.order.PushFront(&bundleCacheEntry{key: key, bundle: bundle, expires: expires})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// InvalidateHour drops every cached bundle covering hour, for when keys are
+// submitted or revised during it. It only reaches this process's cache: other
+// replicas, and retrieval servers running apart from submission, pick up new
+// keys when their cached bundles for windows that are still open expire.
+func (c *BundleCache) InvalidateHour(hour uint32) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, elem := range c.entries {
+		if key.StartHour <= hour && hour < key.EndHour {
+			c.remove(elem)
+		}
+	}
+}
+
+// Len returns the number of cached bundles.
+func (c *BundleCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *BundleCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*bundleCacheEntry).key)
+}
@@ -0,0 +1,127 @@
+package retrieval
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"mime/multipart"
+	"testing"
+	"time"
+
+	mockSigner "github.com/cds-snc/covid-alert-server/mocks/pkg/retrieval"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNewBundle(t *testing.T) {
+	now := time.Now()
+	bundle := NewBundle([]byte("bundle"), "application/zip", 2, now)
+
+	assert.Equal(t, []byte("bundle"), bundle.Body)
+	assert.Equal(t, "application/zip", bundle.ContentType)
+	assert.Equal(t, 2, bundle.BatchSize)
+	assert.Equal(t, now, bundle.LastModified)
+	assert.Equal(t, 34, len(bundle.ETag), "should be a quoted 32 character hex digest")
+
+	assert.Equal(t, bundle.ETag, NewBundle([]byte("bundle"), "application/zip", 2, now.Add(time.Hour)).ETag, "same content should have the same ETag")
+	assert.NotEqual(t, bundle.ETag, NewBundle([]byte("other bundle"), "application/zip", 2, now).ETag, "different content should have a different ETag")
+}
+
+func TestNewBundle_SignedContent(t *testing.T) {
+	signer := &mockSigner.Signer{}
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return([]byte("signature"), nil).Once()
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return([]byte("another signature"), nil).Once()
+
+	batch := Batch{Keys: []*pb.TemporaryExposureKey{randomTestKey(), randomTestKey()}}
+	start := time.Unix(18431*86400, 0)
+	end := start.Add(24 * time.Hour)
+
+	var first, second bytes.Buffer
+	_, err := SerializeBatchTo(context.Background(), &first, batch, "302", start, end, 1, 1, defaultSigningKeys(signer))
+	assert.Nil(t, err)
+	_, err = SerializeBatchTo(context.Background(), &second, batch, "302", start, end, 1, 1, defaultSigningKeys(signer))
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.Bytes(), second.Bytes())
+
+	// Signed again, but the same export
+	bundle := NewBundle(first.Bytes(), "application/zip", 1, time.Now())
+	assert.Equal(t, bundle.ETag, NewBundle(second.Bytes(), "application/zip", 1, time.Now()).ETag)
+
+	exportBin, _, err := readExportArchive(first.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, sha256.Sum256(exportBin), bundle.Digest, "should be the digest of export.bin")
+
+	sum, err := ArchiveDigest(second.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, bundle.Digest, sum)
+
+	// Multipart bodies are known by the digests of their parts
+	multipartBundle := func(parts ...[]byte) *Bundle {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, part := range parts {
+			w, _ := mw.CreatePart(nil)
+			w.Write(part)
+		}
+		mw.Close()
+		return NewBundle(buf.Bytes(), "multipart/mixed; boundary="+mw.Boundary(), len(parts), time.Now())
+	}
+	assert.Equal(t, multipartBundle(first.Bytes(), first.Bytes()).ETag, multipartBundle(second.Bytes(), first.Bytes()).ETag)
+	assert.NotEqual(t, multipartBundle(first.Bytes(), first.Bytes()).ETag, multipartBundle(first.Bytes()).ETag)
+}
+
+func TestBundleCache(t *testing.T) {
+	now := time.Now()
+	cache := NewBundleCache(2)
+
+	day1 := BundleKey{Region: "302", StartHour: 24, EndHour: 48, Variant: "batch-1"}
+	day2 := BundleKey{Region: "302", StartHour: 48, EndHour: 72, Variant: "batch-1"}
+	day3 := BundleKey{Region: "302", StartHour: 72, EndHour: 96, Variant: "batch-1"}
+	bundle := NewBundle([]byte("bundle"), "application/zip", 1, now)
+
+	_, ok := cache.Get(day1, now)
+	assert.False(t, ok)
+
+	cache.Add(day1, bundle, time.Time{})
+	cached, ok := cache.Get(day1, now)
+	assert.True(t, ok)
+	assert.Equal(t, bundle, cached)
+
+	// Evicts the least recently used bundle
+	cache.Add(day2, bundle, time.Time{})
+	cache.Get(day1, now)
+	cache.Add(day3, bundle, time.Time{})
+	assert.Equal(t, 2, cache.Len())
+	_, ok = cache.Get(day2, now)
+	assert.False(t, ok, "should have evicted the least recently used bundle")
+	_, ok = cache.Get(day1, now)
+	assert.True(t, ok)
+
+	// Invalidates bundles covering an hour
+	cache.InvalidateHour(80)
+	_, ok = cache.Get(day3, now)
+	assert.False(t, ok, "should have invalidated the bundle covering the hour")
+	_, ok = cache.Get(day1, now)
+	assert.True(t, ok)
+
+	// Expires bundles
+	cache.Add(day2, bundle, now.Add(time.Minute))
+	_, ok = cache.Get(day2, now)
+	assert.True(t, ok)
+	_, ok = cache.Get(day2, now.Add(time.Minute))
+	assert.False(t, ok, "should have expired the bundle")
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestBundleCache_Disabled(t *testing.T) {
+	cache := NewBundleCache(0)
+	assert.Nil(t, cache)
+
+	key := BundleKey{Region: "302"}
+	cache.Add(key, NewBundle(nil, "application/zip", 1, time.Now()), time.Time{})
+	_, ok := cache.Get(key, time.Now())
+	assert.False(t, ok)
+	cache.InvalidateHour(0)
+	assert.Equal(t, 0, cache.Len())
+}
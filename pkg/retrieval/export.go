@@ -0,0 +1,220 @@
+package retrieval
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/blobstore"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"google.golang.org/protobuf/proto"
+)
+
+// Periods an export can cover. Together with the region and the date or hour
+// number, they determine where an export's batches are kept in a BlobStore:
+//
+//	302/day/18431/export-1.zip
+//	302/hour/442344/export-1.zip
+//
+// Each region also has an index.txt listing every export file, oldest first.
+const (
+	DayPeriod  = "day"
+	HourPeriod = "hour"
+)
+
+// ExportPrefix returns the common prefix of the batches of one export.
+func ExportPrefix(region, period string, number uint32) string {
+	return fmt.Sprintf("%s/%s/%d/", region, period, number)
+}
+
+// ExportName returns the name of one batch of an export.
+func ExportName(prefix string, batchNum int) string {
+	return fmt.Sprintf("%sexport-%d.zip", prefix, batchNum)
+}
+
+// IndexName returns the name of the index of a region's exports.
+func IndexName(region string) string {
+	return region + "/index.txt"
+}
+
+// StoredBatches returns the names of the batches stored under an export
+// prefix, in batch order.
+func StoredBatches(ctx context.Context, store blobstore.BlobStore, prefix string) ([]string, error) {
+	names, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var batches []string
+	for _, name := range names {
+		if batchNumber(prefix, name) > 0 {
+			batches = append(batches, name)
+		}
+	}
+	sort.Slice(batches, func(i, j int) bool {
+		return batchNumber(prefix, batches[i]) < batchNumber(prefix, batches[j])
+	})
+	return batches, nil
+}
+
+// batchNumber parses the batch number out of a batch name, or returns 0 if the
+// name isn't one.
+func batchNumber(prefix, name string) int {
+	var n int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(name, prefix), "export-%d.zip", &n); err != nil {
+		return 0
+	}
+	if ExportName(prefix, n) != name {
+		return 0
+	}
+	return n
+}
+
+// PublishExport signs every batch of an export and writes it to the store
+// under prefix. Batches left over from an earlier, larger version of the
+// export are removed before the new ones are written, so that the prefix never
+// holds more batches than the new version has.
+func PublishExport(
+	ctx context.Context, store blobstore.BlobStore, prefix string,
+	batches []Batch,
+	region string,
+	startTimestamp, endTimestamp time.Time,
+	signingKeys SigningKeys,
+) error {
+	// Sign everything up front, so a failure leaves the old version alone
+	data := make([][]byte, len(batches))
+	for i, batch := range batches {
+		var buf bytes.Buffer
+		if _, err := SerializeBatchTo(ctx, &buf, batch, region, startTimestamp, endTimestamp, i+1, len(batches), signingKeys); err != nil {
+			return err
+		}
+		data[i] = buf.Bytes()
+	}
+
+	existing, err := StoredBatches(ctx, store, prefix)
+	if err != nil {
+		return err
+	}
+	for _, name := range existing {
+		if batchNumber(prefix, name) > len(batches) {
+			if err := store.Delete(ctx, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, batch := range data {
+		if err := store.Put(ctx, ExportName(prefix, i+1), batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeExport reads the export out of a serialized export batch, without
+// checking its signature.
+func DecodeExport(data []byte) (*pb.TemporaryExposureKeyExport, error) {
+	exportBin, _, err := readExportArchive(data)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(exportBin, binHeader) {
+		return nil, ErrInvalidExportHeader
+	}
+	export := &pb.TemporaryExposureKeyExport{}
+	if err := proto.Unmarshal(exportBin[binHeaderLength:], export); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// ExportKeyCount returns the number of keys and revised keys in a serialized
+// export batch.
+func ExportKeyCount(data []byte) (int, error) {
+	export, err := DecodeExport(data)
+	if err != nil {
+		return 0, err
+	}
+	return len(export.GetKeys()) + len(export.GetRevisedKeys()), nil
+}
+
+// DeleteExport removes every batch of an export.
+func DeleteExport(ctx context.Context, store blobstore.BlobStore, prefix string) error {
+	names, err := StoredBatches(ctx, store, prefix)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := store.Delete(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteIndex rewrites a region's index.txt to list all of its stored export
+// files, one per line, oldest first.
+func WriteIndex(ctx context.Context, store blobstore.BlobStore, region string) error {
+	names, err := store.List(ctx, region+"/")
+	if err != nil {
+		return err
+	}
+
+	type entry struct {
+		name   string
+		period string
+		number uint32
+		batch  int
+	}
+
+	var entries []entry
+	for _, name := range names {
+		parts := strings.Split(strings.TrimPrefix(name, region+"/"), "/")
+		if len(parts) != 3 {
+			continue
+		}
+		number, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			continue
+		}
+
+		e := entry{period: parts[0], number: uint32(number)}
+		if e.batch = batchNumber(ExportPrefix(region, e.period, e.number), name); e.batch == 0 {
+			continue
+		}
+		e.name = name
+		entries = append(entries, e)
+	}
+
+	// Hours and days are ordered by the time they start at, and the whole
+	// period bundle (day 0) goes last since it changes every day.
+	start := func(e entry) uint32 {
+		if e.period == DayPeriod {
+			if e.number == 0 {
+				return ^uint32(0)
+			}
+			return e.number * 24
+		}
+		return e.number
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if start(entries[i]) != start(entries[j]) {
+			return start(entries[i]) < start(entries[j])
+		}
+		if entries[i].period != entries[j].period {
+			return entries[i].period == DayPeriod
+		}
+		return entries[i].batch < entries[j].batch
+	})
+
+	var index strings.Builder
+	for _, e := range entries {
+		index.WriteString(e.name)
+		index.WriteString("\n")
+	}
+	return store.Put(ctx, IndexName(region), []byte(index.String()))
+}
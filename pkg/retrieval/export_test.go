@@ -0,0 +1,147 @@
+package retrieval
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	mockSigner "github.com/cds-snc/covid-alert-server/mocks/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/blobstore"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
+)
+
+func setupExportStore(t *testing.T) (blobstore.BlobStore, func()) {
+	root, err := ioutil.TempDir("", "exports")
+	assert.Nil(t, err)
+	store, err := blobstore.NewFilesystem(root)
+	assert.Nil(t, err)
+	return store, func() { os.RemoveAll(root) }
+}
+
+func TestExportNames(t *testing.T) {
+	prefix := ExportPrefix("302", DayPeriod, 18431)
+	assert.Equal(t, "302/day/18431/", prefix)
+	assert.Equal(t, "302/day/18431/export-2.zip", ExportName(prefix, 2))
+	assert.Equal(t, "302/hour/442344/", ExportPrefix("302", HourPeriod, 442344))
+	assert.Equal(t, "302/index.txt", IndexName("302"))
+
+	assert.Equal(t, 2, batchNumber(prefix, "302/day/18431/export-2.zip"))
+	assert.Equal(t, 0, batchNumber(prefix, "302/day/18431/export-2.zip.bak"))
+	assert.Equal(t, 0, batchNumber(prefix, "302/day/18431/index.txt"))
+	assert.Equal(t, 0, batchNumber(prefix, "302/day/18431/export-02.zip"))
+}
+
+func TestPublishExport(t *testing.T) {
+	store, cleanup := setupExportStore(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	signer := &mockSigner.Signer{}
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return([]byte("signature"), nil)
+
+	prefix := ExportPrefix("302", DayPeriod, 18431)
+	keys := []*pb.TemporaryExposureKey{randomTestKey(), randomTestKey(), randomTestKey()}
+	start := time.Unix(18431*86400, 0)
+	end := time.Unix(18432*86400, 0)
+
+	err := PublishExport(ctx, store, prefix, batchKeys(keys, nil, 1), "302", start, end, defaultSigningKeys(signer))
+	assert.Nil(t, err)
+
+	names, _ := StoredBatches(ctx, store, prefix)
+	assert.Equal(t, []string{"302/day/18431/export-1.zip", "302/day/18431/export-2.zip", "302/day/18431/export-3.zip"}, names)
+
+	obj, err := store.Get(ctx, names[1])
+	assert.Nil(t, err)
+	data, _ := ioutil.ReadAll(obj)
+	obj.Close()
+
+	zipr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+	f, _ := zipr.File[0].Open()
+	exportBin, _ := ioutil.ReadAll(f)
+	export := &pb.TemporaryExposureKeyExport{}
+	assert.Nil(t, proto.Unmarshal(exportBin[binHeaderLength:], export))
+	assert.Equal(t, int32(2), export.GetBatchNum())
+	assert.Equal(t, int32(3), export.GetBatchSize())
+	assert.Equal(t, keys[1].GetKeyData(), export.GetKeys()[0].GetKeyData())
+
+	// Republishing with fewer batches removes the extra ones
+	err = PublishExport(ctx, store, prefix, BatchKeys(keys, nil), "302", start, end, defaultSigningKeys(signer))
+	assert.Nil(t, err)
+
+	names, _ = StoredBatches(ctx, store, prefix)
+	assert.Equal(t, []string{"302/day/18431/export-1.zip"}, names)
+
+	// A version that can't be signed leaves the last one in place
+	failing := &mockSigner.Signer{}
+	failing.On("Sign", mock.AnythingOfType("[]uint8")).Return(nil, errors.New("no signer"))
+	err = PublishExport(ctx, store, prefix, batchKeys(keys, nil, 1), "302", start, end, defaultSigningKeys(failing))
+	assert.EqualError(t, err, "no signer")
+
+	names, _ = StoredBatches(ctx, store, prefix)
+	assert.Equal(t, []string{"302/day/18431/export-1.zip"}, names)
+
+	assert.Nil(t, DeleteExport(ctx, store, prefix))
+	names, _ = StoredBatches(ctx, store, prefix)
+	assert.Empty(t, names)
+}
+
+func TestStoredBatches_Order(t *testing.T) {
+	store, cleanup := setupExportStore(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	prefix := ExportPrefix("302", DayPeriod, 18431)
+	for _, n := range []int{10, 2, 1} {
+		assert.Nil(t, store.Put(ctx, ExportName(prefix, n), []byte{}))
+	}
+	assert.Nil(t, store.Put(ctx, prefix+"notes.txt", []byte{}))
+
+	names, err := StoredBatches(ctx, store, prefix)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"302/day/18431/export-1.zip", "302/day/18431/export-2.zip", "302/day/18431/export-10.zip"}, names)
+}
+
+func TestWriteIndex(t *testing.T) {
+	store, cleanup := setupExportStore(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	for _, name := range []string{
+		"302/day/0/export-1.zip",
+		"302/hour/442345/export-1.zip",
+		"302/day/18431/export-2.zip",
+		"302/day/18431/export-1.zip",
+		"302/hour/442344/export-1.zip",
+		"302/day/18430/export-1.zip",
+		"302/day/18430/README",
+		"208/day/18430/export-1.zip",
+	} {
+		assert.Nil(t, store.Put(ctx, name, []byte{}))
+	}
+
+	assert.Nil(t, WriteIndex(ctx, store, "302"))
+	// Rewriting must not list the index itself
+	assert.Nil(t, WriteIndex(ctx, store, "302"))
+
+	obj, err := store.Get(ctx, IndexName("302"))
+	assert.Nil(t, err)
+	index, _ := ioutil.ReadAll(obj)
+	obj.Close()
+
+	expected := "302/day/18430/export-1.zip\n" +
+		"302/day/18431/export-1.zip\n" +
+		"302/day/18431/export-2.zip\n" +
+		"302/hour/442344/export-1.zip\n" +
+		"302/hour/442345/export-1.zip\n" +
+		"302/day/0/export-1.zip\n"
+	assert.Equal(t, expected, string(index))
+}
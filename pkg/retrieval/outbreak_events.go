@@ -74,3 +74,97 @@ func SerializeOutbreakEventsTo(
 
 	return totalN, zipw.Close()
 }
+
+// qrBinHeader starts export.bin in version 2 outbreak event exports. Version 1
+// exports have no header, which is how clients tell the two apart.
+var qrBinHeader = []byte("QR Export v2    ")
+
+// SerializeOutbreakEventBatchTo writes a version 2 outbreak event export. Like
+// TEK exports, it carries a header, batch numbers and a SignatureInfo for each
+// of the signing keys active now, and is signed by all of them, so the QR
+// signing key can be rotated. Clients that only understand version 1 are
+// served by SerializeOutbreakEventsTo.
+func SerializeOutbreakEventBatchTo(
+	ctx context.Context, w io.Writer,
+	locations []*pb.OutbreakEvent,
+	startTimestamp, endTimestamp time.Time,
+	batchNum, batchSize int,
+	signingKeys SigningKeys,
+) (int, error) {
+	activeKeys := signingKeys.Active(time.Now())
+	if len(activeKeys) == 0 {
+		return -1, ErrNoActiveSigningKey
+	}
+
+	num := int32(batchNum)
+	size := int32(batchSize)
+
+	start := uint64(startTimestamp.Unix())
+	end := uint64(endTimestamp.Unix())
+
+	var sigInfos []*pb.SignatureInfo
+	for _, key := range activeKeys {
+		sigInfos = append(sigInfos, key.signatureInfo())
+	}
+
+	outbreakEventExport := &pb.OutbreakEventExport{
+		StartTimestamp: &start,
+		EndTimestamp:   &end,
+		Locations:      locations,
+		SignatureInfos: sigInfos,
+		BatchNum:       &num,
+		BatchSize:      &size,
+	}
+
+	// Deterministic, like TEK exports, so a bundle's digest doesn't depend on
+	// where it was built
+	exportBinData, err := proto.MarshalOptions{Deterministic: true}.Marshal(outbreakEventExport)
+	if err != nil {
+		return -1, err
+	}
+
+	signedData := append(append([]byte{}, qrBinHeader...), exportBinData...)
+
+	sigList := &pb.OutbreakEventExportSignatureList{}
+	for i, key := range activeKeys {
+		sig, err := key.Sign(signedData)
+		if err != nil {
+			return -1, err
+		}
+		sigList.Signatures = append(sigList.Signatures, &pb.OutbreakEventExportSignature{
+			Signature:     sig,
+			SignatureInfo: sigInfos[i],
+			BatchNum:      &num,
+			BatchSize:     &size,
+		})
+	}
+	exportSigData, err := proto.Marshal(sigList)
+	if err != nil {
+		return -1, err
+	}
+
+	zipw := zip.NewWriter(w)
+	totalN := 0
+
+	f, err := zipw.Create("export.bin")
+	if err != nil {
+		return -1, err
+	}
+	n, err := f.Write(signedData)
+	if err != nil {
+		return -1, err
+	}
+	totalN += n
+
+	f, err = zipw.Create("export.sig")
+	if err != nil {
+		return -1, err
+	}
+	n, err = f.Write(exportSigData)
+	if err != nil {
+		return -1, err
+	}
+	totalN += n
+
+	return totalN, zipw.Close()
+}
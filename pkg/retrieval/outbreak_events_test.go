@@ -1,6 +1,8 @@
 package retrieval
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"net/http"
 	"net/http/httptest"
@@ -35,6 +37,14 @@ func TestSerializeOutbreakEventsTo(t *testing.T) {
 	assert.Nil(t, receivedZip)
 }
 
+func TestSerializeOutbreakEventBatchTo_NoActiveKey(t *testing.T) {
+	signingKeys := SigningKeys{{Signer: &signer{}, Version: "v1", ID: "302", ValidUntil: time.Now().Add(-time.Hour)}}
+
+	var buf bytes.Buffer
+	_, err := SerializeOutbreakEventBatchTo(context.Background(), &buf, nil, time.Now(), time.Now(), 1, 1, signingKeys)
+	assert.Equal(t, ErrNoActiveSigningKey, err)
+}
+
 func randomTestOutbreakEvent() *pb.OutbreakEvent {
 	uuid := "8a2c34b2-74a5-4b6a-8bed-79b7823b37c7"
 	startTime, _ := timestamp.TimestampProto(time.Unix(1613238163, 0))
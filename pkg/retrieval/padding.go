@@ -0,0 +1,162 @@
+package retrieval
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+)
+
+const (
+	paddingKeyLength     = 16
+	paddingRollingPeriod = 144
+	paddingDays          = 14
+	intervalsPerDay      = 144
+	maxPaddingRisk       = 8
+	maxPaddingOnsetDays  = 5
+)
+
+// Padder hides how many keys an export really holds by adding fake keys to
+// each hour of it until the hour reaches a minimum count plus a random jitter.
+// Fake keys are derived from a secret and the region and hour, so every export
+// covering an hour carries the same fake keys for it, whether it's that hour's,
+// its day's or the entire period's, and they can't be told apart from real keys
+// without the secret. A nil Padder adds nothing.
+//
+// Only hours that are over can be padded: while an hour is still open, its
+// fake keys would make way for real ones as they come in.
+type Padder struct {
+	secret  []byte
+	minimum int
+	jitter  int
+}
+
+// NewPadder returns a Padder using the hex-encoded secret in
+// EXPORT_PADDING_KEY.
+func NewPadder(minimum, jitter int) (*Padder, error) {
+	secretHex := os.Getenv("EXPORT_PADDING_KEY")
+	if len(secretHex) < hex.EncodedLen(config.AppConstants.HmacKeyLength) {
+		return nil, errors.New("EXPORT_PADDING_KEY missing or too short")
+	}
+	secret, err := hex.DecodeString(secretHex)
+	if err != nil {
+		return nil, fmt.Errorf("EXPORT_PADDING_KEY is not hex encoded: %w", err)
+	}
+	if minimum < 0 || jitter < 0 {
+		return nil, errors.New("export padding minimum and jitter can't be negative")
+	}
+
+	return &Padder{secret: secret, minimum: minimum, jitter: jitter}, nil
+}
+
+// Pad returns the keys submitted from startHour up to endHour, with fake keys
+// added to each hour. The result is sorted by key data, as real keys are, so
+// fake keys aren't grouped together.
+func (p *Padder) Pad(keysByHour map[uint32][]*pb.TemporaryExposureKey, region string, startHour, endHour uint32) []*pb.TemporaryExposureKey {
+	if p == nil {
+		return KeysForHours(keysByHour, startHour, endHour)
+	}
+
+	var padded []*pb.TemporaryExposureKey
+	for hour := startHour; hour < endHour; hour++ {
+		padded = append(padded, p.padHour(keysByHour[hour], region, hour)...)
+	}
+	sortKeys(padded)
+	return padded
+}
+
+// padHour returns the keys submitted during hour with its fake keys added.
+func (p *Padder) padHour(keys []*pb.TemporaryExposureKey, region string, hour uint32) []*pb.TemporaryExposureKey {
+	stream := newPaddingStream(p.secret, fmt.Sprintf("%s:%d", region, hour))
+
+	target := p.minimum
+	if p.jitter > 0 {
+		target += stream.intn(p.jitter + 1)
+	}
+	if len(keys) >= target {
+		return keys
+	}
+
+	end := time.Unix(int64(hour+1)*3600, 0)
+	padded := make([]*pb.TemporaryExposureKey, 0, target)
+	padded = append(padded, keys...)
+	for len(padded) < target {
+		padded = append(padded, fakeKey(stream, keys, end))
+	}
+	return padded
+}
+
+// fakeKey returns a key with random key data. Following Google's reference
+// server, the rest of the key is copied from a real key from the same hour when
+// there is one, so fake keys follow the same distribution. Otherwise it gets
+// a full-day rolling period starting on one of the 14 days before end, and a
+// symptom onset in the few days before end.
+func fakeKey(stream *paddingStream, real []*pb.TemporaryExposureKey, end time.Time) *pb.TemporaryExposureKey {
+	key := &pb.TemporaryExposureKey{KeyData: stream.bytes(paddingKeyLength)}
+
+	if len(real) > 0 {
+		model := real[stream.intn(len(real))]
+		key.RollingStartIntervalNumber = model.RollingStartIntervalNumber
+		key.RollingPeriod = model.RollingPeriod
+		key.TransmissionRiskLevel = model.TransmissionRiskLevel
+		key.ReportType = model.ReportType
+		key.DaysSinceOnsetOfSymptoms = model.DaysSinceOnsetOfSymptoms
+		return key
+	}
+
+	endDay := int32(end.Unix() / 86400)
+	daysAgo := int32(stream.intn(paddingDays) + 1)
+	onsetDaysAgo := int32(stream.intn(maxPaddingOnsetDays) + 1)
+
+	rsin := (endDay - daysAgo) * intervalsPerDay
+	rollingPeriod := int32(paddingRollingPeriod)
+	risk := int32(stream.intn(maxPaddingRisk) + 1)
+	onset := onsetDaysAgo - daysAgo
+
+	key.RollingStartIntervalNumber = &rsin
+	key.RollingPeriod = &rollingPeriod
+	key.TransmissionRiskLevel = &risk
+	key.ReportType = pb.TemporaryExposureKey_CONFIRMED_TEST.Enum()
+	key.DaysSinceOnsetOfSymptoms = &onset
+	return key
+}
+
+// paddingStream is a deterministic source of random bytes: HMAC-SHA256 of the
+// region and hour being padded and a counter, keyed with the padding secret.
+type paddingStream struct {
+	secret  []byte
+	label   string
+	counter uint64
+	buf     []byte
+}
+
+func newPaddingStream(secret []byte, label string) *paddingStream {
+	return &paddingStream{secret: secret, label: label}
+}
+
+func (s *paddingStream) bytes(n int) []byte {
+	for len(s.buf) < n {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write([]byte(s.label))
+		binary.Write(mac, binary.BigEndian, s.counter)
+		s.counter++
+		s.buf = mac.Sum(s.buf)
+	}
+	out := make([]byte, n)
+	copy(out, s.buf)
+	s.buf = s.buf[n:]
+	return out
+}
+
+// intn returns a number in [0, n). The modulo bias is negligible for the
+// small n used here.
+func (s *paddingStream) intn(n int) int {
+	return int(binary.BigEndian.Uint64(s.bytes(8)) % uint64(n))
+}
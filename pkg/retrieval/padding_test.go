@@ -0,0 +1,118 @@
+package retrieval
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPadder(minimum, jitter int) *Padder {
+	return &Padder{secret: []byte(strings.Repeat("s", 32)), minimum: minimum, jitter: jitter}
+}
+
+func TestNewPadder(t *testing.T) {
+	config.AppConstants.HmacKeyLength = 32
+	defer os.Unsetenv("EXPORT_PADDING_KEY")
+
+	os.Setenv("EXPORT_PADDING_KEY", "")
+	_, err := NewPadder(1000, 200)
+	assert.EqualError(t, err, "EXPORT_PADDING_KEY missing or too short")
+
+	os.Setenv("EXPORT_PADDING_KEY", strings.Repeat("z", 64))
+	_, err = NewPadder(1000, 200)
+	assert.Contains(t, err.Error(), "EXPORT_PADDING_KEY is not hex encoded")
+
+	os.Setenv("EXPORT_PADDING_KEY", strings.Repeat("a", 64))
+	_, err = NewPadder(-1, 200)
+	assert.EqualError(t, err, "export padding minimum and jitter can't be negative")
+
+	padder, err := NewPadder(1000, 200)
+	assert.Nil(t, err)
+	secret, _ := hex.DecodeString(strings.Repeat("a", 64))
+	assert.Equal(t, &Padder{secret: secret, minimum: 1000, jitter: 200}, padder)
+}
+
+func TestPad_Disabled(t *testing.T) {
+	var padder *Padder
+	keys := []*pb.TemporaryExposureKey{randomTestKey()}
+	assert.Equal(t, keys, padder.Pad(map[uint32][]*pb.TemporaryExposureKey{100: keys}, "302", 100, 101))
+}
+
+func TestPad(t *testing.T) {
+	padder := testPadder(50, 10)
+	hour := uint32(18431 * 24)
+	keys := []*pb.TemporaryExposureKey{randomTestKey(), randomTestKey(), randomTestKey()}
+	keysByHour := map[uint32][]*pb.TemporaryExposureKey{hour: keys}
+
+	padded := padder.Pad(keysByHour, "302", hour, hour+1)
+	assert.True(t, len(padded) >= 50 && len(padded) <= 60, "should pad to the minimum plus jitter")
+	for _, key := range keys {
+		assert.Contains(t, padded, key, "should keep every real key")
+	}
+	for i := 1; i < len(padded); i++ {
+		assert.True(t, bytes.Compare(padded[i-1].GetKeyData(), padded[i].GetKeyData()) < 0, "should be sorted by key data")
+	}
+	for _, key := range padded {
+		assert.Equal(t, 16, len(key.GetKeyData()))
+		assert.Equal(t, keys[0].GetRollingStartIntervalNumber(), key.GetRollingStartIntervalNumber(), "should copy real keys")
+		assert.Equal(t, keys[0].GetTransmissionRiskLevel(), key.GetTransmissionRiskLevel(), "should copy real keys")
+	}
+
+	// Same hour, same padding
+	assert.Equal(t, padded, padder.Pad(keysByHour, "302", hour, hour+1))
+
+	// Different hour, different padding
+	other := padder.Pad(map[uint32][]*pb.TemporaryExposureKey{hour + 1: keys}, "302", hour+1, hour+2)
+	assert.NotEqual(t, padded, other)
+
+	// Enough real keys
+	padder = testPadder(2, 0)
+	assert.ElementsMatch(t, keys, padder.Pad(keysByHour, "302", hour, hour+1))
+}
+
+func TestPad_Hours(t *testing.T) {
+	padder := testPadder(20, 5)
+	day := uint32(18431)
+	keysByHour := map[uint32][]*pb.TemporaryExposureKey{
+		day*24 + 3:  {randomTestKey(), randomTestKey()},
+		day*24 + 17: {randomTestKey()},
+	}
+
+	// A day carries exactly the padding of its hours, so comparing it with the
+	// hourly exports gives nothing away
+	dayKeys := padder.Pad(keysByHour, "302", day*24, (day+1)*24)
+	var hourKeys []*pb.TemporaryExposureKey
+	for hour := day * 24; hour < (day+1)*24; hour++ {
+		padded := padder.Pad(keysByHour, "302", hour, hour+1)
+		assert.True(t, len(padded) >= 20 && len(padded) <= 25, "should pad every hour")
+		hourKeys = append(hourKeys, padded...)
+	}
+	assert.ElementsMatch(t, hourKeys, dayKeys)
+
+	// Keys from outside the window are left out
+	assert.NotContains(t, padder.Pad(keysByHour, "302", day*24, day*24+4), keysByHour[day*24+17][0])
+}
+
+func TestPad_NoRealKeys(t *testing.T) {
+	padder := testPadder(100, 0)
+	hour := uint32(18432*24 - 1)
+	endRSIN := int32(18432 * 144)
+
+	padded := padder.Pad(nil, "302", hour, hour+1)
+	assert.Equal(t, 100, len(padded))
+	for _, key := range padded {
+		assert.True(t, key.GetRollingStartIntervalNumber() < endRSIN)
+		assert.True(t, key.GetRollingStartIntervalNumber() >= endRSIN-14*144)
+		assert.Equal(t, int32(0), key.GetRollingStartIntervalNumber()%144, "should start at midnight")
+		assert.Equal(t, int32(144), key.GetRollingPeriod())
+		assert.True(t, key.GetTransmissionRiskLevel() >= 1 && key.GetTransmissionRiskLevel() <= 8)
+		assert.True(t, key.GetDaysSinceOnsetOfSymptoms() >= -14 && key.GetDaysSinceOnsetOfSymptoms() <= 14)
+		assert.Equal(t, pb.TemporaryExposureKey_CONFIRMED_TEST, key.GetReportType())
+	}
+}
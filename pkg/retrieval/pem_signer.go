@@ -0,0 +1,57 @@
+package retrieval
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+)
+
+// NewPEMSigner returns a signer using the EC private key in the PEM file at
+// path. The key may be a SEC 1 ("EC PRIVATE KEY") or PKCS #8 ("PRIVATE KEY")
+// block. An encrypted SEC 1 block, as written by `openssl ec -aes256`, is
+// decrypted with passphrase.
+func NewPEMSigner(path string, passphrase []byte) (Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+
+	// Legacy PEM encryption is deprecated, but it's what openssl uses for EC keys.
+	der := block.Bytes
+	if x509.IsEncryptedPEMBlock(block) { //nolint:staticcheck
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("%s is encrypted and no passphrase was given", path)
+		}
+		if der, err = x509.DecryptPEMBlock(block, passphrase); err != nil { //nolint:staticcheck
+			return nil, fmt.Errorf("could not decrypt %s: %w", path, err)
+		}
+	}
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		priv, err := x509.ParseECPrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return &signer{privateKey: priv}, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		priv, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s does not hold an EC private key", path)
+		}
+		return &signer{privateKey: priv}, nil
+	default:
+		return nil, fmt.Errorf("%s holds an unsupported PEM block type %q", path, block.Type)
+	}
+}
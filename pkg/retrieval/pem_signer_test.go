@@ -0,0 +1,68 @@
+package retrieval
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writePEM(t *testing.T, dir, name string, block *pem.Block) string {
+	path := filepath.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600))
+	return path
+}
+
+func TestNewPEMSigner(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "pem-signer")
+	defer os.RemoveAll(dir)
+
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	sec1, _ := x509.MarshalECPrivateKey(privateKey)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	expected := &signer{privateKey: privateKey}
+
+	// SEC 1
+	s, err := NewPEMSigner(writePEM(t, dir, "sec1.pem", &pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, s)
+
+	// PKCS #8
+	s, err = NewPEMSigner(writePEM(t, dir, "pkcs8.pem", &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, s)
+
+	// Encrypted
+	encrypted, _ := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", sec1, []byte("passphrase"), x509.PEMCipherAES256) //nolint:staticcheck
+	path := writePEM(t, dir, "encrypted.pem", encrypted)
+
+	s, err = NewPEMSigner(path, []byte("passphrase"))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, s)
+
+	_, err = NewPEMSigner(path, nil)
+	assert.EqualError(t, err, path+" is encrypted and no passphrase was given")
+
+	_, err = NewPEMSigner(path, []byte("wrong"))
+	assert.Contains(t, err.Error(), "could not decrypt "+path)
+
+	// Not a usable key
+	path = writePEM(t, dir, "cert.pem", &pem.Block{Type: "CERTIFICATE", Bytes: []byte("cert")})
+	_, err = NewPEMSigner(path, nil)
+	assert.EqualError(t, err, path+` holds an unsupported PEM block type "CERTIFICATE"`)
+
+	path = filepath.Join(dir, "empty.pem")
+	ioutil.WriteFile(path, []byte("not pem"), 0600)
+	_, err = NewPEMSigner(path, nil)
+	assert.EqualError(t, err, "no PEM data in "+path)
+
+	_, err = NewPEMSigner(filepath.Join(dir, "missing.pem"), nil)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,109 @@
+package retrieval
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const remoteSignerTimeout = 10 * time.Second
+
+// ErrEmptyRemoteSignature is returned when the remote signing service answers
+// without a signature.
+var ErrEmptyRemoteSignature = errors.New("remote signer returned no signature")
+
+// remoteSigner keeps the private key out of this process: it sends the SHA-256
+// digest of the data to a signing service, which returns an ASN.1 DER ECDSA
+// signature of that digest.
+//
+//	POST <url>
+//	Authorization: Bearer <token>
+//	{"algorithm":"SHA256","digest":"<base64>"}
+//
+//	{"signature":"<base64>"}
+type remoteSigner struct {
+	url       string
+	token     string
+	client    *http.Client
+	publicKey *ecdsa.PublicKey
+}
+
+type remoteSignRequest struct {
+	Algorithm string `json:"algorithm"`
+	Digest    []byte `json:"digest"`
+}
+
+type remoteSignResponse struct {
+	Signature []byte `json:"signature"`
+}
+
+// NewRemoteSigner returns a signer that calls the signing service at
+// serviceURL, sending token as a bearer token if it isn't empty. publicKey is
+// the service's public key, if known.
+func NewRemoteSigner(serviceURL, token string, publicKey *ecdsa.PublicKey) (Signer, error) {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote signer URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("remote signer URL %q must be an absolute http or https URL", serviceURL)
+	}
+
+	return &remoteSigner{
+		url:       serviceURL,
+		token:     token,
+		client:    &http.Client{Timeout: remoteSignerTimeout},
+		publicKey: publicKey,
+	}, nil
+}
+
+// Public returns the public key configured for the remote signer, if any.
+func (s *remoteSigner) Public() crypto.PublicKey {
+	if s.publicKey == nil {
+		return nil
+	}
+	return s.publicKey
+}
+
+func (s *remoteSigner) Sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	body, err := json.Marshal(remoteSignRequest{Algorithm: "SHA256", Digest: digest[:]})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("remote signer returned %s", resp.Status)
+	}
+
+	var signed remoteSignResponse
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		return nil, fmt.Errorf("could not decode remote signer response: %w", err)
+	}
+	if len(signed.Signature) == 0 {
+		return nil, ErrEmptyRemoteSignature
+	}
+	return signed.Signature, nil
+}
@@ -0,0 +1,77 @@
+package retrieval
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRemoteSigner(t *testing.T) {
+	_, err := NewRemoteSigner("https://signer.internal/sign", "", nil)
+	assert.Nil(t, err)
+
+	_, err = NewRemoteSigner("signer.internal/sign", "", nil)
+	assert.EqualError(t, err, `remote signer URL "signer.internal/sign" must be an absolute http or https URL`)
+
+	_, err = NewRemoteSigner("ftp://signer.internal/sign", "", nil)
+	assert.EqualError(t, err, `remote signer URL "ftp://signer.internal/sign" must be an absolute http or https URL`)
+}
+
+func TestRemoteSign(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// Stands in for the signing service
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req remoteSignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Algorithm != "SHA256" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		sig, _ := privateKey.Sign(rand.Reader, req.Digest, crypto.SHA256)
+		json.NewEncoder(w).Encode(remoteSignResponse{Signature: sig})
+	}))
+	defer server.Close()
+
+	data := []byte("export data")
+	digest := sha256.Sum256(data)
+
+	s, _ := NewRemoteSigner(server.URL, "token", nil)
+	sig, err := s.Sign(data)
+	assert.Nil(t, err)
+
+	var esig struct {
+		R, S *big.Int
+	}
+	asn1.Unmarshal(sig, &esig)
+	assert.True(t, ecdsa.Verify(&privateKey.PublicKey, digest[:], esig.R, esig.S), "signer should return a valid signature")
+
+	s, _ = NewRemoteSigner(server.URL, "wrong", nil)
+	_, err = s.Sign(data)
+	assert.EqualError(t, err, "remote signer returned 401 Unauthorized")
+}
+
+func TestRemoteSign_EmptySignature(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	s, _ := NewRemoteSigner(server.URL, "", nil)
+	_, err := s.Sign([]byte("export data"))
+	assert.Equal(t, ErrEmptyRemoteSignature, err)
+}
@@ -2,10 +2,14 @@ package retrieval
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"io"
+	"sort"
 	"time"
 
+	"github.com/cds-snc/covid-alert-server/pkg/config"
 	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
 
 	"github.com/Shopify/goose/logger"
@@ -16,14 +20,15 @@ var log = logger.New("retrieval")
 
 const (
 	maxKeysPerFile = 750000
+
+	// SignatureAlgorithm is the OID of ECDSA with SHA-256, which the protocol
+	// requires exports to be signed with.
+	SignatureAlgorithm = "1.2.840.10045.4.3.2"
 )
 
 var (
-	signatureAlgorithm     = "1.2.840.10045.4.3.2" // required by protocol
-	verificationKeyVersion = "v1"
-	verificationKeyID      = "302"
-	binHeader              = []byte("EK Export v1    ")
-	binHeaderLength        = 16
+	binHeader       = []byte("EK Export v1    ")
+	binHeaderLength = 16
 )
 
 func min(a, b int) int {
@@ -33,71 +38,153 @@ func min(a, b int) int {
 	return b
 }
 
-// It's still really unclear to me when A/G wants us to use MCC and when we're
-// expected/permitted to use some other identifier. It would be great to get
-// more clarity on this.
+// transformRegion returns the ISO code configured for an MCC region, which is
+// what Apple and Google expect in exports. Regions without one are passed
+// through unchanged.
 func transformRegion(reg string) string {
-	if reg == "302" {
-		return "CA"
+	if iso, ok := config.AppConstants.RegionISOCodes[reg]; ok {
+		return iso
 	}
 	return reg
 }
 
+// ServesRegion reports whether region is one of the configured regions.
+func ServesRegion(region string) bool {
+	_, ok := config.AppConstants.RegionISOCodes[region]
+	return ok
+}
+
+// Batch is the content of a single export file.
+type Batch struct {
+	Keys        []*pb.TemporaryExposureKey
+	RevisedKeys []*pb.TemporaryExposureKey
+}
+
+// BatchKeys splits keys and revised keys into groups of at most maxKeysPerFile
+// so that each group can be written out as its own signed export file. Revised
+// keys fill the space left after the keys. There is always at least one batch,
+// since an export with no keys is still a valid export.
+func BatchKeys(keys, revisedKeys []*pb.TemporaryExposureKey) []Batch {
+	return batchKeys(keys, revisedKeys, maxKeysPerFile)
+}
+
+func batchKeys(keys, revisedKeys []*pb.TemporaryExposureKey, size int) []Batch {
+	var batches []Batch
+	var current Batch
+	n := 0
+
+	for _, key := range keys {
+		if n == size {
+			batches = append(batches, current)
+			current, n = Batch{}, 0
+		}
+		current.Keys = append(current.Keys, key)
+		n++
+	}
+	for _, key := range revisedKeys {
+		if n == size {
+			batches = append(batches, current)
+			current, n = Batch{}, 0
+		}
+		current.RevisedKeys = append(current.RevisedKeys, key)
+		n++
+	}
+
+	return append(batches, current)
+}
+
+// KeysForHours returns the keys submitted from startHour up to endHour, sorted
+// by key data: grouping them by hour would give away when they were submitted.
+func KeysForHours(keysByHour map[uint32][]*pb.TemporaryExposureKey, startHour, endHour uint32) []*pb.TemporaryExposureKey {
+	var keys []*pb.TemporaryExposureKey
+	for hour := startHour; hour < endHour; hour++ {
+		keys = append(keys, keysByHour[hour]...)
+	}
+	sortKeys(keys)
+	return keys
+}
+
+// RevisedKeysForHours returns the latest revision of every key revised from
+// startHour up to endHour, sorted by key data.
+func RevisedKeysForHours(revisedByHour map[uint32][]*pb.TemporaryExposureKey, startHour, endHour uint32) []*pb.TemporaryExposureKey {
+	latest := make(map[string]*pb.TemporaryExposureKey)
+	for hour := startHour; hour < endHour; hour++ {
+		for _, key := range revisedByHour[hour] {
+			latest[string(key.GetKeyData())] = key
+		}
+	}
+
+	keys := make([]*pb.TemporaryExposureKey, 0, len(latest))
+	for _, key := range latest {
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+	return keys
+}
+
+func sortKeys(keys []*pb.TemporaryExposureKey) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i].GetKeyData(), keys[j].GetKeyData()) < 0
+	})
+}
+
+// SerializeTo writes all keys as a single export, i.e. batch 1 of 1.
 func SerializeTo(
 	ctx context.Context, w io.Writer,
 	keys []*pb.TemporaryExposureKey,
 	region string,
 	startTimestamp, endTimestamp time.Time,
-	signer Signer,
+	signingKeys SigningKeys,
 ) (int, error) {
-	zipw := zip.NewWriter(w)
-
-	one := int32(1)
-
-	start := uint64(startTimestamp.Unix())
-	end := uint64(endTimestamp.Unix())
+	return SerializeBatchTo(ctx, w, Batch{Keys: keys}, region, startTimestamp, endTimestamp, 1, 1, signingKeys)
+}
 
-	sigInfo := &pb.SignatureInfo{
-		VerificationKeyVersion: &verificationKeyVersion,
-		VerificationKeyId:      &verificationKeyID,
-		SignatureAlgorithm:     &signatureAlgorithm,
+// SerializeBatchTo writes one batch of a (possibly) multi-file export. Every
+// batch carries its own signature, and batchNum/batchSize let the EN framework
+// check that it received the complete set. The batch is signed with each of
+// the signing keys active now.
+func SerializeBatchTo(
+	ctx context.Context, w io.Writer,
+	batch Batch,
+	region string,
+	startTimestamp, endTimestamp time.Time,
+	batchNum, batchSize int,
+	signingKeys SigningKeys,
+) (int, error) {
+	activeKeys := signingKeys.Active(time.Now())
+	if len(activeKeys) == 0 {
+		return -1, ErrNoActiveSigningKey
 	}
 
-	region = transformRegion(region)
+	num := int32(batchNum)
+	size := int32(batchSize)
 
-	tekExport := &pb.TemporaryExposureKeyExport{
-		StartTimestamp: &start,
-		EndTimestamp:   &end,
-		Region:         &region,
-		BatchNum:       &one,
-		BatchSize:      &one,
-		SignatureInfos: []*pb.SignatureInfo{sigInfo},
-		Keys:           keys,
-	}
-
-	exportBinData, err := proto.Marshal(tekExport)
+	sigInfos, exportBinData, err := marshalExport(batch, region, startTimestamp, endTimestamp, batchNum, batchSize, activeKeys)
 	if err != nil {
 		return -1, err
 	}
 
-	sig, err := signer.Sign(append(binHeader, exportBinData...))
-	if err != nil {
-		return -1, err
-	}
+	signedData := append(binHeader, exportBinData...)
 
-	sigList := &pb.TEKSignatureList{
-		Signatures: []*pb.TEKSignature{&pb.TEKSignature{
-			SignatureInfo: sigInfo,
-			BatchNum:      &one,
-			BatchSize:     &one,
+	sigList := &pb.TEKSignatureList{}
+	for i, key := range activeKeys {
+		sig, err := key.Sign(signedData)
+		if err != nil {
+			return -1, err
+		}
+		sigList.Signatures = append(sigList.Signatures, &pb.TEKSignature{
+			SignatureInfo: sigInfos[i],
+			BatchNum:      &num,
+			BatchSize:     &size,
 			Signature:     sig,
-		}},
+		})
 	}
 	exportSigData, err := proto.Marshal(sigList)
 	if err != nil {
 		return -1, err
 	}
 
+	zipw := zip.NewWriter(w)
 	totalN := 0
 
 	f, err := zipw.Create("export.bin")
@@ -136,3 +223,65 @@ func SerializeTo(
 	return totalN, zipw.Close()
 }
 
+// ExportDigest returns the digest a batch is known by once serialized with
+// SerializeBatchTo (see NewBundle), without signing it.
+func ExportDigest(
+	batch Batch,
+	region string,
+	startTimestamp, endTimestamp time.Time,
+	batchNum, batchSize int,
+	signingKeys SigningKeys,
+) ([sha256.Size]byte, error) {
+	activeKeys := signingKeys.Active(time.Now())
+	if len(activeKeys) == 0 {
+		return [sha256.Size]byte{}, ErrNoActiveSigningKey
+	}
+
+	_, exportBinData, err := marshalExport(batch, region, startTimestamp, endTimestamp, batchNum, batchSize, activeKeys)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(append(append([]byte{}, binHeader...), exportBinData...)), nil
+}
+
+// marshalExport returns the export.bin content of a batch, less its header,
+// and the signature infos of the keys it's to be signed with.
+func marshalExport(
+	batch Batch,
+	region string,
+	startTimestamp, endTimestamp time.Time,
+	batchNum, batchSize int,
+	activeKeys SigningKeys,
+) ([]*pb.SignatureInfo, []byte, error) {
+	num := int32(batchNum)
+	size := int32(batchSize)
+
+	start := uint64(startTimestamp.Unix())
+	end := uint64(endTimestamp.Unix())
+
+	var sigInfos []*pb.SignatureInfo
+	for _, key := range activeKeys {
+		sigInfos = append(sigInfos, key.signatureInfo())
+	}
+
+	region = transformRegion(region)
+
+	tekExport := &pb.TemporaryExposureKeyExport{
+		StartTimestamp: &start,
+		EndTimestamp:   &end,
+		Region:         &region,
+		BatchNum:       &num,
+		BatchSize:      &size,
+		SignatureInfos: sigInfos,
+		Keys:           batch.Keys,
+		RevisedKeys:    batch.RevisedKeys,
+	}
+
+	// Deterministic, so the content (and the digest bundles are known by) is
+	// the same wherever and whenever the export is built
+	exportBinData, err := proto.MarshalOptions{Deterministic: true}.Marshal(tekExport)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sigInfos, exportBinData, nil
+}
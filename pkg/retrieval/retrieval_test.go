@@ -1,16 +1,22 @@
 package retrieval
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"crypto/rand"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	mockSigner "github.com/cds-snc/covid-alert-server/mocks/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/config"
 	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestMin(t *testing.T) {
@@ -35,18 +41,27 @@ func TestMin(t *testing.T) {
 }
 
 func TestTransformRegion(t *testing.T) {
+	oldCodes := config.AppConstants.RegionISOCodes
+	defer func() { config.AppConstants.RegionISOCodes = oldCodes }()
+	config.AppConstants.RegionISOCodes = map[string]string{"302": "CA", "310": "US"}
 
 	reg := "302"
+	otherReg := "310"
 	regBadOtherInt := "1233"
 	regBadString := "foo"
 
 	ExpectedReg := "CA"
+	ExpectedOtherReg := "US"
 	ExpectedRegBadInt := regBadOtherInt
 	ExpectedRegBadString := regBadString
 
 	assert.Equal(t, ExpectedReg, transformRegion(reg))
+	assert.Equal(t, ExpectedOtherReg, transformRegion(otherReg))
 	assert.Equal(t, ExpectedRegBadInt, transformRegion(regBadOtherInt))
 	assert.Equal(t, ExpectedRegBadString, transformRegion(regBadString))
+
+	assert.True(t, ServesRegion(otherReg))
+	assert.False(t, ServesRegion(regBadOtherInt))
 }
 
 func TestSerializeTo(t *testing.T) {
@@ -65,12 +80,155 @@ func TestSerializeTo(t *testing.T) {
 	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return(data, nil)
 
 	expectedTotal := 206
-	receivedTotal, receivedZip := SerializeTo(ctx, resp, keys, region, startTimestamp, endTimestamp, signer)
+	receivedTotal, receivedZip := SerializeTo(ctx, resp, keys, region, startTimestamp, endTimestamp, defaultSigningKeys(signer))
 
 	assert.Equal(t, expectedTotal, receivedTotal)
 	assert.Nil(t, receivedZip)
 }
 
+func TestBatchKeys(t *testing.T) {
+	keys := []*pb.TemporaryExposureKey{randomTestKey(), randomTestKey(), randomTestKey(), randomTestKey(), randomTestKey()}
+
+	batches := batchKeys(keys, nil, 2)
+	assert.Equal(t, 3, len(batches), "should split 5 keys into 3 batches of at most 2")
+	assert.Equal(t, keys[0:2], batches[0].Keys)
+	assert.Equal(t, keys[2:4], batches[1].Keys)
+	assert.Equal(t, keys[4:5], batches[2].Keys)
+
+	batches = batchKeys(keys, nil, 5)
+	assert.Equal(t, []Batch{{Keys: keys}}, batches, "should not split keys that fit in one batch")
+
+	batches = BatchKeys([]*pb.TemporaryExposureKey{}, nil)
+	assert.Equal(t, 1, len(batches), "should always return at least one batch")
+	assert.Equal(t, 0, len(batches[0].Keys))
+	assert.Equal(t, 0, len(batches[0].RevisedKeys))
+}
+
+func TestBatchKeys_RevisedKeys(t *testing.T) {
+	keys := []*pb.TemporaryExposureKey{randomTestKey(), randomTestKey(), randomTestKey()}
+	revisedKeys := []*pb.TemporaryExposureKey{randomTestKey(), randomTestKey()}
+
+	batches := batchKeys(keys, revisedKeys, 2)
+	assert.Equal(t, 3, len(batches), "should count revised keys towards the batch size")
+	assert.Equal(t, Batch{Keys: keys[0:2]}, batches[0])
+	assert.Equal(t, Batch{Keys: keys[2:3], RevisedKeys: revisedKeys[0:1]}, batches[1])
+	assert.Equal(t, Batch{RevisedKeys: revisedKeys[1:2]}, batches[2])
+
+	batches = BatchKeys(nil, revisedKeys)
+	assert.Equal(t, []Batch{{RevisedKeys: revisedKeys}}, batches)
+}
+
+func TestSerializeBatchTo(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/", nil)
+	ctx := req.Context()
+	buf := new(bytes.Buffer)
+	keys := []*pb.TemporaryExposureKey{randomTestKey(), randomTestKey()}
+	revisedKeys := []*pb.TemporaryExposureKey{randomTestKey()}
+	revisedKeys[0].ReportType = pb.TemporaryExposureKey_REVOKED.Enum()
+	signer := &mockSigner.Signer{}
+
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return([]byte("signature"), nil)
+
+	_, err := SerializeBatchTo(ctx, buf, Batch{Keys: keys, RevisedKeys: revisedKeys}, "302", time.Now(), time.Now().Add(1*time.Hour), 2, 3, defaultSigningKeys(signer))
+	assert.Nil(t, err)
+
+	zipr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+	assert.Equal(t, "export.bin", zipr.File[0].Name)
+	assert.Equal(t, "export.sig", zipr.File[1].Name)
+
+	f, _ := zipr.File[0].Open()
+	exportBin, _ := ioutil.ReadAll(f)
+	export := &pb.TemporaryExposureKeyExport{}
+	assert.Nil(t, proto.Unmarshal(exportBin[binHeaderLength:], export))
+	assert.Equal(t, int32(2), export.GetBatchNum())
+	assert.Equal(t, int32(3), export.GetBatchSize())
+	assert.Equal(t, 2, len(export.GetKeys()))
+	assert.Equal(t, 1, len(export.GetRevisedKeys()))
+	assert.Equal(t, pb.TemporaryExposureKey_REVOKED, export.GetRevisedKeys()[0].GetReportType())
+
+	f, _ = zipr.File[1].Open()
+	exportSig, _ := ioutil.ReadAll(f)
+	sigList := &pb.TEKSignatureList{}
+	assert.Nil(t, proto.Unmarshal(exportSig, sigList))
+	assert.Equal(t, int32(2), sigList.GetSignatures()[0].GetBatchNum())
+	assert.Equal(t, int32(3), sigList.GetSignatures()[0].GetBatchSize())
+	assert.Equal(t, []byte("signature"), sigList.GetSignatures()[0].GetSignature())
+}
+
+func TestExportDigest(t *testing.T) {
+	signer := &mockSigner.Signer{}
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return([]byte("signature"), nil)
+
+	batch := Batch{Keys: []*pb.TemporaryExposureKey{randomTestKey(), randomTestKey()}}
+	start := time.Unix(18431*86400, 0)
+	end := start.Add(24 * time.Hour)
+
+	digest, err := ExportDigest(batch, "302", start, end, 1, 2, defaultSigningKeys(signer))
+	assert.Nil(t, err)
+	signer.AssertNotCalled(t, "Sign", mock.Anything)
+
+	buf := new(bytes.Buffer)
+	_, err = SerializeBatchTo(context.Background(), buf, batch, "302", start, end, 1, 2, defaultSigningKeys(signer))
+	assert.Nil(t, err)
+	assert.Equal(t, NewBundle(buf.Bytes(), "application/zip", 2, time.Now()).Digest, digest, "should be the digest of the export once serialized")
+
+	_, err = ExportDigest(batch, "302", start, end, 1, 2, nil)
+	assert.Equal(t, ErrNoActiveSigningKey, err)
+}
+
+func TestSerializeBatchTo_SigningKeys(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/", nil)
+	ctx := req.Context()
+	keys := []*pb.TemporaryExposureKey{randomTestKey()}
+
+	oldSigner := &mockSigner.Signer{}
+	oldSigner.On("Sign", mock.AnythingOfType("[]uint8")).Return([]byte("old signature"), nil)
+	newSigner := &mockSigner.Signer{}
+	newSigner.On("Sign", mock.AnythingOfType("[]uint8")).Return([]byte("new signature"), nil)
+	retiredSigner := &mockSigner.Signer{}
+
+	signingKeys := SigningKeys{
+		{Signer: retiredSigner, Version: "v0", ID: "302", ValidUntil: time.Now().Add(-time.Hour)},
+		{Signer: oldSigner, Version: "v1", ID: "302", ValidUntil: time.Now().Add(time.Hour)},
+		{Signer: newSigner, Version: "v2", ID: "302", ValidFrom: time.Now().Add(-time.Hour)},
+	}
+
+	buf := new(bytes.Buffer)
+	_, err := SerializeBatchTo(ctx, buf, Batch{Keys: keys}, "302", time.Now(), time.Now().Add(1*time.Hour), 1, 1, signingKeys)
+	assert.Nil(t, err)
+
+	zipr, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+
+	f, _ := zipr.File[0].Open()
+	exportBin, _ := ioutil.ReadAll(f)
+	export := &pb.TemporaryExposureKeyExport{}
+	assert.Nil(t, proto.Unmarshal(exportBin[binHeaderLength:], export))
+	assert.Equal(t, 2, len(export.GetSignatureInfos()), "should only include active keys")
+	assert.Equal(t, "v1", export.GetSignatureInfos()[0].GetVerificationKeyVersion())
+	assert.Equal(t, "v2", export.GetSignatureInfos()[1].GetVerificationKeyVersion())
+
+	f, _ = zipr.File[1].Open()
+	exportSig, _ := ioutil.ReadAll(f)
+	sigList := &pb.TEKSignatureList{}
+	assert.Nil(t, proto.Unmarshal(exportSig, sigList))
+	assert.Equal(t, 2, len(sigList.GetSignatures()), "should sign with every active key")
+	assert.Equal(t, "v1", sigList.GetSignatures()[0].GetSignatureInfo().GetVerificationKeyVersion())
+	assert.Equal(t, []byte("old signature"), sigList.GetSignatures()[0].GetSignature())
+	assert.Equal(t, "v2", sigList.GetSignatures()[1].GetSignatureInfo().GetVerificationKeyVersion())
+	assert.Equal(t, []byte("new signature"), sigList.GetSignatures()[1].GetSignature())
+
+	retiredSigner.AssertNotCalled(t, "Sign", mock.Anything)
+
+	// No key is active
+	_, err = SerializeBatchTo(ctx, new(bytes.Buffer), Batch{Keys: keys}, "302", time.Now(), time.Now().Add(1*time.Hour), 1, 1, signingKeys[:1])
+	assert.Equal(t, ErrNoActiveSigningKey, err)
+}
+
+func defaultSigningKeys(signer Signer) SigningKeys {
+	return SigningKeys{{Signer: signer, Version: defaultVerificationKeyVersion, ID: defaultVerificationKeyID}}
+}
+
 func randomTestKey() *pb.TemporaryExposureKey {
 	token := make([]byte, 16)
 	rand.Read(token)
@@ -7,7 +7,16 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+
+	"google.golang.org/protobuf/proto"
 )
 
 type Signer interface {
@@ -18,22 +27,213 @@ type signer struct {
 	privateKey *ecdsa.PrivateKey
 }
 
-func NewSigner() Signer {
-	ecdsaKeyHex := os.Getenv("ECDSA_KEY")
+// publicKeyer is implemented by signers that know their public key.
+type publicKeyer interface {
+	Public() crypto.PublicKey
+}
+
+// ErrNoActiveSigningKey is returned when an export would have to be signed at a
+// time none of the configured signing keys are valid for.
+var ErrNoActiveSigningKey = errors.New("no active signing key")
+
+// Used when no signing keys are configured, to match the key registered with
+// Apple and Google before rotation was supported.
+const (
+	defaultVerificationKeyVersion = "v1"
+	defaultVerificationKeyID      = "302"
+	defaultSigningKeyEnv          = "ECDSA_KEY"
+)
+
+// Signer backends that can be selected for a signing key.
+const (
+	EnvSignerBackend    = "env"
+	PEMSignerBackend    = "pem"
+	RemoteSignerBackend = "remote"
+)
+
+// ErrUnknownSignerBackend is returned for a signing key configured with a
+// backend other than the ones above.
+var ErrUnknownSignerBackend = errors.New("unknown signer backend")
+
+// NewSigner returns a signer using the hex-encoded DER private key in ECDSA_KEY.
+func NewSigner() (Signer, error) {
+	return NewEnvSigner("ECDSA_KEY")
+}
+
+// NewEnvSigner returns a signer using the hex-encoded DER private key in the
+// environment variable env.
+func NewEnvSigner(env string) (Signer, error) {
+	ecdsaKeyHex := os.Getenv(env)
 	if ecdsaKeyHex == "" {
-		panic("no ECDSA_KEY")
+		return nil, fmt.Errorf("no %s", env)
 	}
 	ecdsaKey, err := hex.DecodeString(ecdsaKeyHex)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%s is not hex encoded: %w", env, err)
 	}
 
 	priv, err := x509.ParseECPrivateKey(ecdsaKey)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%s is not an EC private key: %w", env, err)
+	}
+
+	return &signer{privateKey: priv}, nil
+}
+
+// SigningKey is a key exports are signed with. Version and ID identify the
+// public key registered with Apple and Google, and the key is only used
+// between ValidFrom and ValidUntil. A zero time leaves that end of the window
+// open.
+type SigningKey struct {
+	Signer
+	Version    string
+	ID         string
+	ValidFrom  time.Time
+	ValidUntil time.Time
+}
+
+// ActiveAt reports whether the key may sign exports at t.
+func (k SigningKey) ActiveAt(t time.Time) bool {
+	if !k.ValidFrom.IsZero() && t.Before(k.ValidFrom) {
+		return false
+	}
+	if !k.ValidUntil.IsZero() && !t.Before(k.ValidUntil) {
+		return false
+	}
+	return true
+}
+
+// PublicKey returns the public key matching the key's signer, or nil if the
+// signer can't provide it.
+func (k SigningKey) PublicKey() *ecdsa.PublicKey {
+	p, ok := k.Signer.(publicKeyer)
+	if !ok {
+		return nil
+	}
+	publicKey, _ := p.Public().(*ecdsa.PublicKey)
+	return publicKey
+}
+
+func (k SigningKey) signatureInfo() *pb.SignatureInfo {
+	return &pb.SignatureInfo{
+		VerificationKeyVersion: proto.String(k.Version),
+		VerificationKeyId:      proto.String(k.ID),
+		SignatureAlgorithm:     proto.String(SignatureAlgorithm),
+	}
+}
+
+// SigningKeys are all of the configured signing keys. Exports carry a
+// signature from every key active when they are written, so a new key can be
+// introduced while the old one is still trusted and retired later.
+type SigningKeys []SigningKey
+
+// Active returns the keys that may sign exports at t.
+func (keys SigningKeys) Active(t time.Time) []SigningKey {
+	var active []SigningKey
+	for _, key := range keys {
+		if key.ActiveAt(t) {
+			active = append(active, key)
+		}
+	}
+	return active
+}
+
+// Version returns the key with the given version, whether or not it's active
+// now.
+func (keys SigningKeys) Version(version string) (SigningKey, bool) {
+	for _, key := range keys {
+		if key.Version == version {
+			return key, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+// NewSigningKeys loads the signing keys described by configs, using the
+// backend each one names. With no configs, the key in ECDSA_KEY is used as
+// version "v1" with ID "302".
+func NewSigningKeys(configs []config.SigningKey) (SigningKeys, error) {
+	if len(configs) == 0 {
+		configs = []config.SigningKey{{
+			Version: defaultVerificationKeyVersion,
+			ID:      defaultVerificationKeyID,
+			KeyEnv:  defaultSigningKeyEnv,
+		}}
 	}
 
-	return &signer{privateKey: priv}
+	var keys SigningKeys
+	for _, c := range configs {
+		if c.Version == "" || c.ID == "" {
+			return nil, errors.New("signing keys need a version and id")
+		}
+
+		s, err := newSignerForKey(c)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s/%s: %w", c.ID, c.Version, err)
+		}
+
+		key := SigningKey{Signer: s, Version: c.Version, ID: c.ID}
+		if key.ValidFrom, err = parseValidityTime(c.ValidFrom); err != nil {
+			return nil, fmt.Errorf("signing key %s/%s: validFrom: %w", c.ID, c.Version, err)
+		}
+		if key.ValidUntil, err = parseValidityTime(c.ValidUntil); err != nil {
+			return nil, fmt.Errorf("signing key %s/%s: validUntil: %w", c.ID, c.Version, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func newSignerForKey(c config.SigningKey) (Signer, error) {
+	switch c.Backend {
+	case "", EnvSignerBackend:
+		if c.KeyEnv == "" {
+			return nil, errors.New("keyEnv is required")
+		}
+		return NewEnvSigner(c.KeyEnv)
+	case PEMSignerBackend:
+		if c.KeyFile == "" {
+			return nil, errors.New("keyFile is required")
+		}
+		var passphrase []byte
+		if c.PassphraseEnv != "" {
+			passphrase = []byte(os.Getenv(c.PassphraseEnv))
+		}
+		return NewPEMSigner(c.KeyFile, passphrase)
+	case RemoteSignerBackend:
+		var token string
+		if c.TokenEnv != "" {
+			token = os.Getenv(c.TokenEnv)
+			if token == "" {
+				return nil, fmt.Errorf("no %s", c.TokenEnv)
+			}
+		}
+		var publicKey *ecdsa.PublicKey
+		if c.PublicKeyFile != "" {
+			data, err := ioutil.ReadFile(c.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			publicKey, err = ParsePublicKey(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", c.PublicKeyFile, err)
+			}
+		}
+		return NewRemoteSigner(c.URL, token, publicKey)
+	default:
+		return nil, ErrUnknownSignerBackend
+	}
+}
+
+func parseValidityTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (s *signer) Public() crypto.PublicKey {
+	return s.privateKey.Public()
 }
 
 func (s *signer) Sign(data []byte) ([]byte, error) {
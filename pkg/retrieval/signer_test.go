@@ -8,31 +8,42 @@ import (
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
 	"math/big"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/cds-snc/covid-alert-server/pkg/config"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNewSigner(t *testing.T) {
 
 	os.Setenv("ECDSA_KEY", "")
-	assert.PanicsWithValue(t, "no ECDSA_KEY", func() { NewSigner() }, "ECDSA_KEY needs to be defined")
+	_, err := NewSigner()
+	assert.EqualError(t, err, "no ECDSA_KEY", "ECDSA_KEY needs to be defined")
 
 	os.Setenv("ECDSA_KEY", strings.Repeat("z", 242))
-	assert.PanicsWithError(t, "encoding/hex: invalid byte: U+007A 'z'", func() { NewSigner() }, "ECDSA_KEY needs to be a valid hex sting")
+	_, err = NewSigner()
+	assert.EqualError(t, err, "ECDSA_KEY is not hex encoded: encoding/hex: invalid byte: U+007A 'z'", "ECDSA_KEY needs to be a valid hex sting")
 
 	os.Setenv("ECDSA_KEY", strings.Repeat("a", 242))
-	assert.PanicsWithError(t, "x509: failed to parse EC private key: asn1: structure error: length too large", func() { NewSigner() }, "ECDSA_KEY needs to be a x509 cert")
+	_, err = NewSigner()
+	assert.EqualError(t, err, "ECDSA_KEY is not an EC private key: x509: failed to parse EC private key: asn1: structure error: length too large", "ECDSA_KEY needs to be a x509 cert")
 
 	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	data, _ := x509.MarshalECPrivateKey(privateKey)
 	os.Setenv("ECDSA_KEY", hex.EncodeToString(data))
 
 	expected := &signer{privateKey: privateKey}
-	assert.Equal(t, NewSigner(), expected, "should return a signer struct with a private key")
+	received, err := NewSigner()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, received, "should return a signer struct with a private key")
 
 }
 
@@ -43,7 +54,7 @@ func TestSign(t *testing.T) {
 	data, _ := x509.MarshalECPrivateKey(privateKey)
 	os.Setenv("ECDSA_KEY", hex.EncodeToString(data))
 
-	signer := NewSigner()
+	signer, _ := NewSigner()
 
 	data = []byte(strings.Repeat("a", 10))
 	digest := sha256.Sum256(data)
@@ -60,3 +71,114 @@ func TestSign(t *testing.T) {
 	assert.Equal(t, receivedValidation, expectedValidation, "signer should return a valid signature")
 	assert.Equal(t, receivedError, nil, "signer should not return an error")
 }
+
+func TestSigningKeyActiveAt(t *testing.T) {
+	now := time.Now()
+
+	assert.True(t, SigningKey{}.ActiveAt(now), "a key without a window is always active")
+	assert.True(t, SigningKey{ValidFrom: now}.ActiveAt(now))
+	assert.False(t, SigningKey{ValidFrom: now.Add(time.Second)}.ActiveAt(now))
+	assert.True(t, SigningKey{ValidUntil: now.Add(time.Second)}.ActiveAt(now))
+	assert.False(t, SigningKey{ValidUntil: now}.ActiveAt(now))
+
+	keys := SigningKeys{
+		{Version: "v1", ValidUntil: now},
+		{Version: "v2", ValidFrom: now},
+	}
+	assert.Equal(t, []SigningKey{keys[1]}, keys.Active(now))
+	assert.Equal(t, []SigningKey{keys[0]}, keys.Active(now.Add(-time.Second)))
+}
+
+func TestSigningKeysVersion(t *testing.T) {
+	now := time.Now()
+	keys := SigningKeys{
+		{Version: "v1", ValidUntil: now},
+		{Version: "v2", ValidFrom: now},
+	}
+
+	key, ok := keys.Version("v1")
+	assert.True(t, ok)
+	assert.Equal(t, keys[0], key)
+
+	_, ok = keys.Version("v3")
+	assert.False(t, ok)
+}
+
+func TestNewSigningKeys(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	data, _ := x509.MarshalECPrivateKey(privateKey)
+	os.Setenv("ECDSA_KEY", hex.EncodeToString(data))
+	os.Setenv("ECDSA_KEY_V2", hex.EncodeToString(data))
+	defer os.Unsetenv("ECDSA_KEY_V2")
+
+	// Defaults to ECDSA_KEY
+	keys, err := NewSigningKeys(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, SigningKeys{{Signer: &signer{privateKey: privateKey}, Version: "v1", ID: "302"}}, keys)
+
+	validUntil, _ := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	keys, err = NewSigningKeys([]config.SigningKey{
+		{Version: "v1", ID: "302", KeyEnv: "ECDSA_KEY", ValidUntil: "2021-01-01T00:00:00Z"},
+		{Version: "v2", ID: "302", KeyEnv: "ECDSA_KEY_V2", ValidFrom: "2020-12-01T00:00:00Z"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(keys))
+	assert.Equal(t, validUntil, keys[0].ValidUntil)
+	assert.True(t, keys[0].ValidFrom.IsZero())
+	assert.Equal(t, "v2", keys[1].Version)
+
+	_, err = NewSigningKeys([]config.SigningKey{{Version: "v3", ID: "302", KeyEnv: "ECDSA_KEY_V3"}})
+	assert.EqualError(t, err, "signing key 302/v3: no ECDSA_KEY_V3")
+
+	_, err = NewSigningKeys([]config.SigningKey{{ID: "302", KeyEnv: "ECDSA_KEY"}})
+	assert.EqualError(t, err, "signing keys need a version and id")
+
+	_, err = NewSigningKeys([]config.SigningKey{{Version: "v1", ID: "302"}})
+	assert.EqualError(t, err, "signing key 302/v1: keyEnv is required")
+
+	_, err = NewSigningKeys([]config.SigningKey{{Version: "v1", ID: "302", Backend: "pem"}})
+	assert.EqualError(t, err, "signing key 302/v1: keyFile is required")
+
+	_, err = NewSigningKeys([]config.SigningKey{{Version: "v1", ID: "302", Backend: "hsm"}})
+	assert.True(t, errors.Is(err, ErrUnknownSignerBackend))
+
+	keys, err = NewSigningKeys([]config.SigningKey{{Version: "v1", ID: "302", Backend: "remote", URL: "https://signer.internal/sign"}})
+	assert.Nil(t, err)
+	assert.IsType(t, &remoteSigner{}, keys[0].Signer)
+
+	os.Setenv("SIGNER_TOKEN", "token")
+	defer os.Unsetenv("SIGNER_TOKEN")
+	keys, err = NewSigningKeys([]config.SigningKey{{Version: "v1", ID: "302", Backend: "remote", URL: "https://signer.internal/sign", TokenEnv: "SIGNER_TOKEN"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "token", keys[0].Signer.(*remoteSigner).token)
+
+	_, err = NewSigningKeys([]config.SigningKey{{Version: "v1", ID: "302", Backend: "remote", URL: "https://signer.internal/sign", TokenEnv: "SIGNER_MISSING_TOKEN"}})
+	assert.EqualError(t, err, "signing key 302/v1: no SIGNER_MISSING_TOKEN")
+
+	_, err = NewSigningKeys([]config.SigningKey{{Version: "v1", ID: "302", KeyEnv: "ECDSA_KEY", ValidFrom: "tomorrow"}})
+	assert.Contains(t, err.Error(), "signing key 302/v1: validFrom:")
+}
+
+func TestSigningKeyPublicKey(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	key := SigningKey{Signer: &signer{privateKey: privateKey}}
+	assert.Equal(t, &privateKey.PublicKey, key.PublicKey())
+
+	// Remote signers only know their public key if it's configured
+	dir, _ := ioutil.TempDir("", "public-key")
+	defer os.RemoveAll(dir)
+	der, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	path := writePEM(t, dir, "public.pem", &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	keys, err := NewSigningKeys([]config.SigningKey{
+		{Version: "v1", ID: "302", Backend: "remote", URL: "https://signer.internal/sign"},
+		{Version: "v2", ID: "302", Backend: "remote", URL: "https://signer.internal/sign", PublicKeyFile: path},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, keys[0].PublicKey())
+	assert.Equal(t, &privateKey.PublicKey, keys[1].PublicKey())
+
+	_, err = NewSigningKeys([]config.SigningKey{{Version: "v1", ID: "302", Backend: "remote", URL: "https://signer.internal/sign", PublicKeyFile: filepath.Join(dir, "missing.pem")}})
+	assert.True(t, os.IsNotExist(errors.Unwrap(err)))
+}
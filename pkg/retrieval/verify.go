@@ -0,0 +1,366 @@
+package retrieval
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrMissingExportFile   = errors.New("archive is missing export.bin or export.sig")
+	ErrInvalidExportHeader = errors.New("export.bin does not start with the export header")
+	ErrNotECDSAPublicKey   = errors.New("public key is not an ECDSA key")
+)
+
+// Keys older than this, relative to the end of the export, should have been
+// pruned before the export was written.
+const maxKeyAgeIntervals = 144 * 15
+
+// ExportReport describes an export archive and everything that was found
+// wrong with it. An export is only good if Problems is empty.
+type ExportReport struct {
+	FormatVersion  int
+	StartTimestamp time.Time
+	EndTimestamp   time.Time
+	Region         string
+	BatchNum       int32
+	BatchSize      int32
+	Keys           int
+	RevisedKeys    int
+	Locations      int
+	Signatures     []SignatureReport
+	Problems       []string
+
+	// ExportProblems are the Problems with the export as a whole, rather than
+	// with any one key in it.
+	ExportProblems []string
+	// BadKeys and BadRevisedKeys hold the indexes of the keys, and revised
+	// keys, that the rest of Problems are about.
+	BadKeys        map[int]bool
+	BadRevisedKeys map[int]bool
+}
+
+// SignatureReport is the outcome of checking one signature in export.sig.
+type SignatureReport struct {
+	Version   string
+	ID        string
+	Algorithm string
+	Valid     bool
+}
+
+// OK reports whether the export passed every check.
+func (r *ExportReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *ExportReport) problem(format string, args ...interface{}) {
+	problem := fmt.Sprintf(format, args...)
+	r.Problems = append(r.Problems, problem)
+	r.ExportProblems = append(r.ExportProblems, problem)
+}
+
+func (r *ExportReport) keyProblem(bad map[int]bool, i int, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+	bad[i] = true
+}
+
+// ParsePublicKey reads a PEM encoded ECDSA public key, as registered with
+// Apple and Google.
+func ParsePublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, ErrNotECDSAPublicKey
+	}
+	return ecKey, nil
+}
+
+// VerifyExport checks a /retrieve archive: the export header, every signature
+// in export.sig against publicKey, and the keys in the export. Errors are only
+// returned if the archive can't be read at all; anything else wrong with it is
+// recorded in the report.
+func VerifyExport(data []byte, publicKey *ecdsa.PublicKey) (*ExportReport, error) {
+	exportBin, exportSig, err := readExportArchive(data)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(exportBin, binHeader) {
+		return nil, ErrInvalidExportHeader
+	}
+
+	export := &pb.TemporaryExposureKeyExport{}
+	if err := proto.Unmarshal(exportBin[binHeaderLength:], export); err != nil {
+		return nil, fmt.Errorf("could not decode export.bin: %w", err)
+	}
+	sigList := &pb.TEKSignatureList{}
+	if err := proto.Unmarshal(exportSig, sigList); err != nil {
+		return nil, fmt.Errorf("could not decode export.sig: %w", err)
+	}
+
+	report := &ExportReport{
+		FormatVersion:  1,
+		StartTimestamp: time.Unix(int64(export.GetStartTimestamp()), 0).UTC(),
+		EndTimestamp:   time.Unix(int64(export.GetEndTimestamp()), 0).UTC(),
+		Region:         export.GetRegion(),
+		BatchNum:       export.GetBatchNum(),
+		BatchSize:      export.GetBatchSize(),
+		Keys:           len(export.GetKeys()),
+		RevisedKeys:    len(export.GetRevisedKeys()),
+		BadKeys:        make(map[int]bool),
+		BadRevisedKeys: make(map[int]bool),
+	}
+
+	checkWindow(report)
+
+	var sigs []exportSignature
+	for _, sig := range sigList.GetSignatures() {
+		sigs = append(sigs, sig)
+	}
+	checkSignatures(report, publicKey, exportBin, export.GetSignatureInfos(), sigs)
+
+	checkKeys(report, "key", export.GetKeys(), false, report.BadKeys)
+	checkKeys(report, "revised key", export.GetRevisedKeys(), true, report.BadRevisedKeys)
+
+	return report, nil
+}
+
+// VerifyOutbreakExport checks a /qr archive, in either format. Version 1
+// exports have no header and a single bare signature over export.bin; version
+// 2 exports are laid out like TEK exports.
+func VerifyOutbreakExport(data []byte, publicKey *ecdsa.PublicKey) (*ExportReport, error) {
+	exportBin, exportSig, err := readExportArchive(data)
+	if err != nil {
+		return nil, err
+	}
+
+	v2 := bytes.HasPrefix(exportBin, qrBinHeader)
+	body := exportBin
+	if v2 {
+		body = exportBin[len(qrBinHeader):]
+	}
+
+	export := &pb.OutbreakEventExport{}
+	if err := proto.Unmarshal(body, export); err != nil {
+		return nil, fmt.Errorf("could not decode export.bin: %w", err)
+	}
+
+	report := &ExportReport{
+		FormatVersion:  1,
+		StartTimestamp: time.Unix(int64(export.GetStartTimestamp()), 0).UTC(),
+		EndTimestamp:   time.Unix(int64(export.GetEndTimestamp()), 0).UTC(),
+		Locations:      len(export.GetLocations()),
+	}
+
+	checkWindow(report)
+
+	if v2 {
+		sigList := &pb.OutbreakEventExportSignatureList{}
+		if err := proto.Unmarshal(exportSig, sigList); err != nil {
+			return nil, fmt.Errorf("could not decode export.sig: %w", err)
+		}
+		report.FormatVersion = 2
+		report.BatchNum = export.GetBatchNum()
+		report.BatchSize = export.GetBatchSize()
+
+		var sigs []exportSignature
+		for _, sig := range sigList.GetSignatures() {
+			sigs = append(sigs, sig)
+		}
+		checkSignatures(report, publicKey, exportBin, export.GetSignatureInfos(), sigs)
+	} else {
+		sig := &pb.OutbreakEventExportSignature{}
+		if err := proto.Unmarshal(exportSig, sig); err != nil {
+			return nil, fmt.Errorf("could not decode export.sig: %w", err)
+		}
+		sigReport := SignatureReport{Valid: verifySignature(publicKey, exportBin, sig.GetSignature())}
+		report.Signatures = append(report.Signatures, sigReport)
+		if !sigReport.Valid {
+			report.problem("signature does not verify against the public key")
+		}
+	}
+
+	for i, location := range export.GetLocations() {
+		if location.GetLocationId() == "" {
+			report.problem("location %d has no location id", i)
+		}
+		if location.GetStartTime() == nil || location.GetEndTime() == nil {
+			report.problem("location %d is missing a start or end time", i)
+		} else if location.GetStartTime().GetSeconds() >= location.GetEndTime().GetSeconds() {
+			report.problem("location %d ends before it starts", i)
+		}
+	}
+
+	return report, nil
+}
+
+func readExportArchive(data []byte) (exportBin, exportSig []byte, err error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range zr.File {
+		var dst *[]byte
+		switch f.Name {
+		case "export.bin":
+			dst = &exportBin
+		case "export.sig":
+			dst = &exportSig
+		default:
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		*dst, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if exportBin == nil || exportSig == nil {
+		return nil, nil, ErrMissingExportFile
+	}
+	return exportBin, exportSig, nil
+}
+
+// exportSignature is implemented by both TEKSignature and
+// OutbreakEventExportSignature.
+type exportSignature interface {
+	GetSignatureInfo() *pb.SignatureInfo
+	GetBatchNum() int32
+	GetBatchSize() int32
+	GetSignature() []byte
+}
+
+// checkSignatures checks the batch fields and every signature of an export
+// that carries SignatureInfos. At least one signature has to verify against
+// publicKey.
+func checkSignatures(report *ExportReport, publicKey *ecdsa.PublicKey, signedData []byte, infos []*pb.SignatureInfo, sigs []exportSignature) {
+	if report.BatchSize < 1 || report.BatchNum < 1 || report.BatchNum > report.BatchSize {
+		report.problem("batch %d of %d is not a valid batch", report.BatchNum, report.BatchSize)
+	}
+	if len(infos) == 0 {
+		report.problem("export has no signature infos")
+	}
+	if len(sigs) == 0 {
+		report.problem("export.sig has no signatures")
+		return
+	}
+
+	anyValid := false
+	for i, sig := range sigs {
+		info := sig.GetSignatureInfo()
+		sigReport := SignatureReport{
+			Version:   info.GetVerificationKeyVersion(),
+			ID:        info.GetVerificationKeyId(),
+			Algorithm: info.GetSignatureAlgorithm(),
+			Valid:     verifySignature(publicKey, signedData, sig.GetSignature()),
+		}
+		report.Signatures = append(report.Signatures, sigReport)
+		anyValid = anyValid || sigReport.Valid
+
+		if sig.GetBatchNum() != report.BatchNum || sig.GetBatchSize() != report.BatchSize {
+			report.problem("signature %d is for batch %d of %d", i, sig.GetBatchNum(), sig.GetBatchSize())
+		}
+		if !hasSignatureInfo(infos, info) {
+			report.problem("signature %d (%s/%s) is not listed in the export's signature infos", i, sigReport.Version, sigReport.ID)
+		}
+	}
+	if !anyValid {
+		report.problem("no signature verifies against the public key")
+	}
+}
+
+func verifySignature(publicKey *ecdsa.PublicKey, data, sig []byte) bool {
+	var esig struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(sig, &esig); err != nil || len(rest) != 0 {
+		return false
+	}
+	digest := sha256.Sum256(data)
+	return ecdsa.Verify(publicKey, digest[:], esig.R, esig.S)
+}
+
+func hasSignatureInfo(infos []*pb.SignatureInfo, info *pb.SignatureInfo) bool {
+	for _, candidate := range infos {
+		if proto.Equal(candidate, info) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkWindow(report *ExportReport) {
+	if !report.StartTimestamp.Before(report.EndTimestamp) {
+		report.problem("export window %s to %s is empty", report.StartTimestamp, report.EndTimestamp)
+	}
+}
+
+func checkKeys(report *ExportReport, kind string, keys []*pb.TemporaryExposureKey, revised bool, bad map[int]bool) {
+	endInterval := int32(report.EndTimestamp.Unix() / 600)
+	seen := make(map[string]bool, len(keys))
+
+	for i, key := range keys {
+		id := hex.EncodeToString(key.GetKeyData())
+		if len(key.GetKeyData()) != 16 {
+			report.keyProblem(bad, i, "%s %d has %d bytes of key data", kind, i, len(key.GetKeyData()))
+		} else if seen[id] {
+			report.keyProblem(bad, i, "%s %d (%s) appears more than once", kind, i, id)
+		}
+		seen[id] = true
+
+		if key.GetRollingPeriod() < 1 || key.GetRollingPeriod() > 144 {
+			report.keyProblem(bad, i, "%s %d has rolling period %d", kind, i, key.GetRollingPeriod())
+		}
+		if level := key.GetTransmissionRiskLevel(); level < 0 || level > 8 {
+			report.keyProblem(bad, i, "%s %d has transmission risk level %d", kind, i, level)
+		}
+
+		rsin := key.GetRollingStartIntervalNumber()
+		if rsin <= 0 {
+			report.keyProblem(bad, i, "%s %d has rolling start interval number %d", kind, i, rsin)
+		} else if rsin >= endInterval {
+			report.keyProblem(bad, i, "%s %d starts after the export window ends", kind, i)
+		} else if rsin+key.GetRollingPeriod() < endInterval-maxKeyAgeIntervals {
+			report.keyProblem(bad, i, "%s %d expired more than 15 days before the export window ends", kind, i)
+		}
+
+		switch key.GetReportType() {
+		case pb.TemporaryExposureKey_CONFIRMED_TEST,
+			pb.TemporaryExposureKey_CONFIRMED_CLINICAL_DIAGNOSIS,
+			pb.TemporaryExposureKey_SELF_REPORT:
+		case pb.TemporaryExposureKey_REVOKED:
+			if !revised {
+				report.keyProblem(bad, i, "%s %d is revoked but not in revised keys", kind, i)
+			}
+		default:
+			report.keyProblem(bad, i, "%s %d has report type %s", kind, i, key.GetReportType())
+		}
+
+		if days := key.GetDaysSinceOnsetOfSymptoms(); days < -14 || days > 14 {
+			report.keyProblem(bad, i, "%s %d has %d days since onset of symptoms", kind, i, days)
+		}
+	}
+}
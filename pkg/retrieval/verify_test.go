@@ -0,0 +1,181 @@
+package retrieval
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func verifyTestExport(t *testing.T, privateKey *ecdsa.PrivateKey, keys []*pb.TemporaryExposureKey) []byte {
+	start := time.Unix(1602460800, 0)
+	var buf bytes.Buffer
+	_, err := SerializeBatchTo(context.Background(), &buf, Batch{Keys: keys}, "302", start, start.Add(24*time.Hour), 1, 1, defaultSigningKeys(&signer{privateKey: privateKey}))
+	assert.Nil(t, err)
+	return buf.Bytes()
+}
+
+func verifyTestKey(rsin int32) *pb.TemporaryExposureKey {
+	key := randomTestKey()
+	key.RollingStartIntervalNumber = &rsin
+	key.ReportType = pb.TemporaryExposureKey_CONFIRMED_TEST.Enum()
+	return key
+}
+
+func TestParsePublicKey(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+
+	publicKey, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	assert.Nil(t, err)
+	assert.Equal(t, &privateKey.PublicKey, publicKey)
+
+	_, err = ParsePublicKey([]byte("not pem"))
+	assert.EqualError(t, err, "no PEM data found")
+}
+
+func TestVerifyExport(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// Keys from a day or two before the export's window
+	rsin := int32(1602460800/600 - 144)
+	data := verifyTestExport(t, privateKey, []*pb.TemporaryExposureKey{verifyTestKey(rsin), verifyTestKey(rsin - 144)})
+
+	report, err := VerifyExport(data, &privateKey.PublicKey)
+	assert.Nil(t, err)
+	assert.True(t, report.OK(), "%v", report.Problems)
+	assert.Equal(t, "CA", report.Region)
+	assert.Equal(t, int32(1), report.BatchNum)
+	assert.Equal(t, int32(1), report.BatchSize)
+	assert.Equal(t, 2, report.Keys)
+	assert.Equal(t, time.Unix(1602460800, 0).UTC(), report.StartTimestamp)
+	assert.Equal(t, []SignatureReport{{Version: "v1", ID: "302", Algorithm: "1.2.840.10045.4.3.2", Valid: true}}, report.Signatures)
+
+	// Signed by someone else
+	report, err = VerifyExport(data, &otherKey.PublicKey)
+	assert.Nil(t, err)
+	assert.False(t, report.Signatures[0].Valid)
+	assert.Equal(t, []string{"no signature verifies against the public key"}, report.Problems)
+	assert.Equal(t, report.Problems, report.ExportProblems)
+	assert.Empty(t, report.BadKeys)
+}
+
+func TestVerifyExport_KeyProblems(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	rsin := int32(1602460800/600 - 144)
+	duplicate := verifyTestKey(rsin)
+	short := verifyTestKey(rsin)
+	short.KeyData = short.KeyData[:8]
+	future := verifyTestKey(rsin + 144*3)
+	expired := verifyTestKey(rsin - 144*20)
+	revoked := verifyTestKey(rsin)
+	revoked.ReportType = pb.TemporaryExposureKey_REVOKED.Enum()
+	risky := verifyTestKey(rsin)
+	risky.TransmissionRiskLevel = proto.Int32(9)
+
+	data := verifyTestExport(t, privateKey, []*pb.TemporaryExposureKey{duplicate, duplicate, short, future, expired, revoked, risky})
+
+	report, err := VerifyExport(data, &privateKey.PublicKey)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"key 1 (" + hexKey(duplicate) + ") appears more than once",
+		"key 2 has 8 bytes of key data",
+		"key 3 starts after the export window ends",
+		"key 4 expired more than 15 days before the export window ends",
+		"key 5 is revoked but not in revised keys",
+		"key 6 has transmission risk level 9",
+	}, report.Problems)
+	assert.Empty(t, report.ExportProblems)
+	assert.Equal(t, map[int]bool{1: true, 2: true, 3: true, 4: true, 5: true, 6: true}, report.BadKeys)
+}
+
+func TestVerifyExport_Unreadable(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	_, err := VerifyExport([]byte("not a zip"), &privateKey.PublicKey)
+	assert.NotNil(t, err)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, _ := zw.Create("export.bin")
+	f.Write([]byte("no header here"))
+	f, _ = zw.Create("export.sig")
+	f.Write([]byte{})
+	zw.Close()
+
+	_, err = VerifyExport(buf.Bytes(), &privateKey.PublicKey)
+	assert.Equal(t, ErrInvalidExportHeader, err)
+
+	buf.Reset()
+	zw = zip.NewWriter(&buf)
+	zw.Create("export.bin")
+	zw.Close()
+
+	_, err = VerifyExport(buf.Bytes(), &privateKey.PublicKey)
+	assert.Equal(t, ErrMissingExportFile, err)
+}
+
+func TestVerifyOutbreakExport(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	var buf bytes.Buffer
+	start := time.Unix(1613238163, 0)
+	_, err := SerializeOutbreakEventsTo(context.Background(), &buf, []*pb.OutbreakEvent{randomTestOutbreakEvent()}, start, start.Add(24*time.Hour), &signer{privateKey: privateKey})
+	assert.Nil(t, err)
+
+	report, err := VerifyOutbreakExport(buf.Bytes(), &privateKey.PublicKey)
+	assert.Nil(t, err)
+	assert.True(t, report.OK(), "%v", report.Problems)
+	assert.Equal(t, 1, report.FormatVersion)
+	assert.Equal(t, 1, report.Locations)
+
+	report, err = VerifyOutbreakExport(buf.Bytes(), &otherKey.PublicKey)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"signature does not verify against the public key"}, report.Problems)
+}
+
+func TestVerifyOutbreakExport_V2(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// Signed by both keys during a rotation
+	signingKeys := SigningKeys{
+		{Signer: &signer{privateKey: otherKey}, Version: "v1", ID: "302"},
+		{Signer: &signer{privateKey: privateKey}, Version: "v2", ID: "302"},
+	}
+
+	var buf bytes.Buffer
+	start := time.Unix(1613238163, 0)
+	_, err := SerializeOutbreakEventBatchTo(context.Background(), &buf, []*pb.OutbreakEvent{randomTestOutbreakEvent()}, start, start.Add(24*time.Hour), 1, 1, signingKeys)
+	assert.Nil(t, err)
+
+	report, err := VerifyOutbreakExport(buf.Bytes(), &privateKey.PublicKey)
+	assert.Nil(t, err)
+	assert.True(t, report.OK(), "%v", report.Problems)
+	assert.Equal(t, 2, report.FormatVersion)
+	assert.Equal(t, int32(1), report.BatchNum)
+	assert.Equal(t, int32(1), report.BatchSize)
+	assert.Equal(t, 1, report.Locations)
+	assert.Equal(t, []SignatureReport{
+		{Version: "v1", ID: "302", Algorithm: SignatureAlgorithm, Valid: false},
+		{Version: "v2", ID: "302", Algorithm: SignatureAlgorithm, Valid: true},
+	}, report.Signatures)
+}
+
+func hexKey(key *pb.TemporaryExposureKey) string {
+	return fmt.Sprintf("%x", key.GetKeyData())
+}
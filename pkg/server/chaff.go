@@ -0,0 +1,63 @@
+package server
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+)
+
+// How many recent response times chaff delays are drawn from.
+const responseTimeSamples = 64
+
+// responseTimer remembers how long recent real requests took to answer, so
+// that chaff, which skips the database, isn't answered noticeably sooner.
+type responseTimer struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+// newResponseTimer returns a timer seeded with response times drawn from
+// baseline, so that chaff isn't answered instantly before any real request
+// has been timed. Real response times replace them as they come in.
+func newResponseTimer(baseline config.ChaffResponseTime) *responseTimer {
+	low := time.Duration(baseline.MinMilliseconds) * time.Millisecond
+	spread := time.Duration(baseline.MaxMilliseconds)*time.Millisecond - low
+
+	samples := make([]time.Duration, responseTimeSamples)
+	for i := range samples {
+		samples[i] = low
+		if spread > 0 {
+			samples[i] += time.Duration(rand.Int63n(int64(spread)))
+		}
+	}
+	return &responseTimer{samples: samples}
+}
+
+// observe records how long a real request took since start.
+func (t *responseTimer) observe(start time.Time) {
+	d := time.Since(start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % responseTimeSamples
+}
+
+// delay returns how much longer a chaff request started at start should wait
+// to be answered: a recent real response time, picked at random, less the time
+// already spent on it.
+func (t *responseTimer) delay(start time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.samples[rand.Intn(len(t.samples))] - time.Since(start)
+}
+
+// wait sleeps until a chaff request started at start should be answered.
+func (t *responseTimer) wait(start time.Time) {
+	if d := t.delay(start); d > 0 {
+		time.Sleep(d)
+	}
+}
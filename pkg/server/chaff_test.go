@@ -0,0 +1,43 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseTimer(t *testing.T) {
+	timer := newResponseTimer(config.ChaffResponseTime{MinMilliseconds: 30, MaxMilliseconds: 120})
+
+	// Nothing to go on yet, so the baseline
+	assert.Len(t, timer.samples, responseTimeSamples)
+	for i := 0; i < 100; i++ {
+		d := timer.delay(time.Now())
+		assert.True(t, d > 20*time.Millisecond && d <= 120*time.Millisecond, d)
+	}
+
+	// Time already spent counts
+	assert.True(t, timer.delay(time.Now().Add(-time.Second)) < 0)
+
+	// Real response times replace the baseline
+	start := time.Now().Add(-time.Second)
+	for i := 0; i < responseTimeSamples; i++ {
+		timer.observe(start)
+	}
+	assert.Len(t, timer.samples, responseTimeSamples)
+	assert.InDelta(t, float64(time.Second), float64(timer.delay(time.Now())), float64(100*time.Millisecond))
+
+	// Only recent samples are kept
+	for i := 0; i < responseTimeSamples; i++ {
+		timer.observe(time.Now())
+	}
+	assert.Len(t, timer.samples, responseTimeSamples)
+	assert.True(t, timer.delay(time.Now()) < 100*time.Millisecond)
+}
+
+func TestResponseTimer_NoBaseline(t *testing.T) {
+	timer := newResponseTimer(config.ChaffResponseTime{})
+	assert.True(t, timer.delay(time.Now()) <= 0)
+}
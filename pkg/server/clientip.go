@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+)
+
+// IPv6 clients are usually given a whole /64, so one can rotate through
+// addresses in it to dodge a ban on any one of them.
+const ipv6ClientPrefixLength = 64
+
+// clientIP returns the address a request came from. Each trusted proxy
+// appends the address it got the request from to X-Forwarded-For, so it's
+// read right to left, skipping trusted proxies, up to the first address that
+// isn't one: anything further left could have been written by the client.
+// It returns nil if RemoteAddr isn't an address.
+func (p TrustedProxies) clientIP(r *http.Request) net.IP {
+	ip := parseHost(r.RemoteAddr)
+	if !p.Trusts(r) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHost(hops[i])
+		if hop == nil {
+			// A trusted proxy can't see further than an address it couldn't
+			// write, so the client is the last one we could.
+			return ip
+		}
+		ip = hop
+		if !p.contains(ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// banIdentifier is how a client is identified in failed_key_claim_attempts:
+// by its address, or for IPv6 by its /64 if aggregateIPv6Clients is set.
+func banIdentifier(ip net.IP) string {
+	if ip.To4() == nil && config.AppConstants.AggregateIPv6Clients {
+		prefix := ip.Mask(net.CIDRMask(ipv6ClientPrefixLength, 8*net.IPv6len))
+		return fmt.Sprintf("%s/%d", prefix, ipv6ClientPrefixLength)
+	}
+	return ip.String()
+}
+
+// getIP returns the identifier claim-key bans are tracked by, falling back
+// to RemoteAddr as it is if it can't be parsed.
+func (s *keyClaimServlet) getIP(r *http.Request) string {
+	ip := s.proxies.clientIP(r)
+	if ip == nil {
+		return r.RemoteAddr
+	}
+	return banIdentifier(ip)
+}
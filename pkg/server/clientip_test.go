@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, _ := NewTrustedProxies([]string{"10.0.0.0/8", "2001:db8:ffff::/48"})
+
+	for _, tc := range []struct {
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		// Not through a trusted proxy, so X-Forwarded-For is the client's say-so
+		{"192.0.2.1:1234", []string{"198.51.100.1"}, "192.0.2.1"},
+		{"[2001:db8::1]:1234", nil, "2001:db8::1"},
+		{"192.0.2.1", nil, "192.0.2.1"},
+
+		// Through trusted proxies, right to left
+		{"10.0.0.1:443", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:443", []string{"203.0.113.9, 198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:443", []string{"203.0.113.9, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"10.0.0.1:443", []string{"203.0.113.9, 198.51.100.1", "10.0.0.2"}, "198.51.100.1"},
+		{"[2001:db8:ffff::1]:443", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"10.0.0.1:443", []string{"[2001:db8::1]:5555"}, "2001:db8::1"},
+		{"10.0.0.1:443", []string{"198.51.100.1:5555"}, "198.51.100.1"},
+
+		// As far back as the trusted proxies let us see
+		{"10.0.0.1:443", nil, "10.0.0.1"},
+		{"10.0.0.1:443", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"10.0.0.1:443", []string{"198.51.100.1, unknown, 10.0.0.2"}, "10.0.0.2"},
+
+		// Not an address
+		{"", []string{"198.51.100.1"}, "<nil>"},
+		{"pipe", nil, "<nil>"},
+	} {
+		r, _ := http.NewRequest("POST", "/claim-key", nil)
+		r.RemoteAddr = tc.remoteAddr
+		for _, f := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		assert.Equal(t, tc.expected, proxies.clientIP(r).String(), tc)
+	}
+}
+
+func TestBanIdentifier(t *testing.T) {
+	aggregate := config.AppConstants.AggregateIPv6Clients
+	defer func() { config.AppConstants.AggregateIPv6Clients = aggregate }()
+
+	config.AppConstants.AggregateIPv6Clients = true
+	assert.Equal(t, "198.51.100.1", banIdentifier(net.ParseIP("198.51.100.1")))
+	assert.Equal(t, "198.51.100.1", banIdentifier(net.ParseIP("::ffff:198.51.100.1")))
+	assert.Equal(t, "2001:db8:1:2::/64", banIdentifier(net.ParseIP("2001:db8:1:2:aaaa:bbbb:cccc:dddd")))
+	assert.Equal(t, "2001:db8:1:2::/64", banIdentifier(net.ParseIP("2001:db8:1:2::1")))
+
+	config.AppConstants.AggregateIPv6Clients = false
+	assert.Equal(t, "2001:db8:1:2:aaaa:bbbb:cccc:dddd", banIdentifier(net.ParseIP("2001:db8:1:2:aaaa:bbbb:cccc:dddd")))
+}
+
+func TestGetIP(t *testing.T) {
+	s := &keyClaimServlet{proxies: testProxies}
+
+	r, _ := http.NewRequest("POST", "/claim-key", nil)
+	forwardedFor(r, "198.51.100.1")
+	assert.Equal(t, "198.51.100.1", s.getIP(r))
+
+	// Left as it is if it can't be parsed
+	r.RemoteAddr = "pipe"
+	assert.Equal(t, "pipe", s.getIP(r))
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/cds-snc/covid-alert-server/pkg/federation"
+	"github.com/cds-snc/covid-alert-server/pkg/persistence"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/timemath"
+
+	"github.com/Shopify/goose/srvutil"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// NewFederationServlet returns the servlet peers fetch the keys uploaded to
+// us from. It has its own authentication, separate from the app-facing
+// retrieval HMAC: every peer has its own credentials and allowed regions.
+func NewFederationServlet(db persistence.Conn, clients *federation.Clients, signingKeys retrieval.SigningKeys) srvutil.Servlet {
+	log(nil, nil).Info("registering federation servlet")
+	return &federationServlet{db: db, clients: clients, signingKeys: signingKeys}
+}
+
+type federationServlet struct {
+	db          persistence.Conn
+	clients     *federation.Clients
+	signingKeys retrieval.SigningKeys
+}
+
+func (s *federationServlet) RegisterRouting(r *mux.Router) {
+	log(nil, nil).Info("registering federation route")
+	r.HandleFunc(federation.KeysPath+"{region:[0-9]{3}}", s.keysWrapper)
+}
+
+func (s *federationServlet) fail(logger *logrus.Entry, w http.ResponseWriter, logMsg string, responseMsg string, responseCode int) result {
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	if responseCode == http.StatusInternalServerError {
+		logger.Error(logMsg)
+	} else {
+		logger.Warn(logMsg)
+	}
+	if responseMsg == "" {
+		responseMsg = logMsg
+	}
+	http.Error(w, responseMsg, responseCode)
+	return result(struct{}{})
+}
+
+func (s *federationServlet) keysWrapper(w http.ResponseWriter, r *http.Request) {
+	_ = s.keys(w, r)
+}
+
+// keys serves a page of the keys uploaded to us since the cursor, as a signed
+// export batch. Keys of the current hour aren't served until it's over.
+func (s *federationServlet) keys(w http.ResponseWriter, r *http.Request) result {
+	ctx := r.Context()
+	region := mux.Vars(r)["region"]
+
+	client, ok := s.clients.Authenticate(r)
+	if !ok {
+		return s.fail(log(ctx, nil), w, "invalid federation credentials", "unauthorized", http.StatusUnauthorized)
+	}
+	logger := log(ctx, nil).WithField("peer", client.Name).WithField("region", region)
+
+	if r.Method != "GET" {
+		return s.fail(logger.WithField("method", r.Method), w, "method not allowed", "", http.StatusMethodNotAllowed)
+	}
+
+	if !client.MayReceive(region) {
+		return s.fail(logger, w, "region not allowed for peer", "forbidden", http.StatusForbidden)
+	}
+
+	now := time.Now()
+	currentHour := timemath.HourNumber(now)
+	page, err := s.db.FetchFederationKeys(
+		region, r.URL.Query().Get(federation.CursorParam), currentHour,
+		pb.CurrentRollingStartIntervalNumber(), config.AppConstants.FederationPageSize,
+	)
+	if err == persistence.ErrInvalidFederationCursor {
+		return s.fail(logger, w, "invalid cursor", "", http.StatusBadRequest)
+	} else if err != nil {
+		return s.fail(log(ctx, err).WithField("peer", client.Name), w, "database error", "server error", http.StatusInternalServerError)
+	}
+
+	start := time.Unix(int64(currentHour-numberOfDaysToServe*hoursInDay)*3600, 0)
+	end := time.Unix(int64(currentHour)*3600, 0)
+
+	var buf bytes.Buffer
+	if _, err := retrieval.SerializeBatchTo(ctx, &buf, retrieval.Batch{Keys: page.Keys}, region, start, end, 1, 1, s.signingKeys); err != nil {
+		return s.fail(log(ctx, err).WithField("peer", client.Name), w, "error serializing keys", "server error", http.StatusInternalServerError)
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(federation.NextCursorHeader, page.NextCursor)
+	w.Header().Set(federation.MorePagesHeader, strconv.FormatBool(page.More))
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		logger.WithError(err).Warn("error writing federation keys")
+		return result(struct{}{})
+	}
+
+	logger.WithField("keys", len(page.Keys)).Info("Served keys to federation peer")
+	return result(struct{}{})
+}
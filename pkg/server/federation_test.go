@@ -0,0 +1,131 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	persistence "github.com/cds-snc/covid-alert-server/mocks/pkg/persistence"
+	retrieval "github.com/cds-snc/covid-alert-server/mocks/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/cds-snc/covid-alert-server/pkg/federation"
+	pkgPersistence "github.com/cds-snc/covid-alert-server/pkg/persistence"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/testhelpers"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRegisterRoutingFederation(t *testing.T) {
+	servlet := NewFederationServlet(&persistence.Conn{}, &federation.Clients{}, testSigningKeys(&retrieval.Signer{}))
+	router := Router()
+	servlet.RegisterRouting(router)
+
+	expectedPaths := GetPaths(router)
+	assert.Contains(t, expectedPaths, "/federation/v1/keys/{region:[0-9]{3}}", "should include a federation keys path")
+}
+
+func setupFederationRouter(t *testing.T, db *persistence.Conn, signer *retrieval.Signer) *mux.Router {
+	os.Setenv("FEDERATION_TEST_CLIENT_TOKEN", "ny-token")
+	clients, err := federation.NewClients([]config.FederationClient{
+		{Name: "ny", TokenEnv: "FEDERATION_TEST_CLIENT_TOKEN", Regions: []string{"302"}},
+	}, "", testProxies)
+	assert.Nil(t, err)
+
+	servlet := NewFederationServlet(db, clients, testSigningKeys(signer))
+	router := Router()
+	servlet.RegisterRouting(router)
+	return router
+}
+
+func federationRequest(method, path, token string) *http.Request {
+	req, _ := http.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestFederationKeys(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, signer := &persistence.Conn{}, &retrieval.Signer{}
+	router := setupFederationRouter(t, db, signer)
+
+	keys := []*pb.TemporaryExposureKey{randomTestKey(), randomTestKey()}
+	page := &pkgPersistence.FederationPage{Keys: keys, NextCursor: "445129:" + "ab", More: true}
+	db.On("FetchFederationKeys", "302", "445120:00", mock.AnythingOfType("uint32"), mock.AnythingOfType("int32"), config.AppConstants.FederationPageSize).Return(page, nil)
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return(make([]byte, 64), nil)
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, federationRequest("GET", "/federation/v1/keys/302?cursor=445120:00", "ny-token"))
+
+	assert.Equal(t, 200, resp.Code)
+	assert.Equal(t, "445129:ab", resp.Header().Get(federation.NextCursorHeader))
+	assert.Equal(t, "true", resp.Header().Get(federation.MorePagesHeader))
+	assert.Equal(t, "application/zip", resp.Header().Get("Content-Type"))
+
+	export := readExport(t, resp.Body.Bytes())
+	assert.Len(t, export.GetKeys(), 2)
+	assert.Equal(t, int32(1), export.GetBatchSize())
+
+	testhelpers.AssertLog(t, hook, 3, logrus.InfoLevel, "Served keys to federation peer")
+}
+
+func TestFederationKeys_Unauthorized(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, signer := &persistence.Conn{}, &retrieval.Signer{}
+	router := setupFederationRouter(t, db, signer)
+
+	// No credentials
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, federationRequest("GET", "/federation/v1/keys/302", ""))
+	assert.Equal(t, 401, resp.Code)
+	testhelpers.AssertLog(t, hook, 3, logrus.WarnLevel, "invalid federation credentials")
+
+	// Someone else's token
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, federationRequest("GET", "/federation/v1/keys/302", "nj-token"))
+	assert.Equal(t, 401, resp.Code)
+
+	// A region the peer isn't allowed
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, federationRequest("GET", "/federation/v1/keys/310", "ny-token"))
+	assert.Equal(t, 403, resp.Code)
+	testhelpers.AssertLog(t, hook, 2, logrus.WarnLevel, "region not allowed for peer")
+
+	// Only GET
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, federationRequest("POST", "/federation/v1/keys/302", "ny-token"))
+	assert.Equal(t, 405, resp.Code)
+
+	db.AssertNotCalled(t, "FetchFederationKeys", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFederationKeys_Errors(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, signer := &persistence.Conn{}, &retrieval.Signer{}
+	router := setupFederationRouter(t, db, signer)
+
+	db.On("FetchFederationKeys", "302", "nonsense", mock.Anything, mock.Anything, mock.Anything).Return(nil, pkgPersistence.ErrInvalidFederationCursor)
+	db.On("FetchFederationKeys", "302", "", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("database error"))
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, federationRequest("GET", "/federation/v1/keys/302?cursor=nonsense", "ny-token"))
+	assert.Equal(t, 400, resp.Code)
+	testhelpers.AssertLog(t, hook, 3, logrus.WarnLevel, "invalid cursor")
+
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, federationRequest("GET", "/federation/v1/keys/302", "ny-token"))
+	assert.Equal(t, 500, resp.Code)
+	testhelpers.AssertLog(t, hook, 1, logrus.ErrorLevel, "database error")
+}
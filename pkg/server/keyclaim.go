@@ -1,28 +1,39 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"github.com/cds-snc/covid-alert-server/pkg/config"
 	"github.com/cds-snc/covid-alert-server/pkg/keyclaim"
 	"github.com/cds-snc/covid-alert-server/pkg/persistence"
 	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/telemetry"
 	"io/ioutil"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Shopify/goose/srvutil"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/gorilla/mux"
+	"golang.org/x/crypto/nacl/box"
 	"google.golang.org/protobuf/proto"
 )
 
-func NewKeyClaimServlet(db persistence.Conn, keyClaimAuth keyclaim.Authenticator) srvutil.Servlet {
-	return &keyClaimServlet{db: db, auth: keyClaimAuth}
+func NewKeyClaimServlet(db persistence.Conn, keyClaimAuth keyclaim.Authenticator, proxies TrustedProxies) srvutil.Servlet {
+	return &keyClaimServlet{db: db, auth: keyClaimAuth, timer: newResponseTimer(config.AppConstants.ChaffResponseTime), proxies: proxies}
 }
 
 type keyClaimServlet struct {
-	db   persistence.Conn
-	auth keyclaim.Authenticator
+	db      persistence.Conn
+	auth    keyclaim.Authenticator
+	timer   *responseTimer
+	proxies TrustedProxies
 }
 
 // POST /new-key-claim
@@ -30,7 +41,22 @@ type keyClaimServlet struct {
 func (s *keyClaimServlet) RegisterRouting(r *mux.Router) {
 	r.HandleFunc("/new-key-claim", s.newKeyClaim)
 	r.HandleFunc("/new-key-claim/{hashID:[0-9,a-z]{128}}", s.newKeyClaim)
+	r.HandleFunc("/new-key-claims", s.newKeyClaims)
 	r.HandleFunc("/claim-key", s.claimKeyWrapper)
+	r.HandleFunc("/code-status", s.codeStatus)
+	r.HandleFunc("/revoke-code", s.revokeCode)
+	r.HandleFunc("/reissue-code", s.reissueCode)
+}
+
+// corsPreflight answers a browser's preflight request for a health portal
+// endpoint.
+func corsPreflight(ctx context.Context, w http.ResponseWriter, methods string) {
+	w.Header().Add("Access-Control-Allow-Origin", config.AppConstants.CORSAccessControlAllowOrigin)
+	w.Header().Add("Access-Control-Allow-Methods", methods)
+	w.Header().Add("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Referer, User-Agent")
+	if _, err := w.Write([]byte("")); err != nil {
+		log(ctx, err).Warn("error writing response")
+	}
 }
 
 func (s *keyClaimServlet) newKeyClaim(w http.ResponseWriter, r *http.Request) {
@@ -38,12 +64,7 @@ func (s *keyClaimServlet) newKeyClaim(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	if r.Method == http.MethodOptions {
-		w.Header().Add("Access-Control-Allow-Origin", config.AppConstants.CORSAccessControlAllowOrigin)
-		w.Header().Add("Access-Control-Allow-Methods", "POST")
-		w.Header().Add("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Referer, User-Agent")
-		if _, err := w.Write([]byte("")); err != nil {
-			log(ctx, err).Warn("error writing response")
-		}
+		corsPreflight(ctx, w, "POST")
 		return
 	}
 
@@ -61,19 +82,23 @@ func (s *keyClaimServlet) newKeyClaim(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	/*
-		Since the region that is being retrieved above is no longer the MCC code for canada
-		we want to override that with the actual value. The reason for this is that we are now
-		using the bearer token environment variable to store the name of the provice it's associated with
+	hashID := vars["hashID"]
 
-		Also please note this hurts me to not go through the rest of the code to pull out the region code
-		I will open an issue to continue with this work.
-	*/
-	region = config.AppConstants.RegionCode
+	dates, err := parseOnsetDates(r, time.Now())
+	if err != nil {
+		log(ctx, err).Info("invalid onset date")
+		http.Error(w, "invalid onset date", http.StatusBadRequest)
+		return
+	}
 
-	hashID := vars["hashID"]
+	if !s.useQuota(ctx, w, originator, 1) {
+		return
+	}
 
-	keyClaim, err := s.db.NewKeyClaim(ctx, region, originator, hashID)
+	keyClaim, err := s.db.NewKeyClaim(ctx, region, originator, hashID, dates)
+	if err != nil {
+		s.refundQuota(ctx, originator, 1)
+	}
 	if err == persistence.ErrHashIDClaimed {
 		log(ctx, err).Info("hashID used")
 		http.Error(w, "forbidden", http.StatusForbidden)
@@ -91,6 +116,319 @@ func (s *keyClaimServlet) newKeyClaim(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// useQuota counts codes about to be generated against the originator's
+// quota, and responds with a 429 if that would take it over. Codes that then
+// fail to be generated are given back with refundQuota.
+func (s *keyClaimServlet) useQuota(ctx context.Context, w http.ResponseWriter, originator string, count int) bool {
+	err := s.db.UseOneTimeCodeQuota(ctx, originator, count)
+	if err == persistence.ErrQuotaExceeded {
+		log(ctx, err).Warn("one-time code quota exceeded")
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+		return false
+	} else if err != nil {
+		log(ctx, err).Error("error checking one-time code quota")
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// refundQuota gives back codes counted by useQuota that weren't generated.
+func (s *keyClaimServlet) refundQuota(ctx context.Context, originator string, count int) {
+	if err := s.db.RefundOneTimeCodeQuota(ctx, originator, count); err != nil {
+		log(ctx, err).Warn("error refunding one-time code quota")
+	}
+}
+
+// GET /code-status, POST /revoke-code, POST /reissue-code
+
+// codeRequest authenticates a health authority asking about a code it issued,
+// and reads which code, by one_time_code or hash_id.
+func (s *keyClaimServlet) codeRequest(w http.ResponseWriter, r *http.Request, method string) (originator, oneTimeCode, hashID string, ok bool) {
+	ctx := r.Context()
+
+	if r.Method == http.MethodOptions {
+		corsPreflight(ctx, w, method)
+		return "", "", "", false
+	}
+
+	if r.Method != method {
+		log(ctx, nil).WithField("method", r.Method).Info("disallowed method")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return "", "", "", false
+	}
+
+	hdr := r.Header.Get("Authorization")
+	_, originator, ok = s.auth.RegionFromAuthHeader(hdr)
+	if !ok {
+		log(ctx, nil).WithField("header", hdr).Info("bad auth header")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return "", "", "", false
+	}
+
+	// Codes are read out over the phone, so be forgiving
+	oneTimeCode = strings.ToUpper(r.FormValue("one_time_code"))
+	oneTimeCode = strings.ReplaceAll(oneTimeCode, " ", "")
+	oneTimeCode = strings.ReplaceAll(oneTimeCode, "-", "")
+	hashID = r.FormValue("hash_id")
+
+	if (oneTimeCode == "") == (hashID == "") {
+		log(ctx, nil).Info("code request requires exactly one of one_time_code or hash_id")
+		http.Error(w, "exactly one of one_time_code or hash_id is required", http.StatusBadRequest)
+		return "", "", "", false
+	}
+
+	w.Header().Add("Access-Control-Allow-Origin", config.AppConstants.CORSAccessControlAllowOrigin)
+	return originator, oneTimeCode, hashID, true
+}
+
+// codeError responds to a failed lookup or change of a code.
+func codeError(ctx context.Context, w http.ResponseWriter, err error, action string) {
+	if err == persistence.ErrCodeNotFound {
+		log(ctx, err).Info("code not found")
+		http.Error(w, "code not found", http.StatusNotFound)
+	} else if err == persistence.ErrCodeClaimed {
+		log(ctx, err).Info("code already claimed")
+		http.Error(w, "code already claimed", http.StatusConflict)
+	} else {
+		log(ctx, err).Error("error " + action)
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, v interface{}) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		log(ctx, err).Error("error building json object")
+		http.Error(w, "error building json object", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	if _, err := w.Write(js); err != nil {
+		log(ctx, err).Warn("error writing response")
+	}
+}
+
+// codeStatus tells a health authority whether a code it issued has been
+// claimed, used to upload keys, used up or expired.
+func (s *keyClaimServlet) codeStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	originator, oneTimeCode, hashID, ok := s.codeRequest(w, r, "GET")
+	if !ok {
+		return
+	}
+
+	status, err := s.db.OneTimeCodeStatus(originator, oneTimeCode, hashID)
+	if err != nil {
+		codeError(ctx, w, err, "looking up code")
+		return
+	}
+
+	writeJSON(ctx, w, status)
+}
+
+type revokeCodeResponse struct {
+	Revoked bool `json:"revoked"`
+}
+
+// revokeCode deletes a code a health authority issued, before it's claimed.
+func (s *keyClaimServlet) revokeCode(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	originator, oneTimeCode, hashID, ok := s.codeRequest(w, r, "POST")
+	if !ok {
+		return
+	}
+
+	if err := s.db.RevokeOneTimeCode(ctx, originator, oneTimeCode, hashID); err != nil {
+		codeError(ctx, w, err, "revoking code")
+		return
+	}
+
+	log(ctx, nil).Info("revoked code")
+	writeJSON(ctx, w, revokeCodeResponse{Revoked: true})
+}
+
+// reissueCode gives an unclaimed code a health authority issued a new value,
+// for a patient who lost or mistyped it, and responds with the new code.
+func (s *keyClaimServlet) reissueCode(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	originator, oneTimeCode, hashID, ok := s.codeRequest(w, r, "POST")
+	if !ok {
+		return
+	}
+
+	newCode, err := s.db.ReissueOneTimeCode(ctx, originator, oneTimeCode, hashID)
+	if err != nil {
+		codeError(ctx, w, err, "reissuing code")
+		return
+	}
+
+	log(ctx, nil).Info("reissued code")
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	if _, err := w.Write([]byte(newCode + "\n")); err != nil {
+		log(ctx, err).Warn("error writing response")
+	}
+}
+
+// POST /new-key-claims
+
+var hashIDFormat = regexp.MustCompile("^[0-9,a-z]{128}$")
+
+type newKeyClaimsResponse struct {
+	Codes []persistence.KeyClaim `json:"codes"`
+}
+
+// newKeyClaims generates many codes at once, given either a count or a
+// hash_id for each code. They're returned as CSV if asked for, and JSON
+// otherwise.
+func (s *keyClaimServlet) newKeyClaims(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method == http.MethodOptions {
+		corsPreflight(ctx, w, "POST")
+		return
+	}
+
+	if r.Method != "POST" {
+		log(ctx, nil).WithField("method", r.Method).Info("disallowed method")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hdr := r.Header.Get("Authorization")
+	region, originator, ok := s.auth.RegionFromAuthHeader(hdr)
+	if !ok {
+		log(ctx, nil).WithField("header", hdr).Info("bad auth header")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		log(ctx, err).Info("error parsing form")
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	hashIDs := r.Form["hash_id"]
+	seen := make(map[string]bool, len(hashIDs))
+	for _, hashID := range hashIDs {
+		if !hashIDFormat.MatchString(hashID) || seen[hashID] {
+			log(ctx, nil).Info("invalid or repeated hash_id")
+			http.Error(w, "invalid or repeated hash_id", http.StatusBadRequest)
+			return
+		}
+		seen[hashID] = true
+	}
+
+	count := len(hashIDs)
+	if c := r.FormValue("count"); c != "" {
+		n, err := strconv.Atoi(c)
+		if err != nil || (len(hashIDs) > 0 && n != len(hashIDs)) {
+			log(ctx, err).Info("invalid count")
+			http.Error(w, "invalid count", http.StatusBadRequest)
+			return
+		}
+		count = n
+	}
+	if count < 1 || count > config.AppConstants.MaxUnclaimedOneTimeCodes {
+		log(ctx, nil).WithField("count", count).Info("invalid count")
+		http.Error(w, "invalid count", http.StatusBadRequest)
+		return
+	}
+
+	dates, err := parseOnsetDates(r, time.Now())
+	if err != nil {
+		log(ctx, err).Info("invalid onset date")
+		http.Error(w, "invalid onset date", http.StatusBadRequest)
+		return
+	}
+
+	if !s.useQuota(ctx, w, originator, count) {
+		return
+	}
+
+	claims, err := s.db.NewKeyClaims(ctx, region, originator, count, hashIDs, dates)
+	if err != nil {
+		s.refundQuota(ctx, originator, count)
+	}
+	if err == persistence.ErrHashIDClaimed {
+		log(ctx, err).Info("hashID used")
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	} else if err == persistence.ErrTooManyUnclaimedCodes {
+		log(ctx, err).Info("too many unclaimed codes")
+		http.Error(w, "too many unclaimed codes", http.StatusTooManyRequests)
+		return
+	} else if err != nil {
+		log(ctx, err).Error("error constructing new key claims")
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	log(ctx, nil).WithField("count", len(claims)).Info("generated key claims")
+	w.Header().Add("Access-Control-Allow-Origin", config.AppConstants.CORSAccessControlAllowOrigin)
+
+	if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		w.Header().Add("Content-Type", "text/csv; charset=utf-8")
+		out := csv.NewWriter(w)
+		_ = out.Write([]string{"one_time_code", "hash_id"})
+		for _, claim := range claims {
+			_ = out.Write([]string{claim.OneTimeCode, claim.HashID})
+		}
+		out.Flush()
+		if err := out.Error(); err != nil {
+			log(ctx, err).Warn("error writing response")
+		}
+		return
+	}
+
+	writeJSON(ctx, w, newKeyClaimsResponse{Codes: claims})
+}
+
+var errOnsetDateOutOfRange = errors.New("date is in the future or too far in the past")
+
+// parseOnsetDates reads the optional symptom_onset_date and test_date
+// parameters (YYYY-MM-DD) from the query string or form body.
+func parseOnsetDates(r *http.Request, now time.Time) (persistence.OnsetDates, error) {
+	var dates persistence.OnsetDates
+
+	symptomOnset, err := parseOnsetDate(r.FormValue("symptom_onset_date"), now)
+	if err != nil {
+		return dates, err
+	}
+	test, err := parseOnsetDate(r.FormValue("test_date"), now)
+	if err != nil {
+		return dates, err
+	}
+
+	dates.SymptomOnset = symptomOnset
+	dates.Test = test
+	return dates, nil
+}
+
+func parseOnsetDate(value string, now time.Time) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allow a day of slack for portals ahead of UTC
+	today := now.UTC().Truncate(24 * time.Hour)
+	oldest := today.AddDate(0, 0, -int(config.AppConstants.MaxOnsetDateAgeDays))
+	if date.After(today.AddDate(0, 0, 1)) || date.Before(oldest) {
+		return nil, errOnsetDateOutOfRange
+	}
+	return &date, nil
+}
+
 func kcrError(errCode pb.KeyClaimResponse_ErrorCode, triesRemaining int) *pb.KeyClaimResponse {
 	tr := uint32(triesRemaining)
 	return &pb.KeyClaimResponse{Error: &errCode, TriesRemaining: &tr}
@@ -102,10 +440,11 @@ func (s *keyClaimServlet) claimKeyWrapper(w http.ResponseWriter, r *http.Request
 
 func (s *keyClaimServlet) claimKey(w http.ResponseWriter, r *http.Request) result {
 	ctx := r.Context()
+	start := time.Now()
 
 	// be extremely careful not to log this or otherwise cause it to be persisted
 	// other than transiently in the failed attempts table.
-	ip := getIP(r)
+	ip := s.getIP(r)
 
 	triesRemaining, banDuration, err := s.db.CheckClaimKeyBan(ip)
 	if err != nil {
@@ -136,12 +475,26 @@ func (s *keyClaimServlet) claimKey(w http.ResponseWriter, r *http.Request) resul
 		)
 	}
 
+	if req.GetChaff() {
+		return s.claimChaff(w, r, start)
+	}
+
 	oneTimeCode := req.GetOneTimeCode()
 
 	// Handle odd app inputs
+	oneTimeCode = strings.ToUpper(oneTimeCode)
 	oneTimeCode = strings.ReplaceAll(oneTimeCode, " ", "")
 	oneTimeCode = strings.ReplaceAll(oneTimeCode, "-", "")
 
+	// Codes we can't have issued, like typos caught by the check character,
+	// aren't guesses, so they don't count towards a ban
+	if !keyclaim.WellFormedOneTimeCode(oneTimeCode) {
+		return requestError(
+			ctx, w, nil, "malformed one time code",
+			http.StatusBadRequest, kcrError(pb.KeyClaimResponse_MALFORMED_ONE_TIME_CODE, triesRemaining),
+		)
+	}
+
 	appPublicKey := req.GetAppPublicKey()
 
 	serverPub, err := s.db.ClaimKey(oneTimeCode, appPublicKey, ctx)
@@ -183,6 +536,7 @@ func (s *keyClaimServlet) claimKey(w http.ResponseWriter, r *http.Request) resul
 		)
 	}
 
+	s.timer.observe(start)
 	if _, err := w.Write(data); err != nil {
 		log(ctx, err).Info("error writing response")
 	}
@@ -194,18 +548,34 @@ func (s *keyClaimServlet) claimKey(w http.ResponseWriter, r *http.Request) resul
 	return result{}
 }
 
-var numeric = regexp.MustCompile("^[0-9]+$")
+// claimChaff answers a decoy claim as a successful one, with a server public
+// key whose private key is thrown away. Nothing is stored, and the client's
+// failed attempts are left as they are.
+func (s *keyClaimServlet) claimChaff(w http.ResponseWriter, r *http.Request, start time.Time) result {
+	ctx := r.Context()
 
-func getIP(r *http.Request) string {
-	forwarded := r.Header.Get("X-FORWARDED-FOR")
-	if forwarded != "" {
-		IPList := strings.Split(forwarded, ",")
-		return strings.TrimSpace(IPList[len(IPList)-1])
+	serverPub, _, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return requestError(
+			ctx, w, err, "failure to generate chaff key",
+			http.StatusInternalServerError, kcrError(pb.KeyClaimResponse_SERVER_ERROR, 0),
+		)
 	}
-	// If the RemoteAddr is of the form $ip:$port, return only the IP
-	parts := strings.Split(r.RemoteAddr, ":")
-	if len(parts) == 2 && numeric.MatchString(parts[1]) {
-		return parts[0]
+
+	maxTries := uint32(config.AppConstants.MaxConsecutiveClaimKeyFailures)
+	data, err := proto.Marshal(&pb.KeyClaimResponse{ServerPublicKey: serverPub[:], TriesRemaining: &maxTries})
+	if err != nil {
+		return requestError(
+			ctx, w, err, "failure to marshal response",
+			http.StatusInternalServerError, kcrError(pb.KeyClaimResponse_SERVER_ERROR, 0),
+		)
 	}
-	return r.RemoteAddr
+
+	s.timer.wait(start)
+	if _, err := w.Write(data); err != nil {
+		log(ctx, err).Info("error writing response")
+	}
+	telemetry.CountChaff(ctx, "claim-key")
+
+	return result{}
 }
@@ -34,15 +34,23 @@ func TestNewKeyClaimServlet(t *testing.T) {
 	db := &persistence.Conn{}
 	auth := &keyclaim.Authenticator{}
 
+	servlet := NewKeyClaimServlet(db, auth, testProxies)
+
+	// The timer is seeded at random
+	timer := servlet.(*keyClaimServlet).timer
+	assert.Len(t, timer.samples, responseTimeSamples)
+
 	expected := &keyClaimServlet{
-		db:   db,
-		auth: auth,
+		db:      db,
+		auth:    auth,
+		timer:   timer,
+		proxies: testProxies,
 	}
-	assert.Equal(t, expected, NewKeyClaimServlet(db, auth), "should return a new keyClaimServlet struct")
+	assert.Equal(t, expected, servlet, "should return a new keyClaimServlet struct")
 }
 
 func TestRegisterRoutingKeyClaim(t *testing.T) {
-	servlet := NewKeyClaimServlet(&persistence.Conn{}, &keyclaim.Authenticator{})
+	servlet := NewKeyClaimServlet(&persistence.Conn{}, &keyclaim.Authenticator{}, testProxies)
 	router := Router()
 	servlet.RegisterRouting(router)
 
@@ -50,6 +58,10 @@ func TestRegisterRoutingKeyClaim(t *testing.T) {
 	assert.Contains(t, expectedPaths, "/new-key-claim", "should include a /new-key-claim path")
 	assert.Contains(t, expectedPaths, "/new-key-claim/{hashID:[0-9,a-z]{128}}", "should include a /new-key-claim/{hashID:[0-9,a-z]{128}} path")
 	assert.Contains(t, expectedPaths, "/claim-key", "should include a claim-key path")
+	assert.Contains(t, expectedPaths, "/new-key-claims", "should include a /new-key-claims path")
+	assert.Contains(t, expectedPaths, "/code-status", "should include a code-status path")
+	assert.Contains(t, expectedPaths, "/revoke-code", "should include a revoke-code path")
+	assert.Contains(t, expectedPaths, "/reissue-code", "should include a reissue-code path")
 }
 
 func TestCORS(t *testing.T) {
@@ -133,7 +145,8 @@ func TestGoodAuthToken_NoHashID(t *testing.T) {
 	auth.On("RegionFromAuthHeader", "Bearer goodtoken").Return("302", "goodtoken", true)
 
 	// DB Mock
-	db.On("NewKeyClaim", mock.Anything, "302", "goodtoken", "").Return("AAABBBCCCC", nil)
+	db.On("NewKeyClaim", mock.Anything, "302", "goodtoken", "", err.OnsetDates{}).Return("AAABBBCCCC", nil)
+	db.On("UseOneTimeCodeQuota", mock.Anything, "goodtoken", 1).Return(nil)
 
 	router := buildNewKeyClaimServletRouter(db, auth)
 	_, oldLog := testhelpers.SetupTestLogging(&log)
@@ -149,6 +162,29 @@ func TestGoodAuthToken_NoHashID(t *testing.T) {
 	assert.Equal(t, "AAABBBCCCC\n", string(resp.Body.Bytes()), "Correct response is expected")
 }
 
+func TestGoodAuthToken_OtherRegion(t *testing.T) {
+
+	db := &persistence.Conn{}
+	auth := &keyclaim.Authenticator{}
+
+	// The key claim belongs to the region of the token, not the default one
+	auth.On("RegionFromAuthHeader", "Bearer othertoken").Return("310", "othertoken", true)
+	db.On("NewKeyClaim", mock.Anything, "310", "othertoken", "", err.OnsetDates{}).Return("AAABBBCCCC", nil)
+	db.On("UseOneTimeCodeQuota", mock.Anything, "othertoken", 1).Return(nil)
+
+	router := buildNewKeyClaimServletRouter(db, auth)
+	_, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	req, _ := http.NewRequest("POST", "/new-key-claim", nil)
+	req.Header.Set("Authorization", "Bearer othertoken")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	db.AssertExpectations(t)
+}
+
 func TestGoodAuthToken_HashID(t *testing.T) {
 
 	db := &persistence.Conn{}
@@ -160,7 +196,8 @@ func TestGoodAuthToken_HashID(t *testing.T) {
 
 	hashID := hex.EncodeToString(SHA512([]byte("abcd")))
 	// DB Mock
-	db.On("NewKeyClaim", mock.Anything, "302", "goodtoken", hashID).Return("AAABBBCCCC", nil)
+	db.On("NewKeyClaim", mock.Anything, "302", "goodtoken", hashID, err.OnsetDates{}).Return("AAABBBCCCC", nil)
+	db.On("UseOneTimeCodeQuota", mock.Anything, "goodtoken", 1).Return(nil)
 
 	router := buildNewKeyClaimServletRouter(db, auth)
 	_, oldLog := testhelpers.SetupTestLogging(&log)
@@ -177,6 +214,89 @@ func TestGoodAuthToken_HashID(t *testing.T) {
 
 }
 
+func TestGoodAuthToken_OnsetDates(t *testing.T) {
+
+	db := &persistence.Conn{}
+	auth := &keyclaim.Authenticator{}
+
+	auth.On("RegionFromAuthHeader", "Bearer goodtoken").Return("302", "goodtoken", true)
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	symptomOnset := today.AddDate(0, 0, -3)
+	test := today.AddDate(0, 0, -1)
+	db.On("NewKeyClaim", mock.Anything, "302", "goodtoken", "", err.OnsetDates{SymptomOnset: &symptomOnset, Test: &test}).Return("AAABBBCCCC", nil)
+	db.On("UseOneTimeCodeQuota", mock.Anything, "goodtoken", 1).Return(nil)
+
+	router := buildNewKeyClaimServletRouter(db, auth)
+	_, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	url := fmt.Sprintf("/new-key-claim?symptom_onset_date=%s&test_date=%s", symptomOnset.Format("2006-01-02"), test.Format("2006-01-02"))
+	req, _ := http.NewRequest("POST", url, nil)
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, "AAABBBCCCC\n", string(resp.Body.Bytes()), "Correct response is expected")
+}
+
+func TestBadOnsetDate(t *testing.T) {
+
+	db := &persistence.Conn{}
+	auth := &keyclaim.Authenticator{}
+
+	auth.On("RegionFromAuthHeader", "Bearer goodtoken").Return("302", "goodtoken", true)
+
+	router := buildNewKeyClaimServletRouter(db, auth)
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	req, _ := http.NewRequest("POST", "/new-key-claim?symptom_onset_date=yesterday", nil)
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad request response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "invalid onset date")
+	db.AssertNotCalled(t, "NewKeyClaim", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestParseOnsetDate(t *testing.T) {
+	now := time.Date(2020, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	date, parseErr := parseOnsetDate("", now)
+	assert.Nil(t, date)
+	assert.Nil(t, parseErr)
+
+	date, parseErr = parseOnsetDate("2020-10-10", now)
+	assert.Nil(t, parseErr)
+	assert.Equal(t, time.Date(2020, 10, 10, 0, 0, 0, 0, time.UTC), *date)
+
+	_, parseErr = parseOnsetDate("2020-10-15", now)
+	assert.Nil(t, parseErr)
+
+	// A day ahead is allowed for portals east of UTC, but no more, whatever
+	// the time of day
+	for _, now := range []time.Time{now, time.Date(2020, 10, 15, 0, 0, 0, 0, time.UTC), time.Date(2020, 10, 15, 23, 59, 59, 0, time.UTC)} {
+		_, parseErr = parseOnsetDate("2020-10-16", now)
+		assert.Nil(t, parseErr, now)
+
+		_, parseErr = parseOnsetDate("2020-10-17", now)
+		assert.Equal(t, errOnsetDateOutOfRange, parseErr, now)
+	}
+
+	oldest := now.AddDate(0, 0, -int(config.AppConstants.MaxOnsetDateAgeDays))
+	_, parseErr = parseOnsetDate(oldest.Format("2006-01-02"), now)
+	assert.Nil(t, parseErr)
+
+	_, parseErr = parseOnsetDate(oldest.AddDate(0, 0, -1).Format("2006-01-02"), now)
+	assert.Equal(t, errOnsetDateOutOfRange, parseErr)
+
+	_, parseErr = parseOnsetDate("15/10/2020", now)
+	assert.NotNil(t, parseErr)
+}
+
 func Test_ErrorSavingNoHashID(t *testing.T) {
 
 	auth := &keyclaim.Authenticator{}
@@ -184,7 +304,9 @@ func Test_ErrorSavingNoHashID(t *testing.T) {
 	auth.On("RegionFromAuthHeader", "Bearer errortoken").Return("302", "errortoken", true)
 
 	db := &persistence.Conn{}
-	db.On("NewKeyClaim", mock.Anything, "302", "errortoken", "").Return("", fmt.Errorf("Random error"))
+	db.On("NewKeyClaim", mock.Anything, "302", "errortoken", "", err.OnsetDates{}).Return("", fmt.Errorf("Random error"))
+	db.On("UseOneTimeCodeQuota", mock.Anything, "errortoken", 1).Return(nil)
+	db.On("RefundOneTimeCodeQuota", mock.Anything, "errortoken", 1).Return(nil)
 
 	router := buildNewKeyClaimServletRouter(db, auth)
 
@@ -201,6 +323,7 @@ func Test_ErrorSavingNoHashID(t *testing.T) {
 	assert.Equal(t, "server error\n", string(resp.Body.Bytes()), "server error response is expected")
 
 	testhelpers.AssertLog(t, hook, 1, logrus.ErrorLevel, "error constructing new key claim")
+	db.AssertCalled(t, "RefundOneTimeCodeQuota", mock.Anything, "errortoken", 1)
 
 }
 
@@ -212,7 +335,9 @@ func TestNewKeyClaimErrorSavingDuplicateHashID(t *testing.T) {
 
 	hashID := hex.EncodeToString(SHA512([]byte("abcd")))
 	db := &persistence.Conn{}
-	db.On("NewKeyClaim", mock.Anything, "302", "errortoken", hashID).Return("", err.ErrHashIDClaimed)
+	db.On("NewKeyClaim", mock.Anything, "302", "errortoken", hashID, err.OnsetDates{}).Return("", err.ErrHashIDClaimed)
+	db.On("UseOneTimeCodeQuota", mock.Anything, "errortoken", 1).Return(nil)
+	db.On("RefundOneTimeCodeQuota", mock.Anything, "errortoken", 1).Return(nil)
 
 	router := buildNewKeyClaimServletRouter(db, auth)
 	hook, oldLog := testhelpers.SetupTestLogging(&log)
@@ -291,6 +416,49 @@ func TestNoPost(t *testing.T) {
 	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "disallowed method")
 }
 
+func TestNewKeyClaim_Quota(t *testing.T) {
+	db := &persistence.Conn{}
+	auth := &keyclaim.Authenticator{}
+
+	auth.On("RegionFromAuthHeader", "Bearer overtoken").Return("302", "overtoken", true)
+	auth.On("RegionFromAuthHeader", "Bearer errortoken").Return("302", "errortoken", true)
+	db.On("UseOneTimeCodeQuota", mock.Anything, "overtoken", mock.Anything).Return(err.ErrQuotaExceeded)
+	db.On("UseOneTimeCodeQuota", mock.Anything, "errortoken", mock.Anything).Return(fmt.Errorf("Random error"))
+
+	router := buildNewKeyClaimServletRouter(db, auth)
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	post := func(path, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, strings.NewReader("count=5"))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// Over quota
+	resp := post("/new-key-claim", "overtoken")
+	assert.Equal(t, 429, resp.Code, "Too many requests response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "one-time code quota exceeded")
+
+	resp = post("/new-key-claims", "overtoken")
+	assert.Equal(t, 429, resp.Code, "Too many requests response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "one-time code quota exceeded")
+
+	db.AssertCalled(t, "UseOneTimeCodeQuota", mock.Anything, "overtoken", 1)
+	db.AssertCalled(t, "UseOneTimeCodeQuota", mock.Anything, "overtoken", 5)
+
+	// Error checking the quota
+	resp = post("/new-key-claim", "errortoken")
+	assert.Equal(t, 500, resp.Code, "Server error response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.ErrorLevel, "error checking one-time code quota")
+
+	db.AssertNotCalled(t, "NewKeyClaim", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	db.AssertNotCalled(t, "NewKeyClaims", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestClaimKey(t *testing.T) {
 	db := &persistence.Conn{}
 	auth := &keyclaim.Authenticator{}
@@ -312,9 +480,9 @@ func TestClaimKey(t *testing.T) {
 	db.On("ClaimKey", "AAAAAAAAAA", appPub[:], mock.Anything).Return(serverPub[:], nil)
 
 	// Error Code
-	db.On("ClaimKey", "BBBBBBBBBB", appPub[:], mock.Anything).Return(nil, err.ErrInvalidKeyFormat)
-	db.On("ClaimKey", "CCCCCCCCCC", appPub[:], mock.Anything).Return(nil, err.ErrDuplicateKey)
-	db.On("ClaimKey", "DDDDDDDDDD", appPub[:], mock.Anything).Return(nil, err.ErrInvalidOneTimeCode)
+	db.On("ClaimKey", "FFFFFFFFFF", appPub[:], mock.Anything).Return(nil, err.ErrInvalidKeyFormat)
+	db.On("ClaimKey", "HHHHHHHHHH", appPub[:], mock.Anything).Return(nil, err.ErrDuplicateKey)
+	db.On("ClaimKey", "JJJJJJJJJJ", appPub[:], mock.Anything).Return(nil, err.ErrInvalidOneTimeCode)
 	db.On("ClaimKey", "EEEEEEEEEE", appPub[:], mock.Anything).Return(nil, fmt.Errorf("Generic Error"))
 
 	// Mock failure log
@@ -325,7 +493,7 @@ func TestClaimKey(t *testing.T) {
 	db.On("ClaimKeySuccess", "3.3.3.3").Return(nil)
 	db.On("ClaimKeySuccess", "5.5.5.5").Return(fmt.Errorf("Generic Error"))
 
-	servlet := NewKeyClaimServlet(db, auth)
+	servlet := NewKeyClaimServlet(db, auth, testProxies)
 	router := Router()
 	servlet.RegisterRouting(router)
 
@@ -342,7 +510,7 @@ func TestClaimKey(t *testing.T) {
 
 	// Error finding keyclaim ban
 	req, _ := http.NewRequest("POST", "/claim-key", nil)
-	req.Header.Set("X-FORWARDED-FOR", "1.1.1.1")
+	forwardedFor(req, "1.1.1.1")
 	resp := httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 
@@ -353,7 +521,7 @@ func TestClaimKey(t *testing.T) {
 
 	// IP is banned
 	req, _ = http.NewRequest("POST", "/claim-key", nil)
-	req.Header.Set("X-FORWARDED-FOR", "2.2.2.2")
+	forwardedFor(req, "2.2.2.2")
 	resp = httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 
@@ -386,7 +554,7 @@ func TestClaimKey(t *testing.T) {
 
 	// Bad, non-protobuff payload
 	req, _ = http.NewRequest("POST", "/claim-key", strings.NewReader("sd"))
-	req.Header.Set("X-FORWARDED-FOR", "3.3.3.3")
+	forwardedFor(req, "3.3.3.3")
 	resp = httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 
@@ -397,12 +565,12 @@ func TestClaimKey(t *testing.T) {
 	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "error unmarshalling request")
 
 	// Invalid app key format
-	code := "BBBBBBBBBB"
+	code := "FFFFFFFFFF"
 	upload := buildKeyClaimRequest(&code, appPub[:])
 	marshalledUpload, _ := proto.Marshal(upload)
 
 	req, _ = http.NewRequest("POST", "/claim-key", bytes.NewReader(marshalledUpload))
-	req.Header.Set("X-FORWARDED-FOR", "3.3.3.3")
+	forwardedFor(req, "3.3.3.3")
 	resp = httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 
@@ -413,12 +581,12 @@ func TestClaimKey(t *testing.T) {
 	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "invalid key format")
 
 	// Duplicate app key
-	code = "CCCCCCCCCC"
+	code = "HHHHHHHHHH"
 	upload = buildKeyClaimRequest(&code, appPub[:])
 	marshalledUpload, _ = proto.Marshal(upload)
 
 	req, _ = http.NewRequest("POST", "/claim-key", bytes.NewReader(marshalledUpload))
-	req.Header.Set("X-FORWARDED-FOR", "3.3.3.3")
+	forwardedFor(req, "3.3.3.3")
 	resp = httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 
@@ -429,12 +597,12 @@ func TestClaimKey(t *testing.T) {
 	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "duplicate key")
 
 	// Invalid one time code
-	code = "DDDDDDDDDD"
+	code = "JJJJJJJJJJ"
 	upload = buildKeyClaimRequest(&code, appPub[:])
 	marshalledUpload, _ = proto.Marshal(upload)
 
 	req, _ = http.NewRequest("POST", "/claim-key", bytes.NewReader(marshalledUpload))
-	req.Header.Set("X-FORWARDED-FOR", "3.3.3.3")
+	forwardedFor(req, "3.3.3.3")
 	resp = httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 
@@ -446,12 +614,12 @@ func TestClaimKey(t *testing.T) {
 	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "invalid one time code")
 
 	// Invalid one time code - DB failure on IP ban check
-	code = "DDDDDDDDDD"
+	code = "JJJJJJJJJJ"
 	upload = buildKeyClaimRequest(&code, appPub[:])
 	marshalledUpload, _ = proto.Marshal(upload)
 
 	req, _ = http.NewRequest("POST", "/claim-key", bytes.NewReader(marshalledUpload))
-	req.Header.Set("X-FORWARDED-FOR", "4.4.4.4")
+	forwardedFor(req, "4.4.4.4")
 	resp = httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 
@@ -467,7 +635,7 @@ func TestClaimKey(t *testing.T) {
 	marshalledUpload, _ = proto.Marshal(upload)
 
 	req, _ = http.NewRequest("POST", "/claim-key", bytes.NewReader(marshalledUpload))
-	req.Header.Set("X-FORWARDED-FOR", "3.3.3.3")
+	forwardedFor(req, "3.3.3.3")
 	resp = httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 
@@ -483,7 +651,7 @@ func TestClaimKey(t *testing.T) {
 	marshalledUpload, _ = proto.Marshal(upload)
 
 	req, _ = http.NewRequest("POST", "/claim-key", bytes.NewReader(marshalledUpload))
-	req.Header.Set("X-FORWARDED-FOR", "3.3.3.3")
+	forwardedFor(req, "3.3.3.3")
 	resp = httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 
@@ -497,7 +665,7 @@ func TestClaimKey(t *testing.T) {
 	marshalledUpload, _ = proto.Marshal(upload)
 
 	req, _ = http.NewRequest("POST", "/claim-key", bytes.NewReader(marshalledUpload))
-	req.Header.Set("X-FORWARDED-FOR", "3.3.3.3")
+	forwardedFor(req, "3.3.3.3")
 	resp = httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 
@@ -511,7 +679,7 @@ func TestClaimKey(t *testing.T) {
 	marshalledUpload, _ = proto.Marshal(upload)
 
 	req, _ = http.NewRequest("POST", "/claim-key", bytes.NewReader(marshalledUpload))
-	req.Header.Set("X-FORWARDED-FOR", "3.3.3.3")
+	forwardedFor(req, "3.3.3.3")
 	resp = httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 
@@ -525,7 +693,7 @@ func TestClaimKey(t *testing.T) {
 	marshalledUpload, _ = proto.Marshal(upload)
 
 	req, _ = http.NewRequest("POST", "/claim-key", bytes.NewReader(marshalledUpload))
-	req.Header.Set("X-FORWARDED-FOR", "5.5.5.5")
+	forwardedFor(req, "5.5.5.5")
 	resp = httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 
@@ -536,6 +704,301 @@ func TestClaimKey(t *testing.T) {
 	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "error recording claim-key success")
 }
 
+func TestClaimKey_Chaff(t *testing.T) {
+	db := &persistence.Conn{}
+	triesRemaining := config.AppConstants.MaxConsecutiveClaimKeyFailures
+	banDuration := (time.Duration(config.AppConstants.ClaimKeyBanDuration) * time.Hour)
+
+	db.On("CheckClaimKeyBan", "1.1.1.1").Return(triesRemaining, time.Duration(0), nil)
+	db.On("CheckClaimKeyBan", "2.2.2.2").Return(0, banDuration, nil)
+
+	router := buildNewKeyClaimServletRouter(db, &keyclaim.Authenticator{})
+
+	_, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	appPub, _, _ := box.GenerateKey(rand.Reader)
+	chaff := buildKeyClaimRequest(nil, appPub[:])
+	chaff.Chaff = proto.Bool(true)
+	marshalledUpload, _ := proto.Marshal(chaff)
+
+	// Answered like a successful claim
+	req, _ := http.NewRequest("POST", "/claim-key", bytes.NewReader(marshalledUpload))
+	forwardedFor(req, "1.1.1.1")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	var response pb.KeyClaimResponse
+	proto.Unmarshal(resp.Body.Bytes(), &response)
+	assert.Equal(t, 200, resp.Code, "success response is expected")
+	assert.Equal(t, pb.KeyClaimResponse_NONE, response.GetError())
+	assert.Len(t, response.GetServerPublicKey(), pb.KeyLength)
+	assert.Equal(t, uint32(triesRemaining), response.GetTriesRemaining())
+
+	// Banned like any other request
+	req, _ = http.NewRequest("POST", "/claim-key", bytes.NewReader(marshalledUpload))
+	forwardedFor(req, "2.2.2.2")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 429, resp.Code, "too many requests response is expected")
+
+	db.AssertNotCalled(t, "ClaimKey", mock.Anything, mock.Anything, mock.Anything)
+	db.AssertNotCalled(t, "ClaimKeySuccess", mock.Anything)
+	db.AssertNotCalled(t, "ClaimKeyFailure", mock.Anything)
+}
+
+func TestClaimKey_MalformedCode(t *testing.T) {
+	format := config.AppConstants.OneTimeCodeFormat
+	defer func() { config.AppConstants.OneTimeCodeFormat = format }()
+	config.AppConstants.OneTimeCodeFormat.CheckCharacter = true
+
+	db := &persistence.Conn{}
+	triesRemaining := config.AppConstants.MaxConsecutiveClaimKeyFailures
+
+	appPub, _, _ := box.GenerateKey(rand.Reader)
+	serverPub, _, _ := box.GenerateKey(rand.Reader)
+
+	db.On("CheckClaimKeyBan", "1.1.1.1").Return(triesRemaining, time.Duration(0), nil)
+	db.On("ClaimKey", "URA452UJFZ", appPub[:], mock.Anything).Return(serverPub[:], nil)
+	db.On("ClaimKeySuccess", "1.1.1.1").Return(nil)
+
+	router := buildNewKeyClaimServletRouter(db, &keyclaim.Authenticator{})
+
+	_, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	// A typo is rejected without counting towards a ban
+	marshalledUpload, _ := proto.Marshal(buildKeyClaimRequest(proto.String("URA452UJFQ"), appPub[:]))
+	req, _ := http.NewRequest("POST", "/claim-key", bytes.NewReader(marshalledUpload))
+	forwardedFor(req, "1.1.1.1")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	var response pb.KeyClaimResponse
+	proto.Unmarshal(resp.Body.Bytes(), &response)
+	assert.Equal(t, 400, resp.Code, "bad request response is expected")
+	assert.Equal(t, pb.KeyClaimResponse_MALFORMED_ONE_TIME_CODE, response.GetError())
+	assert.Equal(t, uint32(triesRemaining), response.GetTriesRemaining())
+
+	db.AssertNotCalled(t, "ClaimKey", mock.Anything, mock.Anything, mock.Anything)
+	db.AssertNotCalled(t, "ClaimKeyFailure", mock.Anything)
+
+	// A well-formed code is claimed, however it was typed
+	marshalledUpload, _ = proto.Marshal(buildKeyClaimRequest(proto.String("ura-452-ujfz"), appPub[:]))
+	req, _ = http.NewRequest("POST", "/claim-key", bytes.NewReader(marshalledUpload))
+	forwardedFor(req, "1.1.1.1")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "success response is expected")
+	db.AssertCalled(t, "ClaimKey", "URA452UJFZ", appPub[:], mock.Anything)
+}
+
+func TestNewKeyClaims(t *testing.T) {
+	db := &persistence.Conn{}
+	auth := &keyclaim.Authenticator{}
+
+	auth.On("RegionFromAuthHeader", "Bearer goodtoken").Return("302", "goodtoken", true)
+
+	hashID := strings.Repeat("a", 128)
+	claims := []err.KeyClaim{{OneTimeCode: "AAABBBCCCC"}, {OneTimeCode: "DDDEEEFFFF"}}
+	db.On("NewKeyClaims", mock.Anything, "302", "goodtoken", 2, []string(nil), err.OnsetDates{}).Return(claims, nil)
+	db.On("NewKeyClaims", mock.Anything, "302", "goodtoken", 1, []string{hashID}, err.OnsetDates{}).Return([]err.KeyClaim{{OneTimeCode: "AAABBBCCCC", HashID: hashID}}, nil)
+	db.On("NewKeyClaims", mock.Anything, "302", "goodtoken", 3, []string(nil), err.OnsetDates{}).Return(nil, err.ErrTooManyUnclaimedCodes)
+	db.On("UseOneTimeCodeQuota", mock.Anything, "goodtoken", mock.Anything).Return(nil)
+	db.On("RefundOneTimeCodeQuota", mock.Anything, "goodtoken", mock.Anything).Return(nil)
+
+	router := buildNewKeyClaimServletRouter(db, auth)
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	post := func(body, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/new-key-claims", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer goodtoken")
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// JSON by default
+	resp := post("count=2", "")
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, `{"codes":[{"one_time_code":"AAABBBCCCC"},{"one_time_code":"DDDEEEFFFF"}]}`, resp.Body.String())
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "generated key claims")
+
+	// CSV if asked for
+	resp = post("hash_id="+hashID, "text/csv")
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "one_time_code,hash_id\nAAABBBCCCC,"+hashID+"\n", resp.Body.String())
+
+	// Over the originator's cap
+	resp = post("count=3", "")
+	assert.Equal(t, 429, resp.Code, "Too many requests response is expected")
+
+	// Codes that weren't generated don't count against the quota
+	db.AssertNumberOfCalls(t, "RefundOneTimeCodeQuota", 1)
+	db.AssertCalled(t, "RefundOneTimeCodeQuota", mock.Anything, "goodtoken", 3)
+
+	// Invalid requests
+	for _, body := range []string{
+		"",
+		"count=0",
+		"count=many",
+		fmt.Sprintf("count=%d", config.AppConstants.MaxUnclaimedOneTimeCodes+1),
+		"count=2&hash_id=" + hashID,
+		"hash_id=abc",
+		"hash_id=" + hashID + "&hash_id=" + hashID,
+	} {
+		resp = post(body, "")
+		assert.Equal(t, 400, resp.Code, body)
+	}
+}
+
+func TestCodeStatus(t *testing.T) {
+	db := &persistence.Conn{}
+	auth := &keyclaim.Authenticator{}
+
+	auth.On("RegionFromAuthHeader", "Bearer goodtoken").Return("302", "goodtoken", true)
+	auth.On("RegionFromAuthHeader", "Bearer badtoken").Return("", "", false)
+
+	db.On("OneTimeCodeStatus", "goodtoken", "AAABBBCCCC", "").Return(&err.CodeStatus{Status: err.CodeKeysUploaded, RemainingKeys: 14}, nil)
+	db.On("OneTimeCodeStatus", "goodtoken", "", "abcd").Return(nil, err.ErrCodeNotFound)
+	db.On("OneTimeCodeStatus", "goodtoken", "DDDEEEFFFF", "").Return(nil, fmt.Errorf("Generic Error"))
+
+	router := buildNewKeyClaimServletRouter(db, auth)
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	// Found by code, however it was typed
+	req, _ := http.NewRequest("GET", "/code-status?one_time_code=aaa-bbb-cccc", nil)
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, `{"status":"keys_uploaded","remaining_keys":14}`, resp.Body.String())
+
+	// Not issued by this originator
+	req, _ = http.NewRequest("GET", "/code-status?hash_id=abcd", nil)
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 404, resp.Code, "Not found response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "code not found")
+
+	// Database error
+	req, _ = http.NewRequest("GET", "/code-status?one_time_code=DDDEEEFFFF", nil)
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 500, resp.Code, "Server error response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.ErrorLevel, "error looking up code")
+
+	// Both a code and a hashID
+	req, _ = http.NewRequest("GET", "/code-status?one_time_code=AAABBBCCCC&hash_id=abcd", nil)
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad request response is expected")
+
+	// Bad auth token
+	req, _ = http.NewRequest("GET", "/code-status?one_time_code=AAABBBCCCC", nil)
+	req.Header.Set("Authorization", "Bearer badtoken")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 401, resp.Code, "Unauthorized response is expected")
+
+	// Wrong method
+	req, _ = http.NewRequest("POST", "/code-status?one_time_code=AAABBBCCCC", nil)
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 401, resp.Code, "Unauthorized response is expected")
+}
+
+func TestRevokeCode(t *testing.T) {
+	db := &persistence.Conn{}
+	auth := &keyclaim.Authenticator{}
+
+	auth.On("RegionFromAuthHeader", "Bearer goodtoken").Return("302", "goodtoken", true)
+
+	db.On("RevokeOneTimeCode", mock.Anything, "goodtoken", "AAABBBCCCC", "").Return(nil)
+	db.On("RevokeOneTimeCode", mock.Anything, "goodtoken", "", "abcd").Return(err.ErrCodeClaimed)
+
+	router := buildNewKeyClaimServletRouter(db, auth)
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	req, _ := http.NewRequest("POST", "/revoke-code", strings.NewReader("one_time_code=AAABBBCCCC"))
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, `{"revoked":true}`, resp.Body.String())
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "revoked code")
+
+	// Already claimed
+	req, _ = http.NewRequest("POST", "/revoke-code", strings.NewReader("hash_id=abcd"))
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 409, resp.Code, "Conflict response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "code already claimed")
+}
+
+func TestReissueCode(t *testing.T) {
+	db := &persistence.Conn{}
+	auth := &keyclaim.Authenticator{}
+
+	auth.On("RegionFromAuthHeader", "Bearer goodtoken").Return("302", "goodtoken", true)
+
+	db.On("ReissueOneTimeCode", mock.Anything, "goodtoken", "AAABBBCCCC", "").Return("DDDEEEFFFF", nil)
+	db.On("ReissueOneTimeCode", mock.Anything, "goodtoken", "GGGHHHJJJJ", "").Return("", err.ErrCodeNotFound)
+
+	router := buildNewKeyClaimServletRouter(db, auth)
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	req, _ := http.NewRequest("POST", "/reissue-code", strings.NewReader("one_time_code=AAABBBCCCC"))
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, "DDDEEEFFFF\n", resp.Body.String())
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "reissued code")
+
+	// Deleted, or never issued
+	req, _ = http.NewRequest("POST", "/reissue-code", strings.NewReader("one_time_code=GGGHHHJJJJ"))
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 404, resp.Code, "Not found response is expected")
+}
+
+func forwardedFor(req *http.Request, ip string) {
+	req.RemoteAddr = "10.0.0.1:443"
+	req.Header.Set("X-Forwarded-For", ip)
+}
+
 func buildKeyClaimRequest(oneTimeCode *string, appPublicKey []byte) *pb.KeyClaimRequest {
 	return &pb.KeyClaimRequest{
 		OneTimeCode:  oneTimeCode,
@@ -544,7 +1007,7 @@ func buildKeyClaimRequest(oneTimeCode *string, appPublicKey []byte) *pb.KeyClaim
 }
 
 func buildNewKeyClaimServletRouter(db *persistence.Conn, auth *keyclaim.Authenticator) *mux.Router {
-	servlet := NewKeyClaimServlet(db, auth)
+	servlet := NewKeyClaimServlet(db, auth, testProxies)
 	router := Router()
 	servlet.RegisterRouting(router)
 	return router
@@ -36,6 +36,7 @@ func (m metricsServlet) RegisterRouting(r *mux.Router) {
 	r.HandleFunc(fmt.Sprintf("/events/uploads/{startDate:%s}", DATEFORMAT), m.handleTEKUploadsRequest)
 	log(nil, nil).Info("registering otkdurations")
 	r.HandleFunc(fmt.Sprintf("/events/otkdurations/{startDate:%s}", DATEFORMAT), m.handleOtkDurationsRequest)
+	r.HandleFunc("/events/quotas", m.handleQuotaUsageRequest)
 }
 
 func authorizeRequest(r *http.Request) error {
@@ -220,3 +221,47 @@ func (m *metricsServlet) getDurationData(ctx context.Context, w http.ResponseWri
 	}
 	return
 }
+
+func (m *metricsServlet) handleQuotaUsageRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := authorizeRequest(r); err != nil {
+		log(ctx, err).Info("Unauthorized BasicAuth")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != "GET" {
+		log(ctx, nil).WithField("method", r.Method).Info("disallowed method")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	m.getQuotaUsage(ctx, w)
+	return
+}
+
+// getQuotaUsage responds with each originator's one-time code usage this
+// minute and today, against its quotas.
+func (m *metricsServlet) getQuotaUsage(ctx context.Context, w http.ResponseWriter) {
+	usage, err := m.db.OneTimeCodeUsage()
+	if err != nil {
+		log(ctx, err).Errorf("issue getting one-time code usage")
+		http.Error(w, "error retrieving one-time code usage", http.StatusInternalServerError)
+		return
+	}
+
+	js, err := json.Marshal(usage)
+	if err != nil {
+		log(ctx, err).WithField("QuotaUsageResults", usage).Errorf("error marshaling usage")
+		http.Error(w, "error building json object", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err = w.Write(js); err != nil {
+		log(ctx, err).Errorf("error writing json")
+	}
+}
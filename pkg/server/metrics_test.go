@@ -122,10 +122,11 @@ func TestMetricsServlet_RegisterRoutingMetrics(t *testing.T) {
 	router := createRouter(db, auth)
 
 	expectedPaths := GetPaths(router)
-	assert.Equal(t, len(expectedPaths), 3)
+	assert.Equal(t, len(expectedPaths), 4)
 	assert.Contains(t, expectedPaths, fmt.Sprintf("/events/{startDate:%s}", DATEFORMAT), "Should contain claimed-keys endpoint")
 	assert.Contains(t, expectedPaths, fmt.Sprintf("/events/uploads/{startDate:%s}", DATEFORMAT), "Should contain TEK uploads endpoint")
 	assert.Contains(t, expectedPaths, fmt.Sprintf("/events/otkdurations/{startDate:%s}", DATEFORMAT), "Should contain TEK uploads endpoint")
+	assert.Contains(t, expectedPaths, "/events/quotas", "Should contain quota usage endpoint")
 }
 
 func TestMetricsServlet_DBError(t *testing.T) {
@@ -257,3 +258,44 @@ func TestMetricsServlet_GetOtkDurationsData(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.Code)
 	assert.Equal(t, "[{\"source\":\"foo\",\"date\":\"bar\",\"hours\":1,\"count\":1},{\"source\":\"foo\",\"date\":\"bar\",\"hours\":12,\"count\":1}]", string(resp.Body.Bytes()))
 }
+
+func TestMetricsServlet_GetQuotaUsage(t *testing.T) {
+
+	db, auth := createMocks()
+	router := createRouter(db, auth)
+
+	db.On("OneTimeCodeUsage").
+		Return(
+			[]persistence2.QuotaUsage{{
+				Originator:     "ONApi",
+				Minute:         3,
+				Day:            40,
+				PerMinuteQuota: 100,
+				PerDayQuota:    1000,
+			}},
+			nil,
+		).Once()
+	db.On("OneTimeCodeUsage").Return(nil, fmt.Errorf("error")).Once()
+
+	get := func(method, authorization string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/events/quotas", nil)
+		req.Header.Set("Authorization", authorization)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := get("GET", "Basic foo")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = get("POST", "Basic Zm9vOmJhcg==")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = get("GET", "Basic Zm9vOmJhcg==")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "[{\"originator\":\"ONApi\",\"minute\":3,\"day\":40,\"per_minute_quota\":100,\"per_day_quota\":1000}]", string(resp.Body.Bytes()))
+
+	resp = get("GET", "Basic Zm9vOmJhcg==")
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "error retrieving one-time code usage\n", string(resp.Body.Bytes()))
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies are the proxies in front of us, whose X-Forwarded-For
+// entries and forwarded client certificates we believe.
+type TrustedProxies []*net.IPNet
+
+// NewTrustedProxies parses the CIDRs, or single addresses, of the proxies in
+// front of us.
+func NewTrustedProxies(cidrs []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+func (p TrustedProxies) contains(ip net.IP) bool {
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Len is the number of trusted proxy networks.
+func (p TrustedProxies) Len() int {
+	return len(p)
+}
+
+// Trusts reports whether a request came straight from a trusted proxy.
+func (p TrustedProxies) Trusts(r *http.Request) bool {
+	ip := parseHost(r.RemoteAddr)
+	return ip != nil && p.contains(ip)
+}
+
+// parseHost parses an address, with or without a port.
+func parseHost(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The proxy requests come through in tests.
+var testProxies, _ = NewTrustedProxies([]string{"10.0.0.0/8"})
+
+func TestNewTrustedProxies(t *testing.T) {
+	proxies, err := NewTrustedProxies([]string{"10.0.0.0/8", " 192.0.2.1 ", "2001:db8::/32", "2001:db8:1::1"})
+	assert.Nil(t, err)
+	assert.Len(t, proxies, 4)
+
+	assert.True(t, proxies.contains(net.ParseIP("10.1.2.3")))
+	assert.True(t, proxies.contains(net.ParseIP("192.0.2.1")))
+	assert.False(t, proxies.contains(net.ParseIP("192.0.2.2")))
+	assert.True(t, proxies.contains(net.ParseIP("2001:db8:ffff::1")))
+	assert.False(t, proxies.contains(net.ParseIP("2001:db9::1")))
+
+	for _, cidr := range []string{"", "10.0.0.0/33", "proxy.internal", "10.0.0"} {
+		_, err := NewTrustedProxies([]string{cidr})
+		assert.NotNil(t, err, cidr)
+	}
+}
+
+func TestTrusts(t *testing.T) {
+	proxies, _ := NewTrustedProxies([]string{"10.0.0.0/8"})
+
+	for remoteAddr, trusted := range map[string]bool{"10.0.0.1:443": true, "10.0.0.1": true, "192.0.2.1:443": false, "pipe": false} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		assert.Equal(t, trusted, proxies.Trusts(r), remoteAddr)
+	}
+}
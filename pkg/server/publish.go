@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/persistence"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/timemath"
+	"github.com/cds-snc/covid-alert-server/pkg/verification"
+
+	"github.com/Shopify/goose/srvutil"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// Error codes /v1/publish responds with, as the exposure notification
+// reference server does.
+const (
+	publishBadRequest         = "bad_request"
+	publishUnknownAuthority   = "unknown_health_authority_id"
+	publishInvalidCertificate = "health_authority_verification_certificate_invalid"
+	publishInternalError      = "internal_error"
+)
+
+// Room for 28 keys, the certificate and the padding apps add.
+const maxPublishRequestSizeBytes = 64 * 1024
+
+// NewPublishServlet returns the servlet that accepts keys uploaded with a
+// verification certificate, in the exposure notification reference server's
+// format, so that EN Express apps can upload without a one-time code.
+func NewPublishServlet(db persistence.Conn, verifier *verification.Verifier, cache *retrieval.BundleCache) srvutil.Servlet {
+	log(nil, nil).Info("registering publish servlet")
+	return &publishServlet{db: db, verifier: verifier, cache: cache}
+}
+
+type publishServlet struct {
+	db       persistence.Conn
+	verifier *verification.Verifier
+	cache    *retrieval.BundleCache
+}
+
+type publishKey struct {
+	Key              string `json:"key"`
+	IntervalNumber   int32  `json:"rollingStartNumber"`
+	IntervalCount    int32  `json:"rollingPeriod"`
+	TransmissionRisk int32  `json:"transmissionRisk"`
+}
+
+type publishRequest struct {
+	Keys                 []publishKey `json:"temporaryExposureKeys"`
+	HealthAuthorityID    string       `json:"healthAuthorityID"`
+	VerificationPayload  string       `json:"verificationPayload"`
+	HMACKey              string       `json:"hmacKey"`
+	SymptomOnsetInterval uint32       `json:"symptomOnsetInterval"`
+	Padding              string       `json:"padding"`
+}
+
+type publishResponse struct {
+	InsertedExposures int64  `json:"insertedExposures"`
+	ErrorMessage      string `json:"error,omitempty"`
+	Code              string `json:"code,omitempty"`
+}
+
+func (s *publishServlet) RegisterRouting(r *mux.Router) {
+	log(nil, nil).Info("registering publish route")
+	r.HandleFunc("/v1/publish", s.publishWrapper)
+}
+
+func (s *publishServlet) fail(logger *logrus.Entry, w http.ResponseWriter, logMsg string, code string, responseCode int) result {
+	if responseCode == http.StatusInternalServerError {
+		logger.Error(logMsg)
+	} else {
+		logger.Warn(logMsg)
+	}
+	writePublishResponse(logger, w, responseCode, publishResponse{ErrorMessage: logMsg, Code: code})
+	return result(struct{}{})
+}
+
+func writePublishResponse(logger *logrus.Entry, w http.ResponseWriter, responseCode int, resp publishResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(responseCode)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.WithError(err).Warn("error writing publish response")
+	}
+}
+
+func (s *publishServlet) publishWrapper(w http.ResponseWriter, r *http.Request) {
+	_ = s.publish(w, r)
+}
+
+func (s *publishServlet) publish(w http.ResponseWriter, r *http.Request) result {
+	ctx := r.Context()
+
+	if r.Method != "POST" {
+		return s.fail(log(ctx, nil).WithField("method", r.Method), w, "method not allowed", publishBadRequest, http.StatusMethodNotAllowed)
+	}
+
+	var req publishRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPublishRequestSizeBytes)).Decode(&req); err != nil {
+		return s.fail(log(ctx, err), w, "error unmarshalling request", publishBadRequest, http.StatusBadRequest)
+	}
+	logger := log(ctx, nil).WithField("healthAuthorityID", req.HealthAuthorityID)
+
+	if len(req.Keys) == 0 {
+		return s.fail(logger, w, "no keys provided", publishBadRequest, http.StatusBadRequest)
+	}
+	if len(req.Keys) > pb.MaxKeysInUpload {
+		return s.fail(logger, w, "too many keys provided", publishBadRequest, http.StatusBadRequest)
+	}
+
+	keys := make([]*pb.TemporaryExposureKey, 0, len(req.Keys))
+	for _, k := range req.Keys {
+		keyData, err := base64.StdEncoding.DecodeString(k.Key)
+		if err != nil {
+			return s.fail(logger, w, "invalid key data", publishBadRequest, http.StatusBadRequest)
+		}
+		rsin, rollingPeriod, risk := k.IntervalNumber, k.IntervalCount, k.TransmissionRisk
+		keys = append(keys, &pb.TemporaryExposureKey{
+			KeyData:                    keyData,
+			RollingStartIntervalNumber: &rsin,
+			RollingPeriod:              &rollingPeriod,
+			TransmissionRiskLevel:      &risk,
+		})
+	}
+
+	cert, err := s.verifier.Verify(req.HealthAuthorityID, req.VerificationPayload, time.Now())
+	if err == verification.ErrUnknownHealthAuthority {
+		return s.fail(logger, w, "unknown health authority", publishUnknownAuthority, http.StatusBadRequest)
+	} else if err != nil {
+		return s.fail(logger, w, "invalid verification certificate", publishInvalidCertificate, http.StatusUnauthorized)
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(req.HMACKey)
+	if err != nil || len(secret) == 0 {
+		return s.fail(logger, w, "invalid hmac key", publishBadRequest, http.StatusBadRequest)
+	}
+	if err := cert.CheckTEKMAC(keys, secret); err != nil {
+		return s.fail(logger, w, "keys don't match the verification certificate", publishInvalidCertificate, http.StatusUnauthorized)
+	}
+
+	reportType, ok := certificateReportType(cert.ReportType)
+	if !ok {
+		return s.fail(logger.WithField("reportType", cert.ReportType), w, "unsupported report type", publishBadRequest, http.StatusBadRequest)
+	}
+	for _, key := range keys {
+		key.ReportType = reportType.Enum()
+	}
+
+	if p := checkKeys(keys); p != nil {
+		return s.fail(logger, w, p.msg, publishBadRequest, http.StatusBadRequest)
+	}
+
+	inserted, err := s.db.StoreCertifiedKeys(cert.Region, cert.HealthAuthorityID, cert.Hash, keys, certificateOnsetDates(cert, req.SymptomOnsetInterval))
+	if err == persistence.ErrCertificateUsed {
+		return s.fail(logger, w, "verification certificate already used", publishInvalidCertificate, http.StatusBadRequest)
+	} else if err != nil {
+		return s.fail(log(ctx, err), w, "failed to store diagnosis keys", publishInternalError, http.StatusInternalServerError)
+	}
+	s.cache.InvalidateHour(timemath.HourNumber(time.Now()))
+
+	writePublishResponse(logger, w, http.StatusOK, publishResponse{InsertedExposures: inserted})
+	logger.WithField("keys", inserted).Info("Stored certified keys")
+	return result(struct{}{})
+}
+
+// certificateReportType maps the report type a certificate vouches for to the
+// one stored with the keys. Certificates without one predate report types,
+// and were only issued for positive tests.
+func certificateReportType(reportType string) (pb.TemporaryExposureKey_ReportType, bool) {
+	switch reportType {
+	case "", verification.ReportTypeConfirmed:
+		return pb.TemporaryExposureKey_CONFIRMED_TEST, true
+	case verification.ReportTypeLikely:
+		return pb.TemporaryExposureKey_CONFIRMED_CLINICAL_DIAGNOSIS, true
+	default:
+		return pb.TemporaryExposureKey_UNKNOWN, false
+	}
+}
+
+// certificateOnsetDates returns the dates keys are anchored to. The
+// certificate's symptom onset takes precedence over the app's.
+func certificateOnsetDates(cert *verification.Certificate, requestOnsetInterval uint32) persistence.OnsetDates {
+	var dates persistence.OnsetDates
+
+	onset := cert.SymptomOnsetInterval
+	if onset == 0 {
+		onset = requestOnsetInterval
+	}
+	if onset != 0 {
+		t := time.Unix(int64(onset)*600, 0)
+		dates.SymptomOnset = &t
+	}
+	if cert.TestDateInterval != 0 {
+		t := time.Unix(int64(cert.TestDateInterval)*600, 0)
+		dates.Test = &t
+	}
+	return dates
+}
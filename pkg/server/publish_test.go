@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	persistence "github.com/cds-snc/covid-alert-server/mocks/pkg/persistence"
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	pkgPersistence "github.com/cds-snc/covid-alert-server/pkg/persistence"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	pkgRetrieval "github.com/cds-snc/covid-alert-server/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/testhelpers"
+	"github.com/cds-snc/covid-alert-server/pkg/verification"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRegisterRoutingPublish(t *testing.T) {
+	servlet := NewPublishServlet(&persistence.Conn{}, &verification.Verifier{}, pkgRetrieval.NewBundleCache(1))
+	router := Router()
+	servlet.RegisterRouting(router)
+
+	expectedPaths := GetPaths(router)
+	assert.Contains(t, expectedPaths, "/v1/publish", "should include a publish path")
+}
+
+func setupPublishRouter(t *testing.T, db *persistence.Conn) (*mux.Router, *ecdsa.PrivateKey) {
+	dir, _ := ioutil.TempDir("", "publish")
+	defer os.RemoveAll(dir)
+
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	keyFile := filepath.Join(dir, "v1.pem")
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+
+	verifier, err := verification.NewVerifier([]config.VerificationAuthority{{
+		HealthAuthorityID: "ca.gc.hc",
+		Issuer:            "ca.gc.hc",
+		Audience:          "covid-alert",
+		Keys:              []config.VerificationKey{{ID: "v1", PublicKeyFile: keyFile}},
+	}})
+	assert.Nil(t, err)
+
+	servlet := NewPublishServlet(db, verifier, pkgRetrieval.NewBundleCache(1))
+	router := Router()
+	servlet.RegisterRouting(router)
+	return router, privateKey
+}
+
+func publishRequestBody(privateKey *ecdsa.PrivateKey, keys []*pb.TemporaryExposureKey, macKeys []*pb.TemporaryExposureKey) []byte {
+	secret := []byte("app secret")
+	now := time.Now()
+	certificate := testhelpers.SignCertificate(privateKey, "v1", map[string]interface{}{
+		"iss":        "ca.gc.hc",
+		"aud":        "covid-alert",
+		"iat":        now.Unix(),
+		"exp":        now.Add(15 * time.Minute).Unix(),
+		"reportType": "confirmed",
+		"tekmac":     base64.StdEncoding.EncodeToString(verification.TEKMAC(macKeys, secret)),
+	})
+
+	req := publishRequest{
+		HealthAuthorityID:   "ca.gc.hc",
+		VerificationPayload: certificate,
+		HMACKey:             base64.StdEncoding.EncodeToString(secret),
+	}
+	for _, key := range keys {
+		req.Keys = append(req.Keys, publishKey{
+			Key:              base64.StdEncoding.EncodeToString(key.GetKeyData()),
+			IntervalNumber:   key.GetRollingStartIntervalNumber(),
+			IntervalCount:    key.GetRollingPeriod(),
+			TransmissionRisk: key.GetTransmissionRiskLevel(),
+		})
+	}
+	body, _ := json.Marshal(req)
+	return body
+}
+
+func readPublishResponse(t *testing.T, resp *httptest.ResponseRecorder) publishResponse {
+	var body publishResponse
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	return body
+}
+
+func TestPublish(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db := &persistence.Conn{}
+	router, privateKey := setupPublishRouter(t, db)
+
+	keys := []*pb.TemporaryExposureKey{randomTestKey(), randomTestKey()}
+	db.On("StoreCertifiedKeys", "302", "ca.gc.hc", mock.AnythingOfType("[]uint8"), mock.AnythingOfType("[]*covidshield.TemporaryExposureKey"), pkgPersistence.OnsetDates{}).Return(int64(2), nil)
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest("POST", "/v1/publish", bytes.NewReader(publishRequestBody(privateKey, keys, keys))))
+
+	assert.Equal(t, 200, resp.Code)
+	assert.Equal(t, publishResponse{InsertedExposures: 2}, readPublishResponse(t, resp))
+
+	stored := db.Calls[0].Arguments.Get(3).([]*pb.TemporaryExposureKey)
+	assert.Equal(t, pb.TemporaryExposureKey_CONFIRMED_TEST, stored[0].GetReportType())
+
+	testhelpers.AssertLog(t, hook, 3, logrus.InfoLevel, "Stored certified keys")
+}
+
+func TestPublish_Rejected(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db := &persistence.Conn{}
+	router, privateKey := setupPublishRouter(t, db)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	keys := []*pb.TemporaryExposureKey{randomTestKey(), randomTestKey()}
+
+	// Not signed by the health authority
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest("POST", "/v1/publish", bytes.NewReader(publishRequestBody(otherKey, keys, keys))))
+	assert.Equal(t, 401, resp.Code)
+	assert.Equal(t, "health_authority_verification_certificate_invalid", readPublishResponse(t, resp).Code)
+	testhelpers.AssertLog(t, hook, 3, logrus.WarnLevel, "invalid verification certificate")
+
+	// Issued for other keys
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest("POST", "/v1/publish", bytes.NewReader(publishRequestBody(privateKey, keys, keys[:1]))))
+	assert.Equal(t, 401, resp.Code)
+	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "keys don't match the verification certificate")
+
+	// No keys
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest("POST", "/v1/publish", bytes.NewReader(publishRequestBody(privateKey, nil, nil))))
+	assert.Equal(t, 400, resp.Code)
+	assert.Equal(t, "bad_request", readPublishResponse(t, resp).Code)
+	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "no keys provided")
+
+	// Wrong method
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest("GET", "/v1/publish", nil))
+	assert.Equal(t, 405, resp.Code)
+	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "method not allowed")
+
+	db.AssertNotCalled(t, "StoreCertifiedKeys", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPublish_CertificateUsed(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db := &persistence.Conn{}
+	router, privateKey := setupPublishRouter(t, db)
+
+	keys := []*pb.TemporaryExposureKey{randomTestKey()}
+	db.On("StoreCertifiedKeys", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(int64(0), pkgPersistence.ErrCertificateUsed).Once()
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest("POST", "/v1/publish", bytes.NewReader(publishRequestBody(privateKey, keys, keys))))
+	assert.Equal(t, 400, resp.Code)
+	assert.Equal(t, "health_authority_verification_certificate_invalid", readPublishResponse(t, resp).Code)
+	testhelpers.AssertLog(t, hook, 3, logrus.WarnLevel, "verification certificate already used")
+
+	db.On("StoreCertifiedKeys", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(int64(0), errors.New("oh no"))
+
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest("POST", "/v1/publish", bytes.NewReader(publishRequestBody(privateKey, keys, keys))))
+	assert.Equal(t, 500, resp.Code)
+	assert.Equal(t, "internal_error", readPublishResponse(t, resp).Code)
+	testhelpers.AssertLog(t, hook, 1, logrus.ErrorLevel, "failed to store diagnosis keys")
+}
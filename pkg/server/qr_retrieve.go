@@ -1,12 +1,16 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/cds-snc/covid-alert-server/pkg/config"
 	"github.com/cds-snc/covid-alert-server/pkg/persistence"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
 	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
 	"github.com/cds-snc/covid-alert-server/pkg/timemath"
 
@@ -16,20 +20,33 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func NewQrRetrieveServlet(db persistence.Conn, auth retrieval.Authenticator, signer retrieval.Signer) srvutil.Servlet {
+// Outbreak event export formats. Version 1 is kept for clients released
+// before version 2, and is signed only with the key configured in
+// qrV1SigningKeyVersion, which has to be kept until those clients are retired.
+const (
+	qrExportV1 = 1
+	qrExportV2 = 2
+)
+
+func NewQrRetrieveServlet(db persistence.Conn, auth retrieval.Authenticator, signingKeys retrieval.SigningKeys, cache *retrieval.BundleCache) srvutil.Servlet {
 	log(nil, nil).Info("registering QR retrieval servlet")
-	return &qrRetrieveServlet{db: db, auth: auth, signer: signer}
+	return &qrRetrieveServlet{db: db, auth: auth, signingKeys: signingKeys, cache: cache}
 }
 
+var errNoQRV1SigningKey = errors.New("no signing key for version 1 outbreak event exports")
+
 type qrRetrieveServlet struct {
-	db     persistence.Conn
-	auth   retrieval.Authenticator
-	signer retrieval.Signer
+	db          persistence.Conn
+	auth        retrieval.Authenticator
+	signingKeys retrieval.SigningKeys
+	cache       *retrieval.BundleCache
 }
 
 func (s *qrRetrieveServlet) RegisterRouting(r *mux.Router) {
 	// becomes 7 digits in 2084
 	log(nil, nil).Info("registering QR retrieval route")
+	r.HandleFunc("/qr/{region:[0-9]{3}}/index/{auth:.*}", s.qrRetrieveIndexWrapper)
+	r.HandleFunc("/qr/v2/{region:[0-9]{3}}/{day:[0-9]{5}}/{auth:.*}", s.qrRetrieveV2Wrapper)
 	r.HandleFunc("/qr/{region:[0-9]{3}}/{day:[0-9]{5}}/{auth:.*}", s.qrRetrieveWrapper)
 }
 
@@ -48,40 +65,41 @@ func (s *qrRetrieveServlet) fail(logger *logrus.Entry, w http.ResponseWriter, lo
 }
 
 func (s *qrRetrieveServlet) qrRetrieveWrapper(w http.ResponseWriter, r *http.Request) {
-	_ = s.qrRetrieve(w, r)
+	_ = s.qrRetrieve(w, r, qrExportV1)
+}
+
+func (s *qrRetrieveServlet) qrRetrieveV2Wrapper(w http.ResponseWriter, r *http.Request) {
+	_ = s.qrRetrieve(w, r, qrExportV2)
+}
+
+func (s *qrRetrieveServlet) qrRetrieveIndexWrapper(w http.ResponseWriter, r *http.Request) {
+	_ = s.qrRetrieveIndex(w, r)
 }
 
-func (s *qrRetrieveServlet) qrRetrieve(w http.ResponseWriter, r *http.Request) result {
+func (s *qrRetrieveServlet) qrRetrieve(w http.ResponseWriter, r *http.Request, version int) result {
 	ctx := r.Context()
 	vars := mux.Vars(r)
 
-	/* Hardcode the region as 302 (Canada MCC)
-	You can see the reason for this in pkg/server/keyclaim.go
-	As stated there I'm going to open an issue to continue this work instead of just
-	relying on the hardcoded value.
-	*/
-	region := config.AppConstants.RegionCode
+	region := vars["region"]
 	if !s.auth.Authenticate(region, vars["day"], vars["auth"]) {
 		return s.fail(log(ctx, nil), w, "invalid auth parameter", "unauthorized", http.StatusUnauthorized)
 	}
 
-	if r.Method != "GET" {
+	if r.Method != "GET" && r.Method != "HEAD" {
 		return s.fail(log(ctx, nil).WithField("method", r.Method), w, "method not allowed", "", http.StatusMethodNotAllowed)
 	}
 
-	var startTimestamp time.Time
-	var endTimestamp time.Time
+	if !retrieval.ServesRegion(region) {
+		return s.fail(log(ctx, nil).WithField("region", region), w, "unknown region", "", http.StatusNotFound)
+	}
+
 	var dateNumber uint32
+	var window exportWindow
 
 	if config.AppConstants.EnableEntirePeriodBundle == true && vars["day"] == "00000" {
 
-		endDate := timemath.CurrentDateNumber() - 1
-		startDate := endDate - numberOfDaysToServe
-
-		dateNumber = endDate
-
-		startTimestamp = time.Unix(int64(startDate*86400), 0)
-		endTimestamp = time.Unix(int64((endDate+1)*86400), 0)
+		dateNumber = timemath.CurrentDateNumber() - 1
+		window = entirePeriodWindow(dateNumber)
 
 	} else {
 
@@ -90,9 +108,7 @@ func (s *qrRetrieveServlet) qrRetrieve(w http.ResponseWriter, r *http.Request) r
 			return s.fail(log(ctx, err), w, "invalid day parameter", "", http.StatusBadRequest)
 		}
 		dateNumber = uint32(dateNumber64)
-
-		startTimestamp = time.Unix(int64(dateNumber*86400), 0)
-		endTimestamp = time.Unix(int64((dateNumber+1)*86400), 0)
+		window = dayWindow(dateNumber)
 	}
 
 	currentDateNumber := timemath.CurrentDateNumber()
@@ -105,18 +121,131 @@ func (s *qrRetrieveServlet) qrRetrieve(w http.ResponseWriter, r *http.Request) r
 		return s.fail(log(ctx, nil), w, "request for too-old data", "requested data no longer valid", http.StatusGone)
 	}
 
-	locations, err := s.db.FetchOutbreakForTimeRange(startTimestamp, endTimestamp)
+	bundle, cached, err := s.bundle(ctx, region, window, version, time.Now())
 	if err != nil {
-		return s.fail(log(ctx, err), w, "database error", "", http.StatusInternalServerError)
+		be := err.(*bundleError)
+		return s.fail(log(ctx, be.err), w, be.logMsg, be.responseMsg, http.StatusInternalServerError)
 	}
 
-	w.Header().Add("Content-Type", "application/zip")
-	w.Header().Add("Cache-Control", "public, max-age=3600, max-stale=600")
+	serveBundle(w, r, bundle)
+	if cached {
+		log(ctx, nil).WithField("size", len(bundle.Body)).Info("Wrote cached outbreak event retrieval")
+	} else {
+		log(ctx, nil).WithField("size", len(bundle.Body)).WithField("locations", bundle.Count).WithField("version", version).Info("Wrote outbreak event retrieval")
+	}
+	return result(struct{}{})
+}
 
-	size, err := retrieval.SerializeOutbreakEventsTo(ctx, w, locations, startTimestamp, endTimestamp, s.signer)
-	if err != nil {
-		log(ctx, err).Info("error writing response")
+// qrRetrieveIndex is the outbreak event counterpart of retrieveIndex. It
+// lists version 2 exports only.
+func (s *qrRetrieveServlet) qrRetrieveIndex(w http.ResponseWriter, r *http.Request) result {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	region := vars["region"]
+	if !s.auth.AuthenticateIndex(region, vars["auth"]) {
+		return s.fail(log(ctx, nil), w, "invalid auth parameter", "unauthorized", http.StatusUnauthorized)
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return s.fail(log(ctx, nil).WithField("method", r.Method), w, "method not allowed", "", http.StatusMethodNotAllowed)
+	}
+
+	if !retrieval.ServesRegion(region) {
+		return s.fail(log(ctx, nil).WithField("region", region), w, "unknown region", "", http.StatusNotFound)
+	}
+
+	now := time.Now()
+	currentDateNumber := timemath.CurrentDateNumber()
+	oldestDateNumber := currentDateNumber - numberOfDaysToServe
+
+	key := retrieval.BundleKey{
+		Region:    region,
+		StartHour: oldestDateNumber * hoursInDay,
+		EndHour:   timemath.HourNumber(now) + 1,
+		Variant:   "qr-index",
+	}
+	if bundle, ok := s.cache.Get(key, now); ok {
+		serveBundle(w, r, bundle)
+		log(ctx, nil).WithField("size", len(bundle.Body)).Info("Wrote cached outbreak event index")
+		return result(struct{}{})
+	}
+
+	lastDateNumber := currentDateNumber - 1
+	if config.AppConstants.DisableCurrentDateCheckFeatureFlag {
+		lastDateNumber = currentDateNumber
 	}
-	log(ctx, nil).WithField("unzipped-size", size).WithField("locations", len(locations)).Info("Wrote outbreak event retrieval")
+
+	var windows []exportWindow
+	if config.AppConstants.EnableEntirePeriodBundle {
+		windows = append(windows, entirePeriodWindow(currentDateNumber-1))
+	}
+	for day := oldestDateNumber; day <= lastDateNumber; day++ {
+		windows = append(windows, dayWindow(day))
+	}
+
+	var entries []*pb.BundleIndexEntry
+	for _, window := range windows {
+		bundle, _, err := s.bundle(ctx, region, window, qrExportV2, now)
+		if err != nil {
+			be := err.(*bundleError)
+			return s.fail(log(ctx, be.err), w, be.logMsg, be.responseMsg, http.StatusInternalServerError)
+		}
+		entries = append(entries, retrieval.NewBundleIndexEntry(window.period, window.number, 1, bundle))
+	}
+
+	var buf bytes.Buffer
+	if _, err := retrieval.SerializeBundleIndexTo(ctx, &buf, region, entries, now, s.signingKeys); err != nil {
+		return s.fail(log(ctx, err), w, "error serializing index", "server error", http.StatusInternalServerError)
+	}
+
+	bundle := retrieval.NewBundle(buf.Bytes(), "application/zip", 0, now)
+	s.cache.Add(key, bundle, now.Add(openWindowCacheTTL))
+
+	serveBundle(w, r, bundle)
+	log(ctx, nil).WithField("size", len(bundle.Body)).WithField("bundles", len(entries)).Info("Wrote outbreak event index")
 	return result(struct{}{})
 }
+
+// bundle returns a window's outbreak event export in the given format, from
+// the cache if it's there, and reports whether it was. Errors are
+// *bundleErrors.
+func (s *qrRetrieveServlet) bundle(ctx context.Context, region string, window exportWindow, version int, now time.Time) (*retrieval.Bundle, bool, error) {
+	key := retrieval.BundleKey{
+		Region:    region,
+		StartHour: window.startHour,
+		EndHour:   window.endHour,
+		Variant:   "qr-v" + strconv.Itoa(version),
+	}
+	if bundle, ok := s.cache.Get(key, now); ok {
+		return bundle, true, nil
+	}
+
+	locations, err := s.db.FetchOutbreakForTimeRange(region, window.start, window.end)
+	if err != nil {
+		return nil, false, &bundleError{"database error", "", err}
+	}
+
+	var buf bytes.Buffer
+	if version == qrExportV1 {
+		// Apps check these against the one key they pin, so the key doesn't
+		// change with the active keys.
+		key, ok := s.signingKeys.Version(config.AppConstants.QRV1SigningKeyVersion)
+		if !ok {
+			return nil, false, &bundleError{"error serializing export", "server error", errNoQRV1SigningKey}
+		}
+		_, err = retrieval.SerializeOutbreakEventsTo(ctx, &buf, locations, window.start, window.end, key)
+	} else {
+		_, err = retrieval.SerializeOutbreakEventBatchTo(ctx, &buf, locations, window.start, window.end, 1, 1, s.signingKeys)
+	}
+	if err != nil {
+		return nil, false, &bundleError{"error serializing export", "server error", err}
+	}
+
+	// Outbreak events can be added for past periods, so these are never cached
+	// for longer than an open window.
+	bundle := retrieval.NewBundle(buf.Bytes(), "application/zip", 0, now)
+	bundle.Count = len(locations)
+	s.cache.Add(key, bundle, now.Add(openWindowCacheTTL))
+	return bundle, false, nil
+}
@@ -14,11 +14,14 @@ import (
 
 	persistence "github.com/cds-snc/covid-alert-server/mocks/pkg/persistence"
 	retrieval "github.com/cds-snc/covid-alert-server/mocks/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/config"
 	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	pkgRetrieval "github.com/cds-snc/covid-alert-server/pkg/retrieval"
 	"github.com/cds-snc/covid-alert-server/pkg/timemath"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestNewQrRetrieveServlet(t *testing.T) {
@@ -28,22 +31,24 @@ func TestNewQrRetrieveServlet(t *testing.T) {
 	signer := &retrieval.Signer{}
 
 	expected := &qrRetrieveServlet{
-		db:     db,
-		auth:   auth,
-		signer: signer,
+		db:          db,
+		auth:        auth,
+		signingKeys: testSigningKeys(signer),
 	}
-	assert.Equal(t, expected, NewQrRetrieveServlet(db, auth, signer), "should return a new qrRetrieveServlet struct")
+	assert.Equal(t, expected, NewQrRetrieveServlet(db, auth, testSigningKeys(signer), nil), "should return a new qrRetrieveServlet struct")
 
 }
 
 func TestQrRegisterRoutingRetrieve(t *testing.T) {
 
-	servlet := NewQrRetrieveServlet(&persistence.Conn{}, &retrieval.Authenticator{}, &retrieval.Signer{})
+	servlet := NewQrRetrieveServlet(&persistence.Conn{}, &retrieval.Authenticator{}, testSigningKeys(&retrieval.Signer{}), nil)
 	router := Router()
 	servlet.RegisterRouting(router)
 
 	expectedPaths := GetPaths(router)
 	assert.Contains(t, expectedPaths, "/qr/{region:[0-9]{3}}/{day:[0-9]{5}}/{auth:.*}", "should include a retrieve path")
+	assert.Contains(t, expectedPaths, "/qr/v2/{region:[0-9]{3}}/{day:[0-9]{5}}/{auth:.*}", "should include a version 2 retrieve path")
+	assert.Contains(t, expectedPaths, "/qr/{region:[0-9]{3}}/index/{auth:.*}", "should include an index path")
 
 }
 
@@ -116,7 +121,7 @@ func TestQrRetrieve_AllKeysDownload(t *testing.T) {
 	startTime := time.Unix(int64(startDate*86400), 0)
 	endTime := time.Unix(int64((endDate+1)*86400), 0)
 
-	db.On("FetchOutbreakForTimeRange", startTime, endTime).Return([]*pb.OutbreakEvent{randomTestOutbreakEvent(), randomTestOutbreakEvent()}, nil)
+	db.On("FetchOutbreakForTimeRange", region, startTime, endTime).Return([]*pb.OutbreakEvent{randomTestOutbreakEvent(), randomTestOutbreakEvent()}, nil)
 
 	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return(make([]byte, 64), nil)
 
@@ -132,6 +137,182 @@ func TestQrRetrieve_AllKeysDownload(t *testing.T) {
 	testhelpers.AssertLog(t, hook, 3, logrus.InfoLevel, "Wrote outbreak event retrieval")
 }
 
+func TestQrRetrieve_V2(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, auth, signer := setupQrRetrieveMockers()
+	router := setupQrRetrieveRouter(db, auth, signer)
+
+	region := "302"
+	goodAuth := "abcd"
+	yesterday := timemath.CurrentDateNumber() - 1
+	yesterdaysDate := fmt.Sprint(yesterday)
+
+	auth.On("Authenticate", region, yesterdaysDate, goodAuth).Return(true)
+
+	startTime := time.Unix(int64(yesterday*86400), 0)
+	endTime := time.Unix(int64((yesterday+1)*86400), 0)
+	db.On("FetchOutbreakForTimeRange", region, startTime, endTime).Return([]*pb.OutbreakEvent{randomTestOutbreakEvent()}, nil)
+
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return([]byte("signature"), nil)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/qr/v2/%s/%s/%s", region, yesterdaysDate, goodAuth), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+
+	files := readZip(t, resp.Body.Bytes())
+	assert.Equal(t, "QR Export v2    ", string(files["export.bin"][:16]), "export should start with the version 2 header")
+
+	export := &pb.OutbreakEventExport{}
+	assert.Nil(t, proto.Unmarshal(files["export.bin"][16:], export))
+	assert.Len(t, export.GetLocations(), 1)
+	assert.Equal(t, int32(1), export.GetBatchNum())
+	assert.Equal(t, int32(1), export.GetBatchSize())
+	assert.Equal(t, "v1", export.GetSignatureInfos()[0].GetVerificationKeyVersion())
+
+	sigList := &pb.OutbreakEventExportSignatureList{}
+	assert.Nil(t, proto.Unmarshal(files["export.sig"], sigList))
+	assert.Len(t, sigList.GetSignatures(), 1)
+	assert.Equal(t, []byte("signature"), sigList.GetSignatures()[0].GetSignature())
+	assert.Equal(t, "302", sigList.GetSignatures()[0].GetSignatureInfo().GetVerificationKeyId())
+
+	// The signature covers the header too
+	signer.AssertCalled(t, "Sign", files["export.bin"])
+
+	// Two more entries come from registering the servlet and its route
+	testhelpers.AssertLog(t, hook, 3, logrus.InfoLevel, "Wrote outbreak event retrieval")
+
+	// Version 1 is unchanged: no header, and a bare signature
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/qr/%s/%s/%s", region, yesterdaysDate, goodAuth), nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+
+	files = readZip(t, resp.Body.Bytes())
+	export = &pb.OutbreakEventExport{}
+	assert.Nil(t, proto.Unmarshal(files["export.bin"], export))
+	assert.Len(t, export.GetLocations(), 1)
+	assert.Empty(t, export.GetSignatureInfos())
+
+	sig := &pb.OutbreakEventExportSignature{}
+	assert.Nil(t, proto.Unmarshal(files["export.sig"], sig))
+	assert.Equal(t, []byte("signature"), sig.GetSignature())
+	assert.Nil(t, sig.GetSignatureInfo())
+}
+
+func TestQrRetrieve_V1SigningKey(t *testing.T) {
+	_, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, auth, _ := setupQrRetrieveMockers()
+	v1Signer, v2Signer := &retrieval.Signer{}, &retrieval.Signer{}
+
+	// v1 has been rotated out of the TEK exports, and v2 is active
+	now := time.Now()
+	keys := pkgRetrieval.SigningKeys{
+		{Signer: v2Signer, Version: "v2", ID: "302", ValidFrom: now.Add(-time.Hour)},
+		{Signer: v1Signer, Version: "v1", ID: "302", ValidUntil: now.Add(-time.Hour)},
+	}
+	router := Router()
+	NewQrRetrieveServlet(db, auth, keys, nil).RegisterRouting(router)
+
+	region := "302"
+	goodAuth := "abcd"
+	yesterday := timemath.CurrentDateNumber() - 1
+	yesterdaysDate := fmt.Sprint(yesterday)
+
+	auth.On("Authenticate", region, yesterdaysDate, goodAuth).Return(true)
+	startTime := time.Unix(int64(yesterday*86400), 0)
+	endTime := time.Unix(int64((yesterday+1)*86400), 0)
+	db.On("FetchOutbreakForTimeRange", region, startTime, endTime).Return([]*pb.OutbreakEvent{randomTestOutbreakEvent()}, nil)
+
+	v1Signer.On("Sign", mock.AnythingOfType("[]uint8")).Return([]byte("v1 signature"), nil)
+	v2Signer.On("Sign", mock.AnythingOfType("[]uint8")).Return([]byte("v2 signature"), nil)
+
+	// Version 1 exports keep the key apps pin
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/qr/%s/%s/%s", region, yesterdaysDate, goodAuth), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	sig := &pb.OutbreakEventExportSignature{}
+	assert.Nil(t, proto.Unmarshal(readZip(t, resp.Body.Bytes())["export.sig"], sig))
+	assert.Equal(t, []byte("v1 signature"), sig.GetSignature())
+	v2Signer.AssertNotCalled(t, "Sign", mock.Anything)
+
+	// Version 2 exports follow the active keys
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/qr/v2/%s/%s/%s", region, yesterdaysDate, goodAuth), nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	sigList := &pb.OutbreakEventExportSignatureList{}
+	assert.Nil(t, proto.Unmarshal(readZip(t, resp.Body.Bytes())["export.sig"], sigList))
+	assert.Len(t, sigList.GetSignatures(), 1)
+	assert.Equal(t, []byte("v2 signature"), sigList.GetSignatures()[0].GetSignature())
+
+	// Without the configured key there's no version 1 export
+	router = Router()
+	NewQrRetrieveServlet(db, auth, keys[:1], nil).RegisterRouting(router)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/qr/%s/%s/%s", region, yesterdaysDate, goodAuth), nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 500, resp.Code, "Server error is expected")
+}
+
+func TestQrRetrieve_Index(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	oldEntirePeriod := config.AppConstants.EnableEntirePeriodBundle
+	oldCurrentDate := config.AppConstants.DisableCurrentDateCheckFeatureFlag
+	defer func() {
+		config.AppConstants.EnableEntirePeriodBundle = oldEntirePeriod
+		config.AppConstants.DisableCurrentDateCheckFeatureFlag = oldCurrentDate
+	}()
+	config.AppConstants.EnableEntirePeriodBundle = true
+	config.AppConstants.DisableCurrentDateCheckFeatureFlag = false
+
+	db, auth, signer := setupQrRetrieveMockers()
+	router := setupQrRetrieveRouter(db, auth, signer)
+
+	region := "302"
+	goodAuth := "abcd"
+	yesterday := timemath.CurrentDateNumber() - 1
+
+	auth.On("AuthenticateIndex", region, goodAuth).Return(true)
+	db.On("FetchOutbreakForTimeRange", region, mock.Anything, mock.Anything).Return([]*pb.OutbreakEvent{randomTestOutbreakEvent(), randomTestOutbreakEvent()}, nil)
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return([]byte("signature"), nil)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/qr/%s/index/%s", region, goodAuth), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	testhelpers.AssertLog(t, hook, 3, logrus.InfoLevel, "Wrote outbreak event index")
+
+	files := readZip(t, resp.Body.Bytes())
+	index := &pb.BundleIndex{}
+	assert.Nil(t, proto.Unmarshal(files["index.bin"][16:], index))
+
+	// The entire period bundle, then one per day
+	bundles := index.GetBundles()
+	assert.Len(t, bundles, 1+numberOfDaysToServe)
+	assert.Equal(t, uint32(0), bundles[0].GetNumber())
+	assert.Equal(t, yesterday, bundles[len(bundles)-1].GetNumber())
+	for _, bundle := range bundles {
+		assert.Equal(t, pb.BundleIndexEntry_DAY, bundle.GetPeriod())
+		assert.Equal(t, uint32(2), bundle.GetCount())
+		assert.Len(t, bundle.GetSha256(), 32)
+	}
+}
+
 func TestQrRetrieve_FutureDate(t *testing.T) {
 
 	hook, oldLog := testhelpers.SetupTestLogging(&log)
@@ -200,7 +381,7 @@ func TestQrRetrieve_FailedDbCall(t *testing.T) {
 	startTime := time.Unix(int64(dateNumber64*86400), 0)
 	endTime := time.Unix(int64((dateNumber64+1)*86400), 0)
 
-	db.On("FetchOutbreakForTimeRange", startTime, endTime).Return([]*pb.OutbreakEvent{}, fmt.Errorf("error"))
+	db.On("FetchOutbreakForTimeRange", region, startTime, endTime).Return([]*pb.OutbreakEvent{}, fmt.Errorf("error"))
 
 	// Failing DB message
 	req, _ := http.NewRequest("GET", fmt.Sprintf("/qr/%s/%s/%s", region, yesterdaysDate, goodAuth), nil)
@@ -213,6 +394,46 @@ func TestQrRetrieve_FailedDbCall(t *testing.T) {
 
 }
 
+func TestQrRetrieve_ConditionalGet(t *testing.T) {
+
+	_, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, auth, signer := setupQrRetrieveMockers()
+	router := Router()
+	NewQrRetrieveServlet(db, auth, testSigningKeys(signer), pkgRetrieval.NewBundleCache(10)).RegisterRouting(router)
+
+	region := "302"
+	goodAuth := "abcd"
+	yesterday := timemath.CurrentDateNumber() - 1
+	yesterdaysDate := fmt.Sprint(yesterday)
+
+	auth.On("Authenticate", region, yesterdaysDate, goodAuth).Return(true)
+	startTime := time.Unix(int64(yesterday*86400), 0)
+	endTime := time.Unix(int64((yesterday+1)*86400), 0)
+
+	db.On("FetchOutbreakForTimeRange", region, startTime, endTime).Return([]*pb.OutbreakEvent{randomTestOutbreakEvent()}, nil)
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return(make([]byte, 64), nil)
+
+	url := fmt.Sprintf("/qr/%s/%s/%s", region, yesterdaysDate, goodAuth)
+
+	req, _ := http.NewRequest("GET", url, nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	etag := resp.Header().Get("ETag")
+	assert.NotEmpty(t, etag, "ETag should be set")
+
+	req, _ = http.NewRequest("HEAD", url, nil)
+	req.Header.Set("If-None-Match", etag)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 304, resp.Code, "Not modified response is expected")
+	db.AssertNumberOfCalls(t, "FetchOutbreakForTimeRange", 1)
+}
+
 func setupQrRetrieveMockers() (*persistence.Conn, *retrieval.Authenticator, *retrieval.Signer) {
 
 	db := &persistence.Conn{}
@@ -224,7 +445,7 @@ func setupQrRetrieveMockers() (*persistence.Conn, *retrieval.Authenticator, *ret
 
 func setupQrRetrieveRouter(db *persistence.Conn, auth *retrieval.Authenticator, signer *retrieval.Signer) *mux.Router {
 
-	servlet := NewQrRetrieveServlet(db, auth, signer)
+	servlet := NewQrRetrieveServlet(db, auth, testSigningKeys(signer), nil)
 	router := Router()
 	servlet.RegisterRouting(router)
 
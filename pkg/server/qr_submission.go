@@ -41,7 +41,7 @@ func (s *OutbreakEventServlet) newExposureEvent(w http.ResponseWriter, r *http.R
 	}
 
 	hdr := r.Header.Get("Authorization")
-	_, originator, ok := s.auth.RegionFromAuthHeader(hdr)
+	region, originator, ok := s.auth.RegionFromAuthHeader(hdr)
 	if !ok {
 		log(ctx, nil).WithField("header", hdr).Info("bad auth header")
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
@@ -95,7 +95,7 @@ func (s *OutbreakEventServlet) newExposureEvent(w http.ResponseWriter, r *http.R
 	}
 
 	// Save the new QR Submission
-	err = s.db.NewOutbreakEvent(ctx, originator, &submission)
+	err = s.db.NewOutbreakEvent(ctx, region, originator, &submission)
 
 	if err != nil {
 		requestError(
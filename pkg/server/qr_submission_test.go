@@ -247,7 +247,7 @@ func TestQrUpload_ErrorSaving(t *testing.T) {
 	hook, oldLog, db, router := setupQrUploadTest()
 	defer func() { log = *oldLog }()
 
-	db.On("NewOutbreakEvent", mock.Anything, "goodtoken", mock.AnythingOfType("*covidshield.OutbreakEvent")).Return(fmt.Errorf("error"))
+	db.On("NewOutbreakEvent", mock.Anything, "302", "goodtoken", mock.AnythingOfType("*covidshield.OutbreakEvent")).Return(fmt.Errorf("error"))
 
 	location := "ABCDEFGH"
 	startTime, _ := timestamp.TimestampProto(time.Now())
@@ -271,7 +271,7 @@ func TestQrUpload_SuccessSaving(t *testing.T) {
 	_, oldLog, db, router := setupQrUploadTest()
 	defer func() { log = *oldLog }()
 
-	db.On("NewOutbreakEvent", mock.Anything, "goodtoken", mock.AnythingOfType("*covidshield.OutbreakEvent")).Return(nil)
+	db.On("NewOutbreakEvent", mock.Anything, "302", "goodtoken", mock.AnythingOfType("*covidshield.OutbreakEvent")).Return(nil)
 
 	location := "ABCDEFGH"
 	startTime, _ := timestamp.TimestampProto(time.Now())
@@ -1,10 +1,19 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/cds-snc/covid-alert-server/pkg/blobstore"
 	"github.com/cds-snc/covid-alert-server/pkg/config"
 	"github.com/cds-snc/covid-alert-server/pkg/persistence"
 	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
@@ -12,6 +21,7 @@ import (
 	"github.com/cds-snc/covid-alert-server/pkg/timemath"
 
 	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/Shopify/goose/srvutil"
 	"github.com/gorilla/mux"
@@ -20,20 +30,36 @@ import (
 const (
 	numberOfDaysToServe = 14
 	hoursInDay          = 24
+
+	// How long a bundle is cached for when new keys may still be added to it.
+	openWindowCacheTTL = time.Minute
 )
 
-func NewRetrieveServlet(db persistence.Conn, auth retrieval.Authenticator, signer retrieval.Signer) srvutil.Servlet {
-	return &retrieveServlet{db: db, auth: auth, signer: signer}
+var errNoSuchBatch = errors.New("no such batch")
+
+// NewRetrieveServlet returns the retrieve servlet. If store is not nil, exports
+// already published to it by the export worker are served from there, and
+// only exports that haven't been published yet are built from the database.
+func NewRetrieveServlet(db persistence.Conn, auth retrieval.Authenticator, signingKeys retrieval.SigningKeys, padder *retrieval.Padder, store blobstore.BlobStore, cache *retrieval.BundleCache) srvutil.Servlet {
+	return &retrieveServlet{db: db, auth: auth, signingKeys: signingKeys, padder: padder, store: store, cache: cache}
 }
 
 type retrieveServlet struct {
-	db     persistence.Conn
-	auth   retrieval.Authenticator
-	signer retrieval.Signer
+	db          persistence.Conn
+	auth        retrieval.Authenticator
+	signingKeys retrieval.SigningKeys
+	padder      *retrieval.Padder
+	store       blobstore.BlobStore
+	cache       *retrieval.BundleCache
 }
 
 func (s *retrieveServlet) RegisterRouting(r *mux.Router) {
 	// becomes 7 digits in 2084
+	// The batch route has to be registered first, otherwise {auth:.*} swallows it.
+	r.HandleFunc("/retrieve/{region:[0-9]{3}}/index/{auth:.*}", s.retrieveIndexWrapper)
+	r.HandleFunc("/retrieve/{region:[0-9]{3}}/hour/{hour:[0-9]{6}}/batch/{batch:[0-9]+}/{auth:.*}", s.retrieveHourWrapper)
+	r.HandleFunc("/retrieve/{region:[0-9]{3}}/hour/{hour:[0-9]{6}}/{auth:.*}", s.retrieveHourWrapper)
+	r.HandleFunc("/retrieve/{region:[0-9]{3}}/{day:[0-9]{5}}/batch/{batch:[0-9]+}/{auth:.*}", s.retrieveWrapper)
 	r.HandleFunc("/retrieve/{region:[0-9]{3}}/{day:[0-9]{5}}/{auth:.*}", s.retrieveWrapper)
 }
 
@@ -55,42 +81,85 @@ func (s *retrieveServlet) retrieveWrapper(w http.ResponseWriter, r *http.Request
 	_ = s.retrieve(w, r)
 }
 
+func (s *retrieveServlet) retrieveHourWrapper(w http.ResponseWriter, r *http.Request) {
+	_ = s.retrieveHour(w, r)
+}
+
+func (s *retrieveServlet) retrieveIndexWrapper(w http.ResponseWriter, r *http.Request) {
+	_ = s.retrieveIndex(w, r)
+}
+
+// exportWindow is the span of submission hours a retrieval covers, along with
+// where the export worker would have published it.
+type exportWindow struct {
+	period    string
+	number    uint32
+	startHour uint32
+	endHour   uint32
+	start     time.Time
+	end       time.Time
+}
+
+func dayWindow(dateNumber uint32) exportWindow {
+	return exportWindow{
+		period:    retrieval.DayPeriod,
+		number:    dateNumber,
+		startHour: dateNumber * hoursInDay,
+		endHour:   (dateNumber + 1) * hoursInDay,
+		start:     time.Unix(int64(dateNumber*86400), 0),
+		end:       time.Unix(int64((dateNumber+1)*86400), 0),
+	}
+}
+
+// entirePeriodWindow covers every day that can be served, up to and including
+// endDate. The export worker publishes it as day 0.
+func entirePeriodWindow(endDate uint32) exportWindow {
+	startDate := endDate - numberOfDaysToServe
+	return exportWindow{
+		period:    retrieval.DayPeriod,
+		number:    0,
+		startHour: startDate * hoursInDay,
+		endHour:   (endDate + 1) * hoursInDay,
+		start:     time.Unix(int64(startDate*86400), 0),
+		end:       time.Unix(int64((endDate+1)*86400), 0),
+	}
+}
+
+func hourWindow(hourNumber uint32) exportWindow {
+	return exportWindow{
+		period:    retrieval.HourPeriod,
+		number:    hourNumber,
+		startHour: hourNumber,
+		endHour:   hourNumber + 1,
+		start:     time.Unix(int64(hourNumber)*3600, 0),
+		end:       time.Unix(int64(hourNumber+1)*3600, 0),
+	}
+}
+
 func (s *retrieveServlet) retrieve(w http.ResponseWriter, r *http.Request) result {
 	ctx := r.Context()
 	vars := mux.Vars(r)
 
-	/* Hardcode the region as 302 (Canada MCC)
-	You can see the reason for this in pkg/server/keyclaim.go
-	As stated there I'm going to open an issue to continue this work instead of just
-	relying on the hardcoded value.
-	*/
-	region := config.AppConstants.RegionCode
+	region := vars["region"]
 	if !s.auth.Authenticate(region, vars["day"], vars["auth"]) {
 		return s.fail(log(ctx, nil), w, "invalid auth parameter", "unauthorized", http.StatusUnauthorized)
 	}
 
-	if r.Method != "GET" {
+	if r.Method != "GET" && r.Method != "HEAD" {
 		return s.fail(log(ctx, nil).WithField("method", r.Method), w, "method not allowed", "", http.StatusMethodNotAllowed)
 	}
 
-	var startTimestamp time.Time
-	var endTimestamp time.Time
+	if !retrieval.ServesRegion(region) {
+		return s.fail(log(ctx, nil).WithField("region", region), w, "unknown region", "", http.StatusNotFound)
+	}
+
 	var dateNumber uint32
-	var startHour uint32
-	var endHour uint32
+	var window exportWindow
 
 	if config.AppConstants.EnableEntirePeriodBundle == true && vars["day"] == "00000" {
 
-		endDate := timemath.CurrentDateNumber() - 1
-		startDate := endDate - numberOfDaysToServe
-
-		dateNumber = endDate
-
-		startTimestamp = time.Unix(int64(startDate*86400), 0)
-		endTimestamp = time.Unix(int64((endDate+1)*86400), 0)
-
-		startHour = startDate * 24
-		endHour = (endDate * 24) + 24
+		dateNumber = timemath.CurrentDateNumber() - 1
+		window = entirePeriodWindow(dateNumber)
 
 	} else {
 
@@ -99,16 +168,10 @@ func (s *retrieveServlet) retrieve(w http.ResponseWriter, r *http.Request) resul
 			return s.fail(log(ctx, err), w, "invalid day parameter", "", http.StatusBadRequest)
 		}
 		dateNumber = uint32(dateNumber64)
-
-		startTimestamp = time.Unix(int64(dateNumber*86400), 0)
-		endTimestamp = time.Unix(int64((dateNumber+1)*86400), 0)
-
-		startHour = dateNumber * 24
-		endHour = startHour + 24
+		window = dayWindow(dateNumber)
 
 	}
 
-	currentRSIN := pb.CurrentRollingStartIntervalNumber()
 	currentDateNumber := timemath.CurrentDateNumber()
 
 	if config.AppConstants.DisableCurrentDateCheckFeatureFlag == false && dateNumber == currentDateNumber {
@@ -119,18 +182,535 @@ func (s *retrieveServlet) retrieve(w http.ResponseWriter, r *http.Request) resul
 		return s.fail(log(ctx, nil), w, "request for too-old data", "requested data no longer valid", http.StatusGone)
 	}
 
+	return s.serveWindow(w, r, region, window)
+}
+
+// retrieveHour serves the keys submitted during a single hour, so clients
+// don't have to wait for the day to close before seeing them.
+func (s *retrieveServlet) retrieveHour(w http.ResponseWriter, r *http.Request) result {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	region := vars["region"]
+	if !s.auth.AuthenticateHour(region, vars["hour"], vars["auth"]) {
+		return s.fail(log(ctx, nil), w, "invalid auth parameter", "unauthorized", http.StatusUnauthorized)
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return s.fail(log(ctx, nil).WithField("method", r.Method), w, "method not allowed", "", http.StatusMethodNotAllowed)
+	}
+
+	if !retrieval.ServesRegion(region) {
+		return s.fail(log(ctx, nil).WithField("region", region), w, "unknown region", "", http.StatusNotFound)
+	}
+
+	hourNumber64, err := strconv.ParseUint(vars["hour"], 10, 32)
+	if err != nil {
+		return s.fail(log(ctx, err), w, "invalid hour parameter", "", http.StatusBadRequest)
+	}
+	hourNumber := uint32(hourNumber64)
+
+	currentHourNumber := timemath.HourNumber(time.Now())
+	oldestHourNumber := (timemath.CurrentDateNumber() - numberOfDaysToServe) * hoursInDay
+
+	// While padding is on, hours are only served once they're over (see Padder)
+	if (config.AppConstants.DisableCurrentDateCheckFeatureFlag == false || s.padder != nil) && hourNumber == currentHourNumber {
+		return s.fail(log(ctx, nil), w, "request for current hour", "cannot serve data for current period for privacy reasons", http.StatusNotFound)
+	} else if hourNumber > currentHourNumber {
+		return s.fail(log(ctx, nil), w, "request for future data", "cannot request future data", http.StatusNotFound)
+	} else if hourNumber < oldestHourNumber {
+		return s.fail(log(ctx, nil), w, "request for too-old data", "requested data no longer valid", http.StatusGone)
+	}
+
+	return s.serveWindow(w, r, region, hourWindow(hourNumber))
+}
+
+// retrieveIndex serves a signed list of every batch of every export that can
+// currently be retrieved, so that clients only download what they don't
+// already have.
+func (s *retrieveServlet) retrieveIndex(w http.ResponseWriter, r *http.Request) result {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	region := vars["region"]
+	if !s.auth.AuthenticateIndex(region, vars["auth"]) {
+		return s.fail(log(ctx, nil), w, "invalid auth parameter", "unauthorized", http.StatusUnauthorized)
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return s.fail(log(ctx, nil).WithField("method", r.Method), w, "method not allowed", "", http.StatusMethodNotAllowed)
+	}
+
+	if !retrieval.ServesRegion(region) {
+		return s.fail(log(ctx, nil).WithField("region", region), w, "unknown region", "", http.StatusNotFound)
+	}
+
+	now := time.Now()
+	currentDateNumber := timemath.CurrentDateNumber()
+	currentHourNumber := timemath.HourNumber(now)
+	oldestDateNumber := currentDateNumber - numberOfDaysToServe
+
+	key := retrieval.BundleKey{
+		Region:    region,
+		StartHour: oldestDateNumber * hoursInDay,
+		EndHour:   currentHourNumber + 1,
+		RSIN:      pb.CurrentRollingStartIntervalNumber(),
+		Variant:   "index",
+	}
+	if bundle, ok := s.cache.Get(key, now); ok {
+		serveBundle(w, r, bundle)
+		log(ctx, nil).WithField("size", len(bundle.Body)).Info("Wrote cached retrieval index")
+		return result(struct{}{})
+	}
+
+	// The same windows that retrieve and retrieveHour would serve
+	lastDateNumber, lastHourNumber := currentDateNumber-1, currentHourNumber-1
+	if config.AppConstants.DisableCurrentDateCheckFeatureFlag {
+		lastDateNumber = currentDateNumber
+		if s.padder == nil {
+			lastHourNumber = currentHourNumber
+		}
+	}
+
+	var windows []exportWindow
+	if config.AppConstants.EnableEntirePeriodBundle {
+		windows = append(windows, entirePeriodWindow(currentDateNumber-1))
+	}
+	for day := oldestDateNumber; day <= lastDateNumber; day++ {
+		windows = append(windows, dayWindow(day))
+	}
+	for hour := oldestDateNumber * hoursInDay; hour <= lastHourNumber; hour++ {
+		windows = append(windows, hourWindow(hour))
+	}
+
+	entries, err := s.indexEntries(ctx, region, windows, now)
+	if err != nil {
+		var be *bundleError
+		if !errors.As(err, &be) {
+			be = &bundleError{"error building index", "server error", err}
+		}
+		return s.fail(log(ctx, be.err), w, be.logMsg, be.responseMsg, http.StatusInternalServerError)
+	}
+
+	var buf bytes.Buffer
+	if _, err := retrieval.SerializeBundleIndexTo(ctx, &buf, region, entries, now, s.signingKeys); err != nil {
+		return s.fail(log(ctx, err), w, "error serializing index", "server error", http.StatusInternalServerError)
+	}
+
+	bundle := retrieval.NewBundle(buf.Bytes(), "application/zip", 0, now)
+	s.cache.Add(key, bundle, now.Add(openWindowCacheTTL))
+
+	serveBundle(w, r, bundle)
+	log(ctx, nil).WithField("size", len(bundle.Body)).WithField("bundles", len(entries)).Info("Wrote retrieval index")
+	return result(struct{}{})
+}
+
+// indexEntries describes every batch of every window. Exports the export
+// worker has published are described from the blob store, and the rest from
+// the keys of all of them, fetched at once, without being signed: an export is
+// known by the digest of what's signed, not of the signature.
+func (s *retrieveServlet) indexEntries(ctx context.Context, region string, windows []exportWindow, now time.Time) ([]*pb.BundleIndexEntry, error) {
+	var entries []*pb.BundleIndexEntry
+	var unpublished []exportWindow
+
+	for _, window := range windows {
+		stored := s.storedBatches(ctx, region, window)
+		if len(stored) == 0 {
+			unpublished = append(unpublished, window)
+			continue
+		}
+
+		for batchNum := 1; batchNum <= len(stored); batchNum++ {
+			bundle, err := s.storedExportBundle(ctx, region, window, stored, batchNum, false, now)
+			if err != nil {
+				return nil, &bundleError{"error reading stored export", "server error", err}
+			}
+
+			// Bundles can be shared through the cache, so the count goes on
+			// the entry rather than back on the bundle.
+			entry := retrieval.NewBundleIndexEntry(window.period, window.number, batchNum, bundle)
+			count, err := retrieval.ExportKeyCount(bundle.Body)
+			if err != nil {
+				return nil, &bundleError{"error reading stored export", "server error", err}
+			}
+			entry.Count = proto.Uint32(uint32(count))
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(unpublished) == 0 {
+		return entries, nil
+	}
+
+	startHour, endHour := s.servedHours(unpublished[0], now)
+	for _, window := range unpublished[1:] {
+		windowStart, windowEnd := s.servedHours(window, now)
+		if windowStart < startHour {
+			startHour = windowStart
+		}
+		if windowEnd > endHour {
+			endHour = windowEnd
+		}
+	}
+
+	currentRSIN := pb.CurrentRollingStartIntervalNumber()
 	keys, err := s.db.FetchKeysForHours(region, startHour, endHour, currentRSIN)
 	if err != nil {
-		return s.fail(log(ctx, err), w, "database error", "", http.StatusInternalServerError)
+		return nil, &bundleError{"database error", "", err}
+	}
+	revisedKeys, err := s.db.FetchRevisedKeysForHours(region, startHour, endHour, currentRSIN)
+	if err != nil {
+		return nil, &bundleError{"database error", "", err}
 	}
 
-	w.Header().Add("Content-Type", "application/zip")
-	w.Header().Add("Cache-Control", "public, max-age=3600, max-stale=600")
+	for _, window := range unpublished {
+		startHour, endHour := s.servedHours(window, now)
+		batches := s.batches(keys, revisedKeys, region, startHour, endHour)
+		for i, batch := range batches {
+			digest, err := retrieval.ExportDigest(batch, region, window.start, window.end, i+1, len(batches), s.signingKeys)
+			if err != nil {
+				return nil, &bundleError{"error serializing export", "server error", err}
+			}
+			// Described as bundle would build it, without building it
+			entries = append(entries, retrieval.NewBundleIndexEntry(window.period, window.number, i+1, &retrieval.Bundle{
+				BatchSize:    len(batches),
+				Count:        len(batch.Keys) + len(batch.RevisedKeys),
+				Digest:       digest,
+				LastModified: now,
+			}))
+		}
+	}
 
-	size, err := retrieval.SerializeTo(ctx, w, keys, region, startTimestamp, endTimestamp, s.signer)
+	return entries, nil
+}
+
+func (s *retrieveServlet) serveWindow(w http.ResponseWriter, r *http.Request, region string, window exportWindow) result {
+	ctx := r.Context()
+
+	batchNum, err := parseBatchNumber(mux.Vars(r))
 	if err != nil {
-		log(ctx, err).Info("error writing response")
+		return s.fail(log(ctx, err), w, "invalid batch number", "no such batch", http.StatusNotFound)
+	}
+	allBatches := batchNum == 0 && acceptsMultipart(r)
+
+	bundle, source, err := s.bundle(ctx, region, window, batchNum, allBatches, time.Now())
+	var be *bundleError
+	if err == errNoSuchBatch {
+		return s.fail(log(ctx, nil), w, "invalid batch number", "no such batch", http.StatusNotFound)
+	} else if errors.As(err, &be) {
+		return s.fail(log(ctx, be.err), w, be.logMsg, be.responseMsg, http.StatusInternalServerError)
+	} else if err != nil {
+		return s.fail(log(ctx, err), w, "error building export", "server error", http.StatusInternalServerError)
+	}
+
+	serveBundle(w, r, bundle)
+	logger := log(ctx, nil).WithField("batches", bundle.BatchSize)
+	switch source {
+	case bundleFromCache:
+		logger.WithField("size", len(bundle.Body)).Info("Wrote cached retrieval")
+	case bundleFromStore:
+		logger.WithField("size", len(bundle.Body)).Info("Wrote stored retrieval")
+	default:
+		logger.WithField("size", len(bundle.Body)).WithField("keys", bundle.Count).Info("Wrote retrieval")
 	}
-	log(ctx, nil).WithField("unzipped-size", size).WithField("keys", len(keys)).Info("Wrote retrieval")
 	return result(struct{}{})
 }
+
+// Where a bundle came from.
+const (
+	bundleFromCache = iota
+	bundleFromStore
+	bundleFromDatabase
+)
+
+// bundleError is a failure to build a bundle, with what to log and respond.
+type bundleError struct {
+	logMsg      string
+	responseMsg string
+	err         error
+}
+
+func (e *bundleError) Error() string {
+	return e.logMsg + ": " + e.err.Error()
+}
+
+// bundle returns a window's export, from the cache, the blob store or the
+// database, in that order of preference. Bundles that have to be built are
+// added to the cache. It returns errNoSuchBatch if the export has fewer than
+// batchNum batches, and a *bundleError for anything else.
+func (s *retrieveServlet) bundle(ctx context.Context, region string, window exportWindow, batchNum int, allBatches bool, now time.Time) (*retrieval.Bundle, int, error) {
+	startHour, endHour := s.servedHours(window, now)
+	startTimestamp := window.start
+	endTimestamp := window.end
+	currentRSIN := pb.CurrentRollingStartIntervalNumber()
+
+	key := retrieval.BundleKey{Region: region, StartHour: startHour, EndHour: endHour, RSIN: currentRSIN, Variant: bundleVariant(batchNum, allBatches)}
+	if bundle, ok := s.cache.Get(key, now); ok {
+		return bundle, bundleFromCache, nil
+	}
+
+	if stored := s.storedBatches(ctx, region, window); len(stored) > 0 {
+		if batchNum > len(stored) {
+			return nil, 0, errNoSuchBatch
+		}
+		bundle, err := s.storedExportBundle(ctx, region, window, stored, batchNum, allBatches, now)
+		if err != nil {
+			return nil, 0, &bundleError{"error reading stored export", "server error", err}
+		}
+		return bundle, bundleFromStore, nil
+	}
+
+	keys, err := s.db.FetchKeysForHours(region, startHour, endHour, currentRSIN)
+	if err != nil {
+		return nil, 0, &bundleError{"database error", "", err}
+	}
+
+	revisedKeys, err := s.db.FetchRevisedKeysForHours(region, startHour, endHour, currentRSIN)
+	if err != nil {
+		return nil, 0, &bundleError{"database error", "", err}
+	}
+
+	batches := s.batches(keys, revisedKeys, region, startHour, endHour)
+	if batchNum > len(batches) {
+		return nil, 0, errNoSuchBatch
+	}
+
+	var buf bytes.Buffer
+	var contentType string
+	var count int
+	if allBatches {
+		contentType, _, err = writeMultipartBatches(ctx, &buf, batches, region, startTimestamp, endTimestamp, s.signingKeys)
+		for _, batch := range batches {
+			count += len(batch.Keys) + len(batch.RevisedKeys)
+		}
+	} else {
+		// Clients that don't ask for a specific batch get the first one, and can
+		// use X-Batch-Size to discover the rest.
+		if batchNum == 0 {
+			batchNum = 1
+		}
+		batch := batches[batchNum-1]
+		contentType = "application/zip"
+		count = len(batch.Keys) + len(batch.RevisedKeys)
+		_, err = retrieval.SerializeBatchTo(
+			ctx, &buf, batch, region, startTimestamp, endTimestamp, batchNum, len(batches), s.signingKeys,
+		)
+	}
+	if err != nil {
+		return nil, 0, &bundleError{"error serializing export", "server error", err}
+	}
+
+	bundle := retrieval.NewBundle(buf.Bytes(), contentType, len(batches), now)
+	bundle.Count = count
+	s.cache.Add(key, bundle, windowCacheExpiry(endHour, now))
+	return bundle, bundleFromDatabase, nil
+}
+
+// servedHours returns the hours of window that are served now: all of them,
+// unless padding is on, when only hours that are over can be padded and the
+// rest of the window waits.
+func (s *retrieveServlet) servedHours(window exportWindow, now time.Time) (uint32, uint32) {
+	endHour := window.endHour
+	if currentHour := timemath.HourNumber(now); s.padder != nil && endHour > currentHour {
+		endHour = currentHour
+	}
+	return window.startHour, endHour
+}
+
+// batches splits the keys submitted and revised from startHour up to endHour
+// into the batches of their export, padded if padding is on.
+func (s *retrieveServlet) batches(keys, revisedKeys map[uint32][]*pb.TemporaryExposureKey, region string, startHour, endHour uint32) []retrieval.Batch {
+	return retrieval.BatchKeys(
+		s.padder.Pad(keys, region, startHour, endHour),
+		retrieval.RevisedKeysForHours(revisedKeys, startHour, endHour),
+	)
+}
+
+// windowCacheExpiry is when a bundle ending at endHour has to be rebuilt: until
+// the window is over, new keys can still be submitted for it.
+func windowCacheExpiry(endHour uint32, now time.Time) time.Time {
+	if endHour > timemath.HourNumber(now) {
+		return now.Add(openWindowCacheTTL)
+	}
+	return time.Time{}
+}
+
+// storedBatches lists the batches the export worker has published for window,
+// if any.
+func (s *retrieveServlet) storedBatches(ctx context.Context, region string, window exportWindow) []string {
+	if s.store == nil {
+		return nil
+	}
+	prefix := retrieval.ExportPrefix(region, window.period, window.number)
+	stored, err := retrieval.StoredBatches(ctx, s.store, prefix)
+	if err != nil {
+		log(ctx, err).WithField("export", prefix).Warn("failed to list stored export")
+		return nil
+	}
+	return stored
+}
+
+// storedExportBundle is a stored export as a bundle, from the cache if it's
+// there. Bundles read from the store are added to it.
+func (s *retrieveServlet) storedExportBundle(ctx context.Context, region string, window exportWindow, stored []string, batchNum int, allBatches bool, now time.Time) (*retrieval.Bundle, error) {
+	startHour, endHour := s.servedHours(window, now)
+	key := retrieval.BundleKey{Region: region, StartHour: startHour, EndHour: endHour, RSIN: pb.CurrentRollingStartIntervalNumber(), Variant: bundleVariant(batchNum, allBatches)}
+	if bundle, ok := s.cache.Get(key, now); ok {
+		return bundle, nil
+	}
+
+	bundle, err := storedBundle(ctx, s.store, stored, batchNum, allBatches)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Add(key, bundle, windowCacheExpiry(endHour, now))
+	return bundle, nil
+}
+
+// parseBatchNumber returns the batch number requested, or 0 if the request
+// doesn't name one.
+func parseBatchNumber(vars map[string]string) (int, error) {
+	batch, ok := vars["batch"]
+	if !ok {
+		return 0, nil
+	}
+	batchNum, err := strconv.Atoi(batch)
+	if err != nil {
+		return 0, err
+	}
+	if batchNum < 1 {
+		return 0, errNoSuchBatch
+	}
+	return batchNum, nil
+}
+
+func bundleVariant(batchNum int, allBatches bool) string {
+	if allBatches {
+		return "multipart"
+	}
+	if batchNum == 0 {
+		batchNum = 1
+	}
+	return "batch-" + strconv.Itoa(batchNum)
+}
+
+// serveBundle writes a bundle, or just its headers for HEAD requests and a 304
+// for clients that already have it.
+func serveBundle(w http.ResponseWriter, r *http.Request, bundle *retrieval.Bundle) {
+	w.Header().Set("Cache-Control", "public, max-age=3600, max-stale=600")
+	if bundle.BatchSize > 0 {
+		w.Header().Set("X-Batch-Size", strconv.Itoa(bundle.BatchSize))
+	}
+	w.Header().Set("Content-Type", bundle.ContentType)
+	w.Header().Set("ETag", bundle.ETag)
+	w.Header().Set("Vary", "Accept")
+	http.ServeContent(w, r, "", bundle.LastModified, bytes.NewReader(bundle.Body))
+}
+
+// storedBundle reads the batches of an export published by the export worker
+// into a bundle, the same as if it had been built in-line.
+func storedBundle(ctx context.Context, store blobstore.BlobStore, batches []string, batchNum int, allBatches bool) (*retrieval.Bundle, error) {
+	names := batches
+	if !allBatches {
+		if batchNum == 0 {
+			batchNum = 1
+		}
+		names = batches[batchNum-1 : batchNum]
+	}
+
+	objects := make([]*blobstore.Object, 0, len(names))
+	defer func() {
+		for _, obj := range objects {
+			obj.Close()
+		}
+	}()
+
+	var modified time.Time
+	for _, name := range names {
+		obj, err := store.Get(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+		if obj.ModTime.After(modified) {
+			modified = obj.ModTime
+		}
+	}
+
+	var buf bytes.Buffer
+	contentType := "application/zip"
+	if allBatches {
+		var err error
+		if contentType, err = writeMultipartObjects(&buf, objects); err != nil {
+			return nil, err
+		}
+	} else if _, err := io.Copy(&buf, objects[0]); err != nil {
+		return nil, err
+	}
+
+	bundle := retrieval.NewBundle(buf.Bytes(), contentType, len(batches), modified)
+	// Not known without decoding the export, which only the index needs
+	bundle.Count = -1
+	return bundle, nil
+}
+
+// writeMultipartObjects is writeMultipartBatches for batches that have
+// already been serialized.
+func writeMultipartObjects(w io.Writer, objects []*blobstore.Object) (string, error) {
+	mw := multipart.NewWriter(w)
+
+	for i, obj := range objects {
+		part, err := mw.CreatePart(batchPartHeader(i + 1))
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(part, obj); err != nil {
+			return "", err
+		}
+	}
+
+	return "multipart/mixed; boundary=" + mw.Boundary(), mw.Close()
+}
+
+func batchPartHeader(batchNum int) textproto.MIMEHeader {
+	hdr := make(textproto.MIMEHeader)
+	hdr.Set("Content-Type", "application/zip")
+	hdr.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%d.zip"`, batchNum))
+	return hdr
+}
+
+func acceptsMultipart(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		if strings.Contains(accept, "multipart/mixed") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeMultipartBatches writes every batch as its own application/zip part of
+// a multipart/mixed body, in batch order, and returns the body's content type.
+func writeMultipartBatches(
+	ctx context.Context, w io.Writer,
+	batches []retrieval.Batch,
+	region string,
+	startTimestamp, endTimestamp time.Time,
+	signingKeys retrieval.SigningKeys,
+) (string, int, error) {
+	mw := multipart.NewWriter(w)
+
+	totalN := 0
+	for i, batch := range batches {
+		part, err := mw.CreatePart(batchPartHeader(i + 1))
+		if err != nil {
+			return "", totalN, err
+		}
+		n, err := retrieval.SerializeBatchTo(ctx, part, batch, region, startTimestamp, endTimestamp, i+1, len(batches), signingKeys)
+		if err != nil {
+			return "", totalN, err
+		}
+		totalN += n
+	}
+
+	return "multipart/mixed; boundary=" + mw.Boundary(), totalN, mw.Close()
+}
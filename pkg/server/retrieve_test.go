@@ -1,46 +1,64 @@
 package server
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
 	"github.com/cds-snc/covid-alert-server/pkg/testhelpers"
 	"github.com/gorilla/mux"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	persistence "github.com/cds-snc/covid-alert-server/mocks/pkg/persistence"
 	retrieval "github.com/cds-snc/covid-alert-server/mocks/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/blobstore"
+	"github.com/cds-snc/covid-alert-server/pkg/config"
 	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	pkgRetrieval "github.com/cds-snc/covid-alert-server/pkg/retrieval"
 	"github.com/cds-snc/covid-alert-server/pkg/timemath"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestNewRetrieveServlet(t *testing.T) {
 
 	db := &persistence.Conn{}
 	auth := &retrieval.Authenticator{}
-	signer := &retrieval.Signer{}
+	signingKeys := pkgRetrieval.SigningKeys{{Signer: &retrieval.Signer{}, Version: "v1", ID: "302"}}
 
 	expected := &retrieveServlet{
-		db:     db,
-		auth:   auth,
-		signer: signer,
+		db:          db,
+		auth:        auth,
+		signingKeys: signingKeys,
 	}
-	assert.Equal(t, expected, NewRetrieveServlet(db, auth, signer), "should return a new retrieveServlet struct")
+	assert.Equal(t, expected, NewRetrieveServlet(db, auth, signingKeys, nil, nil, nil), "should return a new retrieveServlet struct")
 
 }
 
 func TestRegisterRoutingRetrieve(t *testing.T) {
 
-	servlet := NewRetrieveServlet(&persistence.Conn{}, &retrieval.Authenticator{}, &retrieval.Signer{})
+	servlet := NewRetrieveServlet(&persistence.Conn{}, &retrieval.Authenticator{}, testSigningKeys(&retrieval.Signer{}), nil, nil, nil)
 	router := Router()
 	servlet.RegisterRouting(router)
 
 	expectedPaths := GetPaths(router)
 	assert.Contains(t, expectedPaths, "/retrieve/{region:[0-9]{3}}/{day:[0-9]{5}}/{auth:.*}", "should include a retrieve path")
+	assert.Contains(t, expectedPaths, "/retrieve/{region:[0-9]{3}}/{day:[0-9]{5}}/batch/{batch:[0-9]+}/{auth:.*}", "should include a batch retrieve path")
+	assert.Contains(t, expectedPaths, "/retrieve/{region:[0-9]{3}}/hour/{hour:[0-9]{6}}/{auth:.*}", "should include an hourly retrieve path")
+	assert.Contains(t, expectedPaths, "/retrieve/{region:[0-9]{3}}/hour/{hour:[0-9]{6}}/batch/{batch:[0-9]+}/{auth:.*}", "should include an hourly batch retrieve path")
 
 }
 
@@ -95,6 +113,48 @@ func TestRetrieve_GoodAuthmock(t *testing.T) {
 	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "method not allowed")
 }
 
+func TestRetrieve_Regions(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	oldCodes := config.AppConstants.RegionISOCodes
+	defer func() { config.AppConstants.RegionISOCodes = oldCodes }()
+	config.AppConstants.RegionISOCodes = map[string]string{"302": "CA", "310": "US"}
+
+	db, auth, signer := setupRetrieveMockers()
+	router := setupRetrieveRouter(db, auth, signer)
+
+	goodAuth := "abcd"
+	yesterday := timemath.CurrentDateNumber() - 1
+	yesterdaysDate := fmt.Sprint(yesterday)
+	currentRSIN := pb.CurrentRollingStartIntervalNumber()
+
+	// Each region is served its own keys, labelled with its own ISO code
+	auth.On("Authenticate", "310", yesterdaysDate, goodAuth).Return(true)
+	db.On("FetchKeysForHours", "310", yesterday*24, (yesterday+1)*24, currentRSIN).Return(inHour(yesterday*24, randomTestKey()), nil)
+	db.On("FetchRevisedKeysForHours", "310", yesterday*24, (yesterday+1)*24, currentRSIN).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return(make([]byte, 64), nil)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/retrieve/310/%s/%s", yesterdaysDate, goodAuth), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, "US", readExport(t, resp.Body.Bytes()).GetRegion())
+	db.AssertNotCalled(t, "FetchKeysForHours", "302", mock.Anything, mock.Anything, mock.Anything)
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "Wrote retrieval")
+
+	// Regions that aren't configured aren't served, even with a valid MAC
+	auth.On("Authenticate", "311", yesterdaysDate, goodAuth).Return(true)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/retrieve/311/%s/%s", yesterdaysDate, goodAuth), nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 404, resp.Code, "Not found response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "unknown region")
+}
+
 func TestRetrieve_AllKeysDownload(t *testing.T) {
 	hook, oldLog := testhelpers.SetupTestLogging(&log)
 	defer func() { log = *oldLog }()
@@ -111,7 +171,8 @@ func TestRetrieve_AllKeysDownload(t *testing.T) {
 	startHour := (timemath.CurrentDateNumber() - 15) * 24
 	endHour := timemath.CurrentDateNumber() * 24
 
-	db.On("FetchKeysForHours", region, startHour, endHour, currentRSIN).Return([]*pb.TemporaryExposureKey{randomTestKey(), randomTestKey()}, nil)
+	db.On("FetchKeysForHours", region, startHour, endHour, currentRSIN).Return(inHour(startHour, randomTestKey(), randomTestKey()), nil)
+	db.On("FetchRevisedKeysForHours", region, startHour, endHour, currentRSIN).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
 
 	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return(make([]byte, 64), nil)
 
@@ -127,6 +188,242 @@ func TestRetrieve_AllKeysDownload(t *testing.T) {
 	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "Wrote retrieval")
 }
 
+func TestRetrieve_Batch(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, auth, signer := setupRetrieveMockers()
+	router := setupRetrieveRouter(db, auth, signer)
+
+	region := "302"
+	goodAuth := "abcd"
+	currentRSIN := pb.CurrentRollingStartIntervalNumber()
+	yesterdaysDate := fmt.Sprint(timemath.CurrentDateNumber() - 1)
+
+	auth.On("Authenticate", region, yesterdaysDate, goodAuth).Return(true)
+	startHour := (timemath.CurrentDateNumber() - 1) * 24
+	endHour := timemath.CurrentDateNumber() * 24
+
+	db.On("FetchKeysForHours", region, startHour, endHour, currentRSIN).Return(inHour(startHour, randomTestKey(), randomTestKey()), nil)
+	db.On("FetchRevisedKeysForHours", region, startHour, endHour, currentRSIN).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return(make([]byte, 64), nil)
+
+	// Existing batch
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/%s/batch/1/%s", region, yesterdaysDate, goodAuth), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Contains(t, resp.Header()["Content-Type"], "application/zip", "Content-Type should be set to application/zip")
+	assert.Contains(t, resp.Header()["X-Batch-Size"], "1", "X-Batch-Size should be set to 1")
+
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "Wrote retrieval")
+
+	// Batch past the end of the export
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/%s/batch/2/%s", region, yesterdaysDate, goodAuth), nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 404, resp.Code, "404 response is expected")
+	assert.Equal(t, "no such batch\n", string(resp.Body.Bytes()), "Correct response is expected")
+
+	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "invalid batch number")
+}
+
+func TestRetrieve_Multipart(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, auth, signer := setupRetrieveMockers()
+	router := setupRetrieveRouter(db, auth, signer)
+
+	region := "302"
+	goodAuth := "abcd"
+	currentRSIN := pb.CurrentRollingStartIntervalNumber()
+	yesterdaysDate := fmt.Sprint(timemath.CurrentDateNumber() - 1)
+
+	auth.On("Authenticate", region, yesterdaysDate, goodAuth).Return(true)
+	startHour := (timemath.CurrentDateNumber() - 1) * 24
+	endHour := timemath.CurrentDateNumber() * 24
+
+	db.On("FetchKeysForHours", region, startHour, endHour, currentRSIN).Return(inHour(startHour, randomTestKey(), randomTestKey()), nil)
+	db.On("FetchRevisedKeysForHours", region, startHour, endHour, currentRSIN).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return(make([]byte, 64), nil)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/%s/%s", region, yesterdaysDate, goodAuth), nil)
+	req.Header.Set("Accept", "multipart/mixed")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header().Get("Content-Type"))
+	assert.Nil(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType, "Content-Type should be set to multipart/mixed")
+
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	part, err := mr.NextPart()
+	assert.Nil(t, err)
+	assert.Equal(t, "application/zip", part.Header.Get("Content-Type"))
+	assert.Equal(t, "export-1.zip", part.FileName())
+
+	_, err = mr.NextPart()
+	assert.Equal(t, io.EOF, err, "should only contain one batch")
+
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "Wrote retrieval")
+}
+
+func TestRetrieve_StoredExport(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	dir, _ := ioutil.TempDir("", "stored-export")
+	defer os.RemoveAll(dir)
+	store, _ := blobstore.NewFilesystem(dir)
+
+	db, auth, signer := setupRetrieveMockers()
+	router := Router()
+	NewRetrieveServlet(db, auth, testSigningKeys(signer), nil, store, nil).RegisterRouting(router)
+
+	region := "302"
+	goodAuth := "abcd"
+	yesterday := timemath.CurrentDateNumber() - 1
+	yesterdaysDate := fmt.Sprint(yesterday)
+
+	auth.On("Authenticate", region, yesterdaysDate, goodAuth).Return(true)
+
+	prefix := pkgRetrieval.ExportPrefix(region, pkgRetrieval.DayPeriod, yesterday)
+	store.Put(context.Background(), pkgRetrieval.ExportName(prefix, 1), []byte("batch one"))
+	store.Put(context.Background(), pkgRetrieval.ExportName(prefix, 2), []byte("batch two"))
+
+	// The first batch by default
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/%s/%s", region, yesterdaysDate, goodAuth), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, "batch one", resp.Body.String(), "Stored export is expected")
+	assert.Equal(t, "application/zip", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "2", resp.Header().Get("X-Batch-Size"))
+	assert.Equal(t, "9", resp.Header().Get("Content-Length"))
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "Wrote stored retrieval")
+
+	// A specific batch
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/%s/batch/2/%s", region, yesterdaysDate, goodAuth), nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, "batch two", resp.Body.String(), "Stored export is expected")
+
+	// Batch past the end of the export
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/%s/batch/3/%s", region, yesterdaysDate, goodAuth), nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 404, resp.Code, "404 response is expected")
+
+	// Every batch
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/%s/%s", region, yesterdaysDate, goodAuth), nil)
+	req.Header.Set("Accept", "multipart/mixed")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	_, params, _ := mime.ParseMediaType(resp.Header().Get("Content-Type"))
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for _, expected := range []string{"batch one", "batch two"} {
+		part, err := mr.NextPart()
+		assert.Nil(t, err)
+		body, _ := ioutil.ReadAll(part)
+		assert.Equal(t, expected, string(body))
+	}
+	_, err := mr.NextPart()
+	assert.Equal(t, io.EOF, err, "should only contain two batches")
+
+	// Nothing is read from the database while the export is stored
+	db.AssertNotCalled(t, "FetchKeysForHours", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRetrieve_ConditionalGet(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, auth, signer := setupRetrieveMockers()
+	cache := pkgRetrieval.NewBundleCache(10)
+	router := Router()
+	NewRetrieveServlet(db, auth, testSigningKeys(signer), nil, nil, cache).RegisterRouting(router)
+
+	region := "302"
+	goodAuth := "abcd"
+	currentRSIN := pb.CurrentRollingStartIntervalNumber()
+	yesterdaysDate := fmt.Sprint(timemath.CurrentDateNumber() - 1)
+
+	auth.On("Authenticate", region, yesterdaysDate, goodAuth).Return(true)
+	startHour := (timemath.CurrentDateNumber() - 1) * 24
+	endHour := timemath.CurrentDateNumber() * 24
+
+	db.On("FetchKeysForHours", region, startHour, endHour, currentRSIN).Return(inHour(startHour, randomTestKey()), nil)
+	db.On("FetchRevisedKeysForHours", region, startHour, endHour, currentRSIN).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return(make([]byte, 64), nil)
+
+	url := fmt.Sprintf("/retrieve/%s/%s/%s", region, yesterdaysDate, goodAuth)
+
+	req, _ := http.NewRequest("GET", url, nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	etag := resp.Header().Get("ETag")
+	assert.NotEmpty(t, etag, "ETag should be set")
+	assert.NotEmpty(t, resp.Header().Get("Last-Modified"), "Last-Modified should be set")
+	body := resp.Body.Bytes()
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "Wrote retrieval")
+
+	// Served from the cache
+	req, _ = http.NewRequest("GET", url, nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, etag, resp.Header().Get("ETag"))
+	assert.Equal(t, body, resp.Body.Bytes(), "should serve the same bundle")
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "Wrote cached retrieval")
+
+	// Client already has it
+	req, _ = http.NewRequest("GET", url, nil)
+	req.Header.Set("If-None-Match", etag)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 304, resp.Code, "Not modified response is expected")
+	assert.Equal(t, 0, resp.Body.Len())
+
+	// HEAD
+	req, _ = http.NewRequest("HEAD", url, nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, fmt.Sprint(len(body)), resp.Header().Get("Content-Length"))
+	assert.Equal(t, "application/zip", resp.Header().Get("Content-Type"))
+	assert.Equal(t, 0, resp.Body.Len())
+
+	db.AssertNumberOfCalls(t, "FetchKeysForHours", 1)
+
+	// New keys for the window
+	cache.InvalidateHour(startHour)
+
+	req, _ = http.NewRequest("GET", url, nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	db.AssertNumberOfCalls(t, "FetchKeysForHours", 2)
+}
+
 func TestRetrieve_FutureDate(t *testing.T) {
 
 	hook, oldLog := testhelpers.SetupTestLogging(&log)
@@ -177,6 +474,104 @@ func TestRetrieve_OldDate(t *testing.T) {
 	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "request for too-old data")
 }
 
+func TestRetrieve_Hour(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, auth, signer := setupRetrieveMockers()
+	router := setupRetrieveRouter(db, auth, signer)
+
+	region := "302"
+	goodAuth := "abcd"
+	currentRSIN := pb.CurrentRollingStartIntervalNumber()
+	lastHour := timemath.HourNumber(time.Now()) - 1
+	lastHourNumber := fmt.Sprint(lastHour)
+
+	auth.On("AuthenticateHour", region, lastHourNumber, goodAuth).Return(true)
+	db.On("FetchKeysForHours", region, lastHour, lastHour+1, currentRSIN).Return(inHour(lastHour, randomTestKey()), nil)
+	db.On("FetchRevisedKeysForHours", region, lastHour, lastHour+1, currentRSIN).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return(make([]byte, 64), nil)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/hour/%s/%s", region, lastHourNumber, goodAuth), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, "application/zip", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "1", resp.Header().Get("X-Batch-Size"))
+
+	export := readExport(t, resp.Body.Bytes())
+	assert.Equal(t, uint64(lastHour)*3600, export.GetStartTimestamp(), "export should start at the requested hour")
+	assert.Equal(t, uint64(lastHour+1)*3600, export.GetEndTimestamp(), "export should end an hour later")
+	assert.Len(t, export.GetKeys(), 1)
+
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "Wrote retrieval")
+
+	// The day route is not consulted
+	auth.AssertNotCalled(t, "Authenticate", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRetrieve_HourBadAuth(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, auth, signer := setupRetrieveMockers()
+	router := setupRetrieveRouter(db, auth, signer)
+
+	region := "302"
+	badAuth := "dcba"
+	lastHourNumber := fmt.Sprint(timemath.HourNumber(time.Now()) - 1)
+
+	auth.On("AuthenticateHour", region, lastHourNumber, badAuth).Return(false)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/hour/%s/%s", region, lastHourNumber, badAuth), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 401, resp.Code, "Unauthorized response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "invalid auth parameter")
+}
+
+func TestRetrieve_HourPrivacyChecks(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	oldFlag := config.AppConstants.DisableCurrentDateCheckFeatureFlag
+	defer func() { config.AppConstants.DisableCurrentDateCheckFeatureFlag = oldFlag }()
+	config.AppConstants.DisableCurrentDateCheckFeatureFlag = false
+
+	db, auth, signer := setupRetrieveMockers()
+	router := setupRetrieveRouter(db, auth, signer)
+
+	region := "302"
+	goodAuth := "abcd"
+	currentHour := timemath.HourNumber(time.Now())
+	oldestHour := (timemath.CurrentDateNumber() - numberOfDaysToServe) * hoursInDay
+
+	auth.On("AuthenticateHour", region, mock.AnythingOfType("string"), goodAuth).Return(true)
+
+	tests := []struct {
+		hour uint32
+		code int
+		msg  string
+	}{
+		{currentHour, 404, "request for current hour"},
+		{currentHour + 1, 404, "request for future data"},
+		{oldestHour - 1, 410, "request for too-old data"},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/hour/%d/%s", region, test.hour, goodAuth), nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, test.code, resp.Code, test.msg)
+		testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, test.msg)
+	}
+
+	db.AssertNotCalled(t, "FetchKeysForHours", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestRetrieve_FailedDbCall(t *testing.T) {
 
 	hook, oldLog := testhelpers.SetupTestLogging(&log)
@@ -195,7 +590,7 @@ func TestRetrieve_FailedDbCall(t *testing.T) {
 	startHour := (timemath.CurrentDateNumber() - 1) * 24
 	endHour := timemath.CurrentDateNumber() * 24
 
-	db.On("FetchKeysForHours", region, startHour, endHour, currentRSIN).Return([]*pb.TemporaryExposureKey{}, fmt.Errorf("error"))
+	db.On("FetchKeysForHours", region, startHour, endHour, currentRSIN).Return(map[uint32][]*pb.TemporaryExposureKey{}, fmt.Errorf("error"))
 
 	// Failing DB message
 	req, _ := http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/%s/%s", region, yesterdaysDate, goodAuth), nil)
@@ -208,6 +603,277 @@ func TestRetrieve_FailedDbCall(t *testing.T) {
 
 }
 
+func TestRetrieve_RevisedKeys(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, auth, signer := setupRetrieveMockers()
+	router := setupRetrieveRouter(db, auth, signer)
+
+	region := "302"
+	goodAuth := "abcd"
+	currentRSIN := pb.CurrentRollingStartIntervalNumber()
+	yesterdaysDate := fmt.Sprint(timemath.CurrentDateNumber() - 1)
+
+	auth.On("Authenticate", region, yesterdaysDate, goodAuth).Return(true)
+	startHour := (timemath.CurrentDateNumber() - 1) * 24
+	endHour := timemath.CurrentDateNumber() * 24
+
+	revisedKey := randomTestKey()
+	revisedKey.ReportType = pb.TemporaryExposureKey_REVOKED.Enum()
+
+	db.On("FetchKeysForHours", region, startHour, endHour, currentRSIN).Return(inHour(startHour, randomTestKey()), nil)
+	db.On("FetchRevisedKeysForHours", region, startHour, endHour, currentRSIN).Return(inHour(startHour, revisedKey), nil)
+
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return(make([]byte, 64), nil)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/%s/%s", region, yesterdaysDate, goodAuth), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+
+	body := resp.Body.Bytes()
+	zipr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	assert.Nil(t, err)
+	f, _ := zipr.File[0].Open()
+	exportBin, _ := ioutil.ReadAll(f)
+	export := &pb.TemporaryExposureKeyExport{}
+	assert.Nil(t, proto.Unmarshal(exportBin[16:], export))
+	assert.Equal(t, 1, len(export.GetKeys()))
+	assert.Equal(t, 1, len(export.GetRevisedKeys()))
+	assert.Equal(t, pb.TemporaryExposureKey_REVOKED, export.GetRevisedKeys()[0].GetReportType())
+
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "Wrote retrieval")
+}
+
+func TestRetrieve_RevisedKeysDBError(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, auth, signer := setupRetrieveMockers()
+	router := setupRetrieveRouter(db, auth, signer)
+
+	region := "302"
+	goodAuth := "abcd"
+	currentRSIN := pb.CurrentRollingStartIntervalNumber()
+	yesterdaysDate := fmt.Sprint(timemath.CurrentDateNumber() - 1)
+
+	auth.On("Authenticate", region, yesterdaysDate, goodAuth).Return(true)
+	startHour := (timemath.CurrentDateNumber() - 1) * 24
+	endHour := timemath.CurrentDateNumber() * 24
+
+	db.On("FetchKeysForHours", region, startHour, endHour, currentRSIN).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+	db.On("FetchRevisedKeysForHours", region, startHour, endHour, currentRSIN).Return(map[uint32][]*pb.TemporaryExposureKey{}, fmt.Errorf("error"))
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/%s/%s", region, yesterdaysDate, goodAuth), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 500, resp.Code, "500 response is expected")
+
+	testhelpers.AssertLog(t, hook, 1, logrus.ErrorLevel, "database error")
+}
+
+func TestRetrieve_PaddingCompletedHours(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	os.Setenv("EXPORT_PADDING_KEY", strings.Repeat("a", 64))
+	defer os.Unsetenv("EXPORT_PADDING_KEY")
+	padder, err := pkgRetrieval.NewPadder(5, 0)
+	assert.Nil(t, err)
+
+	disabled := config.AppConstants.DisableCurrentDateCheckFeatureFlag
+	config.AppConstants.DisableCurrentDateCheckFeatureFlag = true
+	defer func() { config.AppConstants.DisableCurrentDateCheckFeatureFlag = disabled }()
+
+	db, auth, signer := setupRetrieveMockers()
+	servlet := NewRetrieveServlet(db, auth, testSigningKeys(signer), padder, nil, nil)
+	router := Router()
+	servlet.RegisterRouting(router)
+
+	region := "302"
+	goodAuth := "abcd"
+	currentRSIN := pb.CurrentRollingStartIntervalNumber()
+	today := timemath.CurrentDateNumber()
+	currentHour := timemath.HourNumber(time.Now())
+
+	// The current hour isn't served while it can still change
+	auth.On("AuthenticateHour", region, fmt.Sprint(currentHour), goodAuth).Return(true)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/hour/%d/%s", region, currentHour, goodAuth), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 404, resp.Code, "404 response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "request for current hour")
+
+	// and today only goes up to the last hour that's over, each of them padded
+	auth.On("Authenticate", region, fmt.Sprint(today), goodAuth).Return(true)
+	db.On("FetchKeysForHours", region, today*hoursInDay, currentHour, currentRSIN).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+	db.On("FetchRevisedKeysForHours", region, today*hoursInDay, currentHour, currentRSIN).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return(make([]byte, 64), nil)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/%d/%s", region, today, goodAuth), nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+
+	export := readExport(t, resp.Body.Bytes())
+	assert.Len(t, export.GetKeys(), 5*int(currentHour-today*hoursInDay))
+}
+
+func TestRetrieve_Index(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	oldEntirePeriod := config.AppConstants.EnableEntirePeriodBundle
+	oldCurrentDate := config.AppConstants.DisableCurrentDateCheckFeatureFlag
+	defer func() {
+		config.AppConstants.EnableEntirePeriodBundle = oldEntirePeriod
+		config.AppConstants.DisableCurrentDateCheckFeatureFlag = oldCurrentDate
+	}()
+	config.AppConstants.EnableEntirePeriodBundle = false
+	config.AppConstants.DisableCurrentDateCheckFeatureFlag = false
+
+	db, auth, signer := setupRetrieveMockers()
+	router := setupRetrieveRouter(db, auth, signer)
+
+	region := "302"
+	goodAuth := "abcd"
+	oldestDay := timemath.CurrentDateNumber() - numberOfDaysToServe
+	oldestHour := oldestDay * hoursInDay
+	currentHour := timemath.HourNumber(time.Now())
+
+	auth.On("AuthenticateIndex", region, goodAuth).Return(true)
+	auth.On("Authenticate", region, fmt.Sprint(oldestDay), goodAuth).Return(true)
+	key := randomTestKey()
+	db.On("FetchKeysForHours", region, mock.Anything, mock.Anything, mock.Anything).Return(inHour(oldestHour, key), nil)
+	db.On("FetchRevisedKeysForHours", region, mock.Anything, mock.Anything, mock.Anything).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return([]byte("signature"), nil)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/index/%s", region, goodAuth), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, "application/zip", resp.Header().Get("Content-Type"))
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "Wrote retrieval index")
+
+	files := readZip(t, resp.Body.Bytes())
+	assert.Equal(t, "Bundle Index v1 ", string(files["index.bin"][:16]))
+	signer.AssertCalled(t, "Sign", files["index.bin"])
+
+	index := &pb.BundleIndex{}
+	assert.Nil(t, proto.Unmarshal(files["index.bin"][16:], index))
+	assert.Equal(t, "302", index.GetRegion())
+	assert.Equal(t, "v1", index.GetSignatureInfos()[0].GetVerificationKeyVersion())
+
+	sigList := &pb.TEKSignatureList{}
+	assert.Nil(t, proto.Unmarshal(files["index.sig"], sigList))
+	assert.Equal(t, []byte("signature"), sigList.GetSignatures()[0].GetSignature())
+
+	// Every past day and hour that can be retrieved, but not the current ones
+	bundles := index.GetBundles()
+	assert.Len(t, bundles, numberOfDaysToServe+int(currentHour-oldestHour))
+
+	first := bundles[0]
+	assert.Equal(t, pb.BundleIndexEntry_DAY, first.GetPeriod())
+	assert.Equal(t, oldestDay, first.GetNumber())
+	assert.Equal(t, int32(1), first.GetBatchNum())
+	assert.Equal(t, int32(1), first.GetBatchSize())
+	assert.Equal(t, uint32(1), first.GetCount())
+
+	last := bundles[len(bundles)-1]
+	assert.Equal(t, pb.BundleIndexEntry_HOUR, last.GetPeriod())
+	assert.Equal(t, currentHour-1, last.GetNumber())
+
+	// Keys are fetched once for every window, and only the index is signed
+	db.AssertNumberOfCalls(t, "FetchKeysForHours", 1)
+	db.AssertNumberOfCalls(t, "FetchRevisedKeysForHours", 1)
+	signer.AssertNumberOfCalls(t, "Sign", 1)
+
+	// The digest is of the export.bin of the bundle /retrieve serves
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/%d/%s", region, oldestDay, goodAuth), nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	digest := sha256.Sum256(readZip(t, resp.Body.Bytes())["export.bin"])
+	assert.Equal(t, digest[:], first.GetSha256())
+}
+
+func TestRetrieve_IndexStoredExports(t *testing.T) {
+	oldEntirePeriod := config.AppConstants.EnableEntirePeriodBundle
+	defer func() { config.AppConstants.EnableEntirePeriodBundle = oldEntirePeriod }()
+	config.AppConstants.EnableEntirePeriodBundle = false
+
+	dir, _ := ioutil.TempDir("", "stored-index")
+	defer os.RemoveAll(dir)
+	store, _ := blobstore.NewFilesystem(dir)
+
+	db, auth, signer := setupRetrieveMockers()
+	router := Router()
+	NewRetrieveServlet(db, auth, testSigningKeys(signer), nil, store, nil).RegisterRouting(router)
+
+	region := "302"
+	goodAuth := "abcd"
+	oldestDay := timemath.CurrentDateNumber() - numberOfDaysToServe
+
+	auth.On("AuthenticateIndex", region, goodAuth).Return(true)
+	db.On("FetchKeysForHours", region, mock.Anything, mock.Anything, mock.Anything).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+	db.On("FetchRevisedKeysForHours", region, mock.Anything, mock.Anything, mock.Anything).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+	signer.On("Sign", mock.AnythingOfType("[]uint8")).Return([]byte("signature"), nil)
+
+	var stored bytes.Buffer
+	batch := pkgRetrieval.Batch{Keys: []*pb.TemporaryExposureKey{randomTestKey(), randomTestKey()}}
+	start := time.Unix(int64(oldestDay)*86400, 0)
+	_, err := pkgRetrieval.SerializeBatchTo(context.Background(), &stored, batch, region, start, start.Add(24*time.Hour), 1, 1, testSigningKeys(signer))
+	assert.Nil(t, err)
+	prefix := pkgRetrieval.ExportPrefix(region, pkgRetrieval.DayPeriod, oldestDay)
+	store.Put(context.Background(), pkgRetrieval.ExportName(prefix, 1), stored.Bytes())
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/retrieve/%s/index/%s", region, goodAuth), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+
+	index := &pb.BundleIndex{}
+	assert.Nil(t, proto.Unmarshal(readZip(t, resp.Body.Bytes())["index.bin"][16:], index))
+
+	// The stored export is described as it's stored
+	first := index.GetBundles()[0]
+	assert.Equal(t, oldestDay, first.GetNumber())
+	assert.Equal(t, uint32(2), first.GetCount())
+	digest := sha256.Sum256(readZip(t, stored.Bytes())["export.bin"])
+	assert.Equal(t, digest[:], first.GetSha256())
+
+	// and the rest from the database
+	second := index.GetBundles()[1]
+	assert.Equal(t, oldestDay+1, second.GetNumber())
+	assert.Equal(t, uint32(0), second.GetCount())
+	db.AssertNumberOfCalls(t, "FetchKeysForHours", 1)
+}
+
+func TestRetrieve_IndexBadAuth(t *testing.T) {
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db, auth, signer := setupRetrieveMockers()
+	router := setupRetrieveRouter(db, auth, signer)
+
+	auth.On("AuthenticateIndex", "302", "dcba").Return(false)
+
+	req, _ := http.NewRequest("GET", "/retrieve/302/index/dcba", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 401, resp.Code, "Unauthorized response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "invalid auth parameter")
+	db.AssertNotCalled(t, "FetchKeysForHours", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 func setupRetrieveMockers() (*persistence.Conn, *retrieval.Authenticator, *retrieval.Signer) {
 
 	db := &persistence.Conn{}
@@ -219,13 +885,17 @@ func setupRetrieveMockers() (*persistence.Conn, *retrieval.Authenticator, *retri
 
 func setupRetrieveRouter(db *persistence.Conn, auth *retrieval.Authenticator, signer *retrieval.Signer) *mux.Router {
 
-	servlet := NewRetrieveServlet(db, auth, signer)
+	servlet := NewRetrieveServlet(db, auth, testSigningKeys(signer), nil, nil, nil)
 	router := Router()
 	servlet.RegisterRouting(router)
 
 	return router
 }
 
+func testSigningKeys(signer *retrieval.Signer) pkgRetrieval.SigningKeys {
+	return pkgRetrieval.SigningKeys{{Signer: signer, Version: "v1", ID: "302"}}
+}
+
 func randomTestKey() *pb.TemporaryExposureKey {
 	token := make([]byte, 16)
 	rand.Read(token)
@@ -240,3 +910,30 @@ func randomTestKey() *pb.TemporaryExposureKey {
 	}
 	return key
 }
+
+// inHour groups keys by hour, as FetchKeysForHours does, all in the same hour.
+func inHour(hour uint32, keys ...*pb.TemporaryExposureKey) map[uint32][]*pb.TemporaryExposureKey {
+	return map[uint32][]*pb.TemporaryExposureKey{hour: keys}
+}
+
+func readExport(t *testing.T, body []byte) *pb.TemporaryExposureKeyExport {
+	data, ok := readZip(t, body)["export.bin"]
+	if !ok {
+		t.Fatal("export.bin missing from archive")
+	}
+	export := &pb.TemporaryExposureKeyExport{}
+	assert.Nil(t, proto.Unmarshal(data[16:], export))
+	return export
+}
+
+func readZip(t *testing.T, body []byte) map[string][]byte {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	assert.Nil(t, err)
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		files[f.Name], _ = ioutil.ReadAll(rc)
+		rc.Close()
+	}
+	return files
+}
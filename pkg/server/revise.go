@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Shopify/goose/srvutil"
+	"github.com/cds-snc/covid-alert-server/pkg/keyclaim"
+	"github.com/cds-snc/covid-alert-server/pkg/persistence"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/timemath"
+	"github.com/gorilla/mux"
+)
+
+func NewKeyRevisionServlet(db persistence.Conn, auth keyclaim.Authenticator, cache *retrieval.BundleCache) srvutil.Servlet {
+	return &keyRevisionServlet{db: db, auth: auth, cache: cache}
+}
+
+type keyRevisionServlet struct {
+	db    persistence.Conn
+	auth  keyclaim.Authenticator
+	cache *retrieval.BundleCache
+}
+
+type keyRevisionResponse struct {
+	RevisedKeys int64 `json:"revised_keys"`
+}
+
+// POST /revise-keys
+
+func (s *keyRevisionServlet) RegisterRouting(r *mux.Router) {
+	r.HandleFunc("/revise-keys", s.reviseKeys)
+}
+
+// reviseKeys lets a health authority change the report type of keys uploaded
+// with a one-time code (or hashID) it issued, e.g. to revoke the keys after a
+// false positive. Revised keys are published in the revised_keys of the
+// exports for the current period.
+func (s *keyRevisionServlet) reviseKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != "POST" {
+		log(ctx, nil).WithField("method", r.Method).Info("disallowed method")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hdr := r.Header.Get("Authorization")
+	_, originator, ok := s.auth.RegionFromAuthHeader(hdr)
+	if !ok {
+		log(ctx, nil).WithField("header", hdr).Info("bad auth header")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	oneTimeCode := r.FormValue("one_time_code")
+	oneTimeCode = strings.ReplaceAll(oneTimeCode, " ", "")
+	oneTimeCode = strings.ReplaceAll(oneTimeCode, "-", "")
+	hashID := r.FormValue("hash_id")
+
+	if (oneTimeCode == "") == (hashID == "") {
+		log(ctx, nil).Info("revision requires exactly one of one_time_code or hash_id")
+		http.Error(w, "exactly one of one_time_code or hash_id is required", http.StatusBadRequest)
+		return
+	}
+
+	reportType, ok := pb.TemporaryExposureKey_ReportType_value[strings.ToUpper(r.FormValue("report_type"))]
+	if !ok {
+		log(ctx, nil).Info("invalid report type for revision")
+		http.Error(w, "invalid report_type", http.StatusBadRequest)
+		return
+	}
+
+	revised, err := s.db.ReviseKeys(originator, oneTimeCode, hashID, pb.TemporaryExposureKey_ReportType(reportType))
+	if err == persistence.ErrInvalidRevision {
+		log(ctx, err).Info("invalid report type for revision")
+		http.Error(w, "invalid report_type", http.StatusBadRequest)
+		return
+	} else if err == persistence.ErrNoKeysToRevise {
+		log(ctx, err).Info("no keys to revise")
+		http.Error(w, "no keys found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log(ctx, err).Error("error revising keys")
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	if revised > 0 {
+		s.cache.InvalidateHour(timemath.HourNumber(time.Now()))
+	}
+
+	log(ctx, nil).WithField("revised", revised).WithField("report_type", pb.TemporaryExposureKey_ReportType(reportType).String()).Info("revised keys")
+
+	js, err := json.Marshal(keyRevisionResponse{RevisedKeys: revised})
+	if err != nil {
+		log(ctx, err).Error("error building json object")
+		http.Error(w, "error building json object", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	if _, err := w.Write(js); err != nil {
+		log(ctx, err).Warn("error writing response")
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	keyclaim "github.com/cds-snc/covid-alert-server/mocks/pkg/keyclaim"
+	persistence "github.com/cds-snc/covid-alert-server/mocks/pkg/persistence"
+	persistenceErrors "github.com/cds-snc/covid-alert-server/pkg/persistence"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/testhelpers"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKeyRevisionServlet(t *testing.T) {
+	db := &persistence.Conn{}
+	auth := &keyclaim.Authenticator{}
+
+	expected := &keyRevisionServlet{
+		db:   db,
+		auth: auth,
+	}
+	assert.Equal(t, expected, NewKeyRevisionServlet(db, auth, nil), "should return a new keyRevisionServlet struct")
+}
+
+func TestRegisterRoutingKeyRevision(t *testing.T) {
+	router := buildKeyRevisionServletRouter(&persistence.Conn{}, &keyclaim.Authenticator{})
+
+	expectedPaths := GetPaths(router)
+	assert.Contains(t, expectedPaths, "/revise-keys", "should include a /revise-keys path")
+}
+
+func TestReviseKeys_Auth(t *testing.T) {
+	db := &persistence.Conn{}
+	auth := &keyclaim.Authenticator{}
+	auth.On("RegionFromAuthHeader", "Bearer badtoken").Return("", "", false)
+
+	router := buildKeyRevisionServletRouter(db, auth)
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	// Only POST is allowed
+	req, _ := http.NewRequest("GET", "/revise-keys", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 401, resp.Code, "Unauthorized response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "disallowed method")
+
+	// Bad token
+	req = reviseKeysRequest(url.Values{"one_time_code": {"AAABBBCCCC"}, "report_type": {"REVOKED"}})
+	req.Header.Set("Authorization", "Bearer badtoken")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 401, resp.Code, "Unauthorized response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "bad auth header")
+}
+
+func TestReviseKeys_BadRequest(t *testing.T) {
+	db := &persistence.Conn{}
+	auth := &keyclaim.Authenticator{}
+	auth.On("RegionFromAuthHeader", "Bearer goodtoken").Return("302", "goodtoken", true)
+
+	router := buildKeyRevisionServletRouter(db, auth)
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	// Neither a one-time code nor a hashID
+	req := reviseKeysRequest(url.Values{"report_type": {"REVOKED"}})
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad request response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "revision requires exactly one of one_time_code or hash_id")
+
+	// Both a one-time code and a hashID
+	req = reviseKeysRequest(url.Values{"one_time_code": {"AAABBBCCCC"}, "hash_id": {"abcd"}, "report_type": {"REVOKED"}})
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad request response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "revision requires exactly one of one_time_code or hash_id")
+
+	// Unknown report type
+	req = reviseKeysRequest(url.Values{"one_time_code": {"AAABBBCCCC"}, "report_type": {"NOT_A_TYPE"}})
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad request response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "invalid report type for revision")
+
+	// Report type keys can't be revised to
+	db.On("ReviseKeys", "goodtoken", "AAABBBCCCC", "", pb.TemporaryExposureKey_SELF_REPORT).Return(int64(0), persistenceErrors.ErrInvalidRevision)
+
+	req = reviseKeysRequest(url.Values{"one_time_code": {"AAABBBCCCC"}, "report_type": {"self_report"}})
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 400, resp.Code, "Bad request response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "invalid report type for revision")
+}
+
+func TestReviseKeys(t *testing.T) {
+	db := &persistence.Conn{}
+	auth := &keyclaim.Authenticator{}
+	auth.On("RegionFromAuthHeader", "Bearer goodtoken").Return("302", "goodtoken", true)
+
+	hashID := strings.Repeat("a", 128)
+	db.On("ReviseKeys", "goodtoken", "AAABBBCCCC", "", pb.TemporaryExposureKey_REVOKED).Return(int64(3), nil)
+	db.On("ReviseKeys", "goodtoken", "", hashID, pb.TemporaryExposureKey_REVOKED).Return(int64(0), persistenceErrors.ErrNoKeysToRevise)
+	db.On("ReviseKeys", "goodtoken", "DDDEEEFFFF", "", pb.TemporaryExposureKey_REVOKED).Return(int64(0), fmt.Errorf("error"))
+
+	router := buildKeyRevisionServletRouter(db, auth)
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	// Revised, with the code formatted the way the app displays it
+	req := reviseKeysRequest(url.Values{"one_time_code": {"AAA-BBB-CCCC"}, "report_type": {"REVOKED"}})
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "Success response is expected")
+	assert.Equal(t, `{"revised_keys":3}`, resp.Body.String(), "Correct response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "revised keys")
+
+	// Nothing uploaded with the hashID
+	req = reviseKeysRequest(url.Values{"hash_id": {hashID}, "report_type": {"REVOKED"}})
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 404, resp.Code, "Not found response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.InfoLevel, "no keys to revise")
+
+	// Database error
+	req = reviseKeysRequest(url.Values{"one_time_code": {"DDDEEEFFFF"}, "report_type": {"REVOKED"}})
+	req.Header.Set("Authorization", "Bearer goodtoken")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 500, resp.Code, "Server error response is expected")
+	testhelpers.AssertLog(t, hook, 1, logrus.ErrorLevel, "error revising keys")
+
+	db.AssertNumberOfCalls(t, "ReviseKeys", 3)
+}
+
+func reviseKeysRequest(values url.Values) *http.Request {
+	req, _ := http.NewRequest("POST", "/revise-keys", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func buildKeyRevisionServletRouter(db *persistence.Conn, auth *keyclaim.Authenticator) *mux.Router {
+	servlet := NewKeyRevisionServlet(db, auth, nil)
+	router := Router()
+	servlet.RegisterRouting(router)
+	return router
+}
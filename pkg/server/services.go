@@ -1,10 +1,14 @@
 package server
 
 import (
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"net/http"
+	"time"
 
 	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
 
 	"github.com/Shopify/goose/srvutil"
 	"github.com/gorilla/mux"
@@ -13,17 +17,35 @@ import (
 var branch string
 var revision string
 
-func NewServicesServlet() srvutil.Servlet {
-	s := &servicesServlet{}
+// NewServicesServlet serves the health and metadata endpoints. signingKeys
+// is only set on servers that sign exports, and is published at
+// /services/verification-keys.json.
+func NewServicesServlet(signingKeys retrieval.SigningKeys) srvutil.Servlet {
+	s := &servicesServlet{signingKeys: signingKeys}
 	return srvutil.PrefixServlet(s, "/services")
 }
 
-type servicesServlet struct{}
+type servicesServlet struct {
+	signingKeys retrieval.SigningKeys
+}
 type version struct {
 	Branch   string `json:"branch"`
 	Revision string `json:"revision"`
 }
 
+type verificationKey struct {
+	Version    string `json:"version"`
+	ID         string `json:"id"`
+	Algorithm  string `json:"algorithm"`
+	PublicKey  string `json:"publicKey"`
+	ValidFrom  string `json:"validFrom,omitempty"`
+	ValidUntil string `json:"validUntil,omitempty"`
+}
+
+type verificationKeys struct {
+	Keys []verificationKey `json:"keys"`
+}
+
 type featureFlags struct {
 	EnableEntirePeriodBundle           bool `json:"enableEntirePeriodBundle"`
 	DisableCurrentDateCheckFeatureFlag bool `json:"disableCurrentDateCheckFeatureFlag"`
@@ -34,6 +56,9 @@ func (s *servicesServlet) RegisterRouting(r *mux.Router) {
 	r.HandleFunc("/present", s.exposurePresence)
 	r.HandleFunc("/version.json", s.version)
 	r.HandleFunc("/featureFlags.json", s.featureFlags)
+	if len(s.signingKeys) > 0 {
+		r.HandleFunc("/verification-keys.json", s.verificationKeys)
+	}
 }
 
 func (s *servicesServlet) exposurePresence(w http.ResponseWriter, r *http.Request) {
@@ -93,3 +118,53 @@ func (s *servicesServlet) version(w http.ResponseWriter, r *http.Request) {
 		log(ctx, err).Info("error writing response")
 	}
 }
+
+// verificationKeys lists the public half of every signing key that hasn't
+// expired, so that keys about to be rotated in can be trusted ahead of time.
+func (s *servicesServlet) verificationKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+
+	now := time.Now()
+	keys := verificationKeys{Keys: []verificationKey{}}
+	for _, key := range s.signingKeys {
+		if !key.ValidUntil.IsZero() && !now.Before(key.ValidUntil) {
+			continue
+		}
+		publicKey := key.PublicKey()
+		if publicKey == nil {
+			continue
+		}
+		der, err := x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil {
+			log(ctx, err).WithField("version", key.Version).Warn("could not marshal verification key")
+			continue
+		}
+
+		vk := verificationKey{
+			Version:   key.Version,
+			ID:        key.ID,
+			Algorithm: retrieval.SignatureAlgorithm,
+			PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		}
+		if !key.ValidFrom.IsZero() {
+			vk.ValidFrom = key.ValidFrom.UTC().Format(time.RFC3339)
+		}
+		if !key.ValidUntil.IsZero() {
+			vk.ValidUntil = key.ValidUntil.UTC().Format(time.RFC3339)
+		}
+		keys.Keys = append(keys.Keys, vk)
+	}
+
+	js, err := json.Marshal(keys)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := w.Write(js); err != nil {
+		log(ctx, err).Info("error writing response")
+	}
+}
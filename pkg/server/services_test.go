@@ -1,14 +1,24 @@
 package server
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"reflect"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/Shopify/goose/srvutil"
+	retrieval "github.com/cds-snc/covid-alert-server/mocks/pkg/retrieval"
+	pkgRetrieval "github.com/cds-snc/covid-alert-server/pkg/retrieval"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,14 +26,14 @@ func TestNewServicesServlet(t *testing.T) {
 	s := &servicesServlet{}
 	// Compare function names vs. functions
 	funcName1 := runtime.FuncForPC(reflect.ValueOf(srvutil.PrefixServlet(s, "/services")).Pointer()).Name()
-	funcName2 := runtime.FuncForPC(reflect.ValueOf(NewServicesServlet()).Pointer()).Name()
+	funcName2 := runtime.FuncForPC(reflect.ValueOf(NewServicesServlet(nil)).Pointer()).Name()
 	assert.Equal(t, funcName1, funcName2, "should return a new servicesServlet function")
 
 }
 
 func TestRegisterRoutingServices(t *testing.T) {
 
-	servlet := NewServicesServlet()
+	servlet := NewServicesServlet(nil)
 	router := Router()
 	servlet.RegisterRouting(router)
 
@@ -35,7 +45,7 @@ func TestRegisterRoutingServices(t *testing.T) {
 }
 
 func TestPing(t *testing.T) {
-	servlet := NewServicesServlet()
+	servlet := NewServicesServlet(nil)
 	router := Router()
 	servlet.RegisterRouting(router)
 
@@ -52,7 +62,7 @@ func TestPing(t *testing.T) {
 }
 
 func TestPresent(t *testing.T) {
-	servlet := NewServicesServlet()
+	servlet := NewServicesServlet(nil)
 	router := Router()
 	servlet.RegisterRouting(router)
 
@@ -69,7 +79,7 @@ func TestVersion(t *testing.T) {
 	branch = "main"
 	revision = "abcd"
 
-	servlet := NewServicesServlet()
+	servlet := NewServicesServlet(nil)
 	router := Router()
 	servlet.RegisterRouting(router)
 
@@ -89,3 +99,48 @@ func TestVersion(t *testing.T) {
 	assert.Contains(t, resp.Header()["Cache-Control"], "no-store", "Cache-Control should be set to no-store")
 	assert.Contains(t, resp.Header()["Content-Type"], "application/json; charset=utf-8", "Cache-Type should be set to application/json; charset=utf-8")
 }
+
+func TestVerificationKeys(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(privateKey)
+	os.Setenv("TEST_VERIFICATION_KEY", hex.EncodeToString(der))
+	defer os.Unsetenv("TEST_VERIFICATION_KEY")
+
+	signer, err := pkgRetrieval.NewEnvSigner("TEST_VERIFICATION_KEY")
+	assert.Nil(t, err)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	signingKeys := pkgRetrieval.SigningKeys{
+		{Signer: signer, Version: "v1", ID: "302", ValidUntil: now.Add(-time.Hour)},
+		{Signer: signer, Version: "v2", ID: "302", ValidUntil: now.Add(time.Hour)},
+		{Signer: signer, Version: "v3", ID: "302", ValidFrom: now.Add(time.Hour)},
+		// No public key available
+		{Signer: &retrieval.Signer{}, Version: "v4", ID: "302"},
+	}
+
+	servlet := NewServicesServlet(signingKeys)
+	router := Router()
+	servlet.RegisterRouting(router)
+
+	req, _ := http.NewRequest("GET", "/services/verification-keys.json", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	publicDER, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+
+	expected, _ := json.Marshal(verificationKeys{Keys: []verificationKey{
+		{Version: "v2", ID: "302", Algorithm: "1.2.840.10045.4.3.2", PublicKey: publicPEM, ValidUntil: now.Add(time.Hour).Format(time.RFC3339)},
+		{Version: "v3", ID: "302", Algorithm: "1.2.840.10045.4.3.2", PublicKey: publicPEM, ValidFrom: now.Add(time.Hour).Format(time.RFC3339)},
+	}})
+
+	assert.Equal(t, 200, resp.Code, "OK response is expected")
+	assert.JSONEq(t, string(expected), resp.Body.String(), "JSON response is expected")
+	assert.Contains(t, resp.Header()["Cache-Control"], "no-store", "Cache-Control should be set to no-store")
+	assert.Contains(t, resp.Header()["Content-Type"], "application/json; charset=utf-8", "Cache-Type should be set to application/json; charset=utf-8")
+
+	// Servers that don't sign exports don't publish keys
+	router = Router()
+	NewServicesServlet(nil).RegisterRouting(router)
+	assert.NotContains(t, GetPaths(router), "/services/verification-keys.json")
+}
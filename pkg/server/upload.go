@@ -8,8 +8,12 @@ import (
 	"sort"
 	"time"
 
+	"github.com/cds-snc/covid-alert-server/pkg/config"
 	"github.com/cds-snc/covid-alert-server/pkg/persistence"
 	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/telemetry"
+	"github.com/cds-snc/covid-alert-server/pkg/timemath"
 
 	"github.com/Shopify/goose/srvutil"
 	"github.com/gorilla/mux"
@@ -17,12 +21,19 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-func NewUploadServlet(db persistence.Conn) srvutil.Servlet {
-	return &uploadServlet{db: db}
+// NewUploadServlet returns the upload servlet. cache is the retrieval bundle
+// cache of this process, if it serves retrieval too; bundles for the current
+// hour are dropped from it whenever keys are stored. Retrieval servers in other
+// processes don't hear about it, and serve what they have cached until it
+// expires.
+func NewUploadServlet(db persistence.Conn, cache *retrieval.BundleCache) srvutil.Servlet {
+	return &uploadServlet{db: db, cache: cache, timer: newResponseTimer(config.AppConstants.ChaffResponseTime)}
 }
 
 type uploadServlet struct {
-	db persistence.Conn
+	db    persistence.Conn
+	cache *retrieval.BundleCache
+	timer *responseTimer
 }
 
 func (s *uploadServlet) RegisterRouting(r *mux.Router) {
@@ -35,6 +46,7 @@ func uploadError(errCode pb.EncryptedUploadResponse_ErrorCode) *pb.EncryptedUplo
 
 func (s *uploadServlet) upload(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	start := time.Now()
 
 	w.Header().Add("Content-Type", "application/x-protobuf")
 
@@ -57,6 +69,11 @@ func (s *uploadServlet) upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if seu.GetChaff() {
+		s.uploadChaff(w, r, start)
+		return
+	}
+
 	serverPub := seu.ServerPublicKey
 	if len(serverPub) != pb.KeyLength {
 		requestError(
@@ -164,6 +181,18 @@ func (s *uploadServlet) upload(w http.ResponseWriter, r *http.Request) {
 			http.StatusBadRequest, uploadError(pb.EncryptedUploadResponse_TOO_MANY_KEYS),
 		)
 		return
+	} else if err == persistence.ErrInvalidReportType {
+		requestError(
+			ctx, w, err, "invalid report type",
+			http.StatusBadRequest, uploadError(pb.EncryptedUploadResponse_INVALID_REPORT_TYPE),
+		)
+		return
+	} else if err == persistence.ErrInvalidDaysSinceOnsetOfSymptoms {
+		requestError(
+			ctx, w, err, "invalid days since onset of symptoms",
+			http.StatusBadRequest, uploadError(pb.EncryptedUploadResponse_INVALID_DAYS_SINCE_ONSET_OF_SYMPTOMS),
+		)
+		return
 	} else if err != nil {
 		requestError(
 			ctx, w, err, "failed to store diagnosis keys",
@@ -171,6 +200,7 @@ func (s *uploadServlet) upload(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
+	s.cache.InvalidateHour(timemath.HourNumber(time.Now()))
 
 	resp := uploadError(pb.EncryptedUploadResponse_NONE)
 	data, err = proto.Marshal(resp)
@@ -182,52 +212,66 @@ func (s *uploadServlet) upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.timer.observe(start)
 	if _, err := w.Write(data); err != nil {
 		log(ctx, err).Info("error writing response")
 	}
 }
 
-func validateKey(ctx context.Context, w http.ResponseWriter, key *pb.TemporaryExposureKey) bool {
-	if key.GetRollingPeriod() < 1 || key.GetRollingPeriod() > 144 {
+// uploadChaff answers a decoy upload as a successful one, no sooner than a
+// real upload would be. Its payload isn't looked at and nothing is stored.
+func (s *uploadServlet) uploadChaff(w http.ResponseWriter, r *http.Request, start time.Time) {
+	ctx := r.Context()
+
+	data, err := proto.Marshal(uploadError(pb.EncryptedUploadResponse_NONE))
+	if err != nil {
 		requestError(
-			ctx, w, nil, "missing or invalid rollingPeriod",
-			http.StatusBadRequest, uploadError(pb.EncryptedUploadResponse_INVALID_ROLLING_PERIOD),
+			ctx, w, err, "error marshalling response",
+			http.StatusInternalServerError, uploadError(pb.EncryptedUploadResponse_SERVER_ERROR),
 		)
-		return false
+		return
+	}
+
+	s.timer.wait(start)
+	if _, err := w.Write(data); err != nil {
+		log(ctx, err).Info("error writing response")
+	}
+	telemetry.CountChaff(ctx, "upload")
+}
+
+// keyProblem is why uploaded keys can't be stored.
+type keyProblem struct {
+	msg  string
+	code pb.EncryptedUploadResponse_ErrorCode
+}
+
+func checkKey(key *pb.TemporaryExposureKey) *keyProblem {
+	if key.GetRollingPeriod() < 1 || key.GetRollingPeriod() > 144 {
+		return &keyProblem{"missing or invalid rollingPeriod", pb.EncryptedUploadResponse_INVALID_ROLLING_PERIOD}
 	}
 
 	if len(key.GetKeyData()) != 16 {
-		requestError(
-			ctx, w, nil, "invalid key data",
-			http.StatusBadRequest, uploadError(pb.EncryptedUploadResponse_INVALID_KEY_DATA),
-		)
-		return false
+		return &keyProblem{"invalid key data", pb.EncryptedUploadResponse_INVALID_KEY_DATA}
 	}
 
 	if key.GetRollingStartIntervalNumber() == 0 {
-		requestError(
-			ctx, w, nil, "invalid rolling start number",
-			http.StatusBadRequest, uploadError(pb.EncryptedUploadResponse_INVALID_ROLLING_START_INTERVAL_NUMBER),
-		)
-		return false
+		return &keyProblem{"invalid rolling start number", pb.EncryptedUploadResponse_INVALID_ROLLING_START_INTERVAL_NUMBER}
 	}
 
 	level := key.GetTransmissionRiskLevel()
 	if level < 0 || level > 8 {
-		requestError(
-			ctx, w, nil, "invalid transmission risk level",
-			http.StatusBadRequest, uploadError(pb.EncryptedUploadResponse_INVALID_TRANSMISSION_RISK_LEVEL),
-		)
-		return false
+		return &keyProblem{"invalid transmission risk level", pb.EncryptedUploadResponse_INVALID_TRANSMISSION_RISK_LEVEL}
 	}
 
-	return true
+	return nil
 }
 
-func validateKeys(ctx context.Context, w http.ResponseWriter, keys []*pb.TemporaryExposureKey) bool {
+// checkKeys applies the rules every upload has to follow, however it was
+// authorized.
+func checkKeys(keys []*pb.TemporaryExposureKey) *keyProblem {
 	for _, key := range keys {
-		if ok := validateKey(ctx, w, key); !ok {
-			return false
+		if p := checkKey(key); p != nil {
+			return p
 		}
 	}
 
@@ -246,12 +290,24 @@ func validateKeys(ctx context.Context, w http.ResponseWriter, keys []*pb.Tempora
 	// Changed from 14 to 15 because you can have a case where you submit for the
 	// past 14 days plus part of today
 	if maxEnd-min > (144 * 15) {
-		requestError(
-			ctx, w, nil, "sequence of rollingStartIntervalNumbers exceeds 15 days",
-			http.StatusBadRequest, uploadError(pb.EncryptedUploadResponse_INVALID_ROLLING_START_INTERVAL_NUMBER),
-		)
+		return &keyProblem{"sequence of rollingStartIntervalNumbers exceeds 15 days", pb.EncryptedUploadResponse_INVALID_ROLLING_START_INTERVAL_NUMBER}
+	}
+
+	return nil
+}
+
+func validateKey(ctx context.Context, w http.ResponseWriter, key *pb.TemporaryExposureKey) bool {
+	if p := checkKey(key); p != nil {
+		requestError(ctx, w, nil, p.msg, http.StatusBadRequest, uploadError(p.code))
 		return false
 	}
+	return true
+}
 
+func validateKeys(ctx context.Context, w http.ResponseWriter, keys []*pb.TemporaryExposureKey) bool {
+	if p := checkKeys(keys); p != nil {
+		requestError(ctx, w, nil, p.msg, http.StatusBadRequest, uploadError(p.code))
+		return false
+	}
 	return true
 }
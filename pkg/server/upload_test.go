@@ -28,7 +28,7 @@ import (
 
 func setupUploadRouter(db *persistence.Conn) *mux.Router {
 
-	servlet := NewUploadServlet(db)
+	servlet := NewUploadServlet(db, nil)
 	router := Router()
 	servlet.RegisterRouting(router)
 
@@ -38,10 +38,17 @@ func setupUploadRouter(db *persistence.Conn) *mux.Router {
 func TestNewUploadServlet(t *testing.T) {
 	db := &persistence.Conn{}
 
+	servlet := NewUploadServlet(db, nil)
+
+	// The timer is seeded at random
+	timer := servlet.(*uploadServlet).timer
+	assert.Len(t, timer.samples, responseTimeSamples)
+
 	expected := &uploadServlet{
-		db: db,
+		db:    db,
+		timer: timer,
 	}
-	assert.Equal(t, expected, NewUploadServlet(db), "should return a new uploadServlet struct")
+	assert.Equal(t, expected, servlet, "should return a new uploadServlet struct")
 }
 
 func TestRegisterRoutingUpload(t *testing.T) {
@@ -453,6 +460,51 @@ func TestUpload_NotEnoughKeysRemaining(t *testing.T) {
 	testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, "not enough keys remaining")
 }
 
+func TestUpload_InvalidKeyMetadata(t *testing.T) {
+
+	hook, oldLog, db, router := setupUploadTest()
+	defer func() { log = *oldLog }()
+
+	cases := []struct {
+		storeErr     error
+		expectedCode pb.EncryptedUploadResponse_ErrorCode
+		expectedLog  string
+	}{
+		{persistenceErrors.ErrInvalidReportType, pb.EncryptedUploadResponse_INVALID_REPORT_TYPE, "invalid report type"},
+		{persistenceErrors.ErrInvalidDaysSinceOnsetOfSymptoms, pb.EncryptedUploadResponse_INVALID_DAYS_SINCE_ONSET_OF_SYMPTOMS, "invalid days since onset of symptoms"},
+	}
+
+	for _, c := range cases {
+		appPub, appPriv, _ := box.GenerateKey(rand.Reader)
+		serverPub, serverPriv, _ := box.GenerateKey(rand.Reader)
+
+		db.On("PrivForPub", serverPub[:]).Return(serverPriv[:], nil)
+		db.On("StoreKeys", appPub, mock.AnythingOfType("[]*covidshield.TemporaryExposureKey"), mock.Anything).Return(c.storeErr)
+
+		var (
+			nonce [24]byte
+			msg   []byte
+		)
+		io.ReadFull(rand.Reader, nonce[:])
+		upload := &pb.Upload{
+			Keys:      []*pb.TemporaryExposureKey{randomTestKey()},
+			Timestamp: &timestamppb.Timestamp{Seconds: time.Now().Unix()},
+		}
+		marshalledUpload, _ := proto.Marshal(upload)
+		encrypted := box.Seal(msg[:], marshalledUpload, &nonce, serverPub, appPriv)
+
+		payload, _ := proto.Marshal(buildUploadRequest(serverPub[:], nonce[:], appPub[:], encrypted))
+		req, _ := http.NewRequest("POST", "/upload", bytes.NewReader(payload))
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, 400, resp.Code, "400 response is expected")
+		assert.True(t, checkUploadResponse(resp.Body.Bytes(), c.expectedCode))
+
+		testhelpers.AssertLog(t, hook, 1, logrus.WarnLevel, c.expectedLog)
+	}
+}
+
 func TestUpload(t *testing.T) {
 
 	_, oldLog := testhelpers.SetupTestLogging(&log)
@@ -491,6 +543,35 @@ func TestUpload(t *testing.T) {
 	assert.True(t, checkUploadResponse(resp.Body.Bytes(), pb.EncryptedUploadResponse_NONE))
 }
 
+func TestUpload_Chaff(t *testing.T) {
+
+	_, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	db := &persistence.Conn{}
+	router := setupUploadRouter(db)
+
+	serverPub, _, _ := box.GenerateKey(rand.Reader)
+	appPub, _, _ := box.GenerateKey(rand.Reader)
+	var nonce [24]byte
+	io.ReadFull(rand.Reader, nonce[:])
+	encrypted := make([]byte, 128)
+	io.ReadFull(rand.Reader, encrypted)
+
+	upload := buildUploadRequest(serverPub[:], nonce[:], appPub[:], encrypted)
+	upload.Chaff = proto.Bool(true)
+	payload, _ := proto.Marshal(upload)
+	req, _ := http.NewRequest("POST", "/upload", bytes.NewReader(payload))
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code, "200 response is expected")
+	assert.True(t, checkUploadResponse(resp.Body.Bytes(), pb.EncryptedUploadResponse_NONE))
+
+	db.AssertNotCalled(t, "PrivForPub", mock.Anything)
+	db.AssertNotCalled(t, "StoreKeys", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestValidateKey_RollingPeriodLT1(t *testing.T) {
 
 	hook, oldLog := testhelpers.SetupTestLogging(&log)
@@ -680,7 +761,7 @@ func TestValidateKeys(t *testing.T) {
 	}
 
 	db := &persistence.Conn{}
-	servlet := NewUploadServlet(db)
+	servlet := NewUploadServlet(db, nil)
 	router := Router()
 	servlet.RegisterRouting(router)
 
@@ -0,0 +1,19 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/kv"
+	"go.opentelemetry.io/otel/api/metric"
+)
+
+var chaffRequests = metric.Must(global.Meter("covidshield")).NewInt64Counter("covidshield.app.chaff_requests.total",
+	metric.WithDescription("Number of decoy requests answered, by endpoint"),
+)
+
+// CountChaff counts a decoy request to endpoint. Decoys are kept out of every
+// other count, so this is the only record of them.
+func CountChaff(ctx context.Context, endpoint string) {
+	chaffRequests.Add(ctx, 1, kv.String("endpoint", endpoint))
+}
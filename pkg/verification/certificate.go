@@ -0,0 +1,226 @@
+package verification
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
+)
+
+const (
+	// How far apart our clock and the verification server's may be.
+	clockSkew = time.Minute
+
+	// Keys are stored with the health authority as their originator.
+	maxHealthAuthorityIDLength = 32
+)
+
+var (
+	// ErrUnknownHealthAuthority is returned for a health authority that isn't
+	// configured.
+	ErrUnknownHealthAuthority = errors.New("unknown health authority")
+
+	// ErrInvalidCertificate is returned for a certificate that doesn't verify.
+	ErrInvalidCertificate = errors.New("invalid verification certificate")
+)
+
+// Report types a certificate can vouch for.
+const (
+	ReportTypeConfirmed = "confirmed"
+	ReportTypeLikely    = "likely"
+	ReportTypeNegative  = "negative"
+)
+
+// Claims are the parts of a verification certificate we use.
+type Claims struct {
+	Issuer               string   `json:"iss"`
+	Audience             audience `json:"aud"`
+	ExpiresAt            int64    `json:"exp"`
+	IssuedAt             int64    `json:"iat"`
+	NotBefore            int64    `json:"nbf"`
+	ReportType           string   `json:"reportType"`
+	SymptomOnsetInterval uint32   `json:"symptomOnsetInterval"`
+	TestDateInterval     uint32   `json:"testDateInterval"`
+	TEKMAC               string   `json:"tekmac"`
+}
+
+// audience is the "aud" claim, which may be a string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(aud string) bool {
+	for _, s := range a {
+		if s == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// Certificate is a verified certificate.
+type Certificate struct {
+	Claims
+	HealthAuthorityID string
+	Region            string
+
+	// Hash identifies the certificate by its signed header and claims, so it
+	// can only be used once however its signature is encoded.
+	Hash []byte
+}
+
+type authority struct {
+	id       string
+	issuer   string
+	audience string
+	region   string
+	keys     map[string]*ecdsa.PublicKey
+}
+
+// Verifier checks verification certificates against the configured
+// authorities' public keys.
+type Verifier struct {
+	authorities map[string]*authority
+}
+
+// NewVerifier loads the configured authorities' public keys.
+func NewVerifier(configs []config.VerificationAuthority) (*Verifier, error) {
+	v := &Verifier{authorities: make(map[string]*authority, len(configs))}
+
+	for _, c := range configs {
+		if c.HealthAuthorityID == "" || c.Issuer == "" || c.Audience == "" {
+			return nil, errors.New("verification authorities need a healthAuthorityID, issuer and audience")
+		}
+		if len(c.HealthAuthorityID) > maxHealthAuthorityIDLength {
+			return nil, fmt.Errorf("verification authority %s: healthAuthorityID is longer than %d characters", c.HealthAuthorityID, maxHealthAuthorityIDLength)
+		}
+		if _, ok := v.authorities[c.HealthAuthorityID]; ok {
+			return nil, fmt.Errorf("verification authority %s is configured more than once", c.HealthAuthorityID)
+		}
+
+		region := c.Region
+		if region == "" {
+			region = config.AppConstants.RegionCode
+		}
+		if !retrieval.ServesRegion(region) {
+			return nil, fmt.Errorf("verification authority %s uploads to unknown region %s", c.HealthAuthorityID, region)
+		}
+
+		if len(c.Keys) == 0 {
+			return nil, fmt.Errorf("verification authority %s has no keys", c.HealthAuthorityID)
+		}
+		keys := make(map[string]*ecdsa.PublicKey, len(c.Keys))
+		for _, k := range c.Keys {
+			pemData, err := ioutil.ReadFile(k.PublicKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("verification authority %s: %w", c.HealthAuthorityID, err)
+			}
+			publicKey, err := retrieval.ParsePublicKey(pemData)
+			if err != nil {
+				return nil, fmt.Errorf("verification authority %s: %w", c.HealthAuthorityID, err)
+			}
+			keys[k.ID] = publicKey
+		}
+
+		v.authorities[c.HealthAuthorityID] = &authority{
+			id:       c.HealthAuthorityID,
+			issuer:   c.Issuer,
+			audience: c.Audience,
+			region:   region,
+			keys:     keys,
+		}
+	}
+	return v, nil
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Verify checks that token is a certificate issued by healthAuthorityID's
+// verification server, and valid now.
+func (v *Verifier) Verify(healthAuthorityID, token string, now time.Time) (*Certificate, error) {
+	a, ok := v.authorities[healthAuthorityID]
+	if !ok {
+		return nil, ErrUnknownHealthAuthority
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidCertificate
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil || h.Algorithm != "ES256" {
+		return nil, ErrInvalidCertificate
+	}
+	publicKey, ok := a.keys[h.KeyID]
+	if !ok {
+		return nil, ErrInvalidCertificate
+	}
+
+	sig, err := base64.RawURLEncoding.Strict().DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return nil, ErrInvalidCertificate
+	}
+	signed := parts[0] + "." + parts[1]
+	digest := sha256.Sum256([]byte(signed))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(publicKey, digest[:], r, s) {
+		return nil, ErrInvalidCertificate
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidCertificate
+	}
+	if claims.Issuer != a.issuer || !claims.Audience.contains(a.audience) {
+		return nil, ErrInvalidCertificate
+	}
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)) {
+		return nil, ErrInvalidCertificate
+	}
+	if now.Add(clockSkew).Before(time.Unix(claims.NotBefore, 0)) || now.Add(clockSkew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return nil, ErrInvalidCertificate
+	}
+
+	// ECDSA signatures can be altered and still verify, so the certificate is
+	// identified by what was signed rather than by the token as a whole.
+	hash := sha256.Sum256([]byte(signed))
+	return &Certificate{
+		Claims:            claims,
+		HealthAuthorityID: a.id,
+		Region:            a.region,
+		Hash:              hash[:],
+	}, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.Strict().DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,185 @@
+package verification
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupVerifier(t *testing.T) (*Verifier, *ecdsa.PrivateKey, func()) {
+	oldCodes := config.AppConstants.RegionISOCodes
+	oldRegion := config.AppConstants.RegionCode
+	config.AppConstants.RegionISOCodes = map[string]string{"302": "CA"}
+	config.AppConstants.RegionCode = "302"
+
+	dir, _ := ioutil.TempDir("", "verification")
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	keyFile := filepath.Join(dir, "v1.pem")
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+
+	verifier, err := NewVerifier([]config.VerificationAuthority{{
+		HealthAuthorityID: "ca.gc.hc",
+		Issuer:            "ca.gc.hc",
+		Audience:          "covid-alert",
+		Keys:              []config.VerificationKey{{ID: "v1", PublicKeyFile: keyFile}},
+	}})
+	assert.Nil(t, err)
+
+	return verifier, privateKey, func() {
+		os.RemoveAll(dir)
+		config.AppConstants.RegionISOCodes = oldCodes
+		config.AppConstants.RegionCode = oldRegion
+	}
+}
+
+func validClaims(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":        "ca.gc.hc",
+		"aud":        "covid-alert",
+		"iat":        now.Unix(),
+		"nbf":        now.Unix(),
+		"exp":        now.Add(15 * time.Minute).Unix(),
+		"reportType": "confirmed",
+		"tekmac":     "bWFj",
+	}
+}
+
+func TestVerify(t *testing.T) {
+	verifier, privateKey, cleanup := setupVerifier(t)
+	defer cleanup()
+
+	now := time.Now()
+	token := testhelpers.SignCertificate(privateKey, "v1", validClaims(now))
+
+	cert, err := verifier.Verify("ca.gc.hc", token, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "ca.gc.hc", cert.HealthAuthorityID)
+	assert.Equal(t, "302", cert.Region)
+	assert.Equal(t, ReportTypeConfirmed, cert.ReportType)
+	assert.Equal(t, "bWFj", cert.TEKMAC)
+	assert.Len(t, cert.Hash, 32)
+
+	// A list of audiences
+	claims := validClaims(now)
+	claims["aud"] = []string{"someone-else", "covid-alert"}
+	_, err = verifier.Verify("ca.gc.hc", testhelpers.SignCertificate(privateKey, "v1", claims), now)
+	assert.Nil(t, err)
+
+	_, err = verifier.Verify("us.ny", token, now)
+	assert.Equal(t, ErrUnknownHealthAuthority, err)
+}
+
+func TestVerify_Invalid(t *testing.T) {
+	verifier, privateKey, cleanup := setupVerifier(t)
+	defer cleanup()
+
+	now := time.Now()
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	with := func(claim string, value interface{}) map[string]interface{} {
+		claims := validClaims(now)
+		claims[claim] = value
+		return claims
+	}
+
+	for name, token := range map[string]string{
+		"malformed":        "not.a-certificate",
+		"unknown key":      testhelpers.SignCertificate(privateKey, "v2", validClaims(now)),
+		"wrong signer":     testhelpers.SignCertificate(otherKey, "v1", validClaims(now)),
+		"wrong issuer":     testhelpers.SignCertificate(privateKey, "v1", with("iss", "us.ny")),
+		"wrong audience":   testhelpers.SignCertificate(privateKey, "v1", with("aud", "someone-else")),
+		"expired":          testhelpers.SignCertificate(privateKey, "v1", with("exp", now.Add(-time.Hour).Unix())),
+		"no expiry":        testhelpers.SignCertificate(privateKey, "v1", with("exp", 0)),
+		"not yet valid":    testhelpers.SignCertificate(privateKey, "v1", with("nbf", now.Add(time.Hour).Unix())),
+		"issued in future": testhelpers.SignCertificate(privateKey, "v1", with("iat", now.Add(time.Hour).Unix())),
+	} {
+		_, err := verifier.Verify("ca.gc.hc", token, now)
+		assert.Equal(t, ErrInvalidCertificate, err, name)
+	}
+
+	// Tampered with after signing
+	token := testhelpers.SignCertificate(privateKey, "v1", validClaims(now))
+	other := testhelpers.SignCertificate(privateKey, "v1", with("reportType", "likely"))
+	parts, otherParts := splitToken(token), splitToken(other)
+	_, err := verifier.Verify("ca.gc.hc", parts[0]+"."+otherParts[1]+"."+parts[2], now)
+	assert.Equal(t, ErrInvalidCertificate, err)
+}
+
+func TestVerify_SameCertificate(t *testing.T) {
+	verifier, privateKey, cleanup := setupVerifier(t)
+	defer cleanup()
+
+	now := time.Now()
+	token := testhelpers.SignCertificate(privateKey, "v1", validClaims(now))
+	cert, err := verifier.Verify("ca.gc.hc", token, now)
+	assert.Nil(t, err)
+
+	// (r, n-s) verifies as well as (r, s), but is still the same certificate
+	parts := splitToken(token)
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	s := new(big.Int).SetBytes(sig[32:])
+	s.Sub(elliptic.P256().Params().N, s)
+	malleated := make([]byte, 64)
+	copy(malleated, sig[:32])
+	sBytes := s.Bytes()
+	copy(malleated[64-len(sBytes):], sBytes)
+
+	other, err := verifier.Verify("ca.gc.hc", parts[0]+"."+parts[1]+"."+base64.RawURLEncoding.EncodeToString(malleated), now)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Hash, other.Hash)
+
+	// The last character of a signature carries four unused bits, which have
+	// to be zero
+	last := strings.IndexByte(base64URLAlphabet, parts[2][len(parts[2])-1])
+	reencoded := parts[2][:len(parts[2])-1] + string(base64URLAlphabet[last^1])
+	_, err = verifier.Verify("ca.gc.hc", parts[0]+"."+parts[1]+"."+reencoded, now)
+	assert.Equal(t, ErrInvalidCertificate, err)
+}
+
+const base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+func splitToken(token string) []string {
+	var parts []string
+	start := 0
+	for i, c := range token {
+		if c == '.' {
+			parts = append(parts, token[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, token[start:])
+}
+
+func TestTEKMAC(t *testing.T) {
+	rsin, rollingPeriod := int32(2651450), int32(144)
+	key := func(data string) *pb.TemporaryExposureKey {
+		return &pb.TemporaryExposureKey{KeyData: []byte(data), RollingStartIntervalNumber: &rsin, RollingPeriod: &rollingPeriod}
+	}
+	secret := []byte("app secret")
+	keys := []*pb.TemporaryExposureKey{key("0123456789abcdef"), key("fedcba9876543210")}
+
+	// Order doesn't matter
+	reversed := []*pb.TemporaryExposureKey{keys[1], keys[0]}
+	assert.Equal(t, TEKMAC(keys, secret), TEKMAC(reversed, secret))
+
+	cert := &Certificate{Claims: Claims{TEKMAC: base64.StdEncoding.EncodeToString(TEKMAC(keys, secret))}}
+	assert.Nil(t, cert.CheckTEKMAC(reversed, secret))
+	assert.Equal(t, ErrTEKMACMismatch, cert.CheckTEKMAC(keys[:1], secret))
+	assert.Equal(t, ErrTEKMACMismatch, cert.CheckTEKMAC(keys, []byte("another secret")))
+}
@@ -0,0 +1,45 @@
+package verification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+)
+
+// ErrTEKMACMismatch is returned when the keys uploaded aren't the ones the
+// certificate was issued for.
+var ErrTEKMACMismatch = errors.New("keys don't match the verification certificate")
+
+// TEKMAC is the HMAC the app has the verification server sign, so that a
+// certificate is only good for the keys it was issued for. Each key is
+// written as base64(key).rollingStartIntervalNumber.rollingPeriod, and the
+// sorted keys are joined with commas.
+func TEKMAC(keys []*pb.TemporaryExposureKey, secret []byte) []byte {
+	perKey := make([]string, 0, len(keys))
+	for _, key := range keys {
+		perKey = append(perKey, fmt.Sprintf("%s.%d.%d",
+			base64.StdEncoding.EncodeToString(key.GetKeyData()), key.GetRollingStartIntervalNumber(), key.GetRollingPeriod(),
+		))
+	}
+	sort.Strings(perKey)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join(perKey, ",")))
+	return mac.Sum(nil)
+}
+
+// CheckTEKMAC checks that keys, with the app's secret, are the keys the
+// certificate was issued for.
+func (c *Certificate) CheckTEKMAC(keys []*pb.TemporaryExposureKey, secret []byte) error {
+	want, err := base64.StdEncoding.DecodeString(c.TEKMAC)
+	if err != nil || !hmac.Equal(want, TEKMAC(keys, secret)) {
+		return ErrTEKMACMismatch
+	}
+	return nil
+}
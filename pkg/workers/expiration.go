@@ -51,6 +51,20 @@ var expirationRunner = func(w *worker, ctx context.Context) error {
 		log(ctx, nil).WithField("count", nDeleted).Info("deleted old claim-key attempts")
 	}
 
+	if nDeleted, err := w.db.DeleteOldVerificationCertificates(); err != nil {
+		log(ctx, err).Info("failed to delete old verification certificates")
+		lastErr = err
+	} else {
+		log(ctx, nil).WithField("count", nDeleted).Info("deleted old verification certificates")
+	}
+
+	if nDeleted, err := w.db.DeleteOldOneTimeCodeUsage(); err != nil {
+		log(ctx, err).Info("failed to delete old one-time code usage")
+		lastErr = err
+	} else {
+		log(ctx, nil).WithField("count", nDeleted).Info("deleted old one-time code usage")
+	}
+
 	return lastErr
 }
 
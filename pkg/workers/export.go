@@ -0,0 +1,192 @@
+package workers
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/blobstore"
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/cds-snc/covid-alert-server/pkg/persistence"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	"github.com/cds-snc/covid-alert-server/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/timemath"
+
+	"github.com/Shopify/goose/logger"
+	"gopkg.in/tomb.v2"
+)
+
+// exportDays matches the number of past days the retrieve servlet serves.
+const exportDays = 14
+
+func exportRunner(store blobstore.BlobStore, signingKeys retrieval.SigningKeys, padder *retrieval.Padder) func(w *worker, ctx context.Context) error {
+	return func(w *worker, ctx context.Context) error {
+		log(ctx, nil).Info("running")
+		now := time.Now()
+		var lastErr error
+		for _, region := range exportRegions() {
+			if err := publishExports(ctx, w.db, store, signingKeys, padder, region, now); err != nil {
+				lastErr = err
+			}
+		}
+		return lastErr
+	}
+}
+
+// exportRegions returns every configured region, in a stable order.
+func exportRegions() []string {
+	regions := make([]string, 0, len(config.AppConstants.RegionISOCodes))
+	for region := range config.AppConstants.RegionISOCodes {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// publishExports makes sure every completed day and hour that clients can
+// still retrieve has an up-to-date export in the store, removes exports that
+// have aged out, and rewrites the index.
+//
+// Old keys are pruned from exports as they expire, so an export is rebuilt
+// once per UTC day rather than only once.
+func publishExports(ctx context.Context, db persistence.Conn, store blobstore.BlobStore, signingKeys retrieval.SigningKeys, padder *retrieval.Padder, region string, now time.Time) error {
+	currentDate := timemath.DateNumber(now)
+	currentHour := timemath.HourNumber(now)
+	oldestDate := currentDate - exportDays
+	builtSince := timemath.MostRecentUTCMidnight(now)
+	currentRSIN := pb.CurrentRollingStartIntervalNumber()
+
+	var lastErr error
+
+	publish := func(period string, number, startHour, endHour uint32) {
+		prefix := retrieval.ExportPrefix(region, period, number)
+
+		fresh, err := exportIsFresh(ctx, store, prefix, builtSince)
+		if err != nil {
+			log(ctx, err).WithField("export", prefix).Warn("failed to check export")
+			lastErr = err
+			return
+		} else if fresh {
+			return
+		}
+
+		keys, err := db.FetchKeysForHours(region, startHour, endHour, currentRSIN)
+		if err != nil {
+			log(ctx, err).WithField("export", prefix).Warn("failed to fetch keys for export")
+			lastErr = err
+			return
+		}
+		revisedKeys, err := db.FetchRevisedKeysForHours(region, startHour, endHour, currentRSIN)
+		if err != nil {
+			log(ctx, err).WithField("export", prefix).Warn("failed to fetch revised keys for export")
+			lastErr = err
+			return
+		}
+
+		start := time.Unix(int64(startHour)*3600, 0)
+		end := time.Unix(int64(endHour)*3600, 0)
+		exportKeys := padder.Pad(keys, region, startHour, endHour)
+		exportRevisedKeys := retrieval.RevisedKeysForHours(revisedKeys, startHour, endHour)
+		batches := retrieval.BatchKeys(exportKeys, exportRevisedKeys)
+		if err := retrieval.PublishExport(ctx, store, prefix, batches, region, start, end, signingKeys); err != nil {
+			log(ctx, err).WithField("export", prefix).Warn("failed to publish export")
+			lastErr = err
+			return
+		}
+
+		log(ctx, nil).WithField("export", prefix).WithField("keys", len(exportKeys)).WithField("revised-keys", len(exportRevisedKeys)).WithField("batches", len(batches)).Info("published export")
+	}
+
+	for date := oldestDate; date < currentDate; date++ {
+		publish(retrieval.DayPeriod, date, date*24, (date+1)*24)
+	}
+	for hour := oldestDate * 24; hour < currentHour; hour++ {
+		publish(retrieval.HourPeriod, hour, hour, hour+1)
+	}
+	if config.AppConstants.EnableEntirePeriodBundle {
+		// Served for day "00000": everything from the last 14 days up to the end of yesterday
+		endDate := currentDate - 1
+		publish(retrieval.DayPeriod, 0, (endDate-exportDays)*24, (endDate+1)*24)
+	}
+
+	if err := pruneExports(ctx, store, region, retrieval.DayPeriod, oldestDate); err != nil {
+		log(ctx, err).Warn("failed to prune daily exports")
+		lastErr = err
+	}
+	if err := pruneExports(ctx, store, region, retrieval.HourPeriod, oldestDate*24); err != nil {
+		log(ctx, err).Warn("failed to prune hourly exports")
+		lastErr = err
+	}
+
+	if err := retrieval.WriteIndex(ctx, store, region); err != nil {
+		log(ctx, err).Warn("failed to write export index")
+		lastErr = err
+	}
+
+	return lastErr
+}
+
+// exportIsFresh reports whether an export exists and was built after since.
+func exportIsFresh(ctx context.Context, store blobstore.BlobStore, prefix string, since time.Time) (bool, error) {
+	obj, err := store.Get(ctx, retrieval.ExportName(prefix, 1))
+	if err == blobstore.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	obj.Close()
+
+	return !obj.ModTime.Before(since), nil
+}
+
+// pruneExports deletes exports for periods numbered before oldest. The whole
+// period bundle (day 0) is kept.
+func pruneExports(ctx context.Context, store blobstore.BlobStore, region, period string, oldest uint32) error {
+	root := region + "/" + period + "/"
+	names, err := store.List(ctx, root)
+	if err != nil {
+		return err
+	}
+
+	pruned := make(map[uint32]bool)
+	for _, name := range names {
+		parts := strings.SplitN(strings.TrimPrefix(name, root), "/", 2)
+		number, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil || number == 0 || uint32(number) >= oldest || pruned[uint32(number)] {
+			continue
+		}
+
+		if err := retrieval.DeleteExport(ctx, store, retrieval.ExportPrefix(region, period, uint32(number))); err != nil {
+			return err
+		}
+		pruned[uint32(number)] = true
+	}
+	return nil
+}
+
+func StartExportWorker(db persistence.Conn, store blobstore.BlobStore, signingKeys retrieval.SigningKeys, padder *retrieval.Padder) (Worker, error) {
+	return createExportWorker(db, store, signingKeys, padder, time.Duration(config.AppConstants.ExportWorkerInterval)*time.Second)
+}
+
+func createExportWorker(db persistence.Conn, store blobstore.BlobStore, signingKeys retrieval.SigningKeys, padder *retrieval.Padder, interval time.Duration) (Worker, error) {
+	worker := &worker{
+		name:     "export",
+		db:       db,
+		interval: interval,
+		tomb:     &tomb.Tomb{},
+		runner:   exportRunner(store, signingKeys, padder),
+	}
+
+	// Publish once before returning, so exports are available as soon as the
+	// server starts. An export that fails isn't worth refusing to start over:
+	// the retrieve servlet builds it from the database until the next run
+	// publishes it.
+	ctx, _ := logger.WithUUID(context.Background())
+	if err := worker.runner(worker, ctx); err != nil {
+		log(ctx, err).WithField("name", worker.name).Error("initial export run failed")
+	}
+
+	return worker, nil
+}
@@ -0,0 +1,254 @@
+package workers
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	persistence "github.com/cds-snc/covid-alert-server/mocks/pkg/persistence"
+	retrieval "github.com/cds-snc/covid-alert-server/mocks/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/blobstore"
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	pb "github.com/cds-snc/covid-alert-server/pkg/proto/covidshield"
+	pkgRetrieval "github.com/cds-snc/covid-alert-server/pkg/retrieval"
+	"github.com/cds-snc/covid-alert-server/pkg/testhelpers"
+	"github.com/cds-snc/covid-alert-server/pkg/timemath"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupStore(t *testing.T) (blobstore.BlobStore, string) {
+	root, err := ioutil.TempDir("", "exports")
+	assert.Nil(t, err)
+
+	store, err := blobstore.NewFilesystem(root)
+	assert.Nil(t, err)
+
+	return store, root
+}
+
+func testSigningKeys() pkgRetrieval.SigningKeys {
+	signer := &retrieval.Signer{}
+	signer.On("Sign", mock.Anything).Return([]byte("signature"), nil)
+	return pkgRetrieval.SigningKeys{{Signer: signer, Version: "v1", ID: "302"}}
+}
+
+func testKey() *pb.TemporaryExposureKey {
+	keyData := make([]byte, 16)
+	rand.Read(keyData)
+	rsin := pb.CurrentRollingStartIntervalNumber() - 144
+	rollingPeriod := int32(144)
+	return &pb.TemporaryExposureKey{
+		KeyData:                    keyData,
+		TransmissionRiskLevel:      new(int32),
+		RollingStartIntervalNumber: &rsin,
+		RollingPeriod:              &rollingPeriod,
+		ReportType:                 pb.TemporaryExposureKey_CONFIRMED_TEST.Enum(),
+	}
+}
+
+// withRegions swaps the configured regions, and returns a func restoring them.
+func withRegions(regions map[string]string) func() {
+	old := config.AppConstants.RegionISOCodes
+	config.AppConstants.RegionISOCodes = regions
+	return func() { config.AppConstants.RegionISOCodes = old }
+}
+
+func readIndex(t *testing.T, store blobstore.BlobStore, region string) []string {
+	obj, err := store.Get(context.Background(), pkgRetrieval.IndexName(region))
+	assert.Nil(t, err)
+	defer obj.Close()
+
+	data, err := ioutil.ReadAll(obj)
+	assert.Nil(t, err)
+	return strings.Fields(string(data))
+}
+
+func TestExportIsFresh(t *testing.T) {
+	store, root := setupStore(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	prefix := pkgRetrieval.ExportPrefix("302", pkgRetrieval.DayPeriod, 18500)
+
+	fresh, err := exportIsFresh(ctx, store, prefix, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.False(t, fresh, "a missing export isn't fresh")
+
+	assert.Nil(t, store.Put(ctx, pkgRetrieval.ExportName(prefix, 1), []byte("export")))
+
+	fresh, err = exportIsFresh(ctx, store, prefix, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.True(t, fresh, "built since then")
+
+	fresh, err = exportIsFresh(ctx, store, prefix, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.False(t, fresh, "built before then")
+}
+
+func TestPruneExports(t *testing.T) {
+	store, root := setupStore(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	for _, name := range []string{
+		"302/day/0/export-1.zip",
+		"302/day/18499/export-1.zip",
+		"302/day/18499/export-2.zip",
+		"302/day/18500/export-1.zip",
+		"302/day/18501/export-1.zip",
+		"302/day/notes/readme.txt",
+		"302/hour/443976/export-1.zip",
+		"310/day/18499/export-1.zip",
+	} {
+		assert.Nil(t, store.Put(ctx, name, []byte("export")))
+	}
+
+	assert.Nil(t, pruneExports(ctx, store, "302", pkgRetrieval.DayPeriod, 18500))
+
+	names, err := store.List(ctx, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"302/day/0/export-1.zip",
+		"302/day/18500/export-1.zip",
+		"302/day/18501/export-1.zip",
+		"302/day/notes/readme.txt",
+		"302/hour/443976/export-1.zip",
+		"310/day/18499/export-1.zip",
+	}, names)
+}
+
+func TestPublishExports(t *testing.T) {
+	store, root := setupStore(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	_, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	now := time.Now()
+	currentDate := timemath.DateNumber(now)
+	currentHour := timemath.HourNumber(now)
+	oldestDate := currentDate - exportDays
+
+	// An export from before the window, which should be pruned
+	stale := pkgRetrieval.ExportName(pkgRetrieval.ExportPrefix("302", pkgRetrieval.DayPeriod, oldestDate-1), 1)
+	assert.Nil(t, store.Put(ctx, stale, []byte("export")))
+
+	key := testKey()
+	db := &persistence.Conn{}
+	db.On("FetchKeysForHours", "302", mock.Anything, mock.Anything, mock.Anything).Return(
+		map[uint32][]*pb.TemporaryExposureKey{currentHour - 1: {key}}, nil,
+	)
+	db.On("FetchRevisedKeysForHours", "302", mock.Anything, mock.Anything, mock.Anything).Return(
+		map[uint32][]*pb.TemporaryExposureKey{}, nil,
+	)
+
+	assert.Nil(t, publishExports(ctx, db, store, testSigningKeys(), nil, "302", now))
+
+	// Every completed day and hour still served, but not the current ones
+	expected := exportDays + int(currentHour-oldestDate*24)
+	if config.AppConstants.EnableEntirePeriodBundle {
+		expected++
+	}
+	db.AssertNumberOfCalls(t, "FetchKeysForHours", expected)
+
+	index := readIndex(t, store, "302")
+	assert.Len(t, index, expected)
+	assert.Contains(t, index, pkgRetrieval.ExportName(pkgRetrieval.ExportPrefix("302", pkgRetrieval.DayPeriod, oldestDate), 1))
+	assert.Contains(t, index, pkgRetrieval.ExportName(pkgRetrieval.ExportPrefix("302", pkgRetrieval.HourPeriod, currentHour-1), 1))
+	assert.NotContains(t, index, pkgRetrieval.ExportName(pkgRetrieval.ExportPrefix("302", pkgRetrieval.HourPeriod, currentHour), 1))
+	assert.NotContains(t, index, stale)
+
+	_, err := store.Get(ctx, stale)
+	assert.Equal(t, blobstore.ErrNotFound, err)
+
+	// The last hour's export carries its key
+	obj, err := store.Get(ctx, pkgRetrieval.ExportName(pkgRetrieval.ExportPrefix("302", pkgRetrieval.HourPeriod, currentHour-1), 1))
+	assert.Nil(t, err)
+	data, _ := ioutil.ReadAll(obj)
+	obj.Close()
+	export, err := pkgRetrieval.DecodeExport(data)
+	assert.Nil(t, err)
+	assert.Len(t, export.GetKeys(), 1)
+	assert.Equal(t, key.GetKeyData(), export.GetKeys()[0].GetKeyData())
+	assert.Equal(t, "CA", export.GetRegion())
+
+	// Exports built today aren't rebuilt
+	assert.Nil(t, publishExports(ctx, db, store, testSigningKeys(), nil, "302", now))
+	db.AssertNumberOfCalls(t, "FetchKeysForHours", expected)
+}
+
+func TestPublishExports_Failures(t *testing.T) {
+	store, root := setupStore(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	_, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+
+	now := time.Now()
+	currentHour := timemath.HourNumber(now)
+
+	// One hour fails, and the rest are still published
+	db := &persistence.Conn{}
+	db.On("FetchKeysForHours", "302", currentHour-1, currentHour, mock.Anything).Return(nil, errors.New("database error"))
+	db.On("FetchKeysForHours", "302", mock.Anything, mock.Anything, mock.Anything).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+	db.On("FetchRevisedKeysForHours", "302", mock.Anything, mock.Anything, mock.Anything).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+
+	assert.EqualError(t, publishExports(ctx, db, store, testSigningKeys(), nil, "302", now), "database error")
+
+	index := readIndex(t, store, "302")
+	assert.NotContains(t, index, pkgRetrieval.ExportName(pkgRetrieval.ExportPrefix("302", pkgRetrieval.HourPeriod, currentHour-1), 1))
+	assert.Contains(t, index, pkgRetrieval.ExportName(pkgRetrieval.ExportPrefix("302", pkgRetrieval.HourPeriod, currentHour-2), 1))
+}
+
+func TestExportRunner_Regions(t *testing.T) {
+	store, root := setupStore(t)
+	defer os.RemoveAll(root)
+
+	_, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+	defer withRegions(map[string]string{"302": "CA", "310": "US"})()
+
+	db := &persistence.Conn{}
+	db.On("FetchKeysForHours", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+	db.On("FetchRevisedKeysForHours", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(map[uint32][]*pb.TemporaryExposureKey{}, nil)
+
+	w := &worker{name: "export", db: db}
+	assert.Nil(t, exportRunner(store, testSigningKeys(), nil)(w, context.Background()))
+
+	// Each region gets its own exports and index
+	for _, region := range []string{"302", "310"} {
+		index := readIndex(t, store, region)
+		assert.NotEmpty(t, index)
+		for _, name := range index {
+			assert.True(t, strings.HasPrefix(name, region+"/"), name)
+		}
+	}
+}
+
+func TestCreateExportWorker_FirstRunFails(t *testing.T) {
+	store, root := setupStore(t)
+	defer os.RemoveAll(root)
+
+	hook, oldLog := testhelpers.SetupTestLogging(&log)
+	defer func() { log = *oldLog }()
+	defer withRegions(map[string]string{"302": "CA"})()
+
+	db := &persistence.Conn{}
+	db.On("FetchKeysForHours", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("database error"))
+
+	// The server still starts, and the next run tries again
+	w, err := createExportWorker(db, store, testSigningKeys(), nil, time.Minute)
+	assert.Nil(t, err)
+	assert.NotNil(t, w)
+	assert.Equal(t, logrus.ErrorLevel, hook.LastEntry().Level)
+	assert.Equal(t, "initial export run failed", hook.LastEntry().Message)
+}
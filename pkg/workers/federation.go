@@ -0,0 +1,48 @@
+package workers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+	"github.com/cds-snc/covid-alert-server/pkg/federation"
+	"github.com/cds-snc/covid-alert-server/pkg/persistence"
+
+	"gopkg.in/tomb.v2"
+)
+
+func federationRunner(peers []federation.Peer, client *http.Client) func(w *worker, ctx context.Context) error {
+	return func(w *worker, ctx context.Context) error {
+		log(ctx, nil).Info("running")
+
+		var lastErr error
+		for _, peer := range peers {
+			imported, err := federation.Sync(ctx, w.db, client, peer)
+			logger := log(ctx, err).WithField("peer", peer.Name).WithField("imported", imported)
+			if err != nil {
+				logger.Warn("failed to sync with federation peer")
+				lastErr = err
+				continue
+			}
+			logger.Info("synced with federation peer")
+		}
+		return lastErr
+	}
+}
+
+func StartFederationWorker(db persistence.Conn, peers []federation.Peer) (Worker, error) {
+	return createFederationWorker(db, peers, time.Duration(config.AppConstants.FederationIngestInterval)*time.Second)
+}
+
+// Unlike the other workers this doesn't run before returning: a peer being
+// down shouldn't keep the server from starting.
+func createFederationWorker(db persistence.Conn, peers []federation.Peer, interval time.Duration) (Worker, error) {
+	return &worker{
+		name:     "federation",
+		db:       db,
+		interval: interval,
+		tomb:     &tomb.Tomb{},
+		runner:   federationRunner(peers, &http.Client{Timeout: time.Minute}),
+	}, nil
+}
@@ -0,0 +1,13 @@
+package workers
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cds-snc/covid-alert-server/pkg/config"
+)
+
+func TestMain(m *testing.M) {
+	config.InitConfig()
+	os.Exit(m.Run())
+}
@@ -49,6 +49,8 @@ Google::Protobuf::DescriptorPool.generated_pool.build do
       value :INVALID_ROLLING_START_INTERVAL_NUMBER, 12
       value :INVALID_TRANSMISSION_RISK_LEVEL, 13
       value :NO_KEYS_IN_PAYLOAD, 14
+      value :INVALID_REPORT_TYPE, 15
+      value :INVALID_DAYS_SINCE_ONSET_OF_SYMPTOMS, 16
     end
     add_message "covidshield.OutbreakEvent" do
       optional :location_id, :string, 1
@@ -71,9 +73,18 @@ Google::Protobuf::DescriptorPool.generated_pool.build do
       optional :start_timestamp, :fixed64, 1
       optional :end_timestamp, :fixed64, 2
       repeated :locations, :message, 3, "covidshield.OutbreakEvent"
+      repeated :signature_infos, :message, 4, "covidshield.SignatureInfo"
+      optional :batch_num, :int32, 5
+      optional :batch_size, :int32, 6
     end
     add_message "covidshield.OutbreakEventExportSignature" do
       optional :signature, :bytes, 1
+      optional :signature_info, :message, 2, "covidshield.SignatureInfo"
+      optional :batch_num, :int32, 3
+      optional :batch_size, :int32, 4
+    end
+    add_message "covidshield.OutbreakEventExportSignatureList" do
+      repeated :signatures, :message, 1, "covidshield.OutbreakEventExportSignature"
     end
     add_message "covidshield.Upload" do
       optional :timestamp, :message, 1, "google.protobuf.Timestamp"
@@ -119,6 +130,25 @@ Google::Protobuf::DescriptorPool.generated_pool.build do
       optional :batch_size, :int32, 3
       optional :signature, :bytes, 4
     end
+    add_message "covidshield.BundleIndex" do
+      optional :region, :string, 1
+      optional :generated_at, :fixed64, 2
+      repeated :bundles, :message, 3, "covidshield.BundleIndexEntry"
+      repeated :signature_infos, :message, 4, "covidshield.SignatureInfo"
+    end
+    add_message "covidshield.BundleIndexEntry" do
+      optional :period, :enum, 1, "covidshield.BundleIndexEntry.Period"
+      optional :number, :uint32, 2
+      optional :batch_num, :int32, 3
+      optional :batch_size, :int32, 4
+      optional :count, :uint32, 5
+      optional :sha256, :bytes, 6
+      optional :generated_at, :fixed64, 7
+    end
+    add_enum "covidshield.BundleIndexEntry.Period" do
+      value :DAY, 0
+      value :HOUR, 1
+    end
   end
 end
 
@@ -134,6 +164,7 @@ module Covidshield
   OutbreakEventResponse::ErrorCode = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("covidshield.OutbreakEventResponse.ErrorCode").enummodule
   OutbreakEventExport = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("covidshield.OutbreakEventExport").msgclass
   OutbreakEventExportSignature = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("covidshield.OutbreakEventExportSignature").msgclass
+  OutbreakEventExportSignatureList = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("covidshield.OutbreakEventExportSignatureList").msgclass
   Upload = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("covidshield.Upload").msgclass
   TemporaryExposureKeyExport = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("covidshield.TemporaryExposureKeyExport").msgclass
   SignatureInfo = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("covidshield.SignatureInfo").msgclass
@@ -141,4 +172,7 @@ module Covidshield
   TemporaryExposureKey::ReportType = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("covidshield.TemporaryExposureKey.ReportType").enummodule
   TEKSignatureList = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("covidshield.TEKSignatureList").msgclass
   TEKSignature = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("covidshield.TEKSignature").msgclass
+  BundleIndex = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("covidshield.BundleIndex").msgclass
+  BundleIndexEntry = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("covidshield.BundleIndexEntry").msgclass
+  BundleIndexEntry::Period = ::Google::Protobuf::DescriptorPool.generated_pool.lookup("covidshield.BundleIndexEntry.Period").enummodule
 end